@@ -0,0 +1,72 @@
+package nbt
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+// Cache keeps decoded NBT files in memory, for servers that consult the
+// same level.dat or configuration files over and over. A file is decoded
+// again only when its modification time or size changed since it was last
+// decoded. The documents are frozen (see Compound.Freeze) because they are
+// shared by everyone reading the file through the cache; Clone them for a
+// copy that can be modified. A Cache is safe for concurrent use, and its
+// zero value is ready to use.
+type Cache struct {
+	mu      sync.Mutex
+	entries map[string]*cache_entry
+}
+
+type cache_entry struct {
+	mod    time.Time
+	size   int64
+	c      *Compound
+	format Format
+}
+
+// Returns the file decoded, as DecodeFile does, from the cache if the file
+// did not change since it was last decoded.
+func (self *Cache) DecodeFile(path string) (*Compound, Format, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		self.Forget(path)
+		return nil, Format{}, err
+	}
+
+	self.mu.Lock()
+	e, ok := self.entries[path]
+	self.mu.Unlock()
+	if ok && e.mod.Equal(info.ModTime()) && e.size == info.Size() {
+		return e.c, e.format, nil
+	}
+
+	c, format, err := DecodeFile(path)
+	if err != nil {
+		self.Forget(path)
+		return nil, Format{}, err
+	}
+	e = &cache_entry{info.ModTime(), info.Size(), c.Freeze(), format}
+
+	self.mu.Lock()
+	if self.entries == nil {
+		self.entries = make(map[string]*cache_entry)
+	}
+	self.entries[path] = e
+	self.mu.Unlock()
+	return e.c, e.format, nil
+}
+
+// Drops the file from the cache, so that it is decoded again on next use.
+func (self *Cache) Forget(path string) {
+	self.mu.Lock()
+	delete(self.entries, path)
+	self.mu.Unlock()
+}
+
+// Drops every file from the cache.
+func (self *Cache) Clear() {
+	self.mu.Lock()
+	self.entries = nil
+	self.mu.Unlock()
+}
@@ -0,0 +1,392 @@
+package nbt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// CBOR tags marking the NBT types that CBOR cannot tell apart on its own.
+// Integers of each size are wrapped in the tag CBORTagBase+type, as is the
+// [element type, items] array of a list. Arrays are written as RFC 8746
+// typed arrays of big endian signed integers.
+const (
+	CBORTagBase = 0x4e425400 // "NBT\x00"
+
+	cbor_sint8_array  = 72
+	cbor_sint32_array = 74
+	cbor_sint64_array = 75
+)
+
+// CBOR major types.
+const (
+	cbor_uint   = 0
+	cbor_nint   = 1
+	cbor_bytes  = 2
+	cbor_text   = 3
+	cbor_array  = 4
+	cbor_map    = 5
+	cbor_tag    = 6
+	cbor_simple = 7
+)
+
+// Encodes the compound as CBOR (RFC 8949) in a form that keeps every tag's
+// type, so that NBT data can be handed to systems that speak CBOR without a
+// lossy JSON step and read back with FromCBOR:
+//
+//   - The document is a 2 element array of the root's name and contents.
+//   - Compounds are maps with text keys, written in key order.
+//   - TAG_Byte, TAG_Short, TAG_Int and TAG_Long are integers in the tag
+//     CBORTagBase plus their type.
+//   - TAG_Float and TAG_Double are single and double precision floats.
+//   - TAG_String is a text string.
+//   - Arrays are typed arrays: tag 72 (sint8), 74 (sint32, big endian) or
+//     75 (sint64, big endian) around a byte string.
+//   - Lists are [element type, [items...]] in the tag CBORTagBase+9. The
+//     element type of a mixed list is 0 and its items are each wrapped in a
+//     single entry compound, as on the wire.
+func ToCBOR(c *Compound) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	cbor_head(buf, cbor_array, 2)
+	cbor_head(buf, cbor_text, uint64(len(c.name)))
+	buf.WriteString(c.name)
+	if err := cbor_write(buf, c); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func cbor_head(buf *bytes.Buffer, major byte, n uint64) {
+	major <<= 5
+	switch {
+	case n < 24:
+		buf.WriteByte(major | byte(n))
+	case n <= math.MaxUint8:
+		buf.Write([]byte{major | 24, byte(n)})
+	case n <= math.MaxUint16:
+		buf.WriteByte(major | 25)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	case n <= math.MaxUint32:
+		buf.WriteByte(major | 26)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	default:
+		buf.WriteByte(major | 27)
+		binary.Write(buf, binary.BigEndian, n)
+	}
+}
+
+func cbor_int(buf *bytes.Buffer, n int64) {
+	if n < 0 {
+		cbor_head(buf, cbor_nint, uint64(-1-n))
+	} else {
+		cbor_head(buf, cbor_uint, uint64(n))
+	}
+}
+
+func cbor_write(buf *bytes.Buffer, v interface{}) error {
+	v = unbox(v)
+	if tag, ok := tag_of(v); ok && tag >= TagByte && tag <= TagLong {
+		n, _ := NumberOf(v)
+		cbor_head(buf, cbor_tag, CBORTagBase+uint64(tag))
+		cbor_int(buf, n.Int64())
+		return nil
+	}
+
+	switch v := v.(type) {
+	case float32:
+		buf.WriteByte(cbor_simple<<5 | 26)
+		binary.Write(buf, binary.BigEndian, math.Float32bits(v))
+
+	case float64:
+		buf.WriteByte(cbor_simple<<5 | 27)
+		binary.Write(buf, binary.BigEndian, math.Float64bits(v))
+
+	case string:
+		cbor_head(buf, cbor_text, uint64(len(v)))
+		buf.WriteString(v)
+
+	case []int8:
+		cbor_head(buf, cbor_tag, cbor_sint8_array)
+		cbor_head(buf, cbor_bytes, uint64(len(v)))
+		binary.Write(buf, binary.BigEndian, v)
+
+	case []int32:
+		cbor_head(buf, cbor_tag, cbor_sint32_array)
+		cbor_head(buf, cbor_bytes, uint64(4*len(v)))
+		binary.Write(buf, binary.BigEndian, v)
+
+	case []int64:
+		cbor_head(buf, cbor_tag, cbor_sint64_array)
+		cbor_head(buf, cbor_bytes, uint64(8*len(v)))
+		binary.Write(buf, binary.BigEndian, v)
+
+	case *Compound:
+		cbor_head(buf, cbor_map, uint64(len(v.data)))
+		for _, k := range v.sorted_keys() {
+			cbor_head(buf, cbor_text, uint64(len(k)))
+			buf.WriteString(k)
+			if err := cbor_write(buf, v.data[k].value()); err != nil {
+				return err
+			}
+		}
+
+	case *List:
+		items := v.items()
+		elem := v.list_type
+		if v.IsMixed() {
+			elem = TagEnd
+		}
+		cbor_head(buf, cbor_tag, CBORTagBase+uint64(TagList))
+		cbor_head(buf, cbor_array, 2)
+		cbor_head(buf, cbor_uint, uint64(elem))
+		cbor_head(buf, cbor_array, uint64(len(items)))
+		for _, item := range items {
+			if v.IsMixed() {
+				item = &Compound{data: map[string]entry{"": entry_of(item)}}
+			}
+			if err := cbor_write(buf, item); err != nil {
+				return err
+			}
+		}
+
+	default:
+		return fmt.Errorf("Cannot encode %T as CBOR", v)
+	}
+	return nil
+}
+
+// Decodes a compound from the CBOR form written by ToCBOR.
+func FromCBOR(data []byte) (*Compound, error) {
+	r := &cbor_reader{data: data}
+	if n, err := r.expect(cbor_array); err != nil || n != 2 {
+		return nil, cbor_error(err)
+	}
+	name, err := r.text()
+	if err != nil {
+		return nil, cbor_error(err)
+	}
+	v, err := r.value(nil)
+	if err != nil {
+		return nil, cbor_error(err)
+	}
+	c, ok := v.(*Compound)
+	if !ok {
+		return nil, ErrNotCompound
+	}
+	if r.pos != len(data) {
+		return nil, errors.New("CBOR: trailing data after the document")
+	}
+	c.name = name
+	return c, nil
+}
+
+func cbor_error(err error) error {
+	if err == nil {
+		err = errors.New("not an NBT document")
+	}
+	return fmt.Errorf("CBOR: %v", err)
+}
+
+type cbor_reader struct {
+	data []byte
+	pos  int
+}
+
+// Reads an item's head, returning its major type and argument.
+func (self *cbor_reader) head() (byte, uint64, error) {
+	if self.pos >= len(self.data) {
+		return 0, 0, io.ErrUnexpectedEOF
+	}
+	b := self.data[self.pos]
+	self.pos++
+	major, info := b>>5, b&0x1f
+	if major == cbor_simple && (info == 26 || info == 27) {
+		// floats are read by the caller
+		return major, uint64(info), nil
+	}
+	size := 0
+	switch {
+	case info < 24:
+		return major, uint64(info), nil
+	case info <= 27:
+		size = 1 << (info - 24)
+	default:
+		return 0, 0, fmt.Errorf("unsupported item 0x%02x", b)
+	}
+	if self.pos+size > len(self.data) {
+		return 0, 0, io.ErrUnexpectedEOF
+	}
+	var n uint64
+	for _, c := range self.data[self.pos : self.pos+size] {
+		n = n<<8 | uint64(c)
+	}
+	self.pos += size
+	return major, n, nil
+}
+
+func (self *cbor_reader) expect(major byte) (uint64, error) {
+	m, n, err := self.head()
+	if err == nil && m != major {
+		err = fmt.Errorf("expected major type %d, got %d", major, m)
+	}
+	return n, err
+}
+
+func (self *cbor_reader) next(n uint64) ([]byte, error) {
+	if n > uint64(len(self.data)-self.pos) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	b := self.data[self.pos : self.pos+int(n)]
+	self.pos += int(n)
+	return b, nil
+}
+
+func (self *cbor_reader) text() (string, error) {
+	n, err := self.expect(cbor_text)
+	if err != nil {
+		return "", err
+	}
+	b, err := self.next(n)
+	return string(b), err
+}
+
+func (self *cbor_reader) value(parent *Compound) (interface{}, error) {
+	major, n, err := self.head()
+	if err != nil {
+		return nil, err
+	}
+	switch major {
+	case cbor_simple:
+		switch n {
+		case 26:
+			b, err := self.next(4)
+			if err != nil {
+				return nil, err
+			}
+			return math.Float32frombits(binary.BigEndian.Uint32(b)), nil
+		case 27:
+			b, err := self.next(8)
+			if err != nil {
+				return nil, err
+			}
+			return math.Float64frombits(binary.BigEndian.Uint64(b)), nil
+		}
+
+	case cbor_text:
+		b, err := self.next(n)
+		return string(b), err
+
+	case cbor_map:
+		c := &Compound{parent: parent, data: make(map[string]entry)}
+		for i := uint64(0); i < n; i++ {
+			k, err := self.text()
+			if err != nil {
+				return nil, err
+			}
+			v, err := self.value(c)
+			if err != nil {
+				return nil, err
+			}
+			if child, ok := v.(*Compound); ok {
+				child.name = k
+			}
+			c.data[k] = c.hold(v)
+		}
+		return c, nil
+
+	case cbor_tag:
+		return self.tagged(n)
+	}
+	return nil, fmt.Errorf("unexpected major type %d", major)
+}
+
+func (self *cbor_reader) tagged(tag uint64) (interface{}, error) {
+	switch tag {
+	case cbor_sint8_array, cbor_sint32_array, cbor_sint64_array:
+		n, err := self.expect(cbor_bytes)
+		if err != nil {
+			return nil, err
+		}
+		b, err := self.next(n)
+		if err != nil {
+			return nil, err
+		}
+		size := map[uint64]int{cbor_sint8_array: 1, cbor_sint32_array: 4, cbor_sint64_array: 8}[tag]
+		if len(b)%size != 0 {
+			return nil, fmt.Errorf("typed array of %d bytes", len(b))
+		}
+		var v interface{}
+		switch size {
+		case 1:
+			v = make([]int8, len(b))
+		case 4:
+			v = make([]int32, len(b)/4)
+		case 8:
+			v = make([]int64, len(b)/8)
+		}
+		binary.Read(bytes.NewReader(b), binary.BigEndian, v)
+		return v, nil
+
+	case CBORTagBase + uint64(TagList):
+		return self.list()
+	}
+
+	if tag < CBORTagBase+uint64(TagByte) || tag > CBORTagBase+uint64(TagLong) {
+		return nil, fmt.Errorf("unknown tag %d", tag)
+	}
+	major, n, err := self.head()
+	if err != nil {
+		return nil, err
+	}
+	var i int64
+	switch {
+	case major == cbor_uint && n <= math.MaxInt64:
+		i = int64(n)
+	case major == cbor_nint && n <= math.MaxInt64:
+		i = -1 - int64(n)
+	default:
+		return nil, errors.New("expected an integer")
+	}
+	num := Number{Type: TagType(tag - CBORTagBase)}.WithInt64(i)
+	if num.Int64() != i {
+		return nil, fmt.Errorf("%d overflows %v", i, num.Type)
+	}
+	return num.Value(), nil
+}
+
+func (self *cbor_reader) list() (interface{}, error) {
+	if n, err := self.expect(cbor_array); err != nil || n != 2 {
+		return nil, cbor_error(err)
+	}
+	elem, err := self.expect(cbor_uint)
+	if err != nil {
+		return nil, err
+	}
+	n, err := self.expect(cbor_array)
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(len(self.data)-self.pos) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	items := make([]interface{}, n)
+	for i := range items {
+		if items[i], err = self.value(nil); err != nil {
+			return nil, err
+		}
+	}
+
+	if elem == uint64(TagEnd) && n > 0 {
+		// mixed list
+		list, err := new_list("", TagCompound, items)
+		if err != nil {
+			return nil, err
+		}
+		unwrap_mixed(list)
+		return list, nil
+	}
+	return new_list("", TagType(elem), items)
+}
@@ -0,0 +1,60 @@
+package nbt
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCBOR(t *testing.T) {
+	c, err := DecodeBytes(helloWorld)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := ToCBOR(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := append([]byte{0x82, 0x6b}, "hello world"...)
+	expected = append(expected, 0xa1, 0x64, 'n', 'a', 'm', 'e', 0x69)
+	expected = append(expected, "Bananrama"...)
+	if !bytes.Equal(out, expected) {
+		t.Errorf("ToCBOR:\nexpected % x\ngot      % x", expected, out)
+	}
+
+	c, err = (&CompoundTag{Name: "Level", Value: []Tag{
+		&ByteTag{"b", -128},
+		&ShortTag{"s", 300},
+		&IntTag{"i", -70000},
+		&LongTag{"l", -9223372036854775808},
+		&FloatTag{"f", 0.1},
+		&DoubleTag{"d", 0.49823147058486938},
+		&ByteArrayTag{"ba", []int8{-1, 0, 1}},
+		&IntArrayTag{"ia", []int32{-1, 1 << 30}},
+		&LongArrayTag{"la", []int64{}},
+		&ListTag{Name: "li", Elem: TagShort, Value: []Tag{&ShortTag{Value: 1}, &ShortTag{Value: 2}}},
+		&ListTag{Name: "empty", Elem: TagEnd},
+		&ListTag{Name: "lc", Elem: TagCompound, Value: []Tag{&CompoundTag{Value: []Tag{&StringTag{"id", "stone"}}}}},
+		&CompoundTag{Name: "sub", Value: []Tag{&CompoundTag{Name: "deeper"}}},
+	}}).Compound()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err = ToCBOR(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	back, err := FromCBOR(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changes := Diff(c, back); len(changes) != 0 || back.Name() != "Level" {
+		t.Errorf("CBOR round trip changed %v", changes)
+	}
+
+	for i := 1; i < len(out); i++ {
+		if _, err := FromCBOR(out[:i]); err == nil {
+			t.Errorf("FromCBOR: accepted a document truncated to %d bytes", i)
+			break
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package nbt
+
+import (
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Java Edition writes strings in Java's modified UTF-8, in which a
+// character outside the Basic Multilingual Plane, such as an emoji, is a
+// pair of UTF-16 surrogates each encoded in three bytes (as in CESU-8),
+// where UTF-8 has a single four byte sequence. Decoders combine such pairs
+// so that strings are valid UTF-8 in Go, and encoders split the characters
+// again unless writing little endian for Bedrock Edition, which uses plain
+// UTF-8. Neither form can be mistaken for the other, so decoding accepts
+// both whatever the byte order.
+
+// Reports whether b[i:] starts with a surrogate pair encoded as two three
+// byte sequences.
+func is_surrogate_pair(b []byte, i int) bool {
+	return i+6 <= len(b) &&
+		b[i] == 0xed && b[i+1]&0xf0 == 0xa0 && b[i+2]&0xc0 == 0x80 &&
+		b[i+3] == 0xed && b[i+4]&0xf0 == 0xb0 && b[i+5]&0xc0 == 0x80
+}
+
+// Decodes a three byte sequence.
+func decode_3(b []byte) rune {
+	return rune(b[0]&0x0f)<<12 | rune(b[1]&0x3f)<<6 | rune(b[2]&0x3f)
+}
+
+// Returns b with each surrogate pair replaced by the UTF-8 encoding of the
+// character it stands for, or b itself if it has none. Unpaired surrogates
+// are left as they are.
+func join_surrogates(b []byte) []byte {
+	i := 0
+	for ; i < len(b); i++ {
+		if is_surrogate_pair(b, i) {
+			break
+		}
+	}
+	if i == len(b) {
+		return b
+	}
+	out := make([]byte, i, len(b)-2)
+	copy(out, b)
+	for i < len(b) {
+		if is_surrogate_pair(b, i) {
+			r := utf16.DecodeRune(decode_3(b[i:]), decode_3(b[i+3:]))
+			out = utf8.AppendRune(out, r)
+			i += 6
+			continue
+		}
+		out = append(out, b[i])
+		i++
+	}
+	return out
+}
+
+// Returns s with each character outside the Basic Multilingual Plane
+// replaced by its surrogate pair, or s itself if it has none. Bytes that
+// are not valid UTF-8 are left as they are.
+func split_surrogates(s string) string {
+	i := 0
+	for ; i < len(s); i++ {
+		if s[i] >= 0xf0 {
+			if _, size := utf8.DecodeRuneInString(s[i:]); size == 4 {
+				break
+			}
+		}
+	}
+	if i == len(s) {
+		return s
+	}
+	out := make([]byte, i, len(s)+len(s)/2)
+	copy(out, s)
+	for i < len(s) {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if size != 4 {
+			out = append(out, s[i:i+size]...)
+			i += size
+			continue
+		}
+		hi, lo := utf16.EncodeRune(r)
+		for _, c := range [2]rune{hi, lo} {
+			out = append(out, 0xe0|byte(c>>12), 0x80|byte(c>>6)&0x3f, 0x80|byte(c)&0x3f)
+		}
+		i += 4
+	}
+	return string(out)
+}
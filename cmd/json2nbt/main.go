@@ -0,0 +1,77 @@
+// Command json2nbt converts the type-preserving JSON form written by
+// nbt2json back to an NBT file.
+//
+// Usage:
+//
+//	json2nbt [-compression gzip|zlib|none] [-bedrock] file.json file.nbt
+//
+// The output is gzip compressed Java Edition NBT by default. With -bedrock it
+// is little endian, and -header adds the 8 byte header of Bedrock Edition's
+// level.dat.
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/moshee/go-nbt"
+)
+
+var (
+	compression = flag.String("compression", "gzip", "output compression: gzip, zlib or none")
+	bedrock     = flag.Bool("bedrock", false, "write little endian Bedrock Edition NBT")
+	header      = flag.Int("header", -1, "with -bedrock, write a level.dat header with this storage version")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: json2nbt [-compression gzip|zlib|none] [-bedrock [-header version]] file.json file.nbt\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := convert(flag.Arg(0), flag.Arg(1)); err != nil {
+		fmt.Fprintf(os.Stderr, "json2nbt: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func convert(in, out string) error {
+	f := nbt.Format{ByteOrder: binary.BigEndian}
+	switch *compression {
+	case "gzip":
+		f.Compression = nbt.Gzip
+	case "zlib":
+		f.Compression = nbt.Zlib
+	case "none":
+		f.Compression = nbt.Uncompressed
+	default:
+		return fmt.Errorf("unknown compression %q", *compression)
+	}
+	if *bedrock {
+		f.ByteOrder = binary.LittleEndian
+		if *header >= 0 {
+			f.Header = true
+			f.HeaderVersion = int32(*header)
+		}
+	}
+
+	js, err := ioutil.ReadFile(in)
+	if err != nil {
+		return err
+	}
+	c := new(nbt.Compound)
+	if err := json.Unmarshal(js, c); err != nil {
+		return fmt.Errorf("%s: %v", in, err)
+	}
+
+	return nbt.EncodeFile(out, c, f)
+}
@@ -0,0 +1,68 @@
+// Command nbt2json converts an NBT file to the type-preserving JSON form
+// read by json2nbt, so that it can be edited in any text editor and
+// converted back without loss. The input's compression and byte order are
+// detected automatically and reported on standard error.
+//
+// Usage:
+//
+//	nbt2json [-compact] file.nbt [file.json]
+//
+// The JSON is written to standard output if no output file is given.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/moshee/go-nbt"
+)
+
+var compact = flag.Bool("compact", false, "write the JSON on a single line")
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: nbt2json [-compact] file.nbt [file.json]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() < 1 || flag.NArg() > 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := convert(flag.Arg(0), flag.Arg(1)); err != nil {
+		fmt.Fprintf(os.Stderr, "nbt2json: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func convert(in, out string) error {
+	c, f, err := nbt.DecodeFile(in)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "%s: %v NBT\n", in, f)
+
+	js, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	if !*compact {
+		buf := new(bytes.Buffer)
+		if err := json.Indent(buf, js, "", "    "); err != nil {
+			return err
+		}
+		js = buf.Bytes()
+	}
+	js = append(js, '\n')
+
+	if out == "" {
+		_, err = os.Stdout.Write(js)
+		return err
+	}
+	return ioutil.WriteFile(out, js, 0644)
+}
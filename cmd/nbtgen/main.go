@@ -0,0 +1,69 @@
+// Command nbtgen generates Go struct definitions from a sample NBT file, for
+// decoding files of the same kind with nbt.Unmarshal. Compression and byte
+// order are detected automatically.
+//
+// Usage:
+//
+//	nbtgen [-package name] [-type name] [-o file.go] sample.dat
+//
+// Compounds become struct types with fields tagged with the entries' names,
+// and lists become slices. The more complete the sample, the more complete
+// the types; lists of compounds are merged across their elements.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/moshee/go-nbt"
+	"github.com/moshee/go-nbt/nbtgen"
+)
+
+var (
+	pkg       = flag.String("package", "main", "package of the generated file")
+	type_name = flag.String("type", "", "name of the root type (default: the root compound's name, or Root)")
+	out       = flag.String("o", "", "write to `file` instead of standard output")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: nbtgen [-package name] [-type name] [-o file.go] sample.dat\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := generate(flag.Arg(0)); err != nil {
+		fmt.Fprintf(os.Stderr, "nbtgen: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func generate(path string) error {
+	c, _, err := nbt.DecodeFile(path)
+	if err != nil {
+		return err
+	}
+	name := *type_name
+	if name == "" {
+		name = c.Name()
+	}
+	if name == "" {
+		name = "Root"
+	}
+
+	src, err := nbtgen.Generate(c, *pkg, name)
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		_, err = os.Stdout.Write(src)
+		return err
+	}
+	return ioutil.WriteFile(*out, src, 0644)
+}
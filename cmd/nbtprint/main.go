@@ -0,0 +1,84 @@
+// Command nbtprint dumps NBT files. Gzip and zlib compression and Java
+// (big endian) and Bedrock (little endian) Edition files are detected
+// automatically.
+//
+// Usage:
+//
+//	nbtprint [-format tree|snbt|json] [-compact] file...
+//
+// The default tree format prints each file's detected format followed by an
+// indented listing of its tags. The snbt and json formats print the document
+// as SNBT or in the type-preserving JSON form understood by json2nbt.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/moshee/go-nbt"
+)
+
+var (
+	format  = flag.String("format", "tree", "output format: tree, snbt or json")
+	compact = flag.Bool("compact", false, "print snbt and json output on a single line")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: nbtprint [-format tree|snbt|json] [-compact] file...\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	status := 0
+	for _, path := range flag.Args() {
+		if err := print_file(path); err != nil {
+			fmt.Fprintf(os.Stderr, "nbtprint: %s: %v\n", path, err)
+			status = 1
+		}
+	}
+	os.Exit(status)
+}
+
+func print_file(path string) error {
+	c, f, err := nbt.DecodeFile(path)
+	if err != nil {
+		return err
+	}
+
+	var out []byte
+	buf := new(bytes.Buffer)
+	switch *format {
+	case "tree":
+		fmt.Printf("%s: %v NBT\n", path, f)
+		c.PrettyPrint()
+		return nil
+
+	case "snbt":
+		if out, err = nbt.MarshalSNBT(c); err == nil && !*compact {
+			err = nbt.IndentSNBT(buf, out, "", "    ")
+			out = buf.Bytes()
+		}
+
+	case "json":
+		if out, err = json.Marshal(c); err == nil && !*compact {
+			err = json.Indent(buf, out, "", "    ")
+			out = buf.Bytes()
+		}
+
+	default:
+		return fmt.Errorf("unknown output format %q", *format)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Printf("%s\n", out)
+	return err
+}
@@ -0,0 +1,99 @@
+// Command nbtq prints the values a jq-like query selects inside NBT files,
+// one per line, for use in shell scripts. Compression and byte order are
+// detected automatically. See nbt.Query for the query language.
+//
+// Usage:
+//
+//	nbtq [-r] [-p] query file...
+//
+// For example
+//
+//	nbtq '.Data.Player.Pos[1]' level.dat
+//
+// prints the player's height as SNBT, such as 64.0d, and
+//
+//	nbtq -p '..[?(@.id == "minecraft:chest")].Items[*]{id, Count}' r.0.0.nbt
+//
+// prints every item in every chest, each after its path. With -r, strings
+// are printed without quotes and numbers without type suffixes. nbtq exits
+// with status 1 if the query selects nothing in some file.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/moshee/go-nbt"
+)
+
+var (
+	raw   = flag.Bool("r", false, "print strings and numbers as plain text")
+	paths = flag.Bool("p", false, "print the path of each value before it")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: nbtq [-r] [-p] query file...\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() < 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	q, err := nbt.CompileQuery(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "nbtq: %v\n", err)
+		os.Exit(2)
+	}
+
+	status := 0
+	for _, file := range flag.Args()[1:] {
+		if err := query(file, q); err != nil {
+			fmt.Fprintf(os.Stderr, "nbtq: %s: %v\n", file, err)
+			status = 1
+		}
+	}
+	os.Exit(status)
+}
+
+func query(file string, q *nbt.Query) error {
+	c, _, err := nbt.DecodeFile(file)
+	if err != nil {
+		return err
+	}
+	matches := q.Run(c)
+	if len(matches) == 0 {
+		return nbt.ErrNotFound
+	}
+	for _, m := range matches {
+		if *paths {
+			fmt.Printf("%v\t", m.Path)
+		}
+		if err := print_value(m.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func print_value(v interface{}) error {
+	if *raw {
+		switch v := v.(type) {
+		case string:
+			fmt.Println(v)
+			return nil
+		case int8, int16, int32, int64, float32, float64:
+			fmt.Println(v)
+			return nil
+		}
+	}
+	out, err := nbt.MarshalSNBT(v)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s\n", out)
+	return nil
+}
@@ -0,0 +1,91 @@
+// Command regiondump inspects Java Edition region files (.mca).
+//
+// Usage:
+//
+//	regiondump file.mca
+//	regiondump -chunk x,z [-o out.nbt] file.mca
+//
+// Without -chunk, it lists the chunks present in the region with their
+// coordinates within the region, the time they were last saved, their
+// compression and their compressed and allocated sizes. With -chunk, it
+// extracts the uncompressed NBT document of the chunk at the given
+// coordinates (0–31) to the -o file, or standard output.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/moshee/go-nbt/region"
+)
+
+var (
+	chunk = flag.String("chunk", "", "extract the chunk at `x,z`")
+	out   = flag.String("o", "", "write the extracted chunk to `file` instead of standard output")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: regiondump [-chunk x,z [-o out.nbt]] file.mca\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	r, err := region.Open(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "regiondump: %v\n", err)
+		os.Exit(1)
+	}
+	defer r.Close()
+
+	if *chunk == "" {
+		err = list(r)
+	} else {
+		err = extract(r)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "regiondump: %v\n", err)
+		r.Close()
+		os.Exit(1)
+	}
+}
+
+func list(r *region.Region) error {
+	chunks, err := r.Chunks()
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(w, "x\tz\tsaved\tcompression\tlength\tsize\t\n")
+	for _, c := range chunks {
+		compression := c.Compression.String()
+		if c.External {
+			compression += " (external)"
+		}
+		fmt.Fprintf(w, "%d\t%d\t%s\t%s\t%d\t%d\t\n", c.X, c.Z,
+			c.Timestamp.UTC().Format(time.RFC3339), compression, c.Length, c.Size)
+	}
+	w.Flush()
+	return err
+}
+
+func extract(r *region.Region) error {
+	var x, z int
+	if _, err := fmt.Sscanf(*chunk, "%d,%d", &x, &z); err != nil {
+		return fmt.Errorf("bad -chunk %q: expected x,z", *chunk)
+	}
+	data, err := r.ChunkData(x, z)
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	return ioutil.WriteFile(*out, data, 0644)
+}
@@ -0,0 +1,187 @@
+package nbt
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+var (
+	ErrShared = errors.New("Compound is shared with a clone; modify it through its root")
+)
+
+// Identifies the tree that owns a compound's or list's contents. Clones
+// get a new token on their first modification, so any compound or list
+// with an older token is shared and must be copied before it is modified.
+// It is not zero sized so that every token is a distinct pointer.
+type cow_token struct{ _ byte }
+
+// Returns a copy of the compound in constant time. The compound and the
+// clone share their contents until one of them is modified, at which point
+// only the compounds and lists on the way to the modified value are copied,
+// along with any arrays directly inside them and the compounds directly
+// inside a copied list; untouched subtrees stay shared. This makes it cheap
+// to take a checkpoint before a speculative edit and to go back to it
+// afterwards.
+//
+// Once cloned, either tree should be modified through Set or SetPath on its
+// root. Nested compounds, those inside lists included, can be modified
+// directly only once such a call has copied them; until then Set on them
+// returns ErrShared rather than modifying both trees. Likewise, lists and
+// arrays fetched before a modification may still refer to the shared
+// contents.
+//
+// A tree and its clones may be read and modified from different goroutines,
+// as long as each one is used from one goroutine at a time. A frozen tree
+// (see Freeze) is not written to by Clone, so it may be cloned from several
+// goroutines at once.
+func (self *Compound) Clone() *Compound {
+	if !self.frozen {
+		// a frozen tree is never modified and need not know it is shared
+		self.shared = true
+	}
+	return &Compound{name: self.name, data: self.data, shared: true}
+}
+
+// Returns an error if the compound cannot be modified in place, and makes
+// sure it does not share its entries with a clone otherwise.
+func (self *Compound) writable() error {
+	if self.frozen {
+		return ErrFrozen
+	}
+	root := self.Root()
+	if root != self && (root.shared || root.token != self.token) {
+		return ErrShared
+	}
+	if self.shared {
+		data := make(map[string]entry, len(self.data))
+		for k, v := range self.data {
+			v.ref = copy_array(v.ref)
+			data[k] = v
+		}
+		self.data = data
+		self.shared = false
+		self.token = new(cow_token)
+	}
+	return nil
+}
+
+// Walks the path like Get, copying any compound or list on the way that is
+// shared with a clone and storing the copy in its place, so that the value
+// returned can be modified in place. The compound must be writable.
+func (self *Compound) own_path(path Path) (interface{}, error) {
+	var v interface{} = self
+	holder := self // the compound nearest to v
+	for i, elem := range path {
+		next, err := path_step(v, elem)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", path[:i+1], err)
+		}
+		if c, ok := v.(*Compound); ok {
+			holder = c
+		}
+		lazy, is_lazy := next.(*LazyList)
+		if is_lazy {
+			// to be changed, it is decoded and put in its place
+			if next, err = lazy.List(); err != nil {
+				return nil, fmt.Errorf("%v: %w", path[:i+1], err)
+			}
+		}
+		if owned, copied := self.own(next, holder); copied || is_lazy {
+			if err := path_store(v, path[:i+1], owned); err != nil {
+				return nil, err
+			}
+			next = owned
+		}
+		v = next
+	}
+	return v, nil
+}
+
+// Returns a copy of a compound or list if it does not belong to the same
+// tree as the compound, with parent, the compound nearest to it, as its
+// parent. A list is copied along with the compounds and lists in it, which
+// could not tell otherwise that they are shared. The second result is false
+// if v was not copied.
+func (self *Compound) own(v interface{}, parent *Compound) (interface{}, bool) {
+	switch v := v.(type) {
+	case *Compound:
+		if v.token == self.token {
+			break
+		}
+		c := &Compound{name: v.name, parent: parent, token: self.token, data: make(map[string]entry, len(v.data))}
+		for k, child := range v.data {
+			child.ref = copy_array(child.ref)
+			c.data[k] = child
+		}
+		return c, true
+
+	case *List:
+		if v.token == self.token {
+			break
+		}
+		l := *v
+		l.token, l.parent = self.token, parent
+		l.frozen, l.hash = false, nil
+		if v.data != nil {
+			src := reflect.ValueOf(v.data)
+			dst := reflect.MakeSlice(src.Type(), src.Len(), src.Len())
+			reflect.Copy(dst, src)
+			switch v.data.(type) {
+			case [][]int8, [][]int32, [][]int64, []*Compound, []*List, []interface{}:
+				for i := 0; i < dst.Len(); i++ {
+					item := dst.Index(i).Interface()
+					if owned, copied := self.own(item, parent); copied {
+						item = owned
+					} else {
+						item = copy_array(item)
+					}
+					if item != nil {
+						dst.Index(i).Set(reflect.ValueOf(item))
+					}
+				}
+			}
+			l.data = dst.Interface()
+		}
+		return &l, true
+	}
+	return v, false
+}
+
+// Returns a copy of an array, and any other value unchanged.
+func copy_array(v interface{}) interface{} {
+	switch v := v.(type) {
+	case []int8:
+		return append([]int8(nil), v...)
+	case []int32:
+		return append([]int32(nil), v...)
+	case []int64:
+		return append([]int64(nil), v...)
+	}
+	return v
+}
+
+// Gives a value that is about to be stored in the compound, and every
+// compound and list inside it, the compound's token, and makes the nearest
+// compound the parent of each list.
+func (self *Compound) adopt(v interface{}) {
+	switch v := v.(type) {
+	case *Compound:
+		v.token = self.token
+		for _, child := range v.data {
+			v.adopt(child.ref)
+		}
+	case *List:
+		v.token = self.token
+		v.parent = self
+		switch v.data.(type) {
+		case []*Compound, []*List, []interface{}:
+			for _, item := range v.items() {
+				if c, ok := item.(*Compound); ok {
+					c.parent = self
+				}
+				self.adopt(item)
+			}
+		}
+	}
+}
@@ -2,11 +2,12 @@ package nbt
 
 import (
 	"bytes"
-	"compress/gzip"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"math"
 
 //	"io/ioutil"
 )
@@ -16,107 +17,619 @@ var (
 	ErrNotCompound  = errors.New("Invalid NBT file: root node is not a TAG_Compound")
 	ErrStoppedShort = errors.New("Unexpected TAG_End")
 	ErrTruncated    = errors.New("Unexpected EOF")
+	ErrTooLarge     = errors.New("NBT document exceeds the size limit")
+	ErrTooDeep      = errors.New("NBT document exceeds the depth limit")
+
+	// Returned for invalid length prefixes, including negative ones.
+	ErrInvalidLength = errors.New("Invalid length")
+
+	// Wrapped by the *NegativeLengthError returned for negative length
+	// prefixes of lists and arrays. String lengths are unsigned.
+	ErrNegativeLength = errors.New("Negative length")
 )
 
+// NegativeLengthError is returned for a list or array whose length prefix
+// is negative. It wraps both ErrNegativeLength and ErrInvalidLength.
+type NegativeLengthError struct {
+	Path   Path    // of the list or array, from the root compound
+	Type   TagType // TagList, TagByteArray, TagIntArray or TagLongArray
+	Length int64
+}
+
+func (self *NegativeLengthError) Error() string {
+	return fmt.Sprintf("%v: %v has negative length %d", self.Path, self.Type, self.Length)
+}
+
+func (self *NegativeLengthError) Unwrap() []error {
+	return []error{ErrNegativeLength, ErrInvalidLength}
+}
+
 // Decodes a gzipped NBT file into a native Go structure.
 func DecodeGzip(src io.Reader) (*Compound, error) {
-	buf := new(bytes.Buffer)
-	r, err := gzip.NewReader(src)
-	defer r.Close()
-	if err != nil {
-		return nil, err
-	}
-	io.Copy(buf, r)
-	return Decode(buf)
+	return DecodeOptions{}.DecodeGzip(src)
 }
 
 // Decodes an NBT file into a native Go structure.
 func Decode(src io.Reader) (*Compound, error) {
-	var tag byte
-	read(&tag, src)
+	return NewDecoder(src).Decode()
+}
+
+// DecodeOptions control how a Decoder interprets its input. Its methods
+// decode with the options in a single call.
+type DecodeOptions struct {
+	// Byte order of numbers and length prefixes. Java Edition uses big
+	// endian, which is the default if nil; Bedrock Edition uses little
+	// endian.
+	ByteOrder binary.ByteOrder
+
+	// Unwrap heterogeneous lists. Binary NBT can only hold lists with a
+	// single element type, so writers that need mixed lists (such as
+	// Minecraft since 1.21.5) emit a list of compounds in which every
+	// element that is not itself a plain compound is wrapped in a compound
+	// with a single entry named "". With this option such lists decode as a
+	// mixed List whose elements are read with (*List).Mixed; otherwise they
+	// decode as the lists of compounds they are on the wire.
+	AllowMixedLists bool
+
+	// If set, called with every named tag the decoder reads, for debugging
+	// malformed input.
+	Trace func(TraceEvent)
+
+	// If set, receives the size, duration and outcome of every document
+	// decoded.
+	Metrics Metrics
+
+	// If set, questionable input that can still be decoded is logged at
+	// LogLevel, or slog.LevelWarn if LogLevel is nil: compounds holding two
+	// entries of the same name, of which the last one is kept, and strings
+	// that are not valid UTF-8.
+	Logger   *slog.Logger
+	LogLevel slog.Leveler
+
+	// Limit on the size of a document, in bytes of input, or 0 for no
+	// limit. Length prefixes are checked against what is left of the limit
+	// before anything is allocated for them, so a hostile document cannot
+	// make the decoder allocate much more than this. Decoding fails with
+	// ErrTooLarge when the limit is exceeded.
+	MaxBytes int64
+
+	// Limit on the number of elements of the lists and arrays of a
+	// document, counted as their lengths are read and before anything is
+	// allocated for them, or 0 for no limit. Decoding fails with
+	// ErrTooLarge when the limit is exceeded.
+	MaxElements int
+
+	// Limit on how deeply compounds and lists may be nested, or 0 for no
+	// limit. The root compound is at depth 1. Decoding fails with
+	// ErrTooDeep when the limit is exceeded.
+	MaxDepth int
+
+	// If set, the decoded documents are allocated from the arena; see
+	// Arena for the rules this imposes.
+	Arena *Arena
+
+	// If set, called for each byte array entry of a compound that is at
+	// least ByteArrayThreshold bytes long, instead of reading it into a
+	// []int8. r yields the array's n bytes and may only be used during the
+	// call; whatever is left of it afterwards is skipped. The value
+	// returned is stored in place of the array: a []int8, a
+	// ByteArrayReader, or nil to leave the entry out. Byte arrays inside
+	// lists are always read into memory.
+	ByteArrayFunc      func(name string, n int, r io.Reader) (interface{}, error)
+	ByteArrayThreshold int
+
+	// If positive, list entries of compounds holding at least this many
+	// compounds are not decoded but kept in their encoded form as a
+	// *LazyList, whose elements are decoded one at a time when they are
+	// asked for.
+	LazyListThreshold int
+
+	// Make DecodeValue fail with an UnknownFieldError on compound entries
+	// that match no struct field, including fields tagged `nbt:"-"`,
+	// instead of skipping them.
+	DisallowUnknownFields bool
+
+	// Match compound entries to struct fields in DecodeValue regardless of
+	// case, for files whose key capitalization changed between versions
+	// ("id" and "Id"), when no field matches exactly.
+	CaseInsensitiveFields bool
+
+	// If set, called by DecodeValue with the name of each compound entry
+	// that matches no struct field exactly, and returning the name of the
+	// field to decode it into, or the name unchanged.
+	FieldNameFunc func(name string) string
+
+	// Make DecodeValue fail on bytes other than 0 and 1 decoded into a
+	// bool, instead of taking every byte other than 0 as true.
+	StrictBools bool
+
+	// Make DecodeValue fail on negative integers decoded into an unsigned
+	// type, instead of taking their bits as unsigned.
+	StrictUnsigned bool
+}
+
+// Decoder reads NBT documents from an input stream.
+//
+// Length prefixes are always checked to be non-negative. If the input
+// reports how much of it is left through a Len() int method, as
+// *bytes.Reader, *bytes.Buffer and *strings.Reader do, they are also checked
+// against it, so that truncated or hostile input fails with ErrTruncated
+// instead of causing large allocations. Otherwise, unless MaxBytes is set,
+// long lists and arrays are read before they are allocated in full, so that
+// such input still fails before the decoder allocates much more than it
+// holds.
+type Decoder struct {
+	DecodeOptions
+	r *counting_reader
+
+	// input offset at which the current document started
+	start int64
+
+	// number of compounds enclosing the tag being read
+	depth int
+
+	// number of compounds and lists enclosing the tag being read, for
+	// MaxDepth
+	nesting int
+
+	// number of list and array elements read, for MaxElements
+	elements int
+
+	// buffer for reads by DecodeValue
+	scratch []byte
+
+	// names of the entries being decoded by DecodeValue, by nesting, which
+	// outlive scratch so that errors can name them
+	names [][]byte
+
+	// whole input, if strings and byte arrays are to point into it; see
+	// OpenMapped
+	view []byte
+
+	// state of Token: the compounds and lists entered, the last token
+	// read, the type of its payload if it is still to be read, whether the
+	// compound or list it names was just entered, and the token read ahead
+	// by Peek
+	frames     []token_frame
+	token      Token
+	pending    TagType
+	fresh      bool
+	next_token Token
+	peeked     bool
+}
+
+func NewDecoder(src io.Reader) *Decoder {
+	return &Decoder{r: &counting_reader{r: src}}
+}
+
+// TraceEvent describes a tag read by a Decoder.
+type TraceEvent struct {
+	// Input offset of the tag's type byte, counted from where the Decoder
+	// started reading.
+	Offset int64
+
+	Type TagType
+	Name string
+
+	// Number of compounds enclosing the tag. The root compound has depth 0
+	// and its TAG_End depth 1. Compounds inside lists count as well.
+	Depth int
+}
+
+func (self *Decoder) trace(offset int64, tag TagType, name string) {
+	if self.Trace != nil {
+		self.Trace(TraceEvent{offset, tag, name, self.depth})
+	}
+}
+
+// Decodes the next uncompressed NBT document from the input. It returns
+// io.EOF if the input ends before the document starts.
+func (self *Decoder) Decode() (*Compound, error) {
+	start := self.clock()
+	c, err := self.decode()
+	self.measure(start, err)
+	return c, err
+}
+
+func (self *Decoder) decode() (*Compound, error) {
+	self.start = self.r.n
+	self.depth = 0
+	self.nesting, self.elements = 0, 0
+	var tag TagType
+	if err := self.read(&tag); err != nil {
+		if self.r.n == self.start {
+			return nil, io.EOF
+		}
+		return nil, err
+	}
 	if tag != TagCompound {
 		return nil, ErrNotCompound
 	}
 
-	name := read_string(src)
-	return read_compound(src, name, nil)
+	name, err := self.read_string()
+	if err != nil {
+		return nil, err
+	}
+	self.trace(self.start, tag, name)
+	return self.read_compound(name, nil)
+}
+
+// Reports whether another document follows in the input, for reading a
+// stream of concatenated documents, such as several gzip members read
+// through one gzip.Reader:
+//
+//	for dec.More() {
+//		c, err := dec.Decode()
+//		...
+//	}
+//
+// It reads one byte ahead, which the next Decode picks up. An error while
+// reading ahead other than io.EOF is returned by the next Decode.
+func (self *Decoder) More() bool {
+	if len(self.r.peeked) > 0 || self.r.peek_err != nil {
+		return true
+	}
+	var b [1]byte
+	n, err := io.ReadFull(self.r.r, b[:])
+	switch {
+	case n == 1:
+		self.r.peeked = append(self.r.peeked[:0], b[0])
+		return true
+	case err == io.EOF:
+		return false
+	}
+	self.r.peek_err = err
+	return true
 }
 
-func read(dest interface{}, src io.Reader) error {
-	return binary.Read(src, binary.BigEndian, dest)
+// Returns the number of bytes of input consumed so far, as the offset at
+// which the next tag or payload starts, for recording where tags are or
+// where the input was corrupt. Bytes read ahead by More are not counted
+// until they are used; the header read ahead by Peek is.
+func (self *Decoder) InputOffset() int64 {
+	return self.r.n
+}
+
+// Decodes an uncompressed NBT document held in memory.
+func DecodeBytes(data []byte) (*Compound, error) {
+	return Decode(bytes.NewReader(data))
+}
+
+// Decodes a single uncompressed NBT document from src into the compound,
+// replacing its name and contents, implementing io.ReaderFrom. The returned
+// count is the number of bytes consumed from src.
+func (self *Compound) ReadFrom(src io.Reader) (int64, error) {
+	if err := self.writable(); err != nil {
+		return 0, err
+	}
+	dec := NewDecoder(src)
+	c, err := dec.Decode()
+	if err != nil {
+		return dec.r.n, err
+	}
+
+	self.replace(c)
+	return dec.r.n, nil
+}
+
+type counting_reader struct {
+	r io.Reader
+	n int64
+
+	// read ahead by Decoder.More and not yet counted
+	peeked   []byte
+	peek_err error
+
+	// everything read while capturing, for RawTag
+	capture   []byte
+	capturing bool
+}
+
+func (self *counting_reader) Read(p []byte) (int, error) {
+	n, err := self.read(p)
+	if self.capturing {
+		self.capture = append(self.capture, p[:n]...)
+	}
+	return n, err
+}
+
+func (self *counting_reader) read(p []byte) (int, error) {
+	if len(self.peeked) > 0 && len(p) > 0 {
+		p[0] = self.peeked[0]
+		self.peeked = self.peeked[:0]
+		self.n++
+		return 1, nil
+	}
+	if err := self.peek_err; err != nil {
+		self.peek_err = nil
+		return 0, err
+	}
+	n, err := self.r.Read(p)
+	self.n += int64(n)
+	return n, err
+}
+
+func (self *Decoder) read(dest interface{}) error {
+	// scalars are read without binary.Read's allocations
+	switch d := dest.(type) {
+	case *int8:
+		n, err := self.next_int(1)
+		*d = int8(n)
+		return err
+	case *int16:
+		n, err := self.next_int(2)
+		*d = int16(n)
+		return err
+	case *int32:
+		n, err := self.next_int(4)
+		*d = int32(n)
+		return err
+	case *int64:
+		n, err := self.next_int(8)
+		*d = n
+		return err
+	case *float32:
+		n, err := self.next_int(4)
+		*d = math.Float32frombits(uint32(n))
+		return err
+	case *float64:
+		n, err := self.next_int(8)
+		*d = math.Float64frombits(uint64(n))
+		return err
+	case []byte:
+		_, err := io.ReadFull(self.r, d)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return ErrTruncated
+		}
+		return err
+	case []int8, []int16, []int32, []int64, []float32, []float64:
+		b, err := self.next(binary.Size(d))
+		if err != nil {
+			return err
+		}
+		_, err = binary.Decode(b, self.byte_order(), d)
+		return err
+	}
+	err := binary.Read(self.r, self.byte_order(), dest)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrTruncated
+	}
+	return err
+}
+
+func (self *Decoder) byte_order() binary.ByteOrder {
+	if self.ByteOrder == nil {
+		return binary.BigEndian
+	}
+	return self.ByteOrder
+}
+
+// Reads the length prefix of a list or array of n elements of at least size
+// bytes each and checks it against what is left of the input, if that is
+// known, of MaxBytes and of MaxElements.
+func (self *Decoder) read_length(size int64) (int, error) {
+	n, err := self.next_int(4)
+	if err != nil {
+		return 0, err
+	}
+	length, err := self.check_length(n, size)
+	if err != nil {
+		return 0, err
+	}
+	return length, self.count_elements(length)
+}
+
+func (self *Decoder) count_elements(n int) error {
+	self.elements += n
+	if self.MaxElements > 0 && self.elements > self.MaxElements {
+		return fmt.Errorf("%w: more than %d list and array elements", ErrTooLarge, self.MaxElements)
+	}
+	return nil
+}
+
+// Reports whether length prefixes are checked against a bound on the size of
+// the input, its remaining length or MaxBytes, so that what they ask for can
+// be allocated up front.
+func (self *Decoder) bounded() bool {
+	_, ok := self.remaining()
+	return ok
+}
+
+// Returns how many more bytes of input the document may take up, if that is
+// known from the input's remaining length or MaxBytes.
+func (self *Decoder) remaining() (int64, bool) {
+	n, ok := int64(-1), false
+	if l, is := self.r.r.(interface{ Len() int }); is {
+		n, ok = int64(l.Len()), true
+	}
+	if self.MaxBytes > 0 {
+		if left := self.MaxBytes - (self.r.n - self.start); !ok || left < n {
+			n, ok = left, true
+		}
+	}
+	if n < 0 {
+		n = 0
+	}
+	return n, ok
+}
+
+// How many elements of a list are allocated before they are read when the
+// input might not hold as many as its length prefix says.
+const list_prealloc = 1024
+
+// Returns the capacity to allocate up front for a list of length elements,
+// each taking up at least a byte of input.
+func (self *Decoder) prealloc(length int) int {
+	left, ok := self.remaining()
+	switch {
+	case !ok && length > list_prealloc:
+		return list_prealloc
+	case ok && int64(length) > left:
+		return int(left)
+	}
+	return length
+}
+
+// Reads length elements of a fixed size into a slice made by alloc. If the
+// input might not hold them all, the slice is only made once they have been
+// read, so that a hostile length prefix cannot make the decoder allocate
+// much more than the input holds.
+func (self *Decoder) read_fixed(length int, size int64, alloc func(int) interface{}) (interface{}, error) {
+	if length <= list_prealloc || self.bounded() {
+		data := alloc(length)
+		return data, self.read(data)
+	}
+	b, err := self.next(int(int64(length) * size))
+	if err != nil {
+		return nil, err
+	}
+	data := alloc(length)
+	_, err = binary.Decode(b, self.byte_order(), data)
+	return data, err
+}
+
+func (self *Decoder) check_length(n, size int64) (int, error) {
+	if n < 0 {
+		return 0, &NegativeLengthError{Length: n}
+	}
+	if l, ok := self.r.r.(interface{ Len() int }); ok && n*size > int64(l.Len()) {
+		return 0, ErrTruncated
+	}
+	if self.MaxBytes > 0 && n*size > self.MaxBytes-(self.r.n-self.start) {
+		return 0, ErrTooLarge
+	}
+	return int(n), nil
+}
+
+// Prepends path to the path of a *NegativeLengthError, which is given the
+// type of the value at path, tag, if it has none yet. Other errors are
+// returned unchanged.
+func with_path(err error, tag TagType, path ...PathElem) error {
+	var neg *NegativeLengthError
+	if errors.As(err, &neg) {
+		neg.Path = append(path[:len(path):len(path)], neg.Path...)
+		if neg.Type == TagEnd {
+			neg.Type = tag
+		}
+	}
+	return err
+}
+
+// Returns the path from root to the named entry of current, a compound at
+// or below root.
+func entry_path(root, current *Compound, name string) Path {
+	path := Path{{Key: name}}
+	for c := current; c != root; c = c.parent {
+		path = append(Path{{Key: c.name}}, path...)
+	}
+	return path
+}
+
+// Called on entering a compound or list, to check MaxDepth.
+func (self *Decoder) enter() error {
+	self.nesting++
+	if self.MaxDepth > 0 && self.nesting > self.MaxDepth {
+		return ErrTooDeep
+	}
+	return nil
 }
 
-func read_string(src io.Reader) string {
-	var strlen int16
-	read(&strlen, src)
-	str := make([]byte, strlen)
-	read(str, src)
-	return string(str)
+func (self *Decoder) leave() {
+	self.nesting--
 }
 
-func read_compound(src io.Reader, name string, parent *Compound) (*Compound, error) {
-	current := &Compound{
-		parent: parent,
-		name:   name,
-		data:   make(map[string]interface{}),
+func (self *Decoder) read_string() (string, error) {
+	strlen, err := self.next_length(2, 1)
+	if err != nil {
+		return "", err
+	}
+	var str string
+	if self.view != nil {
+		b, err := self.borrow(strlen)
+		if err != nil {
+			return "", err
+		}
+		str = view_string(join_surrogates(b))
+	} else {
+		b := self.Arena.make_bytes(strlen)
+		if err := self.read(b); err != nil {
+			return "", err
+		}
+		str = self.Arena.to_string(join_surrogates(b))
 	}
+	check_utf8(self.Logger, self.LogLevel, str)
+	return str, nil
+}
+
+func (self *Decoder) read_compound(name string, parent *Compound) (*Compound, error) {
+	current := self.Arena.compound(name, parent)
 	root := current
+	self.depth++
+	if err := self.enter(); err != nil {
+		return root, err
+	}
 
-	var tag byte
 	for {
-		read(&tag, src)
-		println("reading tag", tag)
-		switch tag {
-		case TagEnd:
-			if current.parent == nil {
+		offset := self.r.n
+		b, err := self.next(1)
+		if err != nil {
+			return root, err
+		}
+		tag := TagType(b[0])
+		if tag == TagEnd {
+			self.trace(offset, tag, "")
+			self.depth--
+			self.leave()
+			if current == root {
 				return root, nil
 			} else {
 				current = current.parent
 			}
+			continue
+		}
 
-		case TagByte:
-			var value int8
-			current.store(&value, src)
-
-		case TagShort:
-			var value int16
-			current.store(&value, src)
-
-		case TagInt:
-			var value int32
-			current.store(&value, src)
-
-		case TagLong:
-			var value int64
-			current.store(&value, src)
-
-		case TagFloat:
-			var value float32
-			current.store(&value, src)
+		name, err := self.read_string()
+		if err != nil {
+			return root, err
+		}
+		self.trace(offset, tag, name)
+		if _, ok := current.data[name]; ok && self.Logger != nil {
+			self.warn("nbt: duplicate compound entry", "compound", current.name, "entry", name)
+		}
 
-		case TagDouble:
-			var value float64
-			current.store(&value, src)
+		switch tag {
+		case TagByte, TagShort, TagInt, TagLong, TagFloat, TagDouble:
+			err = current.store(name, tag, self)
 
 		case TagByteArray:
-			name := read_string(src)
-			var length int32
-			read(&length, src)
-			bytea := make([]int8, length)
-			read(bytea, src)
-			current.data[name] = bytea
+			if self.ByteArrayFunc == nil {
+				var v []int8
+				v, err = self.read_byte_array()
+				current.data[name] = entry{tag: tag, ref: v}
+				break
+			}
+			var v interface{}
+			if v, err = self.stream_byte_array(name); err == nil && v != nil {
+				current.data[name] = entry_of(v)
+			}
 
 		case TagString:
-			name := read_string(src)
-			data := read_string(src)
-			current.data[name] = data
+			var s string
+			s, err = self.read_string()
+			current.data[name] = entry{tag: tag, str: s}
 
 		case TagList:
-			list, err := read_list(src)
-			if err != nil {
-				return root, err
+			var v interface{}
+			v, err = self.read_list_entry(name)
+			if err == nil {
+				switch l := v.(type) {
+				case *List:
+					l.set_parent(current)
+				case *LazyList:
+					l.parent = current
+				}
 			}
-			current.data[list.name] = list
+			current.data[name] = entry{tag: tag, ref: v}
 
 		case TagCompound:
 			// we need to go deeper
@@ -124,90 +637,243 @@ func read_compound(src io.Reader, name string, parent *Compound) (*Compound, err
 			// further calls to (*Compound).store. Once a TAG_End is reached,
 			// appropriate action will be taken to move the target back to this
 			// *Compound's parent.
-			name := read_string(src)
-			c := &Compound{
-				parent: current,
-				name:   name,
-				data:   make(map[string]interface{}),
-			}
-			current.data[name] = c
+			c := self.Arena.compound(name, current)
+			current.data[name] = entry{tag: tag, ref: c}
 			current = c
+			self.depth++
+			err = self.enter()
 
 		case TagIntArray:
 			// I'll assume for now that the length is also a signed int, like
 			// TAG_ByteArray
-			name := read_string(src)
-			var length int32
-			read(&length, src)
-			inta := make([]int32, length)
-			read(inta, src)
-			current.data[name] = inta
+			var v []int32
+			v, err = self.read_int_array()
+			current.data[name] = entry{tag: tag, ref: v}
+
+		case TagLongArray:
+			var v []int64
+			v, err = self.read_long_array()
+			current.data[name] = entry{tag: tag, ref: v}
 
 		default:
-			return root, errors.New(fmt.Sprintf("Unknown type: %v", tag))
+			var v Extension
+			v, err = self.read_extension(tag)
+			current.data[name] = entry{tag: tag, ref: v}
+		}
+		if err != nil {
+			return root, with_path(err, tag, entry_path(root, current, name)...)
 		}
 	}
+}
+
+// Reads the payload of a list, after its name.
+func (self *Decoder) read_list(name string) (*List, error) {
+	if err := self.enter(); err != nil {
+		return nil, err
+	}
+	defer self.leave()
+	list_type, length, err := self.read_list_header()
+	if err != nil {
+		return nil, err
+	}
+	return self.read_list_items(name, list_type, length)
+}
 
-	// not enough TAG_Ends, reached EOF already
-	return root, ErrTruncated
+// Reads the payload of a list entry of a compound, as a *LazyList if
+// LazyListThreshold calls for it and as a *List otherwise.
+func (self *Decoder) read_list_entry(name string) (interface{}, error) {
+	if err := self.enter(); err != nil {
+		return nil, err
+	}
+	defer self.leave()
+	list_type, length, err := self.read_list_header()
+	if err != nil {
+		return nil, err
+	}
+	if list_type == TagCompound && self.LazyListThreshold > 0 && length >= self.LazyListThreshold {
+		return self.read_lazy_list(name, length)
+	}
+	return self.read_list_items(name, list_type, length)
 }
 
-func read_list(src io.Reader) (*List, error) {
-	name := read_string(src)
-	var list_type byte
-	read(&list_type, src)
-	var length int32
-	read(&length, src)
-	list := &List{
-		name:      name,
-		list_type: list_type,
-		length:    length,
+func (self *Decoder) read_list_header() (TagType, int, error) {
+	b, err := self.next(1)
+	if err != nil {
+		return 0, 0, err
 	}
+	list_type := TagType(b[0])
+	length, err := self.read_length(min_size(list_type))
+	return list_type, length, err
+}
+
+func (self *Decoder) read_list_items(name string, list_type TagType, length int) (*List, error) {
+	var err error
+	list := self.Arena.list()
+	list.name, list.list_type, list.length = name, list_type, int32(length)
 
 	switch list_type {
+	case TagEnd:
+		// empty list of unspecified type
+
 	case TagCompound:
-		data := make([]*Compound, length)
-		for k, _ := range data {
-			c, err := read_compound(src, "", nil)
+		data := make([]*Compound, 0, self.prealloc(length))
+		for k := 0; k < length; k++ {
+			c, err := self.read_compound("", nil)
 			if err != nil {
-				return nil, err
+				return nil, with_path(err, TagCompound, PathElem{Index: k, IsIndex: true})
 			}
-			data[k] = c
+			data = append(data, c)
 		}
 		list.data = data
+		if self.AllowMixedLists {
+			unwrap_mixed(list)
+		}
 
 	case TagByte:
-		data := make([]int8, length)
-		read(data, src)
-		list.data = data
-
+		list.data, err = self.read_fixed(length, 1, func(n int) interface{} { return self.Arena.make_int8s(n) })
 	case TagShort:
-		data := make([]int16, length)
-		read(data, src)
+		list.data, err = self.read_fixed(length, 2, func(n int) interface{} { return self.Arena.make_int16s(n) })
+	case TagInt:
+		list.data, err = self.read_fixed(length, 4, func(n int) interface{} { return self.Arena.make_int32s(n) })
+	case TagLong:
+		list.data, err = self.read_fixed(length, 8, func(n int) interface{} { return self.Arena.make_int64s(n) })
+	case TagFloat:
+		list.data, err = self.read_fixed(length, 4, func(n int) interface{} { return self.Arena.make_float32s(n) })
+	case TagDouble:
+		list.data, err = self.read_fixed(length, 8, func(n int) interface{} { return self.Arena.make_float64s(n) })
+
+	case TagString:
+		data := make([]string, 0, self.prealloc(length))
+		for k := 0; k < length; k++ {
+			str, err := self.read_string()
+			if err != nil {
+				return nil, err
+			}
+			data = append(data, str)
+		}
 		list.data = data
 
-	case TagInt:
-		data := make([]int32, length)
-		read(data, src)
+	case TagList:
+		data := make([]*List, 0, self.prealloc(length))
+		for k := 0; k < length; k++ {
+			l, err := self.read_list("")
+			if err != nil {
+				return nil, with_path(err, TagList, PathElem{Index: k, IsIndex: true})
+			}
+			data = append(data, l)
+		}
 		list.data = data
 
-	case TagLong:
-		data := make([]int64, length)
-		read(data, src)
+	case TagByteArray:
+		data := make([][]int8, 0, self.prealloc(length))
+		for k := 0; k < length; k++ {
+			a, err := self.read_byte_array()
+			if err != nil {
+				return nil, with_path(err, TagByteArray, PathElem{Index: k, IsIndex: true})
+			}
+			data = append(data, a)
+		}
 		list.data = data
 
-	case TagFloat:
-		data := make([]float32, length)
-		read(data, src)
+	case TagIntArray:
+		data := make([][]int32, 0, self.prealloc(length))
+		for k := 0; k < length; k++ {
+			a, err := self.read_int_array()
+			if err != nil {
+				return nil, with_path(err, TagIntArray, PathElem{Index: k, IsIndex: true})
+			}
+			data = append(data, a)
+		}
 		list.data = data
 
-	case TagDouble:
-		data := make([]float64, length)
-		read(data, src)
+	case TagLongArray:
+		data := make([][]int64, 0, self.prealloc(length))
+		for k := 0; k < length; k++ {
+			a, err := self.read_long_array()
+			if err != nil {
+				return nil, with_path(err, TagLongArray, PathElem{Index: k, IsIndex: true})
+			}
+			data = append(data, a)
+		}
 		list.data = data
 
 	default:
-		panic(fmt.Sprintf("%#v", list_type))
+		if _, ok := lookup_extension(list_type); !ok {
+			return nil, errors.New(fmt.Sprintf("Unknown list element type: %v", list_type))
+		}
+		data := make([]Extension, 0, self.prealloc(length))
+		for k := 0; k < length; k++ {
+			e, err := self.read_extension(list_type)
+			if err != nil {
+				return nil, err
+			}
+			data = append(data, e)
+		}
+		list.data = data
+	}
+	if err != nil {
+		return nil, err
 	}
 	return list, nil
 }
+
+// Returns the least number of bytes a list element of the given type takes
+// up, for checking list lengths before allocating.
+func min_size(tag TagType) int64 {
+	switch tag {
+	case TagByte, TagCompound:
+		return 1
+	case TagShort, TagString:
+		return 2
+	case TagInt, TagFloat, TagByteArray, TagIntArray, TagLongArray:
+		return 4
+	case TagLong, TagDouble:
+		return 8
+	case TagList:
+		return 5
+	case TagEnd:
+		return 0
+	}
+	// an extension, whose size is unknown but surely not nothing
+	return 1
+}
+
+func (self *Decoder) read_byte_array() ([]int8, error) {
+	length, err := self.read_length(1)
+	if err != nil {
+		return nil, err
+	}
+	if self.view != nil {
+		b, err := self.borrow(length)
+		return view_int8s(b), err
+	}
+	bytea, err := self.read_fixed(length, 1, func(n int) interface{} { return self.Arena.make_int8s(n) })
+	if err != nil {
+		return nil, err
+	}
+	return bytea.([]int8), nil
+}
+
+func (self *Decoder) read_int_array() ([]int32, error) {
+	length, err := self.read_length(4)
+	if err != nil {
+		return nil, err
+	}
+	inta, err := self.read_fixed(length, 4, func(n int) interface{} { return self.Arena.make_int32s(n) })
+	if err != nil {
+		return nil, err
+	}
+	return inta.([]int32), nil
+}
+
+func (self *Decoder) read_long_array() ([]int64, error) {
+	length, err := self.read_length(8)
+	if err != nil {
+		return nil, err
+	}
+	longa, err := self.read_fixed(length, 8, func(n int) interface{} { return self.Arena.make_int64s(n) })
+	if err != nil {
+		return nil, err
+	}
+	return longa.([]int64), nil
+}
@@ -0,0 +1,134 @@
+package nbt
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+)
+
+// Change is one difference between two documents, found by Diff. Old is nil
+// for an entry that was added and New is nil for one that was removed;
+// otherwise the value at Path was changed. Values are plain values as
+// returned by Get.
+type Change struct {
+	Path Path
+	Old  interface{}
+	New  interface{}
+}
+
+func (self Change) String() string {
+	switch {
+	case self.Old == nil:
+		return fmt.Sprintf("+ %v: %s", self.Path, change_value(self.New))
+	case self.New == nil:
+		return fmt.Sprintf("- %v: %s", self.Path, change_value(self.Old))
+	}
+	return fmt.Sprintf("~ %v: %s -> %s", self.Path, change_value(self.Old), change_value(self.New))
+}
+
+func change_value(v interface{}) string {
+	b, err := MarshalSNBT(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+// Compares two documents entry by entry and returns the differences, ordered
+// by path. Compounds are compared key by key and lists of the same element
+// type index by index, so that a change deep inside a document is reported
+// at the path where it happened. A list whose element type changed, an
+// array, or an entry whose tag type changed is reported as a single change.
+// The names of the two roots are not compared.
+//
+// Subtrees that a tree shares with its clone, and identical subtrees of two
+// frozen trees, are skipped without looking inside; see Compound.Hash.
+func Diff(a, b *Compound) []Change {
+	var changes []Change
+	diff_compound(nil, a, b, &changes)
+	return changes
+}
+
+// Reports whether two values are equal as NBT: of the same tag type with
+// the same contents. Floating point values are compared by their bits, so
+// that a NaN equals itself. Compound names are not compared.
+func Equal(a, b interface{}) bool {
+	var changes []Change
+	diff_value(nil, unbox(a), unbox(b), &changes)
+	return len(changes) == 0
+}
+
+func diff_compound(path Path, a, b *Compound, changes *[]Change) {
+	keys := a.sorted_keys()
+	for _, k := range b.sorted_keys() {
+		if _, ok := a.data[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		p := append(path[:len(path):len(path)], PathElem{Key: k})
+		va, ina := a.data[k]
+		vb, inb := b.data[k]
+		switch {
+		case !inb:
+			*changes = append(*changes, Change{Path: p, Old: va.value()})
+		case !ina:
+			*changes = append(*changes, Change{Path: p, New: vb.value()})
+		default:
+			diff_value(p, va.value(), vb.value(), changes)
+		}
+	}
+}
+
+func diff_value(path Path, a, b interface{}, changes *[]Change) {
+	if TypeOf(a) != TypeOf(b) {
+		*changes = append(*changes, Change{Path: path, Old: a, New: b})
+		return
+	}
+	if same_subtree(a, b) {
+		return
+	}
+	switch a := a.(type) {
+	case *Compound:
+		diff_compound(path, a, b.(*Compound), changes)
+		return
+
+	case *List:
+		b := b.(*List)
+		if a.list_type != b.list_type || a.IsMixed() != b.IsMixed() {
+			break
+		}
+		ia, ib := a.items(), b.items()
+		for i := 0; i < len(ia) || i < len(ib); i++ {
+			p := append(path[:len(path):len(path)], PathElem{Index: i, IsIndex: true})
+			switch {
+			case i >= len(ib):
+				*changes = append(*changes, Change{Path: p, Old: ia[i]})
+			case i >= len(ia):
+				*changes = append(*changes, Change{Path: p, New: ib[i]})
+			default:
+				diff_value(p, ia[i], ib[i], changes)
+			}
+		}
+		return
+
+	case float32:
+		if math.Float32bits(a) == math.Float32bits(b.(float32)) {
+			return
+		}
+
+	case float64:
+		if math.Float64bits(a) == math.Float64bits(b.(float64)) {
+			return
+		}
+
+	default:
+		if reflect.DeepEqual(a, b) {
+			return
+		}
+	}
+	*changes = append(*changes, Change{Path: path, Old: a, New: b})
+}
@@ -0,0 +1,133 @@
+package nbt
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+var ErrSessionClosed = errors.New("Editing session is closed")
+
+// Session is an edit of an NBT file that can be undone, for world editing
+// tools that apply several changes and must not leave a half-edited world
+// behind when one of them fails. Edit copies the file to a backup next to
+// it before anything is changed; Commit writes the document back, as often
+// as needed, and Rollback restores the original contents from the backup.
+// Close or Rollback end the session and remove the backup. If the program
+// dies before that, the backup is left in place, named by Backup.
+type Session struct {
+	path   string
+	backup string
+	format Format
+	c      *Compound
+
+	committed bool
+	closed    bool
+}
+
+// Starts an editing session on the named file, which is decoded as
+// DecodeFile does.
+func Edit(path string) (*Session, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c, format, err := DecodeAny(data)
+	if err != nil {
+		return nil, err
+	}
+
+	dir := filepath.Dir(path)
+	f, err := os.CreateTemp(dir, "."+filepath.Base(path)+".bak*")
+	if err != nil {
+		return nil, err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = sync_dir(dir)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return nil, err
+	}
+	return &Session{path: path, backup: f.Name(), format: format, c: c}, nil
+}
+
+// Returns the document being edited.
+func (self *Session) Compound() *Compound { return self.c }
+
+// Returns the format the file was read in, which Commit writes it in.
+func (self *Session) Format() Format { return self.format }
+
+// Returns the path of the copy of the original file.
+func (self *Session) Backup() string { return self.backup }
+
+// Writes the document back to the file, replacing it atomically as
+// EncodeFile does.
+func (self *Session) Commit() error {
+	if self.closed {
+		return ErrSessionClosed
+	}
+	self.committed = true
+	return EncodeFile(self.path, self.c, self.format)
+}
+
+// Restores the file as it was when the session started and ends the
+// session.
+func (self *Session) Rollback() error {
+	if self.closed {
+		return ErrSessionClosed
+	}
+	if self.committed {
+		err := replace_file(self.path, func(w io.Writer) error {
+			f, err := os.Open(self.backup)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			_, err = io.Copy(w, f)
+			return err
+		})
+		if err != nil {
+			// keep the backup for another try
+			return err
+		}
+	}
+	return self.Close()
+}
+
+// Ends the session, keeping what was committed, and removes the backup.
+func (self *Session) Close() error {
+	if self.closed {
+		return nil
+	}
+	self.closed = true
+	return os.Remove(self.backup)
+}
+
+// Edits the named file in a session: f changes the document, which is then
+// committed. If f or the commit fails, the file is rolled back and the
+// error returned.
+func EditFile(path string, f func(c *Compound) error) error {
+	s, err := Edit(path)
+	if err != nil {
+		return err
+	}
+	if err := f(s.c); err != nil {
+		s.Rollback()
+		return err
+	}
+	if err := s.Commit(); err != nil {
+		s.Rollback()
+		return err
+	}
+	return s.Close()
+}
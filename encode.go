@@ -0,0 +1,354 @@
+package nbt
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"math"
+)
+
+var (
+	ErrStringTooLong = errors.New("String too long for TAG_String")
+)
+
+// Encodes a Compound into a gzipped NBT file. The gzip header has no
+// modification time or name and an unknown OS, so the same compound always
+// gives the same bytes.
+func EncodeGzip(dst io.Writer, c *Compound) error {
+	return EncodeGzipHeader(dst, c, gzip.Header{OS: 255})
+}
+
+// Encodes a Compound into a gzipped NBT file with the given gzip header,
+// whose fields are written as they are; note that an OS of 0 means FAT
+// rather than unknown, which is 255.
+func EncodeGzipHeader(dst io.Writer, c *Compound, header gzip.Header) error {
+	return EncodeOptions{}.EncodeGzipHeader(dst, c, header)
+}
+
+// Encodes a Compound into an uncompressed NBT file.
+func Encode(dst io.Writer, c *Compound) error {
+	return NewEncoder(dst).Encode(c)
+}
+
+// EncodeOptions control how an Encoder writes its output. Its methods
+// encode with the options in a single call.
+type EncodeOptions struct {
+	// Byte order of numbers and length prefixes. Java Edition uses big
+	// endian, which is the default if nil; Bedrock Edition uses little
+	// endian. Unless it is little endian, characters outside the Basic
+	// Multilingual Plane are written as surrogate pairs, as Java does.
+	ByteOrder binary.ByteOrder
+
+	// If set, questionable data that can still be encoded is logged at
+	// LogLevel, or slog.LevelWarn if LogLevel is nil. Currently these are
+	// strings that are not valid UTF-8.
+	Logger   *slog.Logger
+	LogLevel slog.Leveler
+
+	// If set, receives the size, duration and outcome of every document
+	// encoded. It must be set before the first document is encoded.
+	Metrics Metrics
+
+	// If set, every byte written to the output is also written to Checksum,
+	// so that its Sum is a digest of everything encoded so far, e.g. with
+	// crc32.NewIEEE() or sha256.New(). It must be set before the first
+	// document is encoded.
+	Checksum hash.Hash
+
+	// If OverrideRootName is set, documents are written with RootName as
+	// the name of the root compound, rather than the compound's own name
+	// (or "" for EncodeValue), e.g. to write the empty name most Java
+	// Edition files have, or a specific one a consumer expects, without
+	// modifying the compound.
+	OverrideRootName bool
+	RootName         string
+
+	// Make EncodeValue fail on unsigned integers above the signed maximum of
+	// their tag type, instead of writing their bits so that they wrap
+	// around to negative values.
+	StrictUnsigned bool
+}
+
+// Encoder writes NBT documents to an output stream.
+type Encoder struct {
+	EncodeOptions
+	w   io.Writer
+	buf *bufio.Writer
+
+	// counts what has left buf, for Metrics
+	counter *counting_writer
+}
+
+func NewEncoder(dst io.Writer) *Encoder {
+	return &Encoder{w: dst}
+}
+
+// Sets up the buffered output on first use.
+func (self *Encoder) init() {
+	if self.buf != nil {
+		return
+	}
+	w := self.w
+	if self.Checksum != nil {
+		w = io.MultiWriter(w, self.Checksum)
+	}
+	if self.Metrics != nil {
+		self.counter = &counting_writer{w: w}
+		w = self.counter
+	}
+	self.buf = bufio.NewWriter(w)
+}
+
+// Writes the compound to the output as an uncompressed NBT document.
+func (self *Encoder) Encode(c *Compound) error {
+	self.init()
+	start, n := self.clock()
+	err := self.encode(c)
+	self.measure(start, n, err)
+	return err
+}
+
+func (self *Encoder) encode(c *Compound) error {
+	if err := self.write(byte(TagCompound)); err != nil {
+		return err
+	}
+	if err := self.write_string(self.root_name(c.name)); err != nil {
+		return err
+	}
+	if err := self.write_compound(c); err != nil {
+		return err
+	}
+	return self.buf.Flush()
+}
+
+func (self *Encoder) root_name(name string) string {
+	if self.OverrideRootName {
+		return self.RootName
+	}
+	return name
+}
+
+// Encodes the compound as an uncompressed NBT document held in memory.
+func (self *Compound) MarshalBytes() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	if err := Encode(buf, self); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Encodes the compound as an uncompressed NBT document, implementing
+// io.WriterTo. The returned count is the number of bytes written to dst.
+func (self *Compound) WriteTo(dst io.Writer) (int64, error) {
+	w := &counting_writer{w: dst}
+	err := Encode(w, self)
+	return w.n, err
+}
+
+type counting_writer struct {
+	w io.Writer
+	n int64
+}
+
+func (self *counting_writer) Write(p []byte) (int, error) {
+	n, err := self.w.Write(p)
+	self.n += int64(n)
+	return n, err
+}
+
+func (self *Encoder) write(src interface{}) error {
+	return binary.Write(self.buf, self.byte_order(), src)
+}
+
+func (self *Encoder) byte_order() binary.ByteOrder {
+	if self.ByteOrder == nil {
+		return binary.BigEndian
+	}
+	return self.ByteOrder
+}
+
+func (self *Encoder) write_string(s string) error {
+	if self.byte_order() != binary.LittleEndian {
+		s = split_surrogates(s)
+	}
+	if len(s) > math.MaxUint16 {
+		return ErrStringTooLong
+	}
+	check_utf8(self.Logger, self.LogLevel, s)
+	if err := self.write(uint16(len(s))); err != nil {
+		return err
+	}
+	_, err := self.buf.WriteString(s)
+	return err
+}
+
+// Writes the payload of a compound: each entry in turn, followed by a
+// TAG_End. Entries are written in key order so that encoding the same tree
+// twice yields the same bytes.
+func (self *Encoder) write_compound(c *Compound) error {
+	for _, k := range c.sorted_keys() {
+		e := c.data[k]
+		if e.tag == TagEnd {
+			return fmt.Errorf("Cannot encode \"%s\": unsupported type %T", k, e.ref)
+		}
+		if err := self.write(byte(e.tag)); err != nil {
+			return err
+		}
+		if err := self.write_string(k); err != nil {
+			return err
+		}
+		if err := self.write_payload(e.stored()); err != nil {
+			return err
+		}
+	}
+	return self.write(byte(TagEnd))
+}
+
+// Returns the tag type a stored value is encoded as.
+func tag_of(v interface{}) (TagType, bool) {
+	switch v.(type) {
+	case int8, *int8:
+		return TagByte, true
+	case int16, *int16:
+		return TagShort, true
+	case int32, *int32:
+		return TagInt, true
+	case int64, *int64:
+		return TagLong, true
+	case float32, *float32:
+		return TagFloat, true
+	case float64, *float64:
+		return TagDouble, true
+	case []int8:
+		return TagByteArray, true
+	case string, *string:
+		return TagString, true
+	case *List:
+		return TagList, true
+	case *Compound:
+		return TagCompound, true
+	case []int32:
+		return TagIntArray, true
+	case []int64:
+		return TagLongArray, true
+	case Number:
+		if n := v.(Number); n.Value() != nil {
+			return n.Type, true
+		}
+	case Extension:
+		return v.(Extension).Type, true
+	case ByteArrayReader:
+		return TagByteArray, true
+	case RawTag:
+		return v.(RawTag).Type, true
+	case *LazyList:
+		return TagList, true
+	}
+	return TagEnd, false
+}
+
+func (self *Encoder) write_payload(v interface{}) error {
+	switch v := v.(type) {
+	case *int8, *int16, *int32, *int64, *float32, *float64,
+		int8, int16, int32, int64, float32, float64:
+		return self.write(v)
+
+	case *string:
+		return self.write_string(*v)
+
+	case string:
+		return self.write_string(v)
+
+	case []int8:
+		if err := self.write(int32(len(v))); err != nil {
+			return err
+		}
+		return self.write(v)
+
+	case []int32:
+		if err := self.write(int32(len(v))); err != nil {
+			return err
+		}
+		return self.write(v)
+
+	case []int64:
+		if err := self.write(int32(len(v))); err != nil {
+			return err
+		}
+		return self.write(v)
+
+	case Number:
+		return self.write(v.Value())
+
+	case Extension:
+		return self.write_extension(v)
+
+	case ByteArrayReader:
+		return self.write_byte_array_reader(v)
+
+	case RawTag:
+		_, err := self.buf.Write(v.Payload)
+		return err
+
+	case *LazyList:
+		return self.write_lazy_list(v)
+
+	case *List:
+		return self.write_list(v)
+
+	case *Compound:
+		return self.write_compound(v)
+	}
+	return fmt.Errorf("Cannot encode unsupported type %T", v)
+}
+
+func (self *Encoder) write_list(l *List) error {
+	if items, ok := l.data.([]interface{}); ok {
+		return self.write_mixed_list(items)
+	}
+	if err := self.write(byte(l.list_type)); err != nil {
+		return err
+	}
+	if err := self.write(l.length); err != nil {
+		return err
+	}
+
+	switch data := l.data.(type) {
+	case nil:
+		return nil
+
+	case []*Compound:
+		for _, c := range data {
+			if err := self.write_compound(c); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case []string:
+		for _, s := range data {
+			if err := self.write_string(s); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case []int8, []int16, []int32, []int64, []float32, []float64:
+		return self.write(data)
+
+	case []*List, [][]int8, [][]int32, [][]int64, []Extension:
+		for _, item := range l.items() {
+			if err := self.write_payload(item); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("Cannot encode list \"%s\" of %T", l.name, l.data)
+}
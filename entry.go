@@ -0,0 +1,104 @@
+package nbt
+
+import (
+	"math"
+)
+
+// entry is a value stored in a Compound. Numbers are held in bits and
+// strings in str, so that storing and reading them allocates nothing, where
+// boxing them in an interface{} would allocate; arrays, lists, compounds
+// and everything else are held in ref.
+type entry struct {
+	tag TagType
+
+	// Integers as an int64, floats by their IEEE 754 bits at their own
+	// width, so that the payloads of NaNs survive.
+	bits uint64
+
+	str string
+	ref interface{}
+}
+
+// Returns the entry for v as held by the compound, which becomes the parent
+// of v if it is a list.
+func (self *Compound) hold(v interface{}) entry {
+	if l, ok := v.(*List); ok {
+		l.set_parent(self)
+	}
+	return entry_of(v)
+}
+
+// Returns the entry holding v: a plain value of one of the types returned
+// by Compound.Get, a scalar boxed in a pointer, or a Number.
+func entry_of(v interface{}) entry {
+	switch v := v.(type) {
+	case int8:
+		return entry{tag: TagByte, bits: uint64(v)}
+	case int16:
+		return entry{tag: TagShort, bits: uint64(v)}
+	case int32:
+		return entry{tag: TagInt, bits: uint64(v)}
+	case int64:
+		return entry{tag: TagLong, bits: uint64(v)}
+	case float32:
+		return entry{tag: TagFloat, bits: uint64(math.Float32bits(v))}
+	case float64:
+		return entry{tag: TagDouble, bits: math.Float64bits(v)}
+	case string:
+		return entry{tag: TagString, str: v}
+	case *int8, *int16, *int32, *int64, *float32, *float64, *string, Number:
+		return entry_of(unbox(v))
+	}
+	tag, _ := tag_of(v)
+	return entry{tag: tag, ref: v}
+}
+
+// Returns the value held, as Compound.Get returns it, or nil for the zero
+// entry a lookup of a missing key yields. A LazyList is decoded into a
+// *List.
+func (e entry) value() interface{} {
+	if l, ok := e.ref.(*LazyList); ok {
+		return l.resolve()
+	}
+	return e.stored()
+}
+
+// Returns the value held as value does, but leaves a LazyList as it is.
+func (e entry) stored() interface{} {
+	switch e.tag {
+	case TagByte:
+		return int8(e.bits)
+	case TagShort:
+		return int16(e.bits)
+	case TagInt:
+		return int32(e.bits)
+	case TagLong:
+		return int64(e.bits)
+	case TagFloat:
+		return math.Float32frombits(uint32(e.bits))
+	case TagDouble:
+		return math.Float64frombits(e.bits)
+	case TagString:
+		return e.str
+	}
+	return e.ref
+}
+
+// Returns the value of a numeric entry as a Number.
+func (e entry) number() (Number, bool) {
+	switch e.tag {
+	case TagByte, TagShort, TagInt, TagLong:
+		return Number{Type: e.tag, i: int64(e.bits)}, true
+	case TagFloat:
+		return Number{Type: TagFloat, f: float64(math.Float32frombits(uint32(e.bits)))}, true
+	case TagDouble:
+		return Number{Type: TagDouble, f: math.Float64frombits(e.bits)}, true
+	}
+	return Number{}, false
+}
+
+// Returns the compound held, if any.
+func (e entry) compound() (*Compound, bool) {
+	c, ok := e.ref.(*Compound)
+	return c, ok
+}
@@ -0,0 +1,86 @@
+package nbt
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// TagHandler reads and writes the payload of a nonstandard tag type, such as
+// the extra tag IDs some modded formats use.
+type TagHandler interface {
+	// Reads the payload of one tag, after its type and name.
+	DecodeTag(src io.Reader) (interface{}, error)
+
+	// Writes the payload of one tag, as previously returned by DecodeTag.
+	EncodeTag(dst io.Writer, v interface{}) error
+}
+
+// Extension is how a tag decoded by a registered TagHandler is stored in a
+// Compound or List. Store an Extension to have the handler encode it.
+type Extension struct {
+	Type  TagType
+	Value interface{}
+}
+
+type extension_tag struct {
+	name    string
+	handler TagHandler
+}
+
+var (
+	extensions_mu sync.RWMutex
+	extensions    = make(map[TagType]extension_tag)
+)
+
+// Registers a handler for a nonstandard tag type, so that the decoder calls
+// it instead of failing on an unknown tag ID. The name is used by
+// TagType.String and ParseTagType. It panics if the tag type is a standard
+// one or already registered.
+func RegisterTag(tag TagType, name string, handler TagHandler) {
+	extensions_mu.Lock()
+	defer extensions_mu.Unlock()
+	if known_tag(tag) {
+		panic(fmt.Sprintf("nbt: RegisterTag of standard tag type %v", tag))
+	}
+	if _, dup := extensions[tag]; dup {
+		panic(fmt.Sprintf("nbt: RegisterTag called twice for tag type %d", byte(tag)))
+	}
+	extensions[tag] = extension_tag{name, handler}
+}
+
+func lookup_extension(tag TagType) (extension_tag, bool) {
+	extensions_mu.RLock()
+	defer extensions_mu.RUnlock()
+	ext, ok := extensions[tag]
+	return ext, ok
+}
+
+// Reads the payload of an extension tag. The handler's reads count against
+// MaxBytes like any others: it sees the input end where the limit runs out.
+func (self *Decoder) read_extension(tag TagType) (Extension, error) {
+	ext, ok := lookup_extension(tag)
+	if !ok {
+		return Extension{}, fmt.Errorf("Unknown type: %v", tag)
+	}
+	var src io.Reader = self.r
+	if self.MaxBytes > 0 {
+		src = &io.LimitedReader{R: self.r, N: self.MaxBytes - (self.r.n - self.start)}
+	}
+	v, err := ext.handler.DecodeTag(src)
+	if err != nil && self.MaxBytes > 0 && self.r.n-self.start >= self.MaxBytes {
+		return Extension{}, ErrTooLarge
+	}
+	return Extension{tag, v}, err
+}
+
+func (self *Encoder) write_extension(v Extension) error {
+	ext, ok := lookup_extension(v.Type)
+	if !ok {
+		return fmt.Errorf("Cannot encode unregistered tag type %v", v.Type)
+	}
+	if err := self.buf.Flush(); err != nil {
+		return err
+	}
+	return ext.handler.EncodeTag(self.w, v.Value)
+}
@@ -0,0 +1,233 @@
+package nbt
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Compression is the compression scheme wrapping an NBT document.
+type Compression int
+
+const (
+	Uncompressed Compression = iota
+	Gzip
+	Zlib
+)
+
+func (self Compression) String() string {
+	switch self {
+	case Uncompressed:
+		return "uncompressed"
+	case Gzip:
+		return "gzip"
+	case Zlib:
+		return "zlib"
+	}
+	return fmt.Sprintf("Compression(%d)", int(self))
+}
+
+// Format describes how an NBT document is stored.
+type Format struct {
+	Compression Compression
+
+	// binary.BigEndian for Java Edition, binary.LittleEndian for Bedrock
+	// Edition.
+	ByteOrder binary.ByteOrder
+
+	// Bedrock Edition's level.dat starts with an 8 byte header holding a
+	// storage version and the length of the document, both as little endian
+	// int32s. Header reports whether the header is present and
+	// HeaderVersion holds the storage version.
+	Header        bool
+	HeaderVersion int32
+}
+
+func (self Format) String() string {
+	edition := "Java Edition (big endian)"
+	if self.ByteOrder == binary.LittleEndian {
+		edition = "Bedrock Edition (little endian)"
+		if self.Header {
+			edition = fmt.Sprintf("Bedrock Edition (little endian, header version %d)", self.HeaderVersion)
+		}
+	}
+	return fmt.Sprintf("%s %s", self.Compression, edition)
+}
+
+// Reads and decodes an NBT file of any supported format. See DecodeAny.
+func DecodeFile(path string) (*Compound, Format, error) {
+	return DecodeOptions{}.DecodeFile(path)
+}
+
+// Decodes an NBT document whose format is not known in advance. Gzip and
+// zlib compression are detected by their magic numbers, and Java Edition
+// (big endian) and Bedrock Edition (little endian, with or without the
+// level.dat header) documents by checking which interpretation is
+// structurally valid.
+func DecodeAny(data []byte) (*Compound, Format, error) {
+	return decode_any(data, DecodeOptions{})
+}
+
+func decode_any(data []byte, opts DecodeOptions) (*Compound, Format, error) {
+	var f Format
+	var err error
+
+	switch {
+	case len(data) >= 2 && data[0] == 0x1f && data[1] == 0x8b:
+		f.Compression = Gzip
+		var r *gzip.Reader
+		if r, err = gzip.NewReader(bytes.NewReader(data)); err == nil {
+			data, err = ioutil.ReadAll(r)
+		}
+
+	case len(data) >= 2 && data[0]&0x0f == 8 && (uint(data[0])<<8|uint(data[1]))%31 == 0:
+		f.Compression = Zlib
+		var r io.ReadCloser
+		if r, err = zlib.NewReader(bytes.NewReader(data)); err == nil {
+			data, err = ioutil.ReadAll(r)
+		}
+	}
+	if err != nil {
+		return nil, f, err
+	}
+
+	f.ByteOrder = binary.BigEndian
+	switch {
+	case valid(data, binary.BigEndian):
+
+	case valid(data, binary.LittleEndian):
+		f.ByteOrder = binary.LittleEndian
+
+	case len(data) >= 8 && int64(binary.LittleEndian.Uint32(data[4:])) == int64(len(data)-8):
+		f.ByteOrder = binary.LittleEndian
+		f.Header = true
+		f.HeaderVersion = int32(binary.LittleEndian.Uint32(data))
+		data = data[8:]
+	}
+
+	opts.ByteOrder = f.ByteOrder
+	c, err := opts.DecodeBytes(data)
+	return c, f, err
+}
+
+// Encodes a compound in the given format, the counterpart of DecodeAny. A
+// nil ByteOrder means big endian.
+func EncodeFormat(dst io.Writer, c *Compound, f Format) error {
+	return encode_format(dst, c, f, EncodeOptions{})
+}
+
+func encode_format(dst io.Writer, c *Compound, f Format, opts EncodeOptions) error {
+	var w io.WriteCloser
+	switch f.Compression {
+	case Uncompressed:
+		w = nop_closer{dst}
+	case Gzip:
+		w = gzip.NewWriter(dst)
+	case Zlib:
+		w = zlib.NewWriter(dst)
+	default:
+		return fmt.Errorf("Unsupported compression: %v", f.Compression)
+	}
+
+	out := io.Writer(w)
+	buf := new(bytes.Buffer)
+	if f.Header {
+		// the header holds the document's length, so it has to be
+		// encoded first
+		out = buf
+	}
+	if f.ByteOrder != nil {
+		opts.ByteOrder = f.ByteOrder
+	}
+	if err := opts.Encode(out, c); err != nil {
+		w.Close()
+		return err
+	}
+	if f.Header {
+		header := make([]byte, 8)
+		binary.LittleEndian.PutUint32(header, uint32(f.HeaderVersion))
+		binary.LittleEndian.PutUint32(header[4:], uint32(buf.Len()))
+		if _, err := w.Write(header); err != nil {
+			return err
+		}
+		if _, err := buf.WriteTo(w); err != nil {
+			return err
+		}
+	}
+	return w.Close()
+}
+
+// Encodes a compound in the given format into the named file, the
+// counterpart of DecodeFile. The file is replaced atomically: the document
+// is written to a temporary file in the same directory, which is synced to
+// disk and then renamed over the target, so that a crash or a failed
+// encoding never leaves a truncated level.dat behind. Where the system
+// allows it, the directory is synced as well so that the rename itself
+// survives a crash. The new file keeps the permissions of the one it
+// replaces, or gets 0644. If the path is a symbolic link, the file it
+// points to is replaced.
+func EncodeFile(path string, c *Compound, f Format) error {
+	return EncodeOptions{}.EncodeFile(path, c, f)
+}
+
+// Replaces the named file with what write writes, as EncodeFile does.
+func replace_file(path string, write func(w io.Writer) error) (err error) {
+	mode := os.FileMode(0644)
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSymlink != 0 {
+			if path, err = filepath.EvalSymlinks(path); err != nil {
+				return err
+			}
+			if info, err = os.Stat(path); err != nil {
+				return err
+			}
+		}
+		mode = info.Mode().Perm()
+	}
+
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	w := bufio.NewWriter(tmp)
+	if err = write(w); err != nil {
+		return err
+	}
+	if err = w.Flush(); err != nil {
+		return err
+	}
+	if err = tmp.Chmod(mode); err != nil {
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	return sync_dir(dir)
+}
+
+type nop_closer struct {
+	io.Writer
+}
+
+func (nop_closer) Close() error { return nil }
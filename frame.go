@@ -0,0 +1,154 @@
+package nbt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// FramePrefix is the kind of length prefix in front of an NBT document sent
+// in a Minecraft packet or plugin message.
+type FramePrefix int
+
+const (
+	// A VarInt: the length in groups of 7 bits, least significant first,
+	// with the high bit set on all but the last of at most 5 bytes.
+	VarIntPrefix FramePrefix = iota
+
+	// A big endian int32.
+	Int32Prefix
+)
+
+// Limits the vanilla client and server put on NBT read from the network.
+const (
+	NetworkMaxBytes = 2097152
+	NetworkMaxDepth = 512
+)
+
+// Returns options that decode with the limits the vanilla game puts on NBT
+// read from the network, for data from untrusted peers. Vanilla counts
+// roughly the memory taken by the decoded tags against its size limit,
+// while MaxBytes counts bytes of input; the two are close for most data.
+func NetworkDecodeOptions() DecodeOptions {
+	return DecodeOptions{MaxBytes: NetworkMaxBytes, MaxDepth: NetworkMaxDepth}
+}
+
+// Reads a frame made of a length prefix and that many bytes holding one
+// uncompressed NBT document, and decodes the document. It returns io.EOF if
+// r is at its end before the frame starts. Frames longer than
+// max bytes, if max is positive, fail with ErrTooLarge before anything is
+// read or allocated for them, as do documents that do not fill their frame
+// exactly. The options given are used for decoding; their MaxBytes is
+// replaced by the length of the frame.
+func ReadFramed(r io.Reader, prefix FramePrefix, max int, opts DecodeOptions) (*Compound, error) {
+	var n int64
+	switch prefix {
+	case VarIntPrefix:
+		v, err := read_varint(r)
+		if err != nil {
+			return nil, err
+		}
+		n = int64(v)
+	case Int32Prefix:
+		var v int32
+		if err := binary.Read(r, binary.BigEndian, &v); err != nil {
+			if err == io.EOF {
+				return nil, io.EOF
+			}
+			return nil, frame_error(err)
+		}
+		n = int64(v)
+	default:
+		return nil, fmt.Errorf("Invalid frame prefix %d", prefix)
+	}
+	if n < 0 {
+		return nil, fmt.Errorf("%w: frame of %d bytes", ErrInvalidLength, n)
+	}
+	if max > 0 && n > int64(max) {
+		return nil, fmt.Errorf("%w: frame of %d bytes", ErrTooLarge, n)
+	}
+
+	data := make([]byte, n)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, frame_error(err)
+	}
+	dec := NewDecoder(bytes.NewReader(data))
+	dec.DecodeOptions = opts
+	dec.MaxBytes = n
+	c, err := dec.Decode()
+	if err == io.EOF {
+		err = ErrTruncated
+	}
+	if err != nil {
+		return nil, err
+	}
+	if dec.r.n != n {
+		return nil, fmt.Errorf("%d bytes left over after the document in its frame", n-dec.r.n)
+	}
+	return c, nil
+}
+
+// Encodes the compound as an uncompressed NBT document and writes it as a
+// frame, with the given length prefix. It fails with ErrTooLarge without
+// writing anything if the document is longer than max bytes, if max is
+// positive. The options given are used for encoding.
+func WriteFramed(w io.Writer, c *Compound, prefix FramePrefix, max int, opts EncodeOptions) error {
+	buf := new(bytes.Buffer)
+	enc := NewEncoder(buf)
+	enc.EncodeOptions = opts
+	if err := enc.Encode(c); err != nil {
+		return err
+	}
+	if max > 0 && buf.Len() > max {
+		return fmt.Errorf("%w: frame of %d bytes", ErrTooLarge, buf.Len())
+	}
+
+	var head []byte
+	switch prefix {
+	case VarIntPrefix:
+		for n := uint32(buf.Len()); ; n >>= 7 {
+			if n < 0x80 {
+				head = append(head, byte(n))
+				break
+			}
+			head = append(head, byte(n)|0x80)
+		}
+	case Int32Prefix:
+		head = binary.BigEndian.AppendUint32(nil, uint32(buf.Len()))
+	default:
+		return fmt.Errorf("Invalid frame prefix %d", prefix)
+	}
+	if _, err := w.Write(head); err != nil {
+		return err
+	}
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// Reads a VarInt, one byte at a time so as not to read past it.
+func read_varint(r io.Reader) (int32, error) {
+	var v uint32
+	var b [1]byte
+	for i := 0; i < 5; i++ {
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			if i == 0 && err == io.EOF {
+				return 0, io.EOF
+			}
+			return 0, frame_error(err)
+		}
+		v |= uint32(b[0]&0x7f) << (7 * i)
+		if b[0]&0x80 == 0 {
+			return int32(v), nil
+		}
+	}
+	return 0, errors.New("VarInt longer than 5 bytes")
+}
+
+func frame_error(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrTruncated
+	}
+	return err
+}
@@ -0,0 +1,46 @@
+package nbt
+
+// Returns a read-only deep copy of the compound, with the digests of its
+// compounds and lists computed and cached (see Hash). Every mutating method
+// returns ErrFrozen when called on it or on any compound or list inside it:
+// Set and SetPath, Attach and Detach, ReadFrom, UnmarshalJSON and Update,
+// and the Sort, Swap and Move methods of the lists, as does Upgrade. It can
+// thus be shared without fear of accidental modification. Arrays and the contents
+// of lists are returned by the accessors as they are stored and must not be
+// modified in place.
+//
+// Freezing a frozen compound returns it as is.
+func (self *Compound) Freeze() *Compound {
+	if self.frozen {
+		return self
+	}
+	c := copy_value(self, nil).(*Compound)
+	freeze(c)
+	// the digests are cached now, before the tree can be shared, so that
+	// Hash only reads them afterwards
+	c.Hash()
+	return c
+}
+
+// Reports whether the compound belongs to a tree returned by Freeze.
+func (self *Compound) Frozen() bool {
+	return self.frozen
+}
+
+func freeze(v interface{}) {
+	switch v := v.(type) {
+	case *Compound:
+		v.frozen = true
+		for _, child := range v.data {
+			freeze(child.ref)
+		}
+	case *List:
+		v.frozen = true
+		switch v.data.(type) {
+		case []*Compound, []*List, []interface{}:
+			for _, item := range v.items() {
+				freeze(item)
+			}
+		}
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package nbt
+
+// Directories cannot be synced here; renaming is as durable as it gets.
+func sync_dir(dir string) error {
+	return nil
+}
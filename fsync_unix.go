@@ -0,0 +1,19 @@
+//go:build unix
+
+package nbt
+
+import "os"
+
+// Syncs a directory, so that files created in it or renamed into it
+// survive a crash.
+func sync_dir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	err = d.Sync()
+	if cerr := d.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,132 @@
+package nbt
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"math"
+)
+
+// Hash is a SHA-256 digest of a compound or list's contents.
+type Hash [sha256.Size]byte
+
+// Returns a digest of the compound's entries, which equals that of another
+// compound exactly when Equal reports the two as equal (barring hash
+// collisions). The compound's own name is not part of it. Each nested
+// compound and list is hashed separately and contributes its digest, like a
+// Merkle tree.
+//
+// The digests of a frozen tree are computed by Freeze and cached in each
+// compound and list, so that hashing it again is free and Diff and Equal can
+// skip identical subtrees of two frozen trees in constant time, from any
+// number of goroutines. Digests of other trees are computed anew on each
+// call, since they could change.
+func (self *Compound) Hash() Hash {
+	if self.hash != nil {
+		return *self.hash
+	}
+	h := sha256.New()
+	write_hash_int(h, TagCompound, int64(len(self.data)))
+	for _, k := range self.sorted_keys() {
+		write_hash_int(h, TagString, int64(len(k)))
+		h.Write([]byte(k))
+		write_hash_value(h, self.data[k].value())
+	}
+	return cache_hash(h, &self.hash, self.frozen)
+}
+
+// Returns a digest of the list's element type and elements. See
+// Compound.Hash.
+func (self *List) Hash() Hash {
+	if self.hash != nil {
+		return *self.hash
+	}
+	h := sha256.New()
+	elem := self.list_type
+	if self.IsMixed() {
+		elem = TagEnd
+	}
+	write_hash_int(h, elem, int64(self.Len()))
+	for _, item := range self.items() {
+		write_hash_value(h, item)
+	}
+	return cache_hash(h, &self.hash, self.frozen)
+}
+
+// Returns the digest written to h, and caches it if the compound or list is
+// frozen. Only Freeze gets here for a frozen tree, which has its digests
+// cached from then on.
+func cache_hash(h hash.Hash, cache **Hash, frozen bool) Hash {
+	var sum Hash
+	h.Sum(sum[:0])
+	if frozen {
+		*cache = &sum
+	}
+	return sum
+}
+
+// Writes a tag type followed by a number.
+func write_hash_int(h hash.Hash, tag TagType, n int64) {
+	var b [9]byte
+	b[0] = byte(tag)
+	binary.BigEndian.PutUint64(b[1:], uint64(n))
+	h.Write(b[:])
+}
+
+func write_hash_value(h hash.Hash, v interface{}) {
+	switch v := v.(type) {
+	case int8:
+		write_hash_int(h, TagByte, int64(v))
+	case int16:
+		write_hash_int(h, TagShort, int64(v))
+	case int32:
+		write_hash_int(h, TagInt, int64(v))
+	case int64:
+		write_hash_int(h, TagLong, v)
+	case float32:
+		write_hash_int(h, TagFloat, int64(math.Float32bits(v)))
+	case float64:
+		write_hash_int(h, TagDouble, int64(math.Float64bits(v)))
+	case string:
+		write_hash_int(h, TagString, int64(len(v)))
+		h.Write([]byte(v))
+	case []int8:
+		write_hash_int(h, TagByteArray, int64(len(v)))
+		binary.Write(h, binary.BigEndian, v)
+	case []int32:
+		write_hash_int(h, TagIntArray, int64(len(v)))
+		binary.Write(h, binary.BigEndian, v)
+	case []int64:
+		write_hash_int(h, TagLongArray, int64(len(v)))
+		binary.Write(h, binary.BigEndian, v)
+	case *Compound:
+		sum := v.Hash()
+		h.Write([]byte{byte(TagCompound)})
+		h.Write(sum[:])
+	case *List:
+		sum := v.Hash()
+		h.Write([]byte{byte(TagList)})
+		h.Write(sum[:])
+	default:
+		tag, _ := tag_of(v)
+		s := fmt.Sprintf("%#v", v)
+		write_hash_int(h, tag, int64(len(s)))
+		h.Write([]byte(s))
+	}
+}
+
+// Reports whether two compounds or lists are known to be equal without
+// comparing them entry by entry: they are the same one, as in a tree and
+// its clone, or both are frozen and have the same digest.
+func same_subtree(a, b interface{}) bool {
+	switch a := a.(type) {
+	case *Compound:
+		b := b.(*Compound)
+		return a == b || a.frozen && b.frozen && a.Hash() == b.Hash()
+	case *List:
+		b := b.(*List)
+		return a == b || a.frozen && b.frozen && a.Hash() == b.Hash()
+	}
+	return false
+}
@@ -0,0 +1,427 @@
+package nbt
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// OpKind is the kind of an Op.
+type OpKind uint8
+
+const (
+	OpSet OpKind = iota + 1
+	OpDelete
+	OpAppend
+)
+
+func (self OpKind) String() string {
+	switch self {
+	case OpSet:
+		return "set"
+	case OpDelete:
+		return "delete"
+	case OpAppend:
+		return "append"
+	}
+	return fmt.Sprintf("OpKind(%d)", uint8(self))
+}
+
+// Op is one operation made through an EditSession: a value set at Path, the
+// entry or element at Path deleted, or a value appended to the list or
+// array at Path. Value is nil for OpDelete, and otherwise a copy of the
+// value as given, with Numbers replaced by their plain values.
+type Op struct {
+	Kind  OpKind
+	Path  Path
+	Value interface{}
+}
+
+func (self Op) String() string {
+	if self.Kind == OpDelete {
+		return fmt.Sprintf("%v %v", self.Kind, self.Path)
+	}
+	return fmt.Sprintf("%v %v %s", self.Kind, self.Path, change_value(self.Value))
+}
+
+// EditSession records the operations made to a compound through it, so
+// that they can be undone and redone, as an interactive editor needs. For
+// each operation it keeps what reverts it: a copy of the value the operation
+// replaced or removed, or the place of the value it added. What a session
+// holds thus grows with the values changed, not with the document. The
+// compound keeps its identity, and is changed in place by Undo and Redo.
+// It should be modified only through the session while the session is in
+// use, since undoing an operation puts back what was there when it was
+// made.
+type EditSession struct {
+	c      *Compound
+	done   []edit
+	undone []Op
+}
+
+// An operation made, with the change that reverts it.
+type edit struct {
+	op   Op
+	undo revert
+}
+
+// Starts recording the operations made to c.
+func NewEditSession(c *Compound) *EditSession {
+	return &EditSession{c: c}
+}
+
+// Returns the document being edited.
+func (self *EditSession) Compound() *Compound { return self.c }
+
+// Sets the value at the path, as Compound.Set does.
+func (self *EditSession) Set(path Path, v interface{}) error {
+	if n, ok := v.(Number); ok {
+		v = n.Value()
+	}
+	return self.Apply(Op{Kind: OpSet, Path: path, Value: v})
+}
+
+// Removes the compound entry or the element of a list or array at the path.
+// Later elements move down by one. The error wraps ErrNotFound if there is
+// nothing there.
+func (self *EditSession) Delete(path Path) error {
+	return self.Apply(Op{Kind: OpDelete, Path: path})
+}
+
+// Appends v to the list or array at the path. It must be of the list's
+// element type, or of the array's element type (int8 for a byte array and
+// so on), unless the list is empty and has no element type yet.
+func (self *EditSession) Append(path Path, v interface{}) error {
+	if n, ok := v.(Number); ok {
+		v = n.Value()
+	}
+	return self.Apply(Op{Kind: OpAppend, Path: path, Value: v})
+}
+
+// Makes an operation, such as one from the Log of another session, and
+// records it. Anything undone is then forgotten. Nothing is recorded if the
+// operation fails, which leaves the document as it was.
+func (self *EditSession) Apply(op Op) error {
+	op.Value = copy_value(op.Value, nil)
+	undo, err := apply_op(self.c, op.Kind, op.Path, copy_value(op.Value, nil))
+	if err != nil {
+		return err
+	}
+	self.done = append(self.done, edit{op, undo})
+	self.undone = nil
+	return nil
+}
+
+// Reports whether there is an operation to undo.
+func (self *EditSession) CanUndo() bool { return len(self.done) > 0 }
+
+// Reports whether there is an undone operation to redo.
+func (self *EditSession) CanRedo() bool { return len(self.undone) > 0 }
+
+// Reverts the last operation not undone yet. It reports whether there was
+// one that could be reverted; one cannot only if the document was changed
+// behind the session's back.
+func (self *EditSession) Undo() bool {
+	if len(self.done) == 0 {
+		return false
+	}
+	e := self.done[len(self.done)-1]
+	if e.undo.apply(self.c) != nil {
+		return false
+	}
+	self.done = self.done[:len(self.done)-1]
+	self.undone = append(self.undone, e.op)
+	return true
+}
+
+// Makes the last undone operation again. It reports whether there was one
+// that could be made.
+func (self *EditSession) Redo() bool {
+	if len(self.undone) == 0 {
+		return false
+	}
+	op := self.undone[len(self.undone)-1]
+	undo, err := apply_op(self.c, op.Kind, op.Path, copy_value(op.Value, nil))
+	if err != nil {
+		return false
+	}
+	self.undone = self.undone[:len(self.undone)-1]
+	self.done = append(self.done, edit{op, undo})
+	return true
+}
+
+// Returns the operations made and not undone, in order. Applied to a copy
+// of the document as it was when the session started, they give the
+// document as it is now.
+func (self *EditSession) Log() []Op {
+	ops := make([]Op, len(self.done))
+	for i, e := range self.done {
+		ops[i] = e.op
+	}
+	return ops
+}
+
+// A change that reverts an operation: the value at path removed if value is
+// nil, and put back otherwise, in place or, for an element removed from a
+// list or array, by inserting it.
+type revert struct {
+	path   Path
+	value  interface{}
+	insert bool
+}
+
+// Makes an operation on c, with v stored as it is, and returns the change
+// that reverts it.
+func apply_op(c *Compound, kind OpKind, path Path, v interface{}) (revert, error) {
+	switch kind {
+	case OpSet, OpDelete:
+		path = absolute_path(c, path)
+		undo := revert{path: path}
+		if old, err := c.Get(path); err == nil && len(path) > 0 {
+			undo.value = copy_value(old, nil)
+		}
+		if kind == OpSet {
+			return undo, c.Set(path, v)
+		}
+		undo.insert = len(path) > 0 && path[len(path)-1].IsIndex
+		return undo, session_delete(c, path)
+
+	case OpAppend:
+		target, err := c.Get(path)
+		if err != nil {
+			return revert{}, fmt.Errorf("%v: %w", path, err)
+		}
+		end := PathElem{Index: elem_count(target), IsIndex: true}
+		undo := revert{path: append(path[:len(path):len(path)], end)}
+		return undo, session_append(c, path, v)
+	}
+	return revert{}, fmt.Errorf("Unknown operation %v", kind)
+}
+
+// Makes the change.
+func (self revert) apply(c *Compound) error {
+	switch {
+	case self.value == nil:
+		return session_delete(c, self.path)
+	case self.insert:
+		return session_insert(c, self.path, self.value)
+	}
+	return c.Set(self.path, self.value)
+}
+
+// Returns the path with a negative index in its last step replaced by the
+// index it stands for now, counted from the end of the list or array.
+func absolute_path(c *Compound, path Path) Path {
+	if len(path) == 0 || !path[len(path)-1].IsIndex || path[len(path)-1].Index >= 0 {
+		return path
+	}
+	target, err := c.Get(path[:len(path)-1])
+	if err != nil {
+		return path
+	}
+	abs := append(Path(nil), path...)
+	abs[len(abs)-1].Index += elem_count(target)
+	return abs
+}
+
+// Returns the number of elements of a list or array, and 0 for anything
+// else.
+func elem_count(v interface{}) int {
+	switch v := v.(type) {
+	case *List:
+		return v.Len()
+	case []int8:
+		return len(v)
+	case []int32:
+		return len(v)
+	case []int64:
+		return len(v)
+	}
+	return 0
+}
+
+// Removes the compound entry or list or array element at the path.
+func session_delete(c *Compound, path Path) error {
+	if len(path) == 0 {
+		return errors.New("Cannot delete the root compound")
+	}
+	if err := c.writable(); err != nil {
+		return err
+	}
+	parent, err := c.own_path(path[:len(path)-1])
+	if err != nil {
+		return err
+	}
+	last := path[len(path)-1]
+	if !last.IsIndex {
+		p, ok := parent.(*Compound)
+		if !ok {
+			return fmt.Errorf("%v: %v is not a compound", path, TypeOf(parent))
+		}
+		e, ok := p.data[last.Key]
+		if !ok {
+			return fmt.Errorf("%v: %w", path, ErrNotFound)
+		}
+		if child, ok := e.ref.(*Compound); ok && child.parent == p {
+			// a compound still shared with a clone keeps its parent there
+			child.parent = nil
+		}
+		delete(p.data, last.Key)
+		return nil
+	}
+
+	var items reflect.Value
+	switch p := parent.(type) {
+	case *List:
+		if p.data != nil {
+			items = reflect.ValueOf(p.data)
+		}
+	case []int8, []int32, []int64:
+		items = reflect.ValueOf(p)
+	default:
+		return fmt.Errorf("%v: %v is not a list or array", path, TypeOf(parent))
+	}
+	i := last.Index
+	if items.IsValid() && i < 0 {
+		i += items.Len()
+	}
+	if !items.IsValid() || i < 0 || i >= items.Len() {
+		return fmt.Errorf("%v: %w", path, ErrNotFound)
+	}
+	rest := reflect.MakeSlice(items.Type(), 0, items.Len()-1)
+	rest = reflect.AppendSlice(rest, items.Slice(0, i))
+	rest = reflect.AppendSlice(rest, items.Slice(i+1, items.Len()))
+	if l, ok := parent.(*List); ok {
+		l.data = rest.Interface()
+		l.length--
+		return nil
+	}
+	return c.Set(path[:len(path)-1], rest.Interface())
+}
+
+// Appends v to the list or array at the path. v is converted as Set
+// converts values, and a LazyList or RawTag is decoded.
+func session_append(c *Compound, path Path, v interface{}) error {
+	if err := c.writable(); err != nil {
+		return err
+	}
+	v, err := list_item(v)
+	if err != nil {
+		return fmt.Errorf("%v: %w", path, err)
+	}
+	tag, ok := tag_of(v)
+	if !ok {
+		return fmt.Errorf("%v: cannot store %T", path, v)
+	}
+	target, err := c.own_path(path)
+	if err != nil {
+		return err
+	}
+	switch t := target.(type) {
+	case *List:
+		list_type := t.list_type
+		empty := list_type == TagEnd && t.Len() == 0
+		if empty {
+			list_type = tag
+		}
+		if !t.IsMixed() && tag != list_type {
+			return fmt.Errorf("%v: cannot store %v in a list of %v", path, tag, list_type)
+		}
+		var elem reflect.Type
+		if t.data != nil && !empty {
+			elem = reflect.TypeOf(t.data).Elem()
+		} else {
+			elem = list_elem_type(list_type)
+		}
+		if elem == nil || !reflect.TypeOf(v).AssignableTo(elem) {
+			return fmt.Errorf("%v: cannot store %T in a list of %v", path, v, list_type)
+		}
+		if t.data == nil || empty {
+			t.data = reflect.MakeSlice(reflect.SliceOf(elem), 0, 1).Interface()
+		}
+		t.list_type = list_type
+		holder := t.parent
+		if holder == nil {
+			holder = c
+		}
+		if child, ok := v.(*Compound); ok {
+			child.parent = holder
+		}
+		holder.adopt(v)
+		t.data = reflect.Append(reflect.ValueOf(t.data), reflect.ValueOf(v)).Interface()
+		t.length++
+		return nil
+	case []int8:
+		if n, ok := v.(int8); ok {
+			return c.Set(path, append(t[:len(t):len(t)], n))
+		}
+	case []int32:
+		if n, ok := v.(int32); ok {
+			return c.Set(path, append(t[:len(t):len(t)], n))
+		}
+	case []int64:
+		if n, ok := v.(int64); ok {
+			return c.Set(path, append(t[:len(t):len(t)], n))
+		}
+	default:
+		return fmt.Errorf("%v: %v is not a list or array", path, TypeOf(target))
+	}
+	return fmt.Errorf("%v: cannot store %v in a %v", path, tag, TypeOf(target))
+}
+
+// Returns v as a list holds it: a plain value, with a LazyList or RawTag
+// decoded. A ByteArrayReader, which can be read only once, is refused.
+func list_item(v interface{}) (interface{}, error) {
+	switch v := unbox(v).(type) {
+	case *LazyList:
+		return v.List()
+	case RawTag:
+		return v.Value()
+	case ByteArrayReader:
+		return nil, errors.New("A ByteArrayReader cannot be stored in a list")
+	default:
+		return v, nil
+	}
+}
+
+// Returns the Go type of the elements of a list of tag, or nil if there is
+// none.
+func list_elem_type(tag TagType) reflect.Type {
+	if t, ok := list_elem_types[tag]; ok {
+		return t
+	}
+	if _, ok := lookup_extension(tag); ok {
+		return reflect.TypeOf(Extension{})
+	}
+	return nil
+}
+
+// Inserts v into the list or array at all but the last step of path, at the
+// index of the last step, moving the elements from there up by one.
+func session_insert(c *Compound, path Path, v interface{}) error {
+	list, i := path[:len(path)-1], path[len(path)-1].Index
+	target, err := c.Get(list)
+	if err != nil {
+		return fmt.Errorf("%v: %w", list, err)
+	}
+	if n := elem_count(target); i < 0 || i > n {
+		return fmt.Errorf("%v: %w", path, ErrNotFound)
+	}
+	if err := session_append(c, list, v); err != nil {
+		return err
+	}
+	if target, err = c.Get(list); err != nil {
+		return err
+	}
+	var items reflect.Value
+	if l, ok := target.(*List); ok {
+		items = reflect.ValueOf(l.data)
+	} else {
+		items = reflect.ValueOf(target)
+	}
+	n := items.Len() - 1
+	last := reflect.ValueOf(items.Index(n).Interface())
+	reflect.Copy(items.Slice(i+1, n+1), items.Slice(i, n))
+	items.Index(i).Set(last)
+	return nil
+}
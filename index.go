@@ -0,0 +1,79 @@
+package nbt
+
+// PathIndex maps the paths of all values in a compound to the values, for
+// programs that look up many paths in the same tree, as returned by
+// Compound.Index. Every compound entry and list element is indexed;
+// elements of arrays and of LazyLists are found through them.
+//
+// The index is a snapshot: values stored into the tree after it was built
+// are not seen, and removed ones still are, so it is best built from a
+// tree that no longer changes, such as a frozen one. Values are those in
+// the tree, so compounds and lists found in the index are live. A PathIndex
+// is safe for concurrent use.
+type PathIndex struct {
+	values map[string]interface{}
+}
+
+// Builds an index of the compound's values. See PathIndex.
+func (self *Compound) Index() *PathIndex {
+	index := &PathIndex{values: make(map[string]interface{})}
+	index.add(nil, self)
+	return index
+}
+
+func (self *PathIndex) add(path Path, v interface{}) {
+	self.values[path.String()] = v
+	switch v := v.(type) {
+	case *Compound:
+		for k, child := range v.data {
+			self.add(extend_path(path, PathElem{Key: k}), child.stored())
+		}
+	case *List:
+		for i, item := range v.items() {
+			self.add(extend_path(path, PathElem{Index: i, IsIndex: true}), item)
+		}
+	}
+}
+
+// Returns the number of values in the index, the root included.
+func (self *PathIndex) Len() int { return len(self.values) }
+
+// Returns the value at the path, as Compound.Get would have when the index
+// was built, and whether there was one.
+func (self *PathIndex) Get(path Path) (interface{}, bool) {
+	if v, ok := self.values[path.String()]; ok {
+		return v, true
+	}
+
+	// negative indices, and values inside arrays and LazyLists, are not
+	// indexed themselves: step to them from the longest indexed prefix
+	for i := len(path) - 1; i >= 0; i-- {
+		v, ok := self.values[path[:i].String()]
+		if !ok {
+			continue
+		}
+		for _, elem := range path[i:] {
+			next, err := path_step(v, elem)
+			if err != nil {
+				return nil, false
+			}
+			v = next
+		}
+		return v, true
+	}
+	return nil, false
+}
+
+// Returns the value at a path given in its text form, as GetPath would
+// have when the index was built, and whether there was one. Paths that are
+// not valid have none.
+func (self *PathIndex) GetPath(path string) (interface{}, bool) {
+	if v, ok := self.values[path]; ok {
+		return v, true
+	}
+	p, err := ParsePath(path)
+	if err != nil {
+		return nil, false
+	}
+	return self.Get(p)
+}
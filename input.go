@@ -0,0 +1,260 @@
+package nbt
+
+import (
+	"io"
+	"math"
+)
+
+// The reads below are shared by Decode, the Token API and DecodeValue.
+
+// Returns the next n bytes of input, which stay valid until the next call.
+func (self *Decoder) next(n int) ([]byte, error) {
+	if cap(self.scratch) < n {
+		if n > read_chunk && !self.bounded() {
+			return self.next_chunked(n)
+		}
+		self.scratch = make([]byte, n)
+	}
+	b := self.scratch[:n]
+	if _, err := io.ReadFull(self.r, b); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, ErrTruncated
+		}
+		return nil, err
+	}
+	return b, nil
+}
+
+// How much of a long payload next reads at a time when the input might end
+// before it does.
+const read_chunk = 64 << 10
+
+// Reads n bytes as next does, growing the buffer as they arrive, so that
+// input that ends early fails before much is allocated for it.
+func (self *Decoder) next_chunked(n int) ([]byte, error) {
+	b := self.scratch[:0]
+	for len(b) < n {
+		k := len(b)
+		if k < read_chunk {
+			k = read_chunk
+		}
+		if k > n-len(b) {
+			k = n - len(b)
+		}
+		b = append(b, make([]byte, k)...)
+		if _, err := io.ReadFull(self.r, b[len(b)-k:]); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return nil, ErrTruncated
+			}
+			return nil, err
+		}
+	}
+	self.scratch = b
+	return b, nil
+}
+
+// Reads an integer of size bytes.
+func (self *Decoder) next_int(size int) (int64, error) {
+	b, err := self.next(size)
+	if err != nil {
+		return 0, err
+	}
+	order := self.byte_order()
+	switch size {
+	case 1:
+		return int64(int8(b[0])), nil
+	case 2:
+		return int64(int16(order.Uint16(b))), nil
+	case 4:
+		return int64(int32(order.Uint32(b))), nil
+	}
+	return int64(order.Uint64(b)), nil
+}
+
+// Reads a length prefix of size bytes counting elements of at least
+// elem_size bytes.
+func (self *Decoder) next_length(size int, elem_size int64) (int, error) {
+	n, err := self.next_int(size)
+	if err != nil {
+		return 0, err
+	}
+	if size == 2 {
+		// string lengths are unsigned
+		n = int64(uint16(n))
+	}
+	return self.check_length(n, elem_size)
+}
+
+// Reads a string and returns its bytes, which stay valid until the next
+// read.
+func (self *Decoder) next_string() ([]byte, error) {
+	n, err := self.next_length(2, 1)
+	if err != nil {
+		return nil, err
+	}
+	b, err := self.next(n)
+	if err != nil {
+		return nil, err
+	}
+	return join_surrogates(b), nil
+}
+
+// Skips the payload of a tag.
+func (self *Decoder) skip(tag TagType) error {
+	if size := fixed_size(tag); size > 0 {
+		return self.discard(size)
+	}
+	switch tag {
+	case TagString:
+		n, err := self.next_length(2, 1)
+		if err != nil {
+			return err
+		}
+		return self.discard(int64(n))
+
+	case TagByteArray, TagIntArray, TagLongArray:
+		elem := fixed_size(array_elem(tag))
+		n, err := self.next_length(4, elem)
+		if err != nil {
+			return err
+		}
+		return self.discard(int64(n) * elem)
+
+	case TagList:
+		if err := self.enter(); err != nil {
+			return err
+		}
+		defer self.leave()
+		b, err := self.next(1)
+		if err != nil {
+			return err
+		}
+		elem := TagType(b[0])
+		n, err := self.next_length(4, min_size(elem))
+		if err != nil {
+			return err
+		}
+		if size := fixed_size(elem); size > 0 {
+			return self.discard(int64(n) * size)
+		}
+		for i := 0; i < n; i++ {
+			if err := self.skip(elem); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case TagCompound:
+		if err := self.enter(); err != nil {
+			return err
+		}
+		defer self.leave()
+		for {
+			b, err := self.next(1)
+			if err != nil {
+				return err
+			}
+			tag := TagType(b[0])
+			if tag == TagEnd {
+				return nil
+			}
+			if err := self.skip(TagString); err != nil {
+				return err
+			}
+			if err := self.skip(tag); err != nil {
+				return err
+			}
+		}
+
+	case TagEnd:
+		return nil
+	}
+	_, err := self.read_extension(tag)
+	return err
+}
+
+// Skips n bytes of input, by seeking over them if the input allows it and
+// a bounded chunk at a time otherwise.
+func (self *Decoder) discard(n int64) error {
+	if n >= seek_threshold {
+		if ok, err := self.seek(n); ok {
+			return err
+		}
+	}
+	for n > 0 {
+		k := n
+		if k > 4096 {
+			k = 4096
+		}
+		if _, err := self.next(int(k)); err != nil {
+			return err
+		}
+		n -= k
+	}
+	return nil
+}
+
+// Payloads at least this long are skipped by seeking when possible.
+const seek_threshold = 64 << 10
+
+// Seeks n bytes forward if the input is an io.Seeker and nothing read from
+// it needs to be kept, reporting whether it did. Seeking past the end is
+// ErrTruncated, as reading would have been.
+func (self *Decoder) seek(n int64) (bool, error) {
+	r := self.r
+	s, ok := r.r.(io.Seeker)
+	if !ok || r.capturing || len(r.peeked) > 0 || r.peek_err != nil {
+		return false, nil
+	}
+	pos, err := s.Seek(0, io.SeekCurrent)
+	if err != nil {
+		// not seekable after all, such as a pipe
+		return false, nil
+	}
+	end, err := s.Seek(0, io.SeekEnd)
+	if err != nil {
+		return true, err
+	}
+	if pos+n > end {
+		r.n += end - pos
+		return true, ErrTruncated
+	}
+	if _, err := s.Seek(pos+n, io.SeekStart); err != nil {
+		return true, err
+	}
+	r.n += n
+	return true, nil
+}
+
+// Reads the payload of a tag as a plain value, of one of the types returned
+// by Compound.Get.
+func (self *Decoder) read_payload(tag TagType, name string) (interface{}, error) {
+	if size := fixed_size(tag); size > 0 {
+		n, err := self.next_int(int(size))
+		if err != nil {
+			return nil, err
+		}
+		switch tag {
+		case TagFloat:
+			return math.Float32frombits(uint32(n)), nil
+		case TagDouble:
+			return math.Float64frombits(uint64(n)), nil
+		}
+		return Number{Type: tag}.WithInt64(n).Value(), nil
+	}
+	switch tag {
+	case TagString:
+		return self.read_string()
+	case TagByteArray:
+		return self.read_byte_array()
+	case TagIntArray:
+		return self.read_int_array()
+	case TagLongArray:
+		return self.read_long_array()
+	case TagList:
+		return self.read_list(name)
+	case TagCompound:
+		return self.read_compound(name, nil)
+	}
+	return self.read_extension(tag)
+}
@@ -0,0 +1,123 @@
+package nbt
+
+import (
+	"fmt"
+)
+
+// Returns the compound's contents in the form Tnze/go-mc's nbt package
+// decodes a document into when given a map[string]interface{}, so that code
+// written against it can be fed from this package: integers and floats keep
+// their size (int8 through int64, float32, float64), byte arrays are []byte,
+// the other arrays are []int32 and []int64, lists are []interface{} and
+// compounds are map[string]interface{}. Values of extension tags are kept as
+// their handler decoded them.
+func ToGoMC(c *Compound) map[string]interface{} {
+	m := make(map[string]interface{}, len(c.data))
+	for k, v := range c.data {
+		m[k] = to_gomc(v.value())
+	}
+	return m
+}
+
+func to_gomc(v interface{}) interface{} {
+	switch v := v.(type) {
+	case []int8:
+		b := make([]byte, len(v))
+		for i, n := range v {
+			b[i] = byte(n)
+		}
+		return b
+	case []int32:
+		return append([]int32(nil), v...)
+	case []int64:
+		return append([]int64(nil), v...)
+	case *List:
+		items := v.items()
+		s := make([]interface{}, len(items))
+		for i, item := range items {
+			s[i] = to_gomc(item)
+		}
+		return s
+	case *Compound:
+		return ToGoMC(v)
+	case Extension:
+		return v.Value
+	}
+	return v
+}
+
+// Builds a compound named name out of a map in the form returned by ToGoMC,
+// as produced by Tnze/go-mc's nbt package. In addition, uint8 and bool
+// values become TAG_Byte, as go-mc encodes them. The elements of a list
+// should all be of one tag type; otherwise the list is a mixed one (see
+// List.IsMixed). An empty list is a list of TAG_End.
+func FromGoMC(name string, m map[string]interface{}) (*Compound, error) {
+	c, err := from_gomc_compound(m, nil)
+	if err != nil {
+		return nil, err
+	}
+	c.name = name
+	return c, nil
+}
+
+func from_gomc_compound(m map[string]interface{}, parent *Compound) (*Compound, error) {
+	c := &Compound{parent: parent, data: make(map[string]entry, len(m))}
+	for k, v := range m {
+		v, err := from_gomc(v, c)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", k, err)
+		}
+		if child, ok := v.(*Compound); ok {
+			child.name = k
+		}
+		c.data[k] = c.hold(v)
+	}
+	return c, nil
+}
+
+func from_gomc(v interface{}, parent *Compound) (interface{}, error) {
+	switch v := v.(type) {
+	case int8, int16, int32, int64, float32, float64, string:
+		return v, nil
+	case uint8:
+		return int8(v), nil
+	case bool:
+		if v {
+			return int8(1), nil
+		}
+		return int8(0), nil
+	case []byte:
+		b := make([]int8, len(v))
+		for i, n := range v {
+			b[i] = int8(n)
+		}
+		return b, nil
+	case []int8:
+		return append([]int8(nil), v...), nil
+	case []int32:
+		return append([]int32(nil), v...), nil
+	case []int64:
+		return append([]int64(nil), v...), nil
+	case map[string]interface{}:
+		return from_gomc_compound(v, parent)
+	case []interface{}:
+		items := make([]interface{}, len(v))
+		elem, mixed := TagEnd, false
+		for i, item := range v {
+			item, err := from_gomc(item, nil)
+			if err != nil {
+				return nil, fmt.Errorf("[%d]: %v", i, err)
+			}
+			tag, _ := tag_of(item)
+			if i > 0 && tag != elem {
+				mixed = true
+			}
+			elem, items[i] = tag, item
+		}
+		if mixed {
+			return &List{list_type: TagCompound, data: items, length: int32(len(items))}, nil
+		}
+		return new_list("", elem, items)
+	}
+	return nil, fmt.Errorf("Cannot convert %T", v)
+}
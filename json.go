@@ -0,0 +1,312 @@
+package nbt
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// JSON form of a tag. The JSON encoding keeps every tag's type so that it
+// can be converted back to NBT without loss:
+//
+//	{"type": "compound", "name": "Level", "value": {
+//	    "intTest":  {"type": "int", "value": 2147483647},
+//	    "ids":      {"type": "int_array", "value": [1, 2, 3]},
+//	    "listTest": {"type": "list", "value": {"elem": "long", "items": [11, 12]}},
+//	    "nested":   {"type": "compound", "value": {...}}
+//	}}
+//
+// Type names are the tag names without the "TAG_" prefix, in lower case.
+// Numbers, strings and arrays are written as the corresponding JSON values.
+// A list's items are written the way values of its element type are; the
+// items of a mixed list are written as complete {"type", "value"} objects
+// under the element type "mixed". Only the root compound has a name.
+type json_node struct {
+	Type  string      `json:"type"`
+	Name  *string     `json:"name,omitempty"`
+	Value interface{} `json:"value"`
+}
+
+type json_list struct {
+	Elem  string        `json:"elem"`
+	Items []interface{} `json:"items"`
+}
+
+const json_mixed = "mixed"
+
+// JSONOptions control how compounds are written as JSON. The zero value
+// writes them as MarshalJSON does.
+type JSONOptions struct {
+	// What to do with floats and doubles that are NaN or infinite, which
+	// JSON has no numbers for. UnmarshalJSON reads the strings written with
+	// NonFiniteLiteral back whatever the options they were written with.
+	NonFinite NonFinite
+}
+
+// Encodes the compound in the type-preserving JSON form, implementing
+// json.Marshaler. NaN and infinite floats and doubles make it fail with a
+// *NonFiniteError; see JSONOptions for alternatives.
+func (self *Compound) MarshalJSON() ([]byte, error) {
+	return JSONOptions{}.Marshal(self)
+}
+
+// Encodes the compound as MarshalJSON does, with the options.
+func (self JSONOptions) Marshal(c *Compound) ([]byte, error) {
+	value, err := self.value(c)
+	if err != nil {
+		return nil, err
+	}
+	name := c.name
+	return json.Marshal(json_node{json_type_name(TagCompound), &name, value})
+}
+
+func json_type_name(tag TagType) string {
+	return strings.ToLower(strings.TrimPrefix(tag.String(), "TAG_"))
+}
+
+func (self *JSONOptions) node_of(v interface{}) (json_node, error) {
+	tag, ok := tag_of(v)
+	if !ok {
+		return json_node{}, fmt.Errorf("Cannot encode %T as JSON", v)
+	}
+	value, err := self.value(v)
+	return json_node{Type: json_type_name(tag), Value: value}, err
+}
+
+// Returns the JSON payload of a value, without its type.
+func (self *JSONOptions) value(v interface{}) (interface{}, error) {
+	switch v := unbox(v).(type) {
+	case *Compound:
+		entries := make(map[string]json_node, len(v.data))
+		for k, child := range v.data {
+			node, err := self.node_of(child.value())
+			if err != nil {
+				return nil, err
+			}
+			entries[k] = node
+		}
+		return entries, nil
+
+	case *List:
+		l := json_list{Elem: json_type_name(v.list_type), Items: make([]interface{}, 0, v.Len())}
+		if v.IsMixed() {
+			l.Elem = json_mixed
+		}
+		for _, item := range v.items() {
+			var value interface{}
+			var err error
+			if v.IsMixed() {
+				value, err = self.node_of(item)
+			} else {
+				value, err = self.value(item)
+			}
+			if err != nil {
+				return nil, err
+			}
+			l.Items = append(l.Items, value)
+		}
+		return l, nil
+
+	case float32:
+		f, literal, err := self.NonFinite.apply(float64(v), TagFloat, "JSON")
+		if literal != "" {
+			return literal, nil
+		}
+		return float32(f), err
+
+	case float64:
+		f, literal, err := self.NonFinite.apply(v, TagDouble, "JSON")
+		if literal != "" {
+			return literal, nil
+		}
+		return f, err
+
+	case int8, int16, int32, int64, string, []int8, []int32, []int64:
+		return v, nil
+	}
+	return nil, fmt.Errorf("Cannot encode %T as JSON", v)
+}
+
+// Decodes the type-preserving JSON form written by MarshalJSON into the
+// compound, replacing its name and contents, implementing json.Unmarshaler.
+func (self *Compound) UnmarshalJSON(data []byte) error {
+	if err := self.writable(); err != nil {
+		return err
+	}
+	var node struct {
+		Type  string
+		Name  string
+		Value json.RawMessage
+	}
+	if err := json_unmarshal(data, &node); err != nil {
+		return err
+	}
+	if tag, err := ParseTagType(node.Type); err != nil || tag != TagCompound {
+		return ErrNotCompound
+	}
+	c, err := compound_from_json(node.Name, node.Value, nil)
+	if err != nil {
+		return err
+	}
+	self.replace(c)
+	return nil
+}
+
+// Unmarshals JSON keeping numbers as json.Number, so that longs survive.
+func json_unmarshal(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+func compound_from_json(name string, data json.RawMessage, parent *Compound) (*Compound, error) {
+	var entries map[string]json.RawMessage
+	if err := json_unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+	c := &Compound{
+		parent: parent,
+		name:   name,
+		data:   make(map[string]entry, len(entries)),
+	}
+	for k, raw := range entries {
+		v, err := value_from_json_node(k, raw, c)
+		if err != nil {
+			return nil, err
+		}
+		c.data[k] = c.hold(v)
+	}
+	return c, nil
+}
+
+// Decodes a complete {"type", "value"} object.
+func value_from_json_node(name string, data json.RawMessage, parent *Compound) (interface{}, error) {
+	var node struct {
+		Type  string
+		Value json.RawMessage
+	}
+	if err := json_unmarshal(data, &node); err != nil {
+		return nil, err
+	}
+	tag, err := ParseTagType(node.Type)
+	if err != nil {
+		return nil, fmt.Errorf("\"%s\": %v", name, err)
+	}
+	return value_from_json(tag, name, node.Value, parent)
+}
+
+// Decodes the payload of a tag of a known type.
+func value_from_json(tag TagType, name string, data json.RawMessage, parent *Compound) (interface{}, error) {
+	switch tag {
+	case TagByte, TagShort, TagInt, TagLong, TagFloat, TagDouble:
+		var n json.Number
+		if err := json_unmarshal(data, &n); err != nil {
+			// NaN and the infinities, written with NonFiniteLiteral
+			var s string
+			json.Unmarshal(data, &s)
+			if f, ok := parse_non_finite(s); ok {
+				switch tag {
+				case TagFloat:
+					return float32(f), nil
+				case TagDouble:
+					return f, nil
+				}
+			}
+			return nil, fmt.Errorf("\"%s\": %v", name, err)
+		}
+		return parse_json_number(tag, name, n)
+
+	case TagString:
+		var s string
+		if err := json_unmarshal(data, &s); err != nil {
+			return nil, fmt.Errorf("\"%s\": %v", name, err)
+		}
+		return s, nil
+
+	case TagByteArray, TagIntArray, TagLongArray:
+		var ns []json.Number
+		if err := json_unmarshal(data, &ns); err != nil {
+			return nil, fmt.Errorf("\"%s\": %v", name, err)
+		}
+		elem := array_elem(tag)
+		items := reflect.MakeSlice(reflect.SliceOf(list_elem_types[elem]), len(ns), len(ns))
+		for i, n := range ns {
+			v, err := parse_json_number(elem, name, n)
+			if err != nil {
+				return nil, err
+			}
+			items.Index(i).Set(reflect.ValueOf(v))
+		}
+		return items.Interface(), nil
+
+	case TagList:
+		var l struct {
+			Elem  string
+			Items []json.RawMessage
+		}
+		if err := json_unmarshal(data, &l); err != nil {
+			return nil, fmt.Errorf("\"%s\": %v", name, err)
+		}
+		items := make([]interface{}, len(l.Items))
+		if l.Elem == json_mixed {
+			for i, raw := range l.Items {
+				v, err := value_from_json_node(name, raw, nil)
+				if err != nil {
+					return nil, err
+				}
+				items[i] = v
+			}
+			return &List{name: name, list_type: TagCompound, data: items, length: int32(len(items))}, nil
+		}
+		elem, err := ParseTagType(l.Elem)
+		if err != nil {
+			return nil, fmt.Errorf("\"%s\": %v", name, err)
+		}
+		for i, raw := range l.Items {
+			v, err := value_from_json(elem, name, raw, nil)
+			if err != nil {
+				return nil, err
+			}
+			items[i] = v
+		}
+		return new_list(name, elem, items)
+
+	case TagCompound:
+		return compound_from_json(name, data, parent)
+	}
+	return nil, fmt.Errorf("\"%s\": cannot decode %v from JSON", name, tag)
+}
+
+func parse_json_number(tag TagType, name string, n json.Number) (interface{}, error) {
+	var v interface{}
+	var err error
+	switch tag {
+	case TagByte:
+		var i int64
+		i, err = strconv.ParseInt(string(n), 10, 8)
+		v = int8(i)
+	case TagShort:
+		var i int64
+		i, err = strconv.ParseInt(string(n), 10, 16)
+		v = int16(i)
+	case TagInt:
+		var i int64
+		i, err = strconv.ParseInt(string(n), 10, 32)
+		v = int32(i)
+	case TagLong:
+		v, err = strconv.ParseInt(string(n), 10, 64)
+	case TagFloat:
+		var f float64
+		f, err = strconv.ParseFloat(string(n), 32)
+		v = float32(f)
+	case TagDouble:
+		v, err = strconv.ParseFloat(string(n), 64)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("\"%s\": invalid %v value %s", name, tag, n)
+	}
+	return v, nil
+}
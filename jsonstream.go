@@ -0,0 +1,616 @@
+package nbt
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"unicode/utf8"
+)
+
+// NBTToJSON and JSONToNBT convert between uncompressed NBT documents and
+// the JSON form of MarshalJSON without building a Compound, so that dumps
+// far larger than memory can be converted: only the compounds and lists
+// being converted are remembered, and one payload at a time is held.
+//
+// A stream holds any number of documents, written as JSON one per line.
+// Compound entries are written in the order they are read, rather than in
+// key order as MarshalJSON writes them.
+
+// Converts the NBT documents read from src into JSON written to dst, as
+// JSONOptions.NBTToJSON does.
+func NBTToJSON(dst io.Writer, src io.Reader) error {
+	return JSONOptions{}.NBTToJSON(dst, NewDecoder(src))
+}
+
+// Converts the NBT documents read by dec into JSON written to dst, one per
+// line, until the input ends. The options of dec, such as its byte order
+// and limits, apply.
+func (self JSONOptions) NBTToJSON(dst io.Writer, dec *Decoder) error {
+	w := bufio.NewWriter(dst)
+	// each compound and list being converted, innermost last
+	var frames []json_frame
+	var b []byte
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF && len(frames) == 0 {
+			return w.Flush()
+		}
+		if err != nil {
+			return err
+		}
+		b = b[:0]
+		if tok.Type == TagEnd {
+			b = append(b, frames[len(frames)-1].close...)
+			frames = frames[:len(frames)-1]
+			if len(frames) == 0 {
+				b = append(b, '\n')
+			}
+			if _, err := w.Write(b); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// a compound entry is a complete {"type", "value"} object, a list
+		// element only its value
+		close := ""
+		if len(frames) == 0 {
+			b = append(b, `{"type":"compound","name":`...)
+			b = json_append_string(b, tok.Name)
+			b = append(b, `,"value":`...)
+			close = "}"
+		} else {
+			top := &frames[len(frames)-1]
+			if !top.empty {
+				b = append(b, ',')
+			}
+			top.empty = false
+			if !top.list {
+				b = json_append_string(b, tok.Name)
+				b = append(b, `:{"type":"`...)
+				b = append(b, json_type_name(tok.Type)...)
+				b = append(b, `","value":`...)
+				close = "}"
+			}
+		}
+
+		switch tok.Type {
+		case TagCompound:
+			b = append(b, '{')
+			frames = append(frames, json_frame{close: "}" + close, empty: true})
+		case TagList:
+			b = append(b, `{"elem":"`...)
+			b = append(b, json_type_name(tok.Elem)...)
+			b = append(b, `","items":[`...)
+			frames = append(frames, json_frame{list: true, close: "]}" + close, empty: true})
+		default:
+			v, err := dec.Value()
+			if err != nil {
+				return err
+			}
+			if b, err = self.append_value(b, v); err != nil {
+				return fmt.Errorf("\"%s\": %w", tok.Name, err)
+			}
+			b = append(b, close...)
+		}
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+}
+
+// A compound or list being written by NBTToJSON.
+type json_frame struct {
+	list  bool
+	close string // what ends it
+	empty bool   // nothing written in it yet
+}
+
+// Appends the JSON value of a payload other than a compound or list.
+func (self *JSONOptions) append_value(b []byte, v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case int8:
+		return strconv.AppendInt(b, int64(v), 10), nil
+	case int16:
+		return strconv.AppendInt(b, int64(v), 10), nil
+	case int32:
+		return strconv.AppendInt(b, int64(v), 10), nil
+	case int64:
+		return strconv.AppendInt(b, v, 10), nil
+	case float32:
+		f, literal, err := self.NonFinite.apply(float64(v), TagFloat, "JSON")
+		if literal != "" {
+			return json_append_string(b, literal), nil
+		}
+		return json_append_float(b, f, 32), err
+	case float64:
+		f, literal, err := self.NonFinite.apply(v, TagDouble, "JSON")
+		if literal != "" {
+			return json_append_string(b, literal), nil
+		}
+		return json_append_float(b, f, 64), err
+	case string:
+		return json_append_string(b, v), nil
+	case []int8:
+		b = append(b, '[')
+		for i, n := range v {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			b = strconv.AppendInt(b, int64(n), 10)
+		}
+		return append(b, ']'), nil
+	case []int32:
+		b = append(b, '[')
+		for i, n := range v {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			b = strconv.AppendInt(b, int64(n), 10)
+		}
+		return append(b, ']'), nil
+	case []int64:
+		b = append(b, '[')
+		for i, n := range v {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			b = strconv.AppendInt(b, n, 10)
+		}
+		return append(b, ']'), nil
+	}
+	return b, fmt.Errorf("Cannot encode %T as JSON", v)
+}
+
+// Appends a float as encoding/json writes it.
+func json_append_float(b []byte, f float64, bits int) []byte {
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 {
+		if bits == 64 && (abs < 1e-6 || abs >= 1e21) || bits == 32 && (float32(abs) < 1e-6 || float32(abs) >= 1e21) {
+			format = 'e'
+		}
+	}
+	b = strconv.AppendFloat(b, f, format, -1, bits)
+	if format == 'e' {
+		// e-09 to e-9
+		if n := len(b); n >= 4 && b[n-4] == 'e' && b[n-3] == '-' && b[n-2] == '0' {
+			b[n-2] = b[n-1]
+			b = b[:n-1]
+		}
+	}
+	return b
+}
+
+// Appends a string as a JSON string, replacing bytes that are not valid
+// UTF-8 with U+FFFD as encoding/json does.
+func json_append_string(b []byte, s string) []byte {
+	const hex = "0123456789abcdef"
+	b = append(b, '"')
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			switch {
+			case c == '"' || c == '\\':
+				b = append(b, '\\', c)
+			case c == '\n':
+				b = append(b, '\\', 'n')
+			case c == '\r':
+				b = append(b, '\\', 'r')
+			case c == '\t':
+				b = append(b, '\\', 't')
+			case c < 0x20:
+				b = append(b, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xf])
+			default:
+				b = append(b, c)
+			}
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			b = append(b, "\ufffd"...)
+		} else {
+			b = append(b, s[i:i+size]...)
+		}
+		i += size
+	}
+	return append(b, '"')
+}
+
+// Converts the JSON documents read from src into NBT written to dst, as
+// EncodeOptions.JSONToNBT does.
+func JSONToNBT(dst io.Writer, src io.Reader) error {
+	return EncodeOptions{}.JSONToNBT(dst, src)
+}
+
+// Converts the JSON documents read from src, in the form written by
+// MarshalJSON or NBTToJSON, into uncompressed NBT documents written to
+// dst, until the input ends. ByteOrder, Logger, LogLevel and the root name
+// options apply.
+//
+// Since the type of a tag is needed before its value can be converted,
+// "type" must come before "value" in every object, and "elem" before
+// "items" in lists, as MarshalJSON writes them. NBT gives the length of a
+// list or array before its elements, so each list or array is held in its
+// encoded form until it ends; the entries of compounds are not held.
+// Mixed lists are written as lists of compounds with every element that is
+// not a compound wrapped, even if their elements share a type.
+func (self EncodeOptions) JSONToNBT(dst io.Writer, src io.Reader) error {
+	c := &nbt_from_json{opts: self, dst: bufio.NewWriter(dst)}
+	c.order = self.ByteOrder
+	if c.order == nil {
+		c.order = binary.BigEndian
+	}
+	c.src = json.NewDecoder(src)
+	c.src.UseNumber()
+	for c.src.More() {
+		if err := c.node("", node_root); err != nil {
+			return err
+		}
+	}
+	return c.dst.Flush()
+}
+
+// State of JSONToNBT.
+type nbt_from_json struct {
+	opts  EncodeOptions
+	order binary.ByteOrder
+	src   *json.Decoder
+	dst   *bufio.Writer
+
+	// the encoded elements of the lists and arrays being converted,
+	// innermost last, and buffers to reuse for them
+	counted []*bytes.Buffer
+	free    []*bytes.Buffer
+
+	scratch [8]byte
+}
+
+// How a {"type", "value"} object is written.
+const (
+	node_root    = iota // a document, whose root compound has its name in the object
+	node_entry          // an entry of a compound
+	node_wrapped        // an element of a mixed list
+)
+
+// Reads a complete {"type", "value"} object and writes its tag.
+func (self *nbt_from_json) node(name string, kind int) error {
+	if err := self.delim('{'); err != nil {
+		return err
+	}
+	tag, typed, done := TagEnd, false, false
+	for self.src.More() {
+		key, err := self.string()
+		if err != nil {
+			return err
+		}
+		switch {
+		case key == "type":
+			s, err := self.string()
+			if err != nil {
+				return err
+			}
+			if tag, err = ParseTagType(s); err != nil {
+				return fmt.Errorf("\"%s\": %v", name, err)
+			}
+			typed = true
+
+		case key == "name" && kind == node_root:
+			if name, err = self.string(); err != nil {
+				return err
+			}
+
+		case key == "value" && !done:
+			if !typed {
+				return fmt.Errorf("\"%s\": \"type\" must come before \"value\"", name)
+			}
+			if err := self.header(tag, name, kind); err != nil {
+				return err
+			}
+			if err := self.payload(tag, name); err != nil {
+				return err
+			}
+			if kind == node_wrapped && tag != TagCompound {
+				if err := self.put_byte(byte(TagEnd)); err != nil {
+					return err
+				}
+			}
+			done = true
+
+		default:
+			var skip json.RawMessage
+			if err := self.src.Decode(&skip); err != nil {
+				return err
+			}
+		}
+	}
+	if !done {
+		return fmt.Errorf("\"%s\": no \"value\"", name)
+	}
+	return self.delim('}')
+}
+
+// Writes what comes before the payload of a tag.
+func (self *nbt_from_json) header(tag TagType, name string, kind int) error {
+	switch kind {
+	case node_root:
+		if tag != TagCompound {
+			return ErrNotCompound
+		}
+		if self.opts.OverrideRootName {
+			name = self.opts.RootName
+		}
+	case node_wrapped:
+		if tag == TagCompound {
+			return nil
+		}
+		name = ""
+	}
+	if err := self.put_byte(byte(tag)); err != nil {
+		return err
+	}
+	return self.put_string(name)
+}
+
+// Reads the JSON value of a tag of a known type and writes its payload.
+func (self *nbt_from_json) payload(tag TagType, name string) error {
+	switch tag {
+	case TagByte, TagShort, TagInt, TagLong, TagFloat, TagDouble:
+		return self.number(tag, name)
+
+	case TagString:
+		s, err := self.string()
+		if err != nil {
+			return err
+		}
+		return self.put_string(s)
+
+	case TagByteArray, TagIntArray, TagLongArray:
+		if err := self.delim('['); err != nil {
+			return err
+		}
+		self.begin()
+		n := 0
+		for ; self.src.More(); n++ {
+			if err := self.number(array_elem(tag), name); err != nil {
+				return err
+			}
+		}
+		if err := self.delim(']'); err != nil {
+			return err
+		}
+		return self.end(n)
+
+	case TagList:
+		return self.list(name)
+
+	case TagCompound:
+		if err := self.delim('{'); err != nil {
+			return err
+		}
+		for self.src.More() {
+			key, err := self.string()
+			if err != nil {
+				return err
+			}
+			if err := self.node(key, node_entry); err != nil {
+				return err
+			}
+		}
+		if err := self.delim('}'); err != nil {
+			return err
+		}
+		return self.put_byte(byte(TagEnd))
+	}
+	return fmt.Errorf("\"%s\": cannot decode %v from JSON", name, tag)
+}
+
+// Reads the {"elem", "items"} value of a list and writes its payload.
+func (self *nbt_from_json) list(name string) error {
+	if err := self.delim('{'); err != nil {
+		return err
+	}
+	elem, mixed, typed, done := TagEnd, false, false, false
+	for self.src.More() {
+		key, err := self.string()
+		if err != nil {
+			return err
+		}
+		switch {
+		case key == "elem":
+			s, err := self.string()
+			if err != nil {
+				return err
+			}
+			mixed = s == json_mixed
+			if mixed {
+				elem = TagCompound
+			} else if elem, err = ParseTagType(s); err != nil {
+				return fmt.Errorf("\"%s\": %v", name, err)
+			}
+			typed = true
+
+		case key == "items" && !done:
+			if !typed {
+				return fmt.Errorf("\"%s\": \"elem\" must come before \"items\"", name)
+			}
+			if err := self.put_byte(byte(elem)); err != nil {
+				return err
+			}
+			if err := self.delim('['); err != nil {
+				return err
+			}
+			self.begin()
+			n := 0
+			for ; self.src.More(); n++ {
+				if mixed {
+					err = self.node(name, node_wrapped)
+				} else {
+					err = self.payload(elem, name)
+				}
+				if err != nil {
+					return err
+				}
+			}
+			if err := self.delim(']'); err != nil {
+				return err
+			}
+			if err := self.end(n); err != nil {
+				return err
+			}
+			done = true
+
+		default:
+			var skip json.RawMessage
+			if err := self.src.Decode(&skip); err != nil {
+				return err
+			}
+		}
+	}
+	if !done {
+		return fmt.Errorf("\"%s\": no \"items\"", name)
+	}
+	return self.delim('}')
+}
+
+// Reads a number, or the literal of a NaN or infinite float or double, and
+// writes it as the given type.
+func (self *nbt_from_json) number(tag TagType, name string) error {
+	tok, err := self.src.Token()
+	if err != nil {
+		return err
+	}
+	var v interface{}
+	switch tok := tok.(type) {
+	case json.Number:
+		if v, err = parse_json_number(tag, name, tok); err != nil {
+			return err
+		}
+	case string:
+		f, ok := parse_non_finite(tok)
+		switch {
+		case ok && tag == TagFloat:
+			v = float32(f)
+		case ok && tag == TagDouble:
+			v = f
+		default:
+			return fmt.Errorf("\"%s\": invalid %v value %q", name, tag, tok)
+		}
+	default:
+		return fmt.Errorf("\"%s\": invalid %v value %v", name, tag, tok)
+	}
+
+	b := self.scratch[:]
+	switch v := v.(type) {
+	case int8:
+		b[0] = byte(v)
+		b = b[:1]
+	case int16:
+		self.order.PutUint16(b, uint16(v))
+		b = b[:2]
+	case int32:
+		self.order.PutUint32(b, uint32(v))
+		b = b[:4]
+	case int64:
+		self.order.PutUint64(b, uint64(v))
+	case float32:
+		self.order.PutUint32(b, math.Float32bits(v))
+		b = b[:4]
+	case float64:
+		self.order.PutUint64(b, math.Float64bits(v))
+	}
+	return self.put(b)
+}
+
+// Reads a string, including an object key.
+func (self *nbt_from_json) string() (string, error) {
+	tok, err := self.src.Token()
+	if err != nil {
+		return "", err
+	}
+	s, ok := tok.(string)
+	if !ok {
+		return "", fmt.Errorf("Expected a JSON string, got %v", tok)
+	}
+	return s, nil
+}
+
+// Reads the given delimiter.
+func (self *nbt_from_json) delim(want json.Delim) error {
+	tok, err := self.src.Token()
+	if err != nil {
+		return err
+	}
+	if tok != want {
+		return fmt.Errorf("Expected %v in JSON, got %v", want, tok)
+	}
+	return nil
+}
+
+// Returns where the bytes of the current payload go.
+func (self *nbt_from_json) out() io.Writer {
+	if n := len(self.counted); n > 0 {
+		return self.counted[n-1]
+	}
+	return self.dst
+}
+
+func (self *nbt_from_json) put(b []byte) error {
+	_, err := self.out().Write(b)
+	return err
+}
+
+func (self *nbt_from_json) put_byte(c byte) error {
+	self.scratch[0] = c
+	return self.put(self.scratch[:1])
+}
+
+func (self *nbt_from_json) put_string(s string) error {
+	if self.order != binary.LittleEndian {
+		s = split_surrogates(s)
+	}
+	if len(s) > math.MaxUint16 {
+		return ErrStringTooLong
+	}
+	check_utf8(self.opts.Logger, self.opts.LogLevel, s)
+	self.order.PutUint16(self.scratch[:], uint16(len(s)))
+	if err := self.put(self.scratch[:2]); err != nil {
+		return err
+	}
+	_, err := io.WriteString(self.out(), s)
+	return err
+}
+
+// Starts holding the elements of a list or array until end.
+func (self *nbt_from_json) begin() {
+	var buf *bytes.Buffer
+	if n := len(self.free); n > 0 {
+		buf, self.free = self.free[n-1], self.free[:n-1]
+		buf.Reset()
+	} else {
+		buf = new(bytes.Buffer)
+	}
+	self.counted = append(self.counted, buf)
+}
+
+// Writes the length of the list or array begun last, as n elements, and
+// then its elements.
+func (self *nbt_from_json) end(n int) error {
+	buf := self.counted[len(self.counted)-1]
+	self.counted = self.counted[:len(self.counted)-1]
+	self.free = append(self.free, buf)
+	if n > math.MaxInt32 {
+		return ErrInvalidLength
+	}
+	self.order.PutUint32(self.scratch[:], uint32(n))
+	if err := self.put(self.scratch[:4]); err != nil {
+		return err
+	}
+	_, err := self.out().Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,183 @@
+package nbt
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+)
+
+// LazyList is a list of compounds kept in its encoded form, whose elements
+// are decoded one at a time when they are asked for, so that a program that
+// needs one block entity out of a huge list does not pay for decoding all
+// of them. The decoder stores lists as LazyLists in place of *List values
+// when DecodeOptions.LazyListThreshold calls for it; Get and GetPath index
+// into them like into lists.
+//
+// Decoded elements are kept, so that changes made to them are seen by later
+// calls and written out by the encoder, which copies the elements that were
+// never decoded as they are. A LazyList is safe for concurrent use, but the
+// compounds it returns are not.
+//
+// Get and GetPath, the encoder and LazyList's own methods decode no more
+// than they must. Everything else that reads the list, such as
+// Compound.List, Diff or the SNBT and JSON writers, decodes it entirely
+// with List, as does changing it with Set. From then on the LazyList stands
+// for the *List returned, and changes made to that are seen through it.
+type LazyList struct {
+	name    string
+	data    []byte
+	offsets []int
+	opts    DecodeOptions
+
+	parent  *Compound // the compound holding the list
+	mu      sync.Mutex
+	decoded []*Compound
+	list    *List // once decoded entirely
+}
+
+// Records where each of the list's n compounds starts in its encoded form,
+// which is captured from the input.
+func (self *Decoder) read_lazy_list(name string, n int) (*LazyList, error) {
+	list := &LazyList{name: name, offsets: make([]int, n+1), decoded: make([]*Compound, n)}
+	list.opts = self.DecodeOptions
+	list.opts.Trace, list.opts.Arena, list.opts.ByteArrayFunc = nil, nil, nil
+	list.opts.ByteOrder = self.byte_order()
+
+	self.r.capture, self.r.capturing = nil, true
+	defer func() { self.r.capture, self.r.capturing = nil, false }()
+	for i := 0; i < n; i++ {
+		list.offsets[i] = len(self.r.capture)
+		if err := self.skip(TagCompound); err != nil {
+			return nil, err
+		}
+	}
+	list.offsets[n] = len(self.r.capture)
+	list.data = self.r.capture
+	return list, nil
+}
+
+func (self *LazyList) Name() string { return self.name }
+
+// Returns the number of compounds in the list.
+func (self *LazyList) Len() int {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if self.list != nil {
+		return self.list.Len()
+	}
+	return len(self.decoded)
+}
+
+// Returns the i'th compound of the list, decoding it on first use.
+func (self *LazyList) Index(i int) (*Compound, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	n := len(self.decoded)
+	if self.list != nil {
+		n = self.list.Len()
+	}
+	if i < 0 || i >= n {
+		return nil, fmt.Errorf("Index %d out of range for a list of %d", i, n)
+	}
+	return self.index(i)
+}
+
+func (self *LazyList) index(i int) (*Compound, error) {
+	if self.list != nil {
+		c, ok := self.list.items()[i].(*Compound)
+		if !ok {
+			return nil, fmt.Errorf("Element %d of list \"%s\" is not a compound", i, self.name)
+		}
+		return c, nil
+	}
+	if c := self.decoded[i]; c != nil {
+		return c, nil
+	}
+	dec := NewDecoder(bytes.NewReader(self.data[self.offsets[i]:self.offsets[i+1]]))
+	dec.DecodeOptions = self.opts
+	c, err := dec.read_compound("", nil)
+	if err != nil {
+		return nil, err
+	}
+	c.parent = self.parent
+	self.decoded[i] = c
+	return c, nil
+}
+
+// Returns the compounds of the list decoded so far, with nil for the
+// others.
+func (self *LazyList) loaded() []interface{} {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if self.list != nil {
+		return self.list.items()
+	}
+	items := make([]interface{}, len(self.decoded))
+	for i, c := range self.decoded {
+		if c != nil {
+			items[i] = c
+		}
+	}
+	return items
+}
+
+// Decodes every element that has not been yet, returning the list as a
+// *List holding the same compounds that Index returns. Every call returns
+// the same *List.
+func (self *LazyList) List() (*List, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if self.list != nil {
+		return self.list, nil
+	}
+	for i := range self.decoded {
+		if _, err := self.index(i); err != nil {
+			return nil, err
+		}
+	}
+	data := append([]*Compound(nil), self.decoded...)
+	self.list = &List{name: self.name, list_type: TagCompound, data: data, length: int32(len(data))}
+	return self.list, nil
+}
+
+// Returns the list as List does, or the LazyList itself if it cannot be
+// decoded, for code that handles *List values only.
+func (self *LazyList) resolve() interface{} {
+	if l, err := self.List(); err == nil {
+		return l
+	}
+	return self
+}
+
+// Writes the list, copying the elements that were not decoded if the byte
+// order allows it.
+func (self *Encoder) write_lazy_list(l *LazyList) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.list != nil {
+		return self.write_list(l.list)
+	}
+	if err := self.write(byte(TagCompound)); err != nil {
+		return err
+	}
+	if err := self.write(int32(len(l.decoded))); err != nil {
+		return err
+	}
+	same_order := self.byte_order() == l.opts.ByteOrder
+	for i, c := range l.decoded {
+		if c == nil && same_order {
+			if _, err := self.buf.Write(l.data[l.offsets[i]:l.offsets[i+1]]); err != nil {
+				return err
+			}
+			continue
+		}
+		c, err := l.index(i)
+		if err != nil {
+			return err
+		}
+		if err := self.write_compound(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package nbt
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// The reordering methods modify the list in place. They return ErrFrozen
+// for a list in a tree returned by Freeze, and ErrShared for a list in a
+// tree that shares its contents with a clone, until Set on the root copies
+// the list by modifying something inside it; see Compound.Clone. Like
+// compounds inside lists, lists inside the compounds of a list cannot tell
+// that they are shared.
+
+// Sorts the list's elements in place, keeping equal elements in order. less
+// compares the elements at indices i and j of the list as it is being
+// sorted, e.g. to order an inventory by slot:
+//
+//	items := inv.List("Items")
+//	err := items.Sort(func(i, j int) bool {
+//		return items.Compounds()[i].Byte("Slot") < items.Compounds()[j].Byte("Slot")
+//	})
+func (self *List) Sort(less func(i, j int) bool) error {
+	if err := self.writable(); err != nil {
+		return err
+	}
+	if self.data != nil {
+		sort.SliceStable(self.data, less)
+	}
+	return nil
+}
+
+// Exchanges the elements at indices i and j. It panics if either is out of
+// range.
+func (self *List) Swap(i, j int) error {
+	self.check_index(i)
+	self.check_index(j)
+	if err := self.writable(); err != nil {
+		return err
+	}
+	reflect.Swapper(self.data)(i, j)
+	return nil
+}
+
+// Moves the element at index from to index to, shifting the elements in
+// between over by one. It panics if either is out of range.
+func (self *List) Move(from, to int) error {
+	self.check_index(from)
+	self.check_index(to)
+	if err := self.writable(); err != nil {
+		return err
+	}
+	swap := reflect.Swapper(self.data)
+	for ; from < to; from++ {
+		swap(from, from+1)
+	}
+	for ; from > to; from-- {
+		swap(from, from-1)
+	}
+	return nil
+}
+
+func (self *List) check_index(i int) {
+	if i < 0 || i >= self.Len() {
+		panic(fmt.Sprintf("nbt: index %d out of range for list \"%s\" of length %d", i, self.name, self.Len()))
+	}
+}
+
+// Returns an error if the list cannot be modified in place, because it is
+// frozen or shared with a clone.
+func (self *List) writable() error {
+	if self.frozen {
+		return ErrFrozen
+	}
+	if self.parent != nil {
+		root := self.parent.Root()
+		if root.shared || root.token != self.token {
+			return ErrShared
+		}
+	}
+	return nil
+}
+
+// Makes c the parent of the list and of the compounds and lists in it, and
+// in the lists in it, so that they can find the root of their tree.
+func (self *List) set_parent(c *Compound) {
+	self.parent = c
+	switch data := self.data.(type) {
+	case []*Compound:
+		for _, item := range data {
+			item.parent = c
+		}
+	case []*List:
+		for _, l := range data {
+			l.set_parent(c)
+		}
+	case []interface{}:
+		for _, item := range data {
+			switch item := item.(type) {
+			case *Compound:
+				item.parent = c
+			case *List:
+				item.set_parent(c)
+			}
+		}
+	}
+}
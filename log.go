@@ -0,0 +1,34 @@
+package nbt
+
+import (
+	"context"
+	"log/slog"
+	"unicode/utf8"
+)
+
+// Logs a warning about questionable data to logger, if it is set, at level,
+// or slog.LevelWarn if level is nil.
+func warn(logger *slog.Logger, level slog.Leveler, msg string, args ...interface{}) {
+	if logger == nil {
+		return
+	}
+	if level == nil {
+		level = slog.LevelWarn
+	}
+	logger.Log(context.Background(), level.Level(), msg, args...)
+}
+
+func (self *Decoder) warn(msg string, args ...interface{}) {
+	warn(self.Logger, self.LogLevel, msg, append(args, "offset", self.r.n)...)
+}
+
+// Warns about strings that are not valid UTF-8. Minecraft writes strings in
+// Java's modified UTF-8, which differs from UTF-8 in its encoding of NUL
+// and of characters outside the Basic Multilingual Plane; the latter are
+// converted on decoding, so such strings usually hold an encoded NUL, an
+// unpaired surrogate or corruption.
+func check_utf8(logger *slog.Logger, level slog.Leveler, s string) {
+	if logger != nil && !utf8.ValidString(s) {
+		warn(logger, level, "nbt: string is not valid UTF-8", "string", s)
+	}
+}
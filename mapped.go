@@ -0,0 +1,108 @@
+package nbt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"unsafe"
+)
+
+// MappedFile is an uncompressed NBT file decoded straight out of memory
+// mapped from the file, as returned by OpenMapped.
+type MappedFile struct {
+	root  *Compound
+	data  []byte
+	unmap func([]byte) error
+}
+
+// Maps an uncompressed NBT file into memory and decodes it, for very large
+// dumps that would otherwise be read into memory first. The strings and
+// byte arrays of the document are not copied but point into the mapping;
+// other arrays and all numbers are copied, since they may need their bytes
+// swapped. The mapping is private, so modifying a byte array in place does
+// not change the file. Java Edition (big endian) and Bedrock Edition
+// (little endian, without a level.dat header) files are told apart as in
+// DecodeAny.
+//
+// Close unmaps the file, after which the document and everything taken
+// from it must no longer be used. On systems without mmap, the file is read
+// into memory instead.
+func OpenMapped(path string) (*MappedFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	data, unmap, err := mmap(f, info.Size())
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) >= 2 && data[0] == 0x1f && data[1] == 0x8b {
+		unmap(data)
+		return nil, errors.New("Cannot map a compressed NBT file")
+	}
+	dec := NewDecoder(bytes.NewReader(data))
+	dec.view = data
+	if !valid(data, binary.BigEndian) && valid(data, binary.LittleEndian) {
+		dec.ByteOrder = binary.LittleEndian
+	}
+	c, err := dec.Decode()
+	if err != nil {
+		unmap(data)
+		return nil, err
+	}
+	return &MappedFile{root: c, data: data, unmap: unmap}, nil
+}
+
+// Returns the decoded document.
+func (self *MappedFile) Compound() *Compound {
+	return self.root
+}
+
+// Unmaps the file. The root compound is emptied, but any other part of the
+// document that is still held must not be used afterwards.
+func (self *MappedFile) Close() error {
+	if self.data == nil {
+		return nil
+	}
+	self.root.data = map[string]entry{}
+	err := self.unmap(self.data)
+	self.data = nil
+	return err
+}
+
+// Returns the next n bytes of input from the memory being decoded, without
+// copying them. It may only be used if view is set.
+func (self *Decoder) borrow(n int) ([]byte, error) {
+	off := self.r.n
+	if int64(n) > int64(len(self.view))-off {
+		return nil, ErrTruncated
+	}
+	if _, err := self.r.r.(io.Seeker).Seek(int64(n), io.SeekCurrent); err != nil {
+		return nil, err
+	}
+	self.r.n += int64(n)
+	return self.view[off : off+int64(n) : off+int64(n)], nil
+}
+
+// Returns bytes as a string or []int8 without copying them.
+func view_string(b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
+	return unsafe.String(&b[0], len(b))
+}
+
+func view_int8s(b []byte) []int8 {
+	if len(b) == 0 {
+		return []int8{}
+	}
+	return unsafe.Slice((*int8)(unsafe.Pointer(&b[0])), len(b))
+}
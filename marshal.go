@@ -0,0 +1,366 @@
+//go:build !nbt_noreflect
+
+package nbt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+)
+
+var (
+	ErrInvalidRoot = errors.New("nbt: only maps with string keys and structs can be encoded as a document")
+)
+
+// Encodes a Go value as an uncompressed NBT document held in memory. See
+// (*Encoder).EncodeValue.
+func Marshal(v interface{}) ([]byte, error) {
+	return EncodeOptions{}.Marshal(v)
+}
+
+// Encodes a Go value as an uncompressed NBT document held in memory as
+// Marshal does.
+func (self EncodeOptions) Marshal(v interface{}) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	if err := self.NewEncoder(buf).EncodeValue(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Writes a Go value to the output as an uncompressed NBT document, without
+// building a Compound first. v must be a *Compound, a map with string keys
+// or a struct, or a pointer to one; the root compound is unnamed unless v is
+// a *Compound.
+//
+// Values are mapped to tag types as documented on TypeOf, so that data
+// loaded from JSON or YAML configuration can be written as NBT directly.
+// In addition:
+//
+//   - Integers must fit in their tag: int and uint values that do not fit
+//     in 32 bits are an error. Unsigned integers are written with the same
+//     bits, so that values above the signed maximum wrap around, unless
+//     StrictUnsigned is set, which makes them an error.
+//   - Bools are written as 1 or 0.
+//   - Encoding/json decodes all numbers as float64, which is written as a
+//     TAG_Double.
+//   - The elements of a slice of interface values must all map to the same
+//     tag type. Empty ones are written as lists of TAG_End.
+//   - Other slices are written as lists of their element type even when
+//     empty, so that a []T or []*T of structs is always a list of
+//     compounds. Nil pointers among their elements are an error.
+//   - Map entries are written in key order and struct fields in declaration
+//     order, named as for DecodeValue. Nil pointers, interfaces, maps and
+//     slices in maps and structs are left out; elsewhere they are an error.
+//   - The fields of anonymous struct fields are written as part of the outer
+//     struct, as for DecodeValue, and the entries of a map field tagged
+//     `nbt:",inline"` after the struct's fields, except those named like
+//     one of them.
+//   - *Compound, *List, Number and Extension values are written as they are
+//     by Encode.
+func (self *Encoder) EncodeValue(v interface{}) error {
+	if c, ok := v.(*Compound); ok {
+		return self.Encode(c)
+	}
+	rv := indirect(reflect.ValueOf(v))
+	if value_tag(rv) != TagCompound {
+		return ErrInvalidRoot
+	}
+
+	self.init()
+	start, n := self.clock()
+	err := self.encode_value(rv)
+	self.measure(start, n, err)
+	return err
+}
+
+func (self *Encoder) encode_value(rv reflect.Value) error {
+	if err := self.write(byte(TagCompound)); err != nil {
+		return err
+	}
+	if err := self.write_string(self.root_name("")); err != nil {
+		return err
+	}
+	if err := self.write_value(rv, TagCompound); err != nil {
+		return err
+	}
+	return self.buf.Flush()
+}
+
+// Follows pointers and interfaces to the value they hold, stopping at the
+// pointers that Compound stores itself.
+func indirect(v reflect.Value) reflect.Value {
+	for (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && !v.IsNil() {
+		if v.Kind() == reflect.Ptr && (v.Type() == compound_type || v.Type() == list_type) {
+			break
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+var (
+	compound_type   = reflect.TypeOf((*Compound)(nil))
+	list_type       = reflect.TypeOf((*List)(nil))
+	number_type     = reflect.TypeOf(Number{})
+	extension_type  = reflect.TypeOf(Extension{})
+	byte_array_type = reflect.TypeOf(ByteArrayReader{})
+)
+
+// Returns the tag type every value of type t is encoded as, so that it can
+// be worked out once per struct field, or TagEnd if it depends on the
+// value, as for pointers, interfaces and the types whose values carry
+// their own tag type.
+func static_tag(t reflect.Type) TagType {
+	switch t {
+	case number_type, extension_type, byte_array_type, raw_tag_type:
+		return TagEnd
+	}
+	if t.Kind() == reflect.Ptr || t.Kind() == reflect.Interface {
+		return TagEnd
+	}
+	return type_of(t)
+}
+
+// Returns the tag type an indirected value is encoded as, or TagEnd if it
+// has none.
+func value_tag(v reflect.Value) TagType {
+	if !v.IsValid() {
+		return TagEnd
+	}
+	if v.CanInterface() {
+		if tag, ok := tag_of(v.Interface()); ok {
+			return tag
+		}
+	}
+	if v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		// nil
+		return TagEnd
+	}
+	return type_of(v.Type())
+}
+
+// Reports whether a value held in a map or struct is left out.
+func is_nil(v reflect.Value) bool {
+	if v.IsValid() && v.Type() == raw_tag_type {
+		return v.Interface().(RawTag).Type == TagEnd
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+		return v.IsNil()
+	}
+	return !v.IsValid()
+}
+
+// Writes the payload of an indirected value as the given tag type, which
+// must be value_tag(v).
+func (self *Encoder) write_value(v reflect.Value, tag TagType) error {
+	if v.CanInterface() {
+		if _, ok := tag_of(v.Interface()); ok {
+			return self.write_payload(v.Interface())
+		}
+	}
+	return self.write_plain(v, tag)
+}
+
+// Writes the payload of a value by its kind, without looking for the types
+// that tag_of knows, which it writes the same way unless they carry their
+// own tag type.
+func (self *Encoder) write_plain(v reflect.Value, tag TagType) error {
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return self.write(int8(1))
+		}
+		return self.write(int8(0))
+
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return self.write_int(tag, v.Int())
+
+	case reflect.Int:
+		if n := v.Int(); n < math.MinInt32 || n > math.MaxInt32 {
+			return fmt.Errorf("nbt: %d overflows %v", n, tag)
+		}
+		return self.write_int(tag, v.Int())
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n := v.Uint()
+		max := uint64(1)<<(8*fixed_size(tag)) - 1
+		if self.StrictUnsigned {
+			max >>= 1
+		}
+		if n > max {
+			return fmt.Errorf("nbt: %d overflows %v", n, tag)
+		}
+		return self.write_int(tag, int64(n))
+
+	case reflect.Float32:
+		return self.write(float32(v.Float()))
+
+	case reflect.Float64:
+		return self.write(v.Float())
+
+	case reflect.String:
+		return self.write_string(v.String())
+
+	case reflect.Slice, reflect.Array:
+		if tag == TagList {
+			return self.write_value_list(v)
+		}
+		if err := self.write(int32(v.Len())); err != nil {
+			return err
+		}
+		for i := 0; i < v.Len(); i++ {
+			var n int64
+			if e := v.Index(i); e.Kind() == reflect.Uint8 {
+				n = int64(e.Uint())
+			} else {
+				n = e.Int()
+			}
+			if err := self.write_int(array_elem(tag), n); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case reflect.Map:
+		if err := self.write_map_entries(v, nil); err != nil {
+			return err
+		}
+		return self.write(byte(TagEnd))
+
+	case reflect.Struct:
+		fields := struct_fields(v.Type())
+		for _, f := range fields.list {
+			field, ok := field_by_index(v, f.index, false)
+			if !ok {
+				// inside a nil embedded struct
+				continue
+			}
+			var err error
+			switch {
+			case f.tag == TagEnd:
+				err = self.write_entry(f.name, field)
+			case !is_nil(field):
+				err = self.write_named(f.name, field, f.tag, true)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if fields.inline != nil {
+			if m, ok := field_by_index(v, fields.inline, false); ok {
+				if err := self.write_map_entries(m, fields.by_name); err != nil {
+					return err
+				}
+			}
+		}
+		return self.write(byte(TagEnd))
+	}
+	return fmt.Errorf("nbt: cannot encode %v", v.Type())
+}
+
+// Writes the entries of a map with string keys in key order, leaving out
+// those named in skip.
+func (self *Encoder) write_map_entries(v reflect.Value, skip map[string]int) error {
+	keys := v.MapKeys()
+	sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+	for _, k := range keys {
+		if _, ok := skip[k.String()]; ok {
+			continue
+		}
+		if err := self.write_entry(k.String(), v.MapIndex(k)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Writes an integer of the given integer tag type, truncating it.
+func (self *Encoder) write_int(tag TagType, n int64) error {
+	switch tag {
+	case TagByte:
+		return self.write(int8(n))
+	case TagShort:
+		return self.write(int16(n))
+	case TagInt:
+		return self.write(int32(n))
+	}
+	return self.write(n)
+}
+
+// Writes a named entry of a compound, unless the value is nil.
+func (self *Encoder) write_entry(name string, v reflect.Value) error {
+	if is_nil(v) {
+		return nil
+	}
+	v = indirect(v)
+	tag := value_tag(v)
+	if tag == TagEnd {
+		return fmt.Errorf("nbt: cannot encode \"%s\" of type %v", name, v.Type())
+	}
+	return self.write_named(name, v, tag, false)
+}
+
+// Writes a named entry of the given tag type, with write_plain if plain.
+func (self *Encoder) write_named(name string, v reflect.Value, tag TagType, plain bool) error {
+	if err := self.write(byte(tag)); err != nil {
+		return err
+	}
+	if err := self.write_string(name); err != nil {
+		return err
+	}
+	var err error
+	if plain {
+		err = self.write_plain(v, tag)
+	} else {
+		err = self.write_value(v, tag)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+func (self *Encoder) write_value_list(v reflect.Value) error {
+	n := v.Len()
+	items := make([]reflect.Value, n)
+	elem := TagEnd
+	if t := v.Type().Elem(); t.Kind() != reflect.Interface {
+		elem = type_of(t)
+		if elem == TagEnd {
+			return fmt.Errorf("nbt: cannot encode a list of %v", t)
+		}
+	}
+	for i := range items {
+		items[i] = indirect(v.Index(i))
+		tag := value_tag(items[i])
+		switch {
+		case tag == TagEnd:
+			return fmt.Errorf("nbt: cannot encode list element %d of type %v", i, v.Index(i).Type())
+		case i == 0 && elem == TagEnd:
+			elem = tag
+		case tag != elem:
+			return fmt.Errorf("nbt: list element %d is %v, not %v", i, tag, elem)
+		}
+	}
+	if n == 0 && v.Type().Elem().Kind() == reflect.Interface {
+		elem = TagEnd
+	}
+
+	if err := self.write(byte(elem)); err != nil {
+		return err
+	}
+	if err := self.write(int32(n)); err != nil {
+		return err
+	}
+	for i, item := range items {
+		if err := self.write_value(item, elem); err != nil {
+			return fmt.Errorf("[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package nbt
+
+import (
+	"fmt"
+)
+
+// Conflict is a part of a document that both sides of Merge3 changed, in
+// different ways. Each value is the one at Path in that document, or nil
+// where there is none.
+type Conflict struct {
+	Path   Path
+	Base   interface{}
+	Ours   interface{}
+	Theirs interface{}
+}
+
+func (self Conflict) String() string {
+	return fmt.Sprintf("! %v: base %s, ours %s, theirs %s", self.Path,
+		conflict_value(self.Base), conflict_value(self.Ours), conflict_value(self.Theirs))
+}
+
+func conflict_value(v interface{}) string {
+	if v == nil {
+		return "none"
+	}
+	return change_value(v)
+}
+
+// Merges the changes made to base in ours and in theirs, for edits made to
+// copies of the same document by different processes or users. The result
+// is a copy of ours with the changes of theirs applied where ours left the
+// same part of the document alone, or made the same change. Where both
+// changed it differently, the result keeps ours, and the conflict is
+// returned, ordered by path. None of the arguments are modified.
+//
+// Changes are found as Diff finds them, so that edits to different entries
+// of a compound, or to different elements of a list that kept its length,
+// merge. Elements added to or removed from a list change the list as a
+// whole, since the indexes of the elements after them move.
+func Merge3(base, ours, theirs *Compound) (*Compound, []Conflict) {
+	merged := copy_value(ours, nil).(*Compound)
+	mine := merge_changes(base, ours)
+	var conflicts []Conflict
+	for _, change := range merge_changes(base, theirs) {
+		if at, conflict := merge_conflict(change, mine); conflict {
+			conflicts = add_conflict(conflicts, at, base, ours, theirs)
+			continue
+		}
+		if merge_apply(merged, change) != nil {
+			conflicts = add_conflict(conflicts, change.Path, base, ours, theirs)
+		}
+	}
+	return merged, conflicts
+}
+
+// Reports whether a change of theirs conflicts with the changes of ours, and
+// the path to record the conflict at: that of the change of ours if it
+// replaced a part of the document holding the change, and that of the change
+// otherwise.
+func merge_conflict(change Change, mine []Change) (Path, bool) {
+	for _, other := range mine {
+		switch {
+		case path_within(change.Path, other.Path) && path_within(other.Path, change.Path):
+			if !Equal(change.New, other.New) {
+				return change.Path, true
+			}
+		case path_within(change.Path, other.Path):
+			return other.Path, true
+		case path_within(other.Path, change.Path):
+			return change.Path, true
+		}
+	}
+	return nil, false
+}
+
+// Returns the changes from base to doc, with those that add or remove list
+// elements replaced by a change to the whole list.
+func merge_changes(base, doc *Compound) []Change {
+	changes := Diff(base, doc)
+	var lists []Path
+	for _, c := range changes {
+		last := c.Path[len(c.Path)-1]
+		if !last.IsIndex || c.Old != nil && c.New != nil {
+			continue
+		}
+		list := c.Path[:len(c.Path)-1]
+		if n := len(lists); n == 0 || !path_within(list, lists[n-1]) || !path_within(lists[n-1], list) {
+			lists = append(lists, list)
+		}
+	}
+	if len(lists) == 0 {
+		return changes
+	}
+
+	var out []Change
+	for _, c := range changes {
+		inside := false
+		for _, list := range lists {
+			if path_within(c.Path, list) {
+				inside = true
+				break
+			}
+		}
+		if !inside {
+			out = append(out, c)
+		}
+	}
+	for _, list := range lists {
+		old, _ := base.Get(list)
+		new, _ := doc.Get(list)
+		out = append(out, Change{Path: list, Old: old, New: new})
+	}
+	return out
+}
+
+// Reports whether path is prefix or lies below it.
+func path_within(path, prefix Path) bool {
+	if len(path) < len(prefix) {
+		return false
+	}
+	for i, elem := range prefix {
+		if path[i] != elem {
+			return false
+		}
+	}
+	return true
+}
+
+// Records a conflict at path, unless one is recorded there already, keeping
+// the conflicts ordered by path.
+func add_conflict(conflicts []Conflict, path Path, base, ours, theirs *Compound) []Conflict {
+	key := path.String()
+	i := 0
+	for ; i < len(conflicts); i++ {
+		s := conflicts[i].Path.String()
+		if s == key {
+			return conflicts
+		}
+		if s > key {
+			break
+		}
+	}
+	c := Conflict{Path: path}
+	c.Base, _ = base.Get(path)
+	c.Ours, _ = ours.Get(path)
+	c.Theirs, _ = theirs.Get(path)
+	conflicts = append(conflicts, Conflict{})
+	copy(conflicts[i+1:], conflicts[i:])
+	conflicts[i] = c
+	return conflicts
+}
+
+// Makes a change of another document to the merged one.
+func merge_apply(merged *Compound, change Change) error {
+	if change.New != nil {
+		return merged.Set(change.Path, copy_value(change.New, nil))
+	}
+	parent, err := merged.own_path(change.Path[:len(change.Path)-1])
+	if err != nil {
+		return err
+	}
+	c, ok := parent.(*Compound)
+	if !ok {
+		return fmt.Errorf("%v: %v is not a compound", change.Path, TypeOf(parent))
+	}
+	delete(c.data, change.Path[len(change.Path)-1].Key)
+	return nil
+}
@@ -0,0 +1,97 @@
+package nbt
+
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+// Metrics receives a measurement of every document decoded by Decode and
+// DecodeValue, and of every document encoded by Encode and EncodeValue,
+// for exporting to Prometheus, expvar or the like. Set it in DecodeOptions
+// or EncodeOptions; the same Metrics may be shared by many Decoders and
+// Encoders running at once, so its methods must be safe for concurrent
+// use. Documents read through the Token API are not measured, and neither
+// is reaching the end of a stream of documents.
+type Metrics interface {
+	// Called after each document decoded, with the number of bytes of
+	// input it took, how long decoding took and the error decoding
+	// returned, if any. ErrorClass sorts such errors into labels.
+	Decoded(bytes int64, d time.Duration, err error)
+
+	// Called after each document encoded, with the number of bytes of
+	// output it took, how long encoding took and the error encoding
+	// returned, if any.
+	Encoded(bytes int64, d time.Duration, err error)
+}
+
+// Returns a short name for the kind of an error returned by decoding or
+// encoding, fit for a metric label: "truncated", "too_large", "too_deep",
+// "invalid_length", "invalid_tag", "not_compound", "stopped_short",
+// "string_too_long", "type" for values of the wrong type for their Go
+// destination, or "other". It returns "" for nil.
+func ErrorClass(err error) string {
+	var type_err *UnmarshalTypeError
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, ErrTruncated):
+		return "truncated"
+	case errors.Is(err, ErrTooLarge):
+		return "too_large"
+	case errors.Is(err, ErrTooDeep):
+		return "too_deep"
+	case errors.Is(err, ErrInvalidLength):
+		return "invalid_length"
+	case errors.Is(err, ErrInvalidTag):
+		return "invalid_tag"
+	case errors.Is(err, ErrNotCompound):
+		return "not_compound"
+	case errors.Is(err, ErrStoppedShort):
+		return "stopped_short"
+	case errors.Is(err, ErrStringTooLong):
+		return "string_too_long"
+	case errors.As(err, &type_err):
+		return "type"
+	}
+	return "other"
+}
+
+// Returns the time a document starts being decoded, if it is to be
+// measured.
+func (self *Decoder) clock() time.Time {
+	if self.Metrics == nil {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+// Reports the document decoded since start to Metrics, unless the input
+// ended before it.
+func (self *Decoder) measure(start time.Time, err error) {
+	if self.Metrics != nil && err != io.EOF {
+		self.Metrics.Decoded(self.r.n-self.start, time.Since(start), err)
+	}
+}
+
+// Returns the time a document starts being encoded and the number of
+// bytes written before it, if it is to be measured.
+func (self *Encoder) clock() (time.Time, int64) {
+	if self.counter == nil {
+		return time.Time{}, 0
+	}
+	return time.Now(), self.written()
+}
+
+// Reports the document encoded since start, after n bytes, to Metrics.
+func (self *Encoder) measure(start time.Time, n int64, err error) {
+	if self.counter != nil {
+		self.Metrics.Encoded(self.written()-n, time.Since(start), err)
+	}
+}
+
+// Returns the number of bytes written so far, counting those still
+// buffered.
+func (self *Encoder) written() int64 {
+	return self.counter.n + int64(self.buf.Buffered())
+}
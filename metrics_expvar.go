@@ -0,0 +1,77 @@
+//go:build !nbt_noreflect
+
+package nbt
+
+import (
+	"expvar"
+	"strconv"
+	"time"
+)
+
+// Upper bounds of the buckets of the duration histograms of ExpvarMetrics.
+var expvar_buckets = []time.Duration{
+	100 * time.Microsecond,
+	time.Millisecond,
+	10 * time.Millisecond,
+	100 * time.Millisecond,
+	time.Second,
+}
+
+// ExpvarMetrics is a Metrics publishing its measurements through expvar,
+// and so at /debug/vars, as a map holding for each of "decode" and
+// "encode":
+//
+//   - decode_documents: the number of documents
+//   - decode_bytes: the number of bytes read
+//   - decode_errors: a map from ErrorClass to the number of failures
+//   - decode_seconds: a cumulative histogram of durations, as a map from
+//     the upper bound of each bucket in seconds, or "+Inf", to the number
+//     of documents that took at most that long
+//   - decode_seconds_sum: the total duration
+type ExpvarMetrics struct {
+	m *expvar.Map
+
+	// the maps of errors and durations of "decode" and "encode"
+	errors  map[string]*expvar.Map
+	seconds map[string]*expvar.Map
+}
+
+// Returns an ExpvarMetrics published under the given name. Like
+// expvar.NewMap, it panics if the name is already in use.
+func NewExpvarMetrics(name string) *ExpvarMetrics {
+	self := &ExpvarMetrics{
+		m:       expvar.NewMap(name),
+		errors:  make(map[string]*expvar.Map),
+		seconds: make(map[string]*expvar.Map),
+	}
+	for _, op := range []string{"decode", "encode"} {
+		self.errors[op] = new(expvar.Map)
+		self.m.Set(op+"_errors", self.errors[op])
+		self.seconds[op] = new(expvar.Map)
+		self.m.Set(op+"_seconds", self.seconds[op])
+	}
+	return self
+}
+
+func (self *ExpvarMetrics) Decoded(bytes int64, d time.Duration, err error) {
+	self.record("decode", bytes, d, err)
+}
+
+func (self *ExpvarMetrics) Encoded(bytes int64, d time.Duration, err error) {
+	self.record("encode", bytes, d, err)
+}
+
+func (self *ExpvarMetrics) record(op string, bytes int64, d time.Duration, err error) {
+	self.m.Add(op+"_documents", 1)
+	self.m.Add(op+"_bytes", bytes)
+	if err != nil {
+		self.errors[op].Add(ErrorClass(err), 1)
+	}
+	for _, bound := range expvar_buckets {
+		if d <= bound {
+			self.seconds[op].Add(strconv.FormatFloat(bound.Seconds(), 'g', -1, 64), 1)
+		}
+	}
+	self.seconds[op].Add("+Inf", 1)
+	self.m.AddFloat(op+"_seconds_sum", d.Seconds())
+}
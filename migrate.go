@@ -0,0 +1,92 @@
+package nbt
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Migration upgrades data written at any DataVersion in [From, To) to the
+// layout of version To, such as the renames of the 1.13 flattening.
+type Migration struct {
+	From, To int32
+	Func     func(c *Compound) error
+}
+
+// Migrations is a registry of Migrations, which Upgrade chains together to
+// bring data up to some version. The zero value is an empty registry ready
+// to use, and it is safe for concurrent use.
+type Migrations struct {
+	mu   sync.RWMutex
+	list []Migration // sorted by From, then To
+}
+
+// DefaultMigrations is the registry used by RegisterMigration and Upgrade.
+var DefaultMigrations = new(Migrations)
+
+// Adds a migration from the versions [from, to) to version to.
+func (self *Migrations) Register(from, to int32, f func(c *Compound) error) {
+	if from >= to {
+		panic(fmt.Sprintf("nbt: migration from DataVersion %d to %d does not go forward", from, to))
+	}
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.list = append(self.list, Migration{from, to, f})
+	sort.SliceStable(self.list, func(i, j int) bool {
+		a, b := self.list[i], self.list[j]
+		return a.From < b.From || a.From == b.From && a.To < b.To
+	})
+}
+
+// Upgrades the compound in place from its DataVersion entry, or 0 if it has
+// none as in data from before 1.9, to the target version. Each registered
+// migration whose range contains the current version and whose end is not
+// past the target is applied in turn, after which DataVersion is set to the
+// migration's end; versions between migrations are assumed to need no
+// changes. DataVersion is finally set to target as a TAG_Int.
+//
+// The DataVersion of a level.dat is in its Data compound, which is what
+// should be passed here. If a migration fails, the compound may have been
+// partly upgraded and DataVersion holds the last version fully reached.
+func (self *Migrations) Upgrade(c *Compound, target int32) error {
+	if err := c.writable(); err != nil {
+		return err
+	}
+	version := int32(0)
+	if n, ok := c.Number("DataVersion"); ok {
+		version = int32(n.Int64())
+	}
+	if version > target {
+		return fmt.Errorf("Cannot downgrade DataVersion %d to %d", version, target)
+	}
+
+	self.mu.RLock()
+	list := self.list
+	self.mu.RUnlock()
+
+	for _, m := range list {
+		if m.To <= version || m.To > target {
+			continue
+		}
+		if m.From > version {
+			version = m.From
+		}
+		if err := m.Func(c); err != nil {
+			return fmt.Errorf("Migrating DataVersion %d to %d: %w", version, m.To, err)
+		}
+		version = m.To
+		c.data["DataVersion"] = entry_of(version)
+	}
+	c.data["DataVersion"] = entry_of(target)
+	return nil
+}
+
+// Registers a migration with DefaultMigrations.
+func RegisterMigration(from, to int32, f func(c *Compound) error) {
+	DefaultMigrations.Register(from, to, f)
+}
+
+// Upgrades the compound to the target version using DefaultMigrations.
+func Upgrade(c *Compound, target int32) error {
+	return DefaultMigrations.Upgrade(c, target)
+}
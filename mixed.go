@@ -0,0 +1,105 @@
+package nbt
+
+import (
+	"fmt"
+)
+
+// Reports whether the list holds elements of more than one type. Mixed lists
+// are only produced when decoding with DecodeOptions.AllowMixedLists.
+func (self *List) IsMixed() bool {
+	_, ok := self.data.([]interface{})
+	return ok
+}
+
+// Returns the elements of a mixed list as plain values: int8 through
+// float64, string, []int8, []int32, []int64, *List or *Compound.
+func (self *List) Mixed() []interface{} { return self.data.([]interface{}) }
+
+// Reports whether a compound is the wrapper around an element of a
+// heterogeneous list: a compound whose only entry is named "".
+func is_list_wrapper(c *Compound) bool {
+	_, ok := c.data[""]
+	return ok && len(c.data) == 1
+}
+
+// Turns a list of compounds containing wrapped elements into a mixed list.
+// Lists without any wrapper are left alone.
+func unwrap_mixed(list *List) {
+	compounds := list.data.([]*Compound)
+	wrapped := false
+	for _, c := range compounds {
+		if is_list_wrapper(c) {
+			wrapped = true
+			break
+		}
+	}
+	if !wrapped {
+		return
+	}
+
+	items := make([]interface{}, len(compounds))
+	for i, c := range compounds {
+		if !is_list_wrapper(c) {
+			items[i] = c
+			continue
+		}
+		v := c.data[""].value()
+		if child, ok := v.(*Compound); ok {
+			child.parent = list.parent
+		}
+		items[i] = v
+	}
+	list.data = items
+}
+
+// Writes a mixed list. If the elements turn out to share a type it is
+// written as an ordinary list, otherwise as a list of compounds with every
+// element that is not a plain compound wrapped.
+func (self *Encoder) write_mixed_list(items []interface{}) error {
+	elem := TagEnd
+	same := true
+	for i, item := range items {
+		tag, ok := tag_of(item)
+		if !ok {
+			return fmt.Errorf("Cannot encode mixed list element %d of type %T", i, item)
+		}
+		if i == 0 {
+			elem = tag
+		} else if tag != elem {
+			same = false
+		}
+	}
+	if !same {
+		elem = TagCompound
+	}
+
+	if err := self.write(byte(elem)); err != nil {
+		return err
+	}
+	if err := self.write(int32(len(items))); err != nil {
+		return err
+	}
+	for _, item := range items {
+		if c, ok := item.(*Compound); same || ok && !is_list_wrapper(c) {
+			if err := self.write_payload(item); err != nil {
+				return err
+			}
+			continue
+		}
+
+		tag, _ := tag_of(item)
+		if err := self.write(byte(tag)); err != nil {
+			return err
+		}
+		if err := self.write_string(""); err != nil {
+			return err
+		}
+		if err := self.write_payload(item); err != nil {
+			return err
+		}
+		if err := self.write(byte(TagEnd)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,17 @@
+//go:build !unix
+
+package nbt
+
+import (
+	"io"
+	"os"
+)
+
+// Reads the file into memory where it cannot be mapped.
+func mmap(f *os.File, size int64) ([]byte, func([]byte) error, error) {
+	data := make([]byte, size)
+	if _, err := io.ReadFull(f, data); err != nil {
+		return nil, nil, err
+	}
+	return data, func([]byte) error { return nil }, nil
+}
@@ -0,0 +1,20 @@
+//go:build unix
+
+package nbt
+
+import (
+	"os"
+	"syscall"
+)
+
+// Maps size bytes of the file privately into memory.
+func mmap(f *os.File, size int64) ([]byte, func([]byte) error, error) {
+	if size == 0 {
+		return []byte{}, func([]byte) error { return nil }, nil
+	}
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_PRIVATE)
+	if err != nil {
+		return nil, nil, &os.PathError{Op: "mmap", Path: f.Name(), Err: err}
+	}
+	return data, syscall.Munmap, nil
+}
@@ -25,17 +25,23 @@ Package nbt provides facilities to encode and decode NBT (Named Binary Tag) data
     10   TAG_Compound   ...     Effectively a list of a named tags
     11   TAG_Int_Array  ...     A length-prefixed array of signed integers. The
                                 prefix is presumably a signed integer.
+    12   TAG_Long_Array ...     A length-prefixed array of signed longs. The
+                                prefix is a signed integer.
 */
 package nbt
 
 import (
 	"fmt"
-	"io"
+	"reflect"
+	"sort"
 	"strings"
 )
 
+// TagType is the one byte ID identifying the type of a tag.
+type TagType byte
+
 const (
-	TagEnd byte = iota
+	TagEnd TagType = iota
 	TagByte
 	TagShort
 	TagInt
@@ -47,33 +53,272 @@ const (
 	TagList
 	TagCompound
 	TagIntArray
+	TagLongArray
 )
 
-// Compound represents an NBT TAG_Compound structure.
+var tag_names = [...]string{
+	TagEnd:       "TAG_End",
+	TagByte:      "TAG_Byte",
+	TagShort:     "TAG_Short",
+	TagInt:       "TAG_Int",
+	TagLong:      "TAG_Long",
+	TagFloat:     "TAG_Float",
+	TagDouble:    "TAG_Double",
+	TagByteArray: "TAG_Byte_Array",
+	TagString:    "TAG_String",
+	TagList:      "TAG_List",
+	TagCompound:  "TAG_Compound",
+	TagIntArray:  "TAG_Int_Array",
+	TagLongArray: "TAG_Long_Array",
+}
+
+// Returns the tag's name as used by the NBT specification, e.g.
+// "TAG_Long_Array".
+func (self TagType) String() string {
+	if int(self) < len(tag_names) {
+		return tag_names[self]
+	}
+	if ext, ok := lookup_extension(self); ok {
+		return ext.name
+	}
+	return fmt.Sprintf("TAG_Unknown(%d)", byte(self))
+}
+
+// Parses a tag type name, including the names of tags registered with
+// RegisterTag. The name is matched case-insensitively, the "TAG_" prefix and
+// the underscores are optional, so "TAG_Long_Array", "Long_Array" and
+// "longarray" all parse as TagLongArray.
+func ParseTagType(name string) (TagType, error) {
+	normalize := func(s string) string {
+		s = strings.ToLower(strings.Replace(s, "_", "", -1))
+		return strings.TrimPrefix(s, "tag")
+	}
+	wanted := normalize(name)
+	for tag, tag_name := range tag_names {
+		if normalize(tag_name) == wanted {
+			return TagType(tag), nil
+		}
+	}
+	extensions_mu.RLock()
+	defer extensions_mu.RUnlock()
+	for tag, ext := range extensions {
+		if normalize(ext.name) == wanted {
+			return tag, nil
+		}
+	}
+	return TagEnd, fmt.Errorf("Unknown tag type name: \"%s\"", name)
+}
+
+// Compound represents an NBT TAG_Compound structure. The zero value is an
+// empty, unnamed compound ready to use.
 type Compound struct {
 	name   string
-	data   map[string]interface{}
+	data   map[string]entry
 	parent *Compound
+	frozen bool
+	shared bool       // entries are shared with a clone
+	token  *cow_token // tree that owns the entries; see Clone
+	hash   *Hash      // cached once frozen
 }
 
-func (c *Compound) store(data interface{}, src io.Reader) {
-	name := read_string(src)
-	read(data, src)
-	c.data[name] = data
+// Reads a number of the given tag type into the named entry.
+func (c *Compound) store(name string, tag TagType, d *Decoder) error {
+	n, err := d.next_int(int(fixed_size(tag)))
+	if err != nil {
+		return err
+	}
+	bits := uint64(n)
+	if tag == TagFloat {
+		bits = uint64(uint32(n))
+	}
+	c.data[name] = entry{tag: tag, bits: bits}
+	return nil
 }
 
-func (self *Compound) Byte(name string) int8          { return self.data[name].(int8) }
-func (self *Compound) Short(name string) int16        { return self.data[name].(int16) }
-func (self *Compound) Int(name string) int32          { return self.data[name].(int32) }
-func (self *Compound) Long(name string) int64         { return self.data[name].(int64) }
-func (self *Compound) Float(name string) float32      { return self.data[name].(float32) }
-func (self *Compound) Double(name string) float64     { return self.data[name].(float64) }
-func (self *Compound) Compound(name string) *Compound { return self.data[name].(*Compound) }
-func (self *Compound) List(name string) *List         { return self.data[name].(*List) }
-func (self *Compound) String(name string) string      { return self.data[name].(string) }
+// The plain accessors panic if the named entry is missing or of another
+// type; they are equivalent to the Must... accessors.
+func (self *Compound) Byte(name string) int8          { return self.MustByte(name) }
+func (self *Compound) Short(name string) int16        { return self.MustShort(name) }
+func (self *Compound) Int(name string) int32          { return self.MustInt(name) }
+func (self *Compound) Long(name string) int64         { return self.MustLong(name) }
+func (self *Compound) Float(name string) float32      { return self.MustFloat(name) }
+func (self *Compound) Double(name string) float64     { return self.MustDouble(name) }
+func (self *Compound) Compound(name string) *Compound { return self.MustCompound(name) }
+func (self *Compound) List(name string) *List         { return self.MustList(name) }
+func (self *Compound) String(name string) string      { return self.MustString(name) }
 func (self *Compound) Name() string                   { return self.name }
 func (self *Compound) Len() int                       { return len(self.data) }
 
+// Returns the compound this one is an entry of, or nil if it is a root. The
+// parent of a compound that is an element of a list is the compound holding
+// the list, or the outermost list if lists are nested.
+func (self *Compound) Parent() *Compound { return self.parent }
+
+// Returns the outermost compound reached by following Parent.
+func (self *Compound) Root() *Compound {
+	root := self
+	for root.parent != nil {
+		root = root.parent
+	}
+	return root
+}
+
+// The Must... accessors panic if the named entry is missing or of another
+// type, with a message naming the compound, the entry and either the entry's
+// actual type or the entries that do exist.
+func (self *Compound) MustByte(name string) int8 {
+	n, _ := self.must(name, TagByte).number()
+	return int8(n.i)
+}
+
+func (self *Compound) MustShort(name string) int16 {
+	n, _ := self.must(name, TagShort).number()
+	return int16(n.i)
+}
+
+func (self *Compound) MustInt(name string) int32 {
+	n, _ := self.must(name, TagInt).number()
+	return int32(n.i)
+}
+
+func (self *Compound) MustLong(name string) int64 {
+	n, _ := self.must(name, TagLong).number()
+	return n.i
+}
+
+func (self *Compound) MustFloat(name string) float32 {
+	n, _ := self.must(name, TagFloat).number()
+	return float32(n.f)
+}
+
+func (self *Compound) MustDouble(name string) float64 {
+	n, _ := self.must(name, TagDouble).number()
+	return n.f
+}
+
+func (self *Compound) MustString(name string) string {
+	return self.must(name, TagString).str
+}
+
+func (self *Compound) MustCompound(name string) *Compound {
+	return self.must(name, TagCompound).ref.(*Compound)
+}
+
+func (self *Compound) MustList(name string) *List {
+	l, ok := self.must(name, TagList).value().(*List)
+	if !ok {
+		_, err := self.data[name].ref.(*LazyList).List()
+		panic(fmt.Sprintf("nbt: list \"%s\" of compound \"%s\" cannot be decoded: %v", name, self.name, err))
+	}
+	return l
+}
+
+func (self *Compound) must(name string, tag TagType) entry {
+	e, ok := self.data[name]
+	if !ok {
+		panic(fmt.Sprintf("nbt: compound \"%s\" has no entry \"%s\" (entries: %s)",
+			self.name, name, strings.Join(self.sorted_keys(), ", ")))
+	}
+	if e.tag != tag {
+		panic(fmt.Sprintf("nbt: entry \"%s\" of compound \"%s\" is %s, not %s",
+			name, self.name, e.tag, tag))
+	}
+	return e
+}
+
+// Takes over the name and contents of another compound.
+func (self *Compound) replace(c *Compound) {
+	self.name = c.name
+	self.data = c.data
+	for _, e := range self.data {
+		if child, ok := e.compound(); ok {
+			child.parent = self
+		}
+		if self.token != nil {
+			self.adopt(e.ref)
+		}
+	}
+}
+
+func (self *Compound) sorted_keys() []string {
+	keys := make([]string, 0, len(self.data))
+	for k := range self.data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// The ...Or accessors return def when the named entry is missing or is not
+// of the requested tag type, for reading optional fields.
+func (self *Compound) ByteOr(name string, def int8) int8 {
+	if n, ok := self.number_of(name, TagByte); ok {
+		return int8(n.i)
+	}
+	return def
+}
+
+func (self *Compound) ShortOr(name string, def int16) int16 {
+	if n, ok := self.number_of(name, TagShort); ok {
+		return int16(n.i)
+	}
+	return def
+}
+
+func (self *Compound) IntOr(name string, def int32) int32 {
+	if n, ok := self.number_of(name, TagInt); ok {
+		return int32(n.i)
+	}
+	return def
+}
+
+func (self *Compound) LongOr(name string, def int64) int64 {
+	if n, ok := self.number_of(name, TagLong); ok {
+		return n.i
+	}
+	return def
+}
+
+func (self *Compound) FloatOr(name string, def float32) float32 {
+	if n, ok := self.number_of(name, TagFloat); ok {
+		return float32(n.f)
+	}
+	return def
+}
+
+func (self *Compound) DoubleOr(name string, def float64) float64 {
+	if n, ok := self.number_of(name, TagDouble); ok {
+		return n.f
+	}
+	return def
+}
+
+func (self *Compound) StringOr(name string, def string) string {
+	if e := self.data[name]; e.tag == TagString {
+		return e.str
+	}
+	return def
+}
+
+func (self *Compound) CompoundOr(name string, def *Compound) *Compound {
+	if c, ok := self.data[name].compound(); ok {
+		return c
+	}
+	return def
+}
+
+func (self *Compound) ListOr(name string, def *List) *List {
+	if l, ok := self.data[name].value().(*List); ok {
+		return l
+	}
+	return def
+}
+
+func (self *Compound) number_of(name string, tag TagType) (Number, bool) {
+	n, ok := self.data[name].number()
+	return n, ok && n.Type == tag
+}
+
 // Recursively print the compound's contents
 func (self *Compound) PrettyPrint() {
 	self.pretty_print(0)
@@ -81,8 +326,10 @@ func (self *Compound) PrettyPrint() {
 func (self *Compound) pretty_print(indent_level int) {
 	fmt.Printf("%sCompound \"%s\" (%d entries):\n", strings.Repeat("    ", indent_level), self.name, len(self.data))
 	indent_level++
-	for k, v := range self.data {
+	for _, k := range self.sorted_keys() {
+		e := self.data[k]
 		spaces := strings.Repeat("    ", indent_level)
+		v := e.value()
 
 		switch v.(type) {
 		case *Compound:
@@ -93,6 +340,17 @@ func (self *Compound) pretty_print(indent_level int) {
 			fmt.Printf("%sList \"%s\" (%d entries):\n", spaces, k, l.Len())
 			spaces += "    "
 
+			if l.IsMixed() {
+				for _, v := range l.Mixed() {
+					if c, ok := v.(*Compound); ok {
+						c.pretty_print(indent_level + 1)
+					} else {
+						print_item(v, spaces, kind_name(TypeOf(v)))
+					}
+				}
+				continue
+			}
+
 			switch l.list_type {
 			case TagCompound:
 				for _, c := range l.Compounds() {
@@ -133,32 +391,44 @@ func (self *Compound) pretty_print(indent_level int) {
 				for _, v := range l.Strings() {
 					print_item(v, spaces, "String")
 				}
+
+			default:
+				for _, v := range l.items() {
+					print_item(v, spaces, kind_name(l.list_type))
+				}
 			}
 		default:
 			switch v.(type) {
-			case *int8:
-				fmt.Printf("%sByte \"%s\": %v\n", spaces, k, *v.(*int8))
-			case *int16:
-				fmt.Printf("%sShort \"%s\": %v\n", spaces, k, *v.(*int16))
-			case *int32:
-				fmt.Printf("%sInt \"%s\": %v\n", spaces, k, *v.(*int32))
-			case *int64:
-				fmt.Printf("%sLong \"%s\": %v\n", spaces, k, *v.(*int64))
-			case *float32:
-				fmt.Printf("%sFloat \"%s\": %v\n", spaces, k, *v.(*float32))
-			case *float64:
-				fmt.Printf("%sDouble \"%s\": %v\n", spaces, k, *v.(*float64))
-			case *string:
-				fmt.Printf("%sString \"%s\": %v\n", spaces, k, *v.(*string))
+			case int8:
+				fmt.Printf("%sByte \"%s\": %v\n", spaces, k, v)
+			case int16:
+				fmt.Printf("%sShort \"%s\": %v\n", spaces, k, v)
+			case int32:
+				fmt.Printf("%sInt \"%s\": %v\n", spaces, k, v)
+			case int64:
+				fmt.Printf("%sLong \"%s\": %v\n", spaces, k, v)
+			case float32:
+				fmt.Printf("%sFloat \"%s\": %v\n", spaces, k, v)
+			case float64:
+				fmt.Printf("%sDouble \"%s\": %v\n", spaces, k, v)
+			case string:
+				fmt.Printf("%sString \"%s\": %v\n", spaces, k, v)
 			case []int8:
 				fmt.Printf("%sByte Array \"%s\": [%d]\n", spaces, k, len(v.([]int8)))
 			case []int32:
 				fmt.Printf("%sInt Array \"%s\": [%d]\n", spaces, k, len(v.([]int32)))
+			case []int64:
+				fmt.Printf("%sLong Array \"%s\": [%d]\n", spaces, k, len(v.([]int64)))
 			}
 		}
 	}
 }
 
+// Returns the name PrettyPrint uses for a tag type, e.g. "Byte Array".
+func kind_name(tag TagType) string {
+	return strings.Replace(strings.TrimPrefix(tag.String(), "TAG_"), "_", " ", -1)
+}
+
 func print_item(thing interface{}, spaces, kind string) {
 	fmt.Printf("%s%s: %v\n", spaces, kind, thing)
 }
@@ -166,12 +436,16 @@ func print_item(thing interface{}, spaces, kind string) {
 // List represents an NBT TAG_List structure. 
 type List struct {
 	name      string
-	list_type byte
+	list_type TagType
 	data      interface{}
 	length    int32
+	parent    *Compound // the compound holding the list, or nil if unknown
+	token     *cow_token
+	frozen    bool
+	hash      *Hash
 }
 
-func (self *List) ListType() byte         { return self.list_type }
+func (self *List) ListType() TagType      { return self.list_type }
 func (self *List) Len() int               { return int(self.length) }
 func (self *List) Bytes() []int8          { return self.data.([]int8) }
 func (self *List) Shorts() []int16        { return self.data.([]int16) }
@@ -181,3 +455,133 @@ func (self *List) Floats() []float32      { return self.data.([]float32) }
 func (self *List) Doubles() []float64     { return self.data.([]float64) }
 func (self *List) Strings() []string      { return self.data.([]string) }
 func (self *List) Compounds() []*Compound { return self.data.([]*Compound) }
+
+// Returns the list's elements one by one, as plain values.
+func (self *List) items() []interface{} {
+	if self.data == nil {
+		return nil
+	}
+	v := reflect.ValueOf(self.data)
+	items := make([]interface{}, v.Len())
+	for i := range items {
+		items[i] = v.Index(i).Interface()
+	}
+	return items
+}
+
+// Go types of the elements of a List's data for each element tag type.
+var list_elem_types = map[TagType]reflect.Type{
+	TagByte:      reflect.TypeOf(int8(0)),
+	TagShort:     reflect.TypeOf(int16(0)),
+	TagInt:       reflect.TypeOf(int32(0)),
+	TagLong:      reflect.TypeOf(int64(0)),
+	TagFloat:     reflect.TypeOf(float32(0)),
+	TagDouble:    reflect.TypeOf(float64(0)),
+	TagByteArray: reflect.TypeOf([]int8(nil)),
+	TagString:    reflect.TypeOf(""),
+	TagList:      reflect.TypeOf((*List)(nil)),
+	TagCompound:  reflect.TypeOf((*Compound)(nil)),
+	TagIntArray:  reflect.TypeOf([]int32(nil)),
+	TagLongArray: reflect.TypeOf([]int64(nil)),
+}
+
+// Builds a list of elem tags out of individual values, which may be boxed the
+// way Compound entries are.
+func new_list(name string, elem TagType, items []interface{}) (*List, error) {
+	list := &List{name: name, list_type: elem, length: int32(len(items))}
+	if elem == TagEnd {
+		if len(items) > 0 {
+			return nil, fmt.Errorf("List \"%s\" of TAG_End is not empty", name)
+		}
+		return list, nil
+	}
+
+	t, ok := list_elem_types[elem]
+	if !ok {
+		return nil, fmt.Errorf("List \"%s\": invalid element type %v", name, elem)
+	}
+	data := reflect.MakeSlice(reflect.SliceOf(t), 0, len(items))
+	for i, item := range items {
+		item = unbox(item)
+		if tag, _ := tag_of(item); tag != elem {
+			return nil, fmt.Errorf("List \"%s\" of %v: element %d is %T", name, elem, i, item)
+		}
+		data = reflect.Append(data, reflect.ValueOf(item))
+	}
+	list.data = data.Interface()
+	return list, nil
+}
+
+// Returns the plain value behind a boxed scalar (*int8, *string, ...) or a
+// Number, and any other value unchanged.
+func unbox(v interface{}) interface{} {
+	switch v := v.(type) {
+	case *int8:
+		return *v
+	case *int16:
+		return *v
+	case *int32:
+		return *v
+	case *int64:
+		return *v
+	case *float32:
+		return *v
+	case *float64:
+		return *v
+	case *string:
+		return *v
+	case Number:
+		return v.Value()
+	}
+	return v
+}
+
+// Returns a deep copy of a value as stored in a Compound or List, so that
+// the copy shares no mutable memory with the original. Copied compounds get
+// parent as their parent.
+func copy_value(v interface{}, parent *Compound) interface{} {
+	switch v := v.(type) {
+	case []int8:
+		return append([]int8(nil), v...)
+	case []int32:
+		return append([]int32(nil), v...)
+	case []int64:
+		return append([]int64(nil), v...)
+	case *Compound:
+		c := &Compound{name: v.name, parent: parent, data: make(map[string]entry, len(v.data))}
+		for k, child := range v.data {
+			child.ref = copy_value(child.ref, c)
+			if l, ok := child.ref.(*List); ok {
+				l.set_parent(c)
+			}
+			c.data[k] = child
+		}
+		return c
+	case *List:
+		l := *v
+		l.parent, l.token, l.frozen, l.hash = nil, nil, false, nil
+		if v.data != nil {
+			src := reflect.ValueOf(v.data)
+			dst := reflect.MakeSlice(src.Type(), src.Len(), src.Len())
+			reflect.Copy(dst, src)
+			switch src.Interface().(type) {
+			case []int8, []int16, []int32, []int64, []float32, []float64, []string:
+			default:
+				for i := 0; i < dst.Len(); i++ {
+					item := copy_value(dst.Index(i).Interface(), nil)
+					if item == nil {
+						continue
+					}
+					dst.Index(i).Set(reflect.ValueOf(item))
+				}
+			}
+			l.data = dst.Interface()
+		}
+		return &l
+	case *LazyList:
+		if l, err := v.List(); err == nil {
+			return copy_value(l, parent)
+		}
+	}
+	return v
+}
@@ -2,8 +2,21 @@ package nbt
 
 import (
 	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"hash/crc32"
+	"io"
 	"io/ioutil"
+	"log/slog"
+	"math"
+	"os"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 /*
@@ -70,3 +83,2611 @@ func TestDecodeGzip(t *testing.T) {
 
 	data.PrettyPrint()
 }
+
+// TAG_Compound('hello world'): TAG_String('name'): 'Bananrama'
+var helloWorld = []byte{
+	0x0a, 0x00, 0x0b, 'h', 'e', 'l', 'l', 'o', ' ', 'w', 'o', 'r', 'l', 'd',
+	0x08, 0x00, 0x04, 'n', 'a', 'm', 'e',
+	0x00, 0x09, 'B', 'a', 'n', 'a', 'n', 'r', 'a', 'm', 'a',
+	0x00,
+}
+
+func TestMarshalBytes(t *testing.T) {
+	data, err := DecodeBytes(helloWorld)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if name := data.String("name"); name != "Bananrama" {
+		t.Errorf("in /name: expected 'Bananrama', got %s", name)
+	}
+
+	b, err := data.MarshalBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, helloWorld) {
+		t.Errorf("round trip mismatch:\nexpected % x\ngot      % x", helloWorld, b)
+	}
+}
+
+func TestWriteToReadFrom(t *testing.T) {
+	data, err := DecodeBytes(helloWorld)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := new(bytes.Buffer)
+	n, err := data.WriteTo(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(helloWorld)) {
+		t.Errorf("WriteTo: expected %d bytes written, got %d", len(helloWorld), n)
+	}
+
+	// trailing bytes after the document must be left unread
+	buf.WriteString("trailer")
+	c := new(Compound)
+	n, err = c.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(helloWorld)) {
+		t.Errorf("ReadFrom: expected %d bytes read, got %d", len(helloWorld), n)
+	}
+	if c.Name() != "hello world" || c.String("name") != "Bananrama" {
+		t.Errorf("ReadFrom: decoded wrong contents")
+	}
+	if buf.String() != "trailer" {
+		t.Errorf("ReadFrom: consumed past the end of the document")
+	}
+}
+
+func TestValid(t *testing.T) {
+	if !Valid(helloWorld) {
+		t.Errorf("Valid rejected a well-formed document")
+	}
+	for i := 0; i < len(helloWorld); i++ {
+		if Valid(helloWorld[:i]) {
+			t.Errorf("Valid accepted a document truncated to %d bytes", i)
+		}
+	}
+	if Valid(append(append([]byte{}, helloWorld...), 0)) {
+		t.Errorf("Valid accepted trailing data")
+	}
+
+	// TAG_Compound(''): TAG_List('l') of 2^31-1 compounds
+	huge := []byte{0x0a, 0x00, 0x00, 0x09, 0x00, 0x01, 'l', 0x0a, 0x7f, 0xff, 0xff, 0xff, 0x00, 0x00}
+	if Valid(huge) {
+		t.Errorf("Valid accepted an impossible list length")
+	}
+}
+
+func TestNumber(t *testing.T) {
+	c := &Compound{name: "", data: map[string]entry{}}
+	c.data["b"] = entry_of(int8(100))
+
+	n, ok := c.Number("b")
+	if !ok || n.Type != TagByte || n.Int64() != 100 {
+		t.Fatalf("Number(\"b\"): got %v (%v)", n, ok)
+	}
+
+	// doubling overflows a TAG_Byte, which must wrap rather than widen
+	n = n.WithInt64(n.Int64() * 2)
+	if n.Int64() != -56 {
+		t.Errorf("WithInt64: expected -56, got %v", n)
+	}
+
+	c.data["b"] = entry_of(n)
+	out, err := c.MarshalBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []byte{0x0a, 0x00, 0x00, 0x01, 0x00, 0x01, 'b', 0xc8, 0x00}
+	if !bytes.Equal(out, expected) {
+		t.Errorf("expected % x, got % x", expected, out)
+	}
+
+	if _, ok := NumberOf("not a number"); ok {
+		t.Errorf("NumberOf accepted a string")
+	}
+}
+
+func TestAnyInt(t *testing.T) {
+	c := &Compound{data: map[string]entry{
+		"b": entry_of(int8(1)), "l": entry_of(int64(1 << 40)), "f": entry_of(float32(2.5)), "s": entry_of("1"),
+	}}
+
+	if n, ok := c.AnyInt("b"); !ok || n != 1 {
+		t.Errorf("AnyInt(\"b\"): got %d, %v", n, ok)
+	}
+	if n, ok := c.AnyInt("l"); !ok || n != 1<<40 {
+		t.Errorf("AnyInt(\"l\"): got %d, %v", n, ok)
+	}
+	if _, ok := c.AnyInt("f"); ok {
+		t.Errorf("AnyInt(\"f\"): accepted a fractional float")
+	}
+	if _, ok := c.AnyInt("s"); ok {
+		t.Errorf("AnyInt(\"s\"): accepted a string")
+	}
+	for _, f := range []float64{math.Inf(1), math.Inf(-1), math.NaN(), 1e300, -1e300, 1 << 63} {
+		d := &Compound{data: map[string]entry{"f": entry_of(f)}}
+		if n, ok := d.AnyInt("f"); ok {
+			t.Errorf("AnyInt(%v): accepted as %d", f, n)
+		}
+	}
+	d := &Compound{data: map[string]entry{"f": entry_of(float64(-1 << 63))}}
+	if n, ok := d.AnyInt("f"); !ok || n != -1<<63 {
+		t.Errorf("AnyInt(-2^63): got %d, %v", n, ok)
+	}
+	if _, ok := c.AnyInt("missing"); ok {
+		t.Errorf("AnyInt(\"missing\"): accepted a missing key")
+	}
+	if n, ok := c.AnyFloat("f"); !ok || n != 2.5 {
+		t.Errorf("AnyFloat(\"f\"): got %v, %v", n, ok)
+	}
+
+	// scalars are stored unboxed, so reading them does not allocate
+	allocs := testing.AllocsPerRun(100, func() {
+		c.AnyInt("l")
+		c.MustLong("l")
+		c.FloatOr("f", 0)
+		c.StringOr("s", "")
+		c.Number("b")
+	})
+	if allocs != 0 {
+		t.Errorf("reading scalars: expected no allocations, got %v", allocs)
+	}
+}
+
+func TestOrAccessors(t *testing.T) {
+	data, err := DecodeBytes(helloWorld)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s := data.StringOr("name", "nobody"); s != "Bananrama" {
+		t.Errorf("StringOr(\"name\"): expected 'Bananrama', got %s", s)
+	}
+	if s := data.StringOr("CustomName", "nobody"); s != "nobody" {
+		t.Errorf("StringOr(\"CustomName\"): expected the default, got %s", s)
+	}
+	if n := data.IntOr("name", 7); n != 7 {
+		t.Errorf("IntOr(\"name\"): expected the default for a mistyped entry, got %d", n)
+	}
+	if c := data.CompoundOr("name", nil); c != nil {
+		t.Errorf("CompoundOr(\"name\"): expected the default for a mistyped entry")
+	}
+}
+
+func TestMustPanics(t *testing.T) {
+	data, err := DecodeBytes(helloWorld)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectPanic := func(expected string, f func()) {
+		defer func() {
+			if r := recover(); r != expected {
+				t.Errorf("expected panic %q, got %v", expected, r)
+			}
+		}()
+		f()
+	}
+	expectPanic(`nbt: compound "hello world" has no entry "nmae" (entries: name)`, func() { data.MustString("nmae") })
+	expectPanic(`nbt: entry "name" of compound "hello world" is TAG_String, not TAG_Int`, func() { data.MustInt("name") })
+
+	data.data["i"] = entry_of(int32(5))
+	if n := data.Int("i"); n != 5 {
+		t.Errorf("Int(\"i\"): expected 5, got %d", n)
+	}
+}
+
+func TestTagType(t *testing.T) {
+	if s := TagLongArray.String(); s != "TAG_Long_Array" {
+		t.Errorf("TagLongArray.String(): got %s", s)
+	}
+	for _, name := range []string{"TAG_Long_Array", "Long_Array", "longarray"} {
+		if tag, err := ParseTagType(name); err != nil || tag != TagLongArray {
+			t.Errorf("ParseTagType(%q): got %v, %v", name, tag, err)
+		}
+	}
+	if _, err := ParseTagType("TAG_Nope"); err == nil {
+		t.Errorf("ParseTagType accepted an unknown name")
+	}
+	if s := TagType(99).String(); s != "TAG_Unknown(99)" {
+		t.Errorf("TagType(99).String(): got %s", s)
+	}
+}
+
+func TestTypeOf(t *testing.T) {
+	var i int32
+	tests := []struct {
+		v   interface{}
+		tag TagType
+	}{
+		{true, TagByte},
+		{&i, TagInt},
+		{uint16(1), TagShort},
+		{[]byte("abc"), TagByteArray},
+		{[]int64{1}, TagLongArray},
+		{[]string{"a"}, TagList},
+		{map[string]interface{}{}, TagCompound},
+		{struct{ X int }{}, TagCompound},
+		{new(List), TagList},
+		{Number{Type: TagFloat}, TagFloat},
+		{nil, TagEnd},
+		{make(chan int), TagEnd},
+	}
+	for _, test := range tests {
+		if tag := TypeOf(test.v); tag != test.tag {
+			t.Errorf("TypeOf(%#v): expected %v, got %v", test.v, test.tag, tag)
+		}
+	}
+}
+
+func TestTagTree(t *testing.T) {
+	data, err := DecodeBytes(helloWorld)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tree := data.Tag()
+	if s, ok := tree.Get("name").(*StringTag); !ok || s.Value != "Bananrama" {
+		t.Fatalf("Tag(): expected /name to be StringTag 'Bananrama', got %#v", tree.Get("name"))
+	}
+
+	tree.Value = append(tree.Value, &ListTag{Name: "pos", Elem: TagDouble, Value: []Tag{
+		&DoubleTag{Value: 1.5}, &DoubleTag{Value: -2},
+	}})
+	c, err := tree.Compound()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pos := c.List("pos").Doubles(); len(pos) != 2 || pos[1] != -2 {
+		t.Errorf("Compound(): expected /pos to be [1.5 -2], got %v", pos)
+	}
+
+	tree.Value = append(tree.Value, &ListTag{Name: "bad", Elem: TagInt, Value: []Tag{&ByteTag{}}})
+	if _, err := tree.Compound(); err == nil {
+		t.Errorf("Compound(): accepted a list with a mistyped element")
+	}
+}
+
+func TestMixedList(t *testing.T) {
+	// TAG_Compound(''): TAG_List('l') of [{'': 1}, {'': "a"}, {'x': 2b}]
+	doc := []byte{
+		0x0a, 0x00, 0x00,
+		0x09, 0x00, 0x01, 'l', 0x0a, 0x00, 0x00, 0x00, 0x03,
+		0x03, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00,
+		0x08, 0x00, 0x00, 0x00, 0x01, 'a', 0x00,
+		0x01, 0x00, 0x01, 'x', 0x02, 0x00,
+		0x00,
+	}
+
+	plain, err := DecodeBytes(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := plain.List("l"); l.IsMixed() || len(l.Compounds()) != 3 {
+		t.Errorf("without AllowMixedLists: expected a list of 3 compounds")
+	}
+
+	dec := NewDecoder(bytes.NewReader(doc))
+	dec.AllowMixedLists = true
+	mixed, err := dec.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := mixed.List("l").Mixed()
+	if len(items) != 3 || items[0] != int32(1) || items[1] != "a" || items[2].(*Compound).Byte("x") != 2 {
+		t.Errorf("with AllowMixedLists: got %v", items)
+	}
+
+	out, err := mixed.MarshalBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, doc) {
+		t.Errorf("round trip mismatch:\nexpected % x\ngot      % x", doc, out)
+	}
+}
+
+// A made-up TAG_UUID holding two longs.
+type uuidHandler struct{}
+
+func (uuidHandler) DecodeTag(src io.Reader) (interface{}, error) {
+	var v [2]int64
+	err := binary.Read(src, binary.BigEndian, &v)
+	return v, err
+}
+
+func (uuidHandler) EncodeTag(dst io.Writer, v interface{}) error {
+	return binary.Write(dst, binary.BigEndian, v.([2]int64))
+}
+
+func TestRegisterTag(t *testing.T) {
+	const TagUUID TagType = 100
+	RegisterTag(TagUUID, "TAG_UUID", uuidHandler{})
+
+	doc := []byte{
+		0x0a, 0x00, 0x00,
+		100, 0x00, 0x02, 'i', 'd', 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 2,
+		0x00,
+	}
+	c, err := DecodeBytes(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ext := c.data["id"].ref.(Extension); ext.Type != TagUUID || ext.Value != [2]int64{1, 2} {
+		t.Errorf("expected a decoded TAG_UUID, got %#v", ext)
+	}
+	if out, err := c.MarshalBytes(); err != nil || !bytes.Equal(out, doc) {
+		t.Errorf("round trip: got % x, %v", out, err)
+	}
+	if tag, err := ParseTagType("uuid"); err != nil || tag != TagUUID || tag.String() != "TAG_UUID" {
+		t.Errorf("ParseTagType(\"uuid\"): got %v, %v", tag, err)
+	}
+
+	// extension payloads count against the limits like any others
+	huge := []byte{0x0a, 0x00, 0x00, 0x09, 0x00, 0x01, 'l', 100, 0x7f, 0xff, 0xff, 0xff, 0, 0, 0, 0}
+	if _, err := DecodeBytes(huge); !errors.Is(err, ErrTruncated) {
+		t.Errorf("huge list of TAG_UUID: expected ErrTruncated, got %v", err)
+	}
+	dec := NewDecoder(bytes.NewReader(doc))
+	dec.MaxBytes = 16
+	if _, err := dec.Decode(); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("TAG_UUID past MaxBytes: expected ErrTooLarge, got %v", err)
+	}
+}
+
+func TestDecodeAny(t *testing.T) {
+	// the same document in little endian
+	le := append([]byte{}, helloWorld...)
+	le[1], le[2] = le[2], le[1]
+	le[15], le[16] = le[16], le[15]
+	le[21], le[22] = le[22], le[21]
+	header := append([]byte{8, 0, 0, 0, byte(len(le)), 0, 0, 0}, le...)
+
+	gz := new(bytes.Buffer)
+	w := gzip.NewWriter(gz)
+	w.Write(helloWorld)
+	w.Close()
+
+	zl := new(bytes.Buffer)
+	zw := zlib.NewWriter(zl)
+	zw.Write(helloWorld)
+	zw.Close()
+
+	tests := []struct {
+		data   []byte
+		format Format
+	}{
+		{helloWorld, Format{Uncompressed, binary.BigEndian, false, 0}},
+		{gz.Bytes(), Format{Gzip, binary.BigEndian, false, 0}},
+		{zl.Bytes(), Format{Zlib, binary.BigEndian, false, 0}},
+		{le, Format{Uncompressed, binary.LittleEndian, false, 0}},
+		{header, Format{Uncompressed, binary.LittleEndian, true, 8}},
+	}
+	for _, test := range tests {
+		c, f, err := DecodeAny(test.data)
+		if err != nil {
+			t.Errorf("DecodeAny(%v): %v", test.format, err)
+			continue
+		}
+		if f != test.format {
+			t.Errorf("DecodeAny: expected %v, got %v", test.format, f)
+		}
+		if s := c.StringOr("name", ""); s != "Bananrama" {
+			t.Errorf("DecodeAny(%v): expected /name 'Bananrama', got %s", test.format, s)
+		}
+	}
+}
+
+func TestMarshalText(t *testing.T) {
+	inner := &Compound{name: "x", data: map[string]entry{"f": entry_of(float32(0.1))}}
+	ints, _ := new_list("ints", TagInt, []interface{}{int32(1), int32(2)})
+	c := &Compound{name: "root", data: map[string]entry{
+		"l": entry_of(int64(-3)), "s": entry_of(`say "hi"`), "x": entry_of(inner),
+		"a b": entry_of([]int8{1, -1}), "ints": entry_of(ints),
+	}}
+
+	snbt, err := MarshalSNBT(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"a b":[B;1b,-1b],ints:[1,2],l:-3L,s:'say "hi"',x:{f:0.1f}}`
+	if string(snbt) != expected {
+		t.Errorf("MarshalSNBT:\nexpected %s\ngot      %s", expected, snbt)
+	}
+
+	js, err := c.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = `{"type":"compound","name":"root","value":{` +
+		`"a b":{"type":"byte_array","value":[1,-1]},` +
+		`"ints":{"type":"list","value":{"elem":"int","items":[1,2]}},` +
+		`"l":{"type":"long","value":-3},` +
+		`"s":{"type":"string","value":"say \"hi\""},` +
+		`"x":{"type":"compound","value":{"f":{"type":"float","value":0.1}}}}}`
+	if string(js) != expected {
+		t.Errorf("MarshalJSON:\nexpected %s\ngot      %s", expected, js)
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	doc := []byte{
+		0x0a, 0x00, 0x04, 'r', 'o', 'o', 't',
+		0x0a, 0x00, 0x01, 'c', 0x0c, 0x00, 0x01, 'a', 0x00, 0x00, 0x00, 0x01, 0, 0, 0, 0, 0, 0, 0, 9, 0x00,
+		0x04, 0x00, 0x01, 'l', 0x7f, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+		0x09, 0x00, 0x01, 'n', 0x09, 0x00, 0x00, 0x00, 0x01,
+		0x05, 0x00, 0x00, 0x00, 0x01, 0x3f, 0x00, 0x00, 0x00,
+		0x00,
+	}
+	c, err := DecodeBytes(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	js, err := c.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	back := new(Compound)
+	if err := back.UnmarshalJSON(js); err != nil {
+		t.Fatal(err)
+	}
+	out, err := back.MarshalBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, doc) {
+		t.Errorf("round trip through %s:\nexpected % x\ngot      % x", js, doc, out)
+	}
+	if back.Compound("c").parent != back {
+		t.Errorf("UnmarshalJSON: nested compound has the wrong parent")
+	}
+}
+
+func TestJSONStream(t *testing.T) {
+	c, err := DecodeBytes(helloWorld)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner := &Compound{data: map[string]entry{"f": entry_of(float32(0.1)), "s": entry_of("<\x01\U0001F600>")}}
+	list, _ := new_list("l", TagCompound, []interface{}{inner})
+	nested, _ := new_list("n", TagList, []interface{}{list})
+	c.data["n"] = entry_of(nested)
+	c.data["ints"] = entry_of([]int32{1, -2})
+	c.data["d"] = entry_of(1e-7)
+	c.data["e"] = entry_of(&List{list_type: TagEnd})
+	doc, err := c.MarshalBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	js := new(bytes.Buffer)
+	if err := NBTToJSON(js, bytes.NewReader(append(append([]byte{}, doc...), doc...))); err != nil {
+		t.Fatal(err)
+	}
+	expected, err := c.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(js.String(), "\n")
+	if len(lines) != 3 || lines[0] != lines[1] || lines[2] != "" {
+		t.Fatalf("NBTToJSON: expected two documents, got %s", js)
+	}
+	from_json := new(Compound)
+	if err := from_json.UnmarshalJSON([]byte(lines[0])); err != nil {
+		t.Fatal(err)
+	}
+	if changes := Diff(c, from_json); len(changes) > 0 {
+		t.Errorf("NBTToJSON: %v", changes)
+	}
+	// the same but for encoding/json escaping < and >
+	if html := strings.NewReplacer(`\u003c`, "<", `\u003e`, ">").Replace(string(expected)); lines[0] != html {
+		t.Errorf("NBTToJSON:\nexpected %s\ngot      %s", html, lines[0])
+	}
+
+	out := new(bytes.Buffer)
+	if err := JSONToNBT(out, js); err != nil {
+		t.Fatal(err)
+	}
+	if want := append(append([]byte{}, doc...), doc...); !bytes.Equal(out.Bytes(), want) {
+		t.Errorf("JSONToNBT:\nexpected % x\ngot      % x", want, out.Bytes())
+	}
+
+	mixed := `{"type":"compound","value":{"m":{"type":"list","value":{"elem":"mixed","items":[` +
+		`{"type":"int","value":1},{"type":"string","value":"a"},{"type":"compound","value":{}}]}}}}`
+	out.Reset()
+	if err := JSONToNBT(out, strings.NewReader(mixed)); err != nil {
+		t.Fatal(err)
+	}
+	got, err := DecodeOptions{AllowMixedLists: true}.DecodeBytes(out.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := new(Compound)
+	if err := want.UnmarshalJSON([]byte(mixed)); err != nil {
+		t.Fatal(err)
+	}
+	if changes := Diff(want, got); len(changes) > 0 {
+		t.Errorf("JSONToNBT of a mixed list: %v", changes)
+	}
+
+	for _, bad := range []string{
+		`{"value":{},"type":"compound"}`,
+		`{"type":"int","value":1}`,
+		`{"type":"compound","value":{"b":{"type":"byte","value":300}}}`,
+		`{"type":"compound","value":{"l":{"type":"list","value":{"items":[],"elem":"int"}}}}`,
+	} {
+		if err := JSONToNBT(io.Discard, strings.NewReader(bad)); err == nil {
+			t.Errorf("JSONToNBT(%s): expected an error", bad)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	a, err := (&CompoundTag{Value: []Tag{
+		&StringTag{"name", "Bananrama"},
+		&IntTag{"gone", 1},
+		&ListTag{Name: "pos", Elem: TagDouble, Value: []Tag{&DoubleTag{Value: 1}, &DoubleTag{Value: 2}}},
+		&CompoundTag{Name: "data", Value: []Tag{&ByteTag{"flag", 0}}},
+	}}).Compound()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := (&CompoundTag{Value: []Tag{
+		&StringTag{"name", "Bananrama"},
+		&ListTag{Name: "pos", Elem: TagDouble, Value: []Tag{&DoubleTag{Value: 1}, &DoubleTag{Value: 3}, &DoubleTag{Value: 4}}},
+		&CompoundTag{Name: "data", Value: []Tag{&ShortTag{"flag", 0}, &StringTag{"new", "x"}}},
+	}}).Compound()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		`~ .data.flag: 0b -> 0s`,
+		`+ .data.new: "x"`,
+		`- .gone: 1`,
+		`~ .pos[1]: 2.0d -> 3.0d`,
+		`+ .pos[2]: 4.0d`,
+	}
+	changes := Diff(a, b)
+	if len(changes) != len(expected) {
+		t.Fatalf("Diff: expected %d changes, got %v", len(expected), changes)
+	}
+	for i, c := range changes {
+		if s := c.String(); s != expected[i] {
+			t.Errorf("Diff: change %d: expected %s, got %s", i, expected[i], s)
+		}
+	}
+
+	if len(Diff(a, a)) != 0 || !Equal(a, a) {
+		t.Errorf("Diff: a document differs from itself")
+	}
+	if Equal(a, b) {
+		t.Errorf("Equal: different documents are equal")
+	}
+}
+
+func TestMerge3(t *testing.T) {
+	doc := func(tags ...Tag) *Compound {
+		c, err := (&CompoundTag{Value: tags}).Compound()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	base := doc(
+		&StringTag{"name", "Bananrama"},
+		&IntTag{"gone", 1},
+		&IntTag{"score", 5},
+		&ListTag{Name: "pos", Elem: TagDouble, Value: []Tag{&DoubleTag{Value: 1}, &DoubleTag{Value: 2}}},
+		&ListTag{Name: "inv", Elem: TagString, Value: []Tag{&StringTag{Value: "apple"}}},
+	)
+	ours := doc(
+		&StringTag{"name", "Bananrama"},
+		&IntTag{"score", 6},
+		&ListTag{Name: "pos", Elem: TagDouble, Value: []Tag{&DoubleTag{Value: 3}, &DoubleTag{Value: 2}}},
+		&ListTag{Name: "inv", Elem: TagString, Value: []Tag{&StringTag{Value: "apple"}, &StringTag{Value: "pear"}}},
+	)
+	theirs := doc(
+		&StringTag{"name", "Bananarama"},
+		&IntTag{"score", 7},
+		&ListTag{Name: "pos", Elem: TagDouble, Value: []Tag{&DoubleTag{Value: 1}, &DoubleTag{Value: 4}}},
+		&ListTag{Name: "inv", Elem: TagString, Value: []Tag{&StringTag{Value: "plum"}}},
+		&ByteTag{"new", 1},
+	)
+	before := []*Compound{copy_value(base, nil).(*Compound), copy_value(ours, nil).(*Compound), copy_value(theirs, nil).(*Compound)}
+
+	merged, conflicts := Merge3(base, ours, theirs)
+	expected := doc(
+		&StringTag{"name", "Bananarama"},
+		&IntTag{"score", 6},
+		&ListTag{Name: "pos", Elem: TagDouble, Value: []Tag{&DoubleTag{Value: 3}, &DoubleTag{Value: 4}}},
+		&ListTag{Name: "inv", Elem: TagString, Value: []Tag{&StringTag{Value: "apple"}, &StringTag{Value: "pear"}}},
+		&ByteTag{"new", 1},
+	)
+	if !Equal(merged, expected) {
+		t.Errorf("Merge3: expected %v, got %v", Diff(expected, merged), merged)
+	}
+	expected_conflicts := []string{
+		`! .inv: base ["apple"], ours ["apple","pear"], theirs ["plum"]`,
+		`! .score: base 5, ours 6, theirs 7`,
+	}
+	if len(conflicts) != len(expected_conflicts) {
+		t.Fatalf("Merge3: expected %d conflicts, got %v", len(expected_conflicts), conflicts)
+	}
+	for i, c := range conflicts {
+		if s := c.String(); s != expected_conflicts[i] {
+			t.Errorf("Merge3: conflict %d: expected %s, got %s", i, expected_conflicts[i], s)
+		}
+	}
+	for i, c := range []*Compound{base, ours, theirs} {
+		if !Equal(c, before[i]) {
+			t.Errorf("Merge3: argument %d modified: %v", i, Diff(before[i], c))
+		}
+	}
+
+	// The same change on both sides is no conflict.
+	merged, conflicts = Merge3(base, theirs, theirs)
+	if len(conflicts) != 0 || !Equal(merged, theirs) {
+		t.Errorf("Merge3: identical changes: got %v, %v", merged, conflicts)
+	}
+
+	// Both entries of a compound changed differently on both sides, and the
+	// compound removed by theirs while ours changed both.
+	pet := func(x, y int32) Tag {
+		return &CompoundTag{Name: "pet", Value: []Tag{&IntTag{"x", x}, &IntTag{"y", y}}}
+	}
+	base, ours = doc(pet(1, 1)), doc(pet(2, 2))
+	merged, conflicts = Merge3(base, ours, doc(pet(3, 3)))
+	if len(conflicts) != 2 || conflicts[0].String() != "! .pet.x: base 1, ours 2, theirs 3" ||
+		conflicts[1].String() != "! .pet.y: base 1, ours 2, theirs 3" || !Equal(merged, ours) {
+		t.Errorf("Merge3: two conflicting entries: got %v, %v", merged, conflicts)
+	}
+	merged, conflicts = Merge3(base, ours, doc())
+	if len(conflicts) != 1 || conflicts[0].Path.String() != ".pet" || !Equal(merged, ours) {
+		t.Errorf("Merge3: removed compound: got %v, %v", merged, conflicts)
+	}
+}
+
+func TestEditHistory(t *testing.T) {
+	c, err := (&CompoundTag{Value: []Tag{
+		&StringTag{"name", "Bananrama"},
+		&IntTag{"gone", 1},
+		&ListTag{Name: "pos", Elem: TagDouble, Value: []Tag{&DoubleTag{Value: 1}, &DoubleTag{Value: 2}}},
+		&ByteArrayTag{"data", []int8{1, 2, 3}},
+		&CompoundTag{Name: "inner", Value: []Tag{&ShortTag{"x", 5}}},
+	}}).Compound()
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := copy_value(c, nil).(*Compound)
+	s := NewEditSession(c)
+
+	ops := []func() error{
+		func() error { return s.Set(Path{{Key: "name"}}, "Bananarama") },
+		func() error { return s.Delete(Path{{Key: "gone"}}) },
+		func() error { return s.Append(Path{{Key: "pos"}}, 3.0) },
+		func() error { return s.Delete(Path{{Key: "pos"}, {Index: 0, IsIndex: true}}) },
+		func() error { return s.Delete(Path{{Key: "data"}, {Index: -1, IsIndex: true}}) },
+		func() error { return s.Append(Path{{Key: "data"}}, int8(9)) },
+		func() error { return s.Set(Path{{Key: "inner"}, {Key: "x"}}, int16(6)) },
+	}
+	var states []*Compound
+	for i, op := range ops {
+		states = append(states, copy_value(c, nil).(*Compound))
+		if err := op(); err != nil {
+			t.Fatalf("EditSession: op %d: %v", i, err)
+		}
+	}
+	end := copy_value(c, nil).(*Compound)
+	if s := c.String("name"); s != "Bananarama" {
+		t.Errorf("EditSession: expected name Bananarama, got %s", s)
+	}
+	if _, ok := c.data["gone"]; ok {
+		t.Errorf("EditSession: gone was not deleted")
+	}
+	if d := c.List("pos").Doubles(); len(d) != 2 || d[0] != 2 || d[1] != 3 {
+		t.Errorf("EditSession: expected pos [2 3], got %v", d)
+	}
+	if d := c.data["data"].value().([]int8); len(d) != 3 || d[0] != 1 || d[1] != 2 || d[2] != 9 {
+		t.Errorf("EditSession: expected data [1 2 9], got %v", d)
+	}
+
+	expected := []string{
+		`set .name "Bananarama"`,
+		`delete .gone`,
+		`append .pos 3.0d`,
+		`delete .pos[0]`,
+		`delete .data[-1]`,
+		`append .data 9b`,
+		`set .inner.x 6s`,
+	}
+	log := s.Log()
+	if len(log) != len(expected) {
+		t.Fatalf("EditSession: expected %d ops, got %v", len(expected), log)
+	}
+	for i, op := range log {
+		if s := op.String(); s != expected[i] {
+			t.Errorf("EditSession: op %d: expected %s, got %s", i, expected[i], s)
+		}
+	}
+
+	for i := len(ops) - 1; i >= 0; i-- {
+		if !s.Undo() {
+			t.Fatalf("EditSession: nothing to undo at op %d", i)
+		}
+		if !Equal(c, states[i]) {
+			t.Errorf("EditSession: undoing op %d: %v", i, Diff(states[i], c))
+		}
+	}
+	if s.Undo() || !Equal(c, start) {
+		t.Errorf("EditSession: undid past the start")
+	}
+	for s.Redo() {
+	}
+	if !Equal(c, end) {
+		t.Errorf("EditSession: redoing: %v", Diff(end, c))
+	}
+
+	// Replaying the log on the original document gives the same result.
+	replay := NewEditSession(start)
+	for _, op := range log {
+		if err := replay.Apply(op); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !Equal(start, end) {
+		t.Errorf("EditSession: replaying: %v", Diff(end, start))
+	}
+
+	if err := s.Delete(Path{{Key: "missing"}}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("EditSession: expected ErrNotFound, got %v", err)
+	}
+	if err := s.Append(Path{{Key: "pos"}}, "x"); err == nil {
+		t.Errorf("EditSession: appended a string to a list of doubles")
+	}
+	s.Undo()
+	if !s.CanRedo() || !Equal(c, states[len(states)-1]) {
+		t.Errorf("EditSession: a failed op was recorded")
+	}
+
+	// The session keeps no copies of the document, whose nested compounds
+	// stay modifiable directly, and undoing reverts only its own operations.
+	for i, step := range []func() bool{s.Redo, s.Undo, func() bool { return true }} {
+		step()
+		inner := c.CompoundOr("inner", nil)
+		if inner == nil {
+			t.Fatalf("EditSession: step %d: no inner compound", i)
+		}
+		if err := inner.Set(Path{{Key: "y"}}, int32(i)); err != nil {
+			t.Errorf("EditSession: step %d: Set on a nested compound: %v", i, err)
+		}
+		if err := c.Set(Path{{Key: "inner"}, {Key: "x"}}, int16(i)); err != nil {
+			t.Errorf("EditSession: step %d: Set through the root: %v", i, err)
+		}
+		if x := inner.ShortOr("x", -1); x != int16(i) {
+			t.Errorf("EditSession: step %d: the nested compound was left behind, x = %d", i, x)
+		}
+	}
+	for s.Undo() {
+	}
+	inner := states[0].CompoundOr("inner", nil)
+	inner.Set(Path{{Key: "x"}}, int16(2))
+	inner.Set(Path{{Key: "y"}}, int32(2))
+	if !Equal(c, states[0]) {
+		t.Errorf("EditSession: undoing changed more than the operations: %v", Diff(states[0], c))
+	}
+}
+
+func TestSessionAppend(t *testing.T) {
+	const TagPair TagType = 101
+	if _, ok := lookup_extension(TagPair); !ok {
+		RegisterTag(TagPair, "TAG_Pair", uuidHandler{})
+	}
+
+	var items []Tag
+	for i := 0; i < 20; i++ {
+		items = append(items, &CompoundTag{Value: []Tag{&IntTag{"x", int32(i)}}})
+	}
+	b, err := (&CompoundTag{Value: []Tag{
+		&ListTag{Name: "l", Elem: TagCompound, Value: items},
+	}}).Compound()
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc, err := b.MarshalBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec := NewDecoder(bytes.NewReader(enc))
+	dec.LazyListThreshold = 10
+	lazy, err := dec.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pair := Extension{TagPair, [2]int64{1, 2}}
+	tests := []struct {
+		name string
+		elem TagType
+		v    interface{}
+		want interface{}
+	}{
+		{"extension to an empty list", TagEnd, pair, pair},
+		{"extension to a list of ints", TagInt, pair, nil},
+		{"byte array reader", TagEnd, ByteArrayReader{bytes.NewReader(nil), 0}, nil},
+		{"raw tag", TagInt, RawTag{TagInt, []byte{0, 0, 0, 7}}, int32(7)},
+		{"raw tag of the wrong type", TagString, RawTag{TagInt, []byte{0, 0, 0, 7}}, nil},
+		{"lazy list", TagEnd, lazy.data["l"].ref, 20},
+		{"compound to a list of ints", TagInt, &Compound{data: map[string]entry{}}, nil},
+		{"long to a list of ints", TagInt, int64(1), nil},
+	}
+	for _, test := range tests {
+		c, err := (&CompoundTag{Value: []Tag{&ListTag{Name: "l", Elem: test.elem}}}).Compound()
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := NewEditSession(c)
+		err = s.Append(Path{{Key: "l"}}, test.v)
+		l := c.List("l")
+		if test.want == nil {
+			if err == nil || l.Len() != 0 || l.list_type != test.elem {
+				t.Errorf("%s: expected an error and no change, got %v, %v", test.name, err, l)
+			}
+			continue
+		}
+		if err != nil || l.Len() != 1 {
+			t.Errorf("%s: got %v, %v", test.name, err, l)
+			continue
+		}
+		got, err := c.Get(Path{{Key: "l"}, {Index: 0, IsIndex: true}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n, ok := test.want.(int); ok {
+			if inner, ok := got.(*List); !ok || inner.Len() != n {
+				t.Errorf("%s: expected a list of %d, got %v", test.name, n, got)
+			}
+		} else if got != test.want {
+			t.Errorf("%s: expected %v, got %v", test.name, test.want, got)
+		}
+		if !s.Undo() || l.Len() != 0 {
+			t.Errorf("%s: undoing left %v", test.name, l)
+		}
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	c, err := (&CompoundTag{Value: []Tag{
+		&IntTag{"XpLevel", 1},
+		&IntTag{"SpawnX", 10},
+		&ListTag{Name: "pos", Elem: TagDouble, Value: []Tag{&DoubleTag{Value: 1}}},
+		&CompoundTag{Name: "inner", Value: []Tag{&ShortTag{"x", 5}}},
+	}}).Compound()
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := copy_value(c, nil).(*Compound)
+
+	failed := errors.New("validation failed")
+	var leaked *Tx
+	err = c.Update(func(tx *Tx) error {
+		leaked = tx
+		if err := tx.Set(Path{{Key: "XpLevel"}}, int32(30)); err != nil {
+			return err
+		}
+		if err := tx.Append(Path{{Key: "pos"}}, 2.0); err != nil {
+			return err
+		}
+		if err := tx.Delete(Path{{Key: "SpawnX"}}); err != nil {
+			return err
+		}
+		return failed
+	})
+	if err != failed {
+		t.Errorf("Update: expected %v, got %v", failed, err)
+	}
+	if !Equal(c, start) {
+		t.Errorf("Update: failed transaction left changes: %v", Diff(start, c))
+	}
+	if err := leaked.Set(Path{{Key: "XpLevel"}}, int32(2)); err != ErrTxDone {
+		t.Errorf("Update: expected ErrTxDone after the transaction, got %v", err)
+	}
+
+	func() {
+		defer func() { recover() }()
+		c.Update(func(tx *Tx) error {
+			tx.Delete(Path{{Key: "SpawnX"}})
+			panic("oops")
+		})
+	}()
+	if !Equal(c, start) {
+		t.Errorf("Update: panicking transaction left changes: %v", Diff(start, c))
+	}
+
+	err = c.Update(func(tx *Tx) error {
+		if err := tx.Set(Path{{Key: "XpLevel"}}, int32(30)); err != nil {
+			return err
+		}
+		return tx.Delete(Path{{Key: "SpawnX"}})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Int("XpLevel") != 30 || c.Len() != 3 {
+		t.Errorf("Update: changes were not kept: %v", Diff(start, c))
+	}
+
+	// Nested compounds stay part of the tree and modifiable directly once a
+	// transaction has ended, whether it changed anything, was kept or not.
+	if err := c.Update(func(tx *Tx) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Compound("inner").Set(Path{{Key: "x"}}, int16(6)); err != nil {
+		t.Errorf("Update: Set on a nested compound after an empty transaction: %v", err)
+	}
+	for i, result := range []error{nil, failed} {
+		before := c.Compound("inner")
+		c.Update(func(tx *Tx) error {
+			if err := tx.Set(Path{{Key: "inner"}, {Key: "x"}}, int16(10+i)); err != nil {
+				return err
+			}
+			return result
+		})
+		inner := c.Compound("inner")
+		if inner != before {
+			t.Errorf("Update: transaction %d replaced the nested compound", i)
+		}
+		if err := inner.Set(Path{{Key: "x"}}, int16(i)); err != nil {
+			t.Errorf("Update: Set on a nested compound after transaction %d: %v", i, err)
+		}
+		if x := c.Compound("inner").ShortOr("x", -1); x != int16(i) {
+			t.Errorf("Update: after transaction %d: expected x = %d, got %d", i, i, x)
+		}
+	}
+
+	if err := c.Freeze().Update(func(tx *Tx) error { return nil }); err != ErrFrozen {
+		t.Errorf("Update: expected ErrFrozen, got %v", err)
+	}
+}
+
+func TestHostileLengths(t *testing.T) {
+	header := []byte{0x0a, 0x00, 0x00}
+	tests := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"negative byte array", []byte{0x07, 0x00, 0x01, 'a', 0xff, 0xff, 0xff, 0xfe}, ErrInvalidLength},
+		{"negative list", []byte{0x09, 0x00, 0x01, 'a', 0x01, 0x80, 0x00, 0x00, 0x00}, ErrInvalidLength},
+		{"huge int array", []byte{0x0b, 0x00, 0x01, 'a', 0x7f, 0xff, 0xff, 0xff}, ErrTruncated},
+		{"huge list of compounds", []byte{0x09, 0x00, 0x01, 'a', 0x0a, 0x7f, 0xff, 0xff, 0xff}, ErrTruncated},
+		{"long string", []byte{0x08, 0x00, 0x01, 'a', 0xff, 0xff, 'b'}, ErrTruncated},
+		{"missing TAG_End", []byte{0x01, 0x00, 0x01, 'a', 0x01}, ErrTruncated},
+	}
+	for _, test := range tests {
+		data := append(append([]byte{}, header...), test.data...)
+		_, err := DecodeBytes(data)
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.err, err)
+		}
+		// without its length known, the input is read before the lengths
+		// are trusted
+		_, err = NewDecoder(struct{ io.Reader }{bytes.NewReader(data)}).Decode()
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s from a stream: expected %v, got %v", test.name, test.err, err)
+		}
+	}
+
+	big := bigList(100000)
+	if c, err := NewDecoder(struct{ io.Reader }{bytes.NewReader(big)}).Decode(); err != nil {
+		t.Errorf("long list from a stream: %v", err)
+	} else if l, _ := c.Get(Path{{Key: "l"}}); l.(*List).Len() != 100000 {
+		t.Errorf("long list from a stream: got %d elements", l.(*List).Len())
+	}
+	dec := NewDecoder(bytes.NewReader(big))
+	dec.MaxElements = 99999
+	if _, err := dec.Decode(); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("MaxElements: expected ErrTooLarge, got %v", err)
+	}
+	dec = NewDecoder(bytes.NewReader(big))
+	dec.MaxElements = 100000
+	if _, err := dec.Decode(); err != nil {
+		t.Errorf("MaxElements: %v", err)
+	}
+
+	dec = NewDecoder(bytes.NewReader(bigList(1000)))
+	dec.MaxBytes = 1000
+	if _, err := dec.Decode(); err != ErrTooLarge {
+		t.Errorf("MaxBytes: expected ErrTooLarge, got %v", err)
+	}
+	dec = NewDecoder(bytes.NewReader(bigList(1000)))
+	dec.MaxBytes = 5000
+	if _, err := dec.Decode(); err != nil {
+		t.Errorf("MaxBytes: %v", err)
+	}
+	if _, err := dec.Decode(); err != io.EOF {
+		t.Errorf("Decode at end of input: expected io.EOF, got %v", err)
+	}
+}
+
+// Returns a document holding a list of n ints.
+
+// A document whose second int array in .c.l has a length of -3.
+var negativeLength = []byte{
+	0x0a, 0x00, 0x00,
+	0x0a, 0x00, 0x01, 'c',
+	0x09, 0x00, 0x01, 'l', 0x0b, 0x00, 0x00, 0x00, 0x02,
+	0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x07,
+	0xff, 0xff, 0xff, 0xfd,
+}
+
+// Checks that err reports the negative length of negativeLength.
+func checkNegativeLength(t *testing.T, what string, err error) {
+	t.Helper()
+	var neg *NegativeLengthError
+	if !errors.As(err, &neg) {
+		t.Errorf("%s: expected a NegativeLengthError, got %v", what, err)
+		return
+	}
+	if neg.Path.String() != ".c.l[1]" || neg.Type != TagIntArray || neg.Length != -3 {
+		t.Errorf("%s: got %v", what, neg)
+	}
+	if !errors.Is(err, ErrNegativeLength) || !errors.Is(err, ErrInvalidLength) {
+		t.Errorf("%s: %v does not wrap ErrNegativeLength and ErrInvalidLength", what, err)
+	}
+}
+
+func TestNegativeLength(t *testing.T) {
+	_, err := DecodeBytes(negativeLength)
+	checkNegativeLength(t, "Decode", err)
+}
+
+// A document holding "a\U0001F600b" at s, with the emoji as the surrogates
+// D83D DE00.
+var surrogatePairs = []byte{
+	0x0a, 0x00, 0x00,
+	0x08, 0x00, 0x01, 's', 0x00, 0x08,
+	'a', 0xed, 0xa0, 0xbd, 0xed, 0xb8, 0x80, 'b',
+	0x00,
+}
+
+func TestSurrogatePairs(t *testing.T) {
+	data := surrogatePairs
+	const want = "a\U0001F600b"
+
+	c, err := DecodeBytes(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := c.StringOr("s", ""); s != want {
+		t.Errorf("Decode: got %q, expected %q", s, want)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := Encode(buf, c); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Errorf("Encode: got % x, expected % x", buf.Bytes(), data)
+	}
+
+	// Bedrock Edition writes UTF-8, which reads back the same.
+	buf.Reset()
+	if err := (EncodeOptions{ByteOrder: binary.LittleEndian}).Encode(buf, c); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(buf.Bytes(), []byte(want)) {
+		t.Errorf("little endian: got % x", buf.Bytes())
+	}
+	c, err = (DecodeOptions{ByteOrder: binary.LittleEndian}).DecodeBytes(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := c.StringOr("s", ""); s != want {
+		t.Errorf("little endian: got %q, expected %q", s, want)
+	}
+}
+
+func bigList(n int) []byte {
+	data := []byte{0x0a, 0x00, 0x00, 0x09, 0x00, 0x01, 'l', 0x03}
+	data = append(data, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	data = append(data, make([]byte, 4*n)...)
+	return append(data, 0x00)
+}
+
+func TestTrace(t *testing.T) {
+	var events []TraceEvent
+	dec := NewDecoder(bytes.NewReader(helloWorld))
+	dec.Trace = func(e TraceEvent) { events = append(events, e) }
+	if _, err := dec.Decode(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []TraceEvent{
+		{0, TagCompound, "hello world", 0},
+		{14, TagString, "name", 1},
+		{32, TagEnd, "", 1},
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("Trace: expected %v, got %v", expected, events)
+	}
+	for i := range events {
+		if events[i] != expected[i] {
+			t.Errorf("Trace: event %d: expected %v, got %v", i, expected[i], events[i])
+		}
+	}
+}
+
+func TestLogger(t *testing.T) {
+	// TAG_Compound(''): TAG_Byte('a'): 1, TAG_String('a'): "\xff"
+	data := []byte{
+		0x0a, 0x00, 0x00,
+		0x01, 0x00, 0x01, 'a', 0x01,
+		0x08, 0x00, 0x01, 'a', 0x00, 0x01, 0xff,
+		0x00,
+	}
+	buf := new(bytes.Buffer)
+	dec := NewDecoder(bytes.NewReader(data))
+	dec.Logger = slog.New(slog.NewTextHandler(buf, nil))
+	dec.LogLevel = slog.LevelInfo
+	c, err := dec.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := c.String("a"); s != "\xff" {
+		t.Errorf("duplicate entry: expected the last one to be kept, got %q", s)
+	}
+
+	log := buf.String()
+	for _, msg := range []string{"level=INFO msg=\"nbt: duplicate compound entry\"", "not valid UTF-8"} {
+		if !strings.Contains(log, msg) {
+			t.Errorf("expected %q to be logged, got:\n%s", msg, log)
+		}
+	}
+}
+
+func TestSimplify(t *testing.T) {
+	c, err := (&CompoundTag{Value: []Tag{
+		&ByteTag{"b", -1},
+		&FloatTag{"f", 0.5},
+		&ByteArrayTag{"bytes", []int8{-1, 2}},
+		&IntArrayTag{"ints", []int32{3}},
+		&ListTag{Name: "list", Elem: TagCompound, Value: []Tag{&CompoundTag{Value: []Tag{&StringTag{"s", "x"}}}}},
+	}}).Compound()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := c.Simplify()
+	if m["b"] != int64(-1) || m["f"] != 0.5 || string(m["bytes"].([]byte)) != "\xff\x02" || m["ints"].([]interface{})[0] != int64(3) {
+		t.Errorf("Simplify: got %#v", m)
+	}
+	list := m["list"].([]interface{})
+	if list[0].(map[string]interface{})["s"] != "x" {
+		t.Errorf("Simplify: got list %#v", list)
+	}
+}
+
+func TestUpgrade(t *testing.T) {
+	var migrations Migrations
+	var applied []string
+	migrations.Register(1451, 1519, func(c *Compound) error {
+		applied = append(applied, "flatten")
+		return c.SetPath("id", c.String("id")+"_flat")
+	})
+	migrations.Register(100, 1000, func(c *Compound) error {
+		applied = append(applied, "early")
+		return nil
+	})
+	migrations.Register(2000, 3000, func(c *Compound) error {
+		applied = append(applied, "late")
+		return nil
+	})
+
+	c, err := (&CompoundTag{Value: []Tag{&IntTag{"DataVersion", 1343}, &StringTag{"id", "stone"}}}).Compound()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := migrations.Upgrade(c, 2500); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(applied, ",") != "flatten" {
+		t.Errorf("Upgrade: applied %v, expected only flatten", applied)
+	}
+	if c.String("id") != "stone_flat" || c.Int("DataVersion") != 2500 {
+		t.Errorf("Upgrade: got id %q version %d", c.String("id"), c.Int("DataVersion"))
+	}
+
+	if err := migrations.Upgrade(c, 2000); err == nil {
+		t.Error("Upgrade: expected an error downgrading")
+	}
+
+	// no DataVersion at all counts as 0
+	applied = nil
+	c, _ = (&CompoundTag{Value: []Tag{&StringTag{"id", "dirt"}}}).Compound()
+	if err := migrations.Upgrade(c, 3000); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(applied, ",") != "early,flatten,late" {
+		t.Errorf("Upgrade: applied %v", applied)
+	}
+
+	failing := errors.New("broken")
+	migrations.Register(3000, 3100, func(c *Compound) error { return failing })
+	if err := migrations.Upgrade(c, 3100); !errors.Is(err, failing) || c.Int("DataVersion") != 3000 {
+		t.Errorf("Upgrade: expected the migration's error at version 3000, got %v at %d", err, c.Int("DataVersion"))
+	}
+}
+
+func TestSyncCompound(t *testing.T) {
+	c, err := (&CompoundTag{Value: []Tag{
+		&IntTag{"n", 0},
+		&ListTag{Name: "l", Elem: TagCompound, Value: []Tag{&CompoundTag{Value: []Tag{&StringTag{"s", "a"}}}}},
+	}}).Compound()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc := NewSyncCompound(c)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				sc.Update(func(c *Compound) error {
+					return c.SetPath("n", c.Int("n")+1)
+				})
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if _, err := sc.GetPath("n"); err != nil {
+					t.Error(err)
+				}
+				sc.View(func(c *Compound) { c.MarshalBytes() })
+			}
+		}()
+	}
+	wg.Wait()
+	if n, _ := sc.GetPath("n"); n != int32(800) {
+		t.Errorf("SyncCompound: expected 800 increments, got %v", n)
+	}
+
+	// values returned by Get are copies
+	l, _ := sc.GetPath("l")
+	l.(*List).Compounds()[0].SetPath("s", "b")
+	if s, _ := sc.GetPath("l[0].s"); s != "a" {
+		t.Errorf("SyncCompound: modifying a copy changed the tree to %v", s)
+	}
+	cp := sc.Copy()
+	cp.SetPath("n", int32(0))
+	if n, _ := sc.GetPath("n"); n != int32(800) {
+		t.Errorf("SyncCompound: modifying a copy changed the tree to %v", n)
+	}
+}
+
+func TestFreeze(t *testing.T) {
+	c, err := (&CompoundTag{Value: []Tag{
+		&IntTag{"n", 1},
+		&CompoundTag{Name: "sub", Value: []Tag{&StringTag{"s", "a"}}},
+		&ListTag{Name: "l", Elem: TagCompound, Value: []Tag{&CompoundTag{Value: []Tag{&StringTag{"s", "a"}}}}},
+	}}).Compound()
+	if err != nil {
+		t.Fatal(err)
+	}
+	frozen := c.Freeze()
+	if !frozen.Frozen() || c.Frozen() || frozen.Freeze() != frozen {
+		t.Fatal("Freeze: wrong frozen state")
+	}
+
+	for _, target := range []*Compound{frozen, frozen.Compound("sub"), frozen.List("l").Compounds()[0]} {
+		if err := target.SetPath("s", "b"); err != ErrFrozen {
+			t.Errorf("Set on %q: expected ErrFrozen, got %v", target.Name(), err)
+		}
+	}
+	if err := frozen.UnmarshalJSON([]byte(`{"type":"compound","value":{}}`)); err != ErrFrozen {
+		t.Errorf("UnmarshalJSON: expected ErrFrozen, got %v", err)
+	}
+	if _, err := frozen.ReadFrom(bytes.NewReader(nil)); err != ErrFrozen {
+		t.Errorf("ReadFrom: expected ErrFrozen, got %v", err)
+	}
+	if _, err := frozen.Detach("sub"); err != ErrFrozen {
+		t.Errorf("Detach: expected ErrFrozen, got %v", err)
+	}
+	if err := frozen.Attach(new(Compound)); err != ErrFrozen {
+		t.Errorf("Attach: expected ErrFrozen, got %v", err)
+	}
+	if err := frozen.Update(func(tx *Tx) error { return nil }); err != ErrFrozen {
+		t.Errorf("Update: expected ErrFrozen, got %v", err)
+	}
+	if err := frozen.List("l").Swap(0, 0); err != ErrFrozen {
+		t.Errorf("Swap: expected ErrFrozen, got %v", err)
+	}
+
+	// the original is still writable and independent
+	if err := c.SetPath("sub.s", "b"); err != nil {
+		t.Fatal(err)
+	}
+	if frozen.Compound("sub").String("s") != "a" {
+		t.Error("Freeze: frozen copy shares data with the original")
+	}
+}
+
+func TestClone(t *testing.T) {
+	c, err := (&CompoundTag{Value: []Tag{
+		&IntTag{"n", 1},
+		&CompoundTag{Name: "a", Value: []Tag{
+			&CompoundTag{Name: "b", Value: []Tag{&StringTag{"s", "x"}}},
+			&IntArrayTag{"arr", []int32{1, 2, 3}},
+		}},
+		&CompoundTag{Name: "untouched", Value: []Tag{&StringTag{"s", "x"}}},
+		&ListTag{Name: "l", Elem: TagCompound, Value: []Tag{&CompoundTag{Value: []Tag{&StringTag{"s", "x"}}}}},
+	}}).Compound()
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, _ := c.MarshalBytes()
+	held := c.Compound("a").Compound("b")
+
+	clone := c.Clone()
+	for _, p := range []string{"a.b.s", "a.arr[1]", "l[0].s"} {
+		var v interface{} = "y"
+		if p == "a.arr[1]" {
+			v = int32(20)
+		}
+		if err := clone.SetPath(p, v); err != nil {
+			t.Fatalf("SetPath %s: %v", p, err)
+		}
+	}
+	if after, _ := c.MarshalBytes(); !bytes.Equal(before, after) {
+		t.Error("Clone: modifying the clone changed the original")
+	}
+	if clone.Compound("untouched") != c.Compound("untouched") {
+		t.Error("Clone: untouched subtree was copied")
+	}
+	if s, _ := clone.GetPath("a.b.s"); s != "y" {
+		t.Errorf("Clone: expected the clone to be modified, got %v", s)
+	}
+
+	// a nested compound cannot be modified behind the clone's back until
+	// the root has copied it
+	if err := held.SetPath("s", "z"); err != ErrShared {
+		t.Errorf("Set on a shared compound: expected ErrShared, got %v", err)
+	}
+	if err := c.SetPath("n", int32(2)); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetPath("a.b.s", "z"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Compound("a").SetPath("b.s", "z"); err != nil {
+		t.Errorf("Set on a copied compound: %v", err)
+	}
+	if s, _ := clone.GetPath("a.b.s"); s != "y" {
+		t.Errorf("Clone: modifying the original changed the clone to %v", s)
+	}
+	if s, _ := c.GetPath("a.b.s"); s != "z" {
+		t.Errorf("Clone: expected the original to be modified, got %v", s)
+	}
+	if n, _ := clone.GetPath("n"); n != int32(1) {
+		t.Errorf("Clone: modifying the original changed the clone to %v", n)
+	}
+
+	// values stored in a modified tree can be modified through themselves
+	sub, _ := (&CompoundTag{Value: []Tag{&CompoundTag{Name: "x", Value: []Tag{&IntTag{"i", 0}}}}}).Compound()
+	if err := c.SetPath("new", sub); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Compound("new").Compound("x").SetPath("i", int32(1)); err != nil {
+		t.Errorf("Set on a stored compound: %v", err)
+	}
+}
+
+func TestCloneListElements(t *testing.T) {
+	item := func(slot int8) Tag {
+		return &CompoundTag{Value: []Tag{
+			&ByteTag{"Slot", slot},
+			&CompoundTag{Name: "tag", Value: []Tag{&IntTag{"Damage", 0}}},
+		}}
+	}
+	c, err := (&CompoundTag{Value: []Tag{
+		&ListTag{Name: "Inventory", Elem: TagCompound, Value: []Tag{item(0), item(1)}},
+	}}).Compound()
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, _ := c.MarshalBytes()
+
+	// a compound in a shared list cannot be modified behind the clone's
+	// back, in either tree
+	clone := c.Clone()
+	for _, doc := range []*Compound{c, clone} {
+		if err := doc.List("Inventory").Compounds()[0].SetPath("Slot", int8(5)); err != ErrShared {
+			t.Errorf("Set on a compound in a shared list: expected ErrShared, got %v", err)
+		}
+	}
+
+	// modifying the clone through its root copies the list and the
+	// compounds in it
+	if err := clone.SetPath("Inventory[0].Slot", int8(5)); err != nil {
+		t.Fatal(err)
+	}
+	if err := clone.List("Inventory").Compounds()[1].SetPath("Slot", int8(6)); err != nil {
+		t.Errorf("Set on a copied list element: %v", err)
+	}
+	if err := clone.List("Inventory").Compounds()[1].Compound("tag").SetPath("Damage", int32(1)); err != ErrShared {
+		t.Errorf("Set inside a copied list element: expected ErrShared, got %v", err)
+	}
+	if err := clone.SetPath("Inventory[1].tag.Damage", int32(1)); err != nil {
+		t.Fatal(err)
+	}
+	if after, _ := c.MarshalBytes(); !bytes.Equal(before, after) {
+		t.Errorf("Clone: modifying list elements of the clone changed the original: %v", Diff(c, clone))
+	}
+	if got := clone.List("Inventory").Compounds(); got[0].Byte("Slot") != 5 || got[1].Byte("Slot") != 6 ||
+		got[1].Compound("tag").Int("Damage") != 1 {
+		t.Errorf("Clone: list elements not modified: %v", clone)
+	}
+
+	// the original is modified in the same way, without touching the clone
+	if err := c.SetPath("Inventory[1].Slot", int8(7)); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.List("Inventory").Compounds()[0].SetPath("Slot", int8(8)); err != nil {
+		t.Errorf("Set on a copied list element of the original: %v", err)
+	}
+	if got := clone.List("Inventory").Compounds(); got[0].Byte("Slot") != 5 || got[1].Byte("Slot") != 6 {
+		t.Errorf("Clone: modifying the original changed the clone: %v", clone)
+	}
+}
+
+func TestHash(t *testing.T) {
+	build := func(name string, x int32) *Compound {
+		c, err := (&CompoundTag{Name: name, Value: []Tag{
+			&CompoundTag{Name: "a", Value: []Tag{&IntTag{"x", x}, &FloatTag{"f", 1.5}}},
+			&CompoundTag{Name: "b", Value: []Tag{&LongArrayTag{"arr", []int64{1, 2}}}},
+			&ListTag{Name: "l", Elem: TagString, Value: []Tag{&StringTag{"", "s"}}},
+		}}).Compound()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	a, b := build("one", 1), build("two", 1)
+	if a.Hash() != b.Hash() || !Equal(a, b) {
+		t.Error("Hash: equal compounds with different names hash differently")
+	}
+	if a.hash != nil {
+		t.Error("Hash: cached the digest of a mutable compound")
+	}
+	if err := b.SetPath("a.x", int32(2)); err != nil {
+		t.Fatal(err)
+	}
+	if a.Hash() == b.Hash() || a.Compound("b").Hash() != b.Compound("b").Hash() {
+		t.Error("Hash: digests do not follow the contents")
+	}
+
+	fa, fb := a.Freeze(), b.Freeze()
+	changes := Diff(fa, fb)
+	if len(changes) != 1 || changes[0].Path.String() != ".a.x" {
+		t.Errorf("Diff of frozen trees: %v", changes)
+	}
+	if fa.Compound("b").hash == nil || fa.List("l").hash == nil {
+		t.Error("Diff of frozen trees: digests of identical subtrees not cached")
+	}
+	if fa.Hash() != a.Hash() {
+		t.Error("Hash: frozen copy hashes differently")
+	}
+
+	// Run with -race: frozen trees are shared between goroutines, which may
+	// compare them at the same time.
+	fc, fd := build("c", 3).Freeze(), build("d", 4).Freeze()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if Equal(fc, fd) || len(Diff(fc, fd)) != 1 {
+				t.Error("Diff of frozen trees from several goroutines: wrong result")
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestChecksum(t *testing.T) {
+	c, err := (&CompoundTag{Name: "hello", Value: []Tag{&StringTag{"name", "Bananrama"}}}).Compound()
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	enc := NewEncoder(buf)
+	enc.Checksum = crc32.NewIEEE()
+	for i := 0; i < 2; i++ {
+		if err := enc.Encode(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if sum, expected := enc.Checksum.(hash.Hash32).Sum32(), crc32.ChecksumIEEE(buf.Bytes()); sum != expected {
+		t.Errorf("Checksum: expected %08x, got %08x", expected, sum)
+	}
+}
+
+func TestArena(t *testing.T) {
+	var items []Tag
+	for i := 0; i < 50; i++ {
+		items = append(items, &CompoundTag{Value: []Tag{
+			&StringTag{"id", "minecraft:stone"},
+			&ByteTag{"Count", int8(i)},
+			&IntArrayTag{"UUID", []int32{1, 2, 3, int32(i)}},
+			&ListTag{Name: "Pos", Elem: TagDouble, Value: []Tag{&DoubleTag{"", 1}, &DoubleTag{"", 2}}},
+		}})
+	}
+	c, err := (&CompoundTag{Name: "root", Value: []Tag{
+		&ListTag{Name: "Items", Elem: TagCompound, Value: items},
+		&LongArrayTag{"longs", make([]int64, 2000)},
+		&CompoundTag{Name: "sub", Value: []Tag{&ShortTag{"s", 1}, &FloatTag{"f", 1}, &LongTag{"l", 1}}},
+	}}).Compound()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := c.MarshalBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	arena := new(Arena)
+	decode := func() *Compound {
+		dec := NewDecoder(bytes.NewReader(data))
+		dec.Arena = arena
+		got, err := dec.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+	for i := 0; i < 3; i++ {
+		got := decode()
+		if changes := Diff(c, got); len(changes) > 0 || got.Name() != "root" {
+			t.Fatalf("decoding with an arena, round %d: %v", i, changes)
+		}
+		arena.Reset()
+	}
+
+	heap := testing.AllocsPerRun(10, func() { DecodeBytes(data) })
+	reused := testing.AllocsPerRun(10, func() {
+		decode()
+		arena.Reset()
+	})
+	if reused > heap/4 {
+		t.Errorf("decoding with an arena: %v allocations, %v without", reused, heap)
+	}
+}
+
+func TestOpenMapped(t *testing.T) {
+	c, err := (&CompoundTag{Name: "root", Value: []Tag{
+		&StringTag{"name", "Bananrama"},
+		&ByteArrayTag{"bytes", []int8{1, 2, 3}},
+		&IntArrayTag{"ints", []int32{1, -2}},
+		&ListTag{Name: "strings", Elem: TagString, Value: []Tag{&StringTag{"", "a"}, &StringTag{"", ""}}},
+	}}).Compound()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := c.MarshalBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := t.TempDir() + "/mapped.nbt"
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := OpenMapped(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := m.Compound()
+	if changes := Diff(c, got); len(changes) > 0 || got.Name() != "root" {
+		t.Errorf("OpenMapped: %v", changes)
+	}
+	// the mapping is private
+	got.data["bytes"].ref.([]int8)[0] = 9
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got.Len() != 0 {
+		t.Error("Close: root compound not emptied")
+	}
+	if after, _ := os.ReadFile(path); !bytes.Equal(after, data) {
+		t.Error("OpenMapped: modifying the document changed the file")
+	}
+
+	if _, err := OpenMapped(path + ".missing"); err == nil {
+		t.Error("OpenMapped: expected an error for a missing file")
+	}
+	os.WriteFile(path, data[:len(data)-3], 0644)
+	if _, err := OpenMapped(path); err != ErrTruncated {
+		t.Errorf("OpenMapped of a truncated file: expected ErrTruncated, got %v", err)
+	}
+}
+
+func TestStreamByteArrays(t *testing.T) {
+	big := make([]int8, 1000)
+	for i := range big {
+		big[i] = int8(i)
+	}
+	c, err := (&CompoundTag{Name: "root", Value: []Tag{
+		&ByteArrayTag{"big", big},
+		&ByteArrayTag{"skipped", big},
+		&ByteArrayTag{"small", []int8{1, 2}},
+		&IntTag{"after", 7},
+	}}).Compound()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := c.MarshalBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var streamed []byte
+	dec := NewDecoder(bytes.NewReader(data))
+	dec.ByteArrayThreshold = 100
+	dec.ByteArrayFunc = func(name string, n int, r io.Reader) (interface{}, error) {
+		if n != 1000 {
+			t.Errorf("ByteArrayFunc: %s has length %d", name, n)
+		}
+		if name == "skipped" {
+			// read part of it only
+			r.Read(make([]byte, 10))
+			return nil, nil
+		}
+		b, err := io.ReadAll(r)
+		streamed = b
+		return ByteArrayReader{bytes.NewReader(b), len(b)}, err
+	}
+	got, err := dec.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(streamed) != 1000 || streamed[999] != byte(big[999]) {
+		t.Errorf("ByteArrayFunc: streamed %d bytes", len(streamed))
+	}
+	if _, ok := got.data["skipped"]; ok || got.Int("after") != 7 || len(got.data["small"].ref.([]int8)) != 2 {
+		t.Errorf("streaming byte arrays: wrong document %v", got.Simplify())
+	}
+
+	// the reader is written back out as a byte array
+	if err := got.SetPath("skipped", ByteArrayReader{bytes.NewReader(streamed), 1000}); err != nil {
+		t.Fatal(err)
+	}
+	out, err := got.MarshalBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, data) {
+		t.Error("encoding a ByteArrayReader: output differs")
+	}
+	got.SetPath("skipped", ByteArrayReader{bytes.NewReader(streamed), 2000})
+	if _, err := got.MarshalBytes(); err == nil {
+		t.Error("encoding a short ByteArrayReader: expected an error")
+	}
+}
+
+func TestDecodeStream(t *testing.T) {
+	var docs []*Compound
+	raw := new(bytes.Buffer)
+	gz := new(bytes.Buffer)
+	for i := 0; i < 3; i++ {
+		c, err := (&CompoundTag{Name: "doc", Value: []Tag{&IntTag{"i", int32(i)}}}).Compound()
+		if err != nil {
+			t.Fatal(err)
+		}
+		docs = append(docs, c)
+		Encode(raw, c)
+		// one gzip member per document
+		EncodeGzip(gz, c)
+	}
+
+	for _, src := range []io.Reader{bytes.NewReader(raw.Bytes()), must_gunzip(t, gz.Bytes())} {
+		dec := NewDecoder(src)
+		var got []*Compound
+		for dec.More() {
+			c, err := dec.Decode()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, c)
+		}
+		if len(got) != len(docs) {
+			t.Fatalf("More: read %d documents, expected %d", len(got), len(docs))
+		}
+		for i := range got {
+			if !Equal(got[i], docs[i]) {
+				t.Errorf("document %d differs", i)
+			}
+		}
+		if _, err := dec.Decode(); err != io.EOF {
+			t.Errorf("Decode at the end: expected io.EOF, got %v", err)
+		}
+	}
+
+	// a truncated last document is an error, not the end
+	dec := NewDecoder(bytes.NewReader(raw.Bytes()[:raw.Len()-1]))
+	n := 0
+	var err error
+	for dec.More() && err == nil {
+		_, err = dec.Decode()
+		n++
+	}
+	if n != 3 || err != ErrTruncated {
+		t.Errorf("truncated stream: %d documents, error %v", n, err)
+	}
+}
+
+func must_gunzip(t *testing.T, data []byte) io.Reader {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestRootName(t *testing.T) {
+	c, err := (&CompoundTag{Name: "hello", Value: []Tag{&IntTag{"x", 1}}}).Compound()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"", "Data"} {
+		buf := new(bytes.Buffer)
+		enc := NewEncoder(buf)
+		enc.OverrideRootName, enc.RootName = true, name
+		for i := 0; i < 2; i++ {
+			if err := enc.Encode(c); err != nil {
+				t.Fatal(err)
+			}
+		}
+		dec := NewDecoder(buf)
+		for i := 0; i < 2; i++ {
+			got, err := dec.Decode()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Name() != name || !Equal(got, c) {
+				t.Errorf("OverrideRootName %q: document %d named %q", name, i, got.Name())
+			}
+		}
+	}
+	if c.Name() != "hello" {
+		t.Error("OverrideRootName: compound renamed")
+	}
+}
+
+func TestEncodeGzipHeader(t *testing.T) {
+	c, err := (&CompoundTag{Name: "hello", Value: []Tag{&StringTag{"name", "Bananrama"}}}).Compound()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b := new(bytes.Buffer), new(bytes.Buffer)
+	EncodeGzip(a, c)
+	EncodeGzip(b, c)
+	if !bytes.Equal(a.Bytes(), b.Bytes()) {
+		t.Error("EncodeGzip: output is not reproducible")
+	}
+
+	header := gzip.Header{Name: "level.dat", ModTime: time.Unix(1700000000, 0), OS: 3}
+	buf := new(bytes.Buffer)
+	if err := EncodeGzipHeader(buf, c, header); err != nil {
+		t.Fatal(err)
+	}
+	r, err := gzip.NewReader(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Name != header.Name || !r.ModTime.Equal(header.ModTime) || r.OS != header.OS {
+		t.Errorf("EncodeGzipHeader: got header %+v", r.Header)
+	}
+	got, err := Decode(r)
+	if err != nil || !Equal(got, c) {
+		t.Errorf("EncodeGzipHeader: document did not survive: %v", err)
+	}
+}
+
+func TestFramed(t *testing.T) {
+	c, err := (&CompoundTag{Name: "msg", Value: []Tag{&StringTag{"text", strings.Repeat("x", 200)}}}).Compound()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, prefix := range []FramePrefix{VarIntPrefix, Int32Prefix} {
+		buf := new(bytes.Buffer)
+		for i := 0; i < 2; i++ {
+			if err := WriteFramed(buf, c, prefix, 0, EncodeOptions{}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if b := buf.Bytes(); prefix == VarIntPrefix && int(b[0]&0x7f)|int(b[1])<<7 != len(b)/2-2 {
+			t.Errorf("WriteFramed: VarInt prefix % x for %d bytes", b[:2], len(b)/2-2)
+		}
+		for i := 0; i < 2; i++ {
+			got, err := ReadFramed(buf, prefix, 1000, DecodeOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !Equal(got, c) {
+				t.Errorf("ReadFramed: document %d differs", i)
+			}
+		}
+		if _, err := ReadFramed(buf, prefix, 1000, DecodeOptions{}); err != io.EOF {
+			t.Errorf("ReadFramed at the end: expected io.EOF, got %v", err)
+		}
+
+		WriteFramed(buf, c, prefix, 0, EncodeOptions{})
+		if _, err := ReadFramed(buf, prefix, 100, DecodeOptions{}); !errors.Is(err, ErrTooLarge) {
+			t.Errorf("ReadFramed of a large frame: expected ErrTooLarge, got %v", err)
+		}
+		if err := WriteFramed(buf, c, prefix, 100, EncodeOptions{}); !errors.Is(err, ErrTooLarge) {
+			t.Errorf("WriteFramed of a large frame: expected ErrTooLarge, got %v", err)
+		}
+	}
+
+	// a frame longer than its document
+	framed := append([]byte{0, 0, 0, 0}, helloWorld...)
+	framed = append(framed, 0)
+	binary.BigEndian.PutUint32(framed, uint32(len(framed)-4))
+	if _, err := ReadFramed(bytes.NewReader(framed), Int32Prefix, 0, DecodeOptions{}); err == nil {
+		t.Error("ReadFramed: expected an error for bytes left over")
+	}
+	if _, err := ReadFramed(bytes.NewReader(framed[:10]), Int32Prefix, 0, DecodeOptions{}); err != ErrTruncated {
+		t.Errorf("ReadFramed of a truncated frame: expected ErrTruncated, got %v", err)
+	}
+}
+
+// A compound holding a list of lists of compounds, at depth 4.
+var maxDepth = []byte{
+	byte(TagCompound), 0, 0,
+	byte(TagList), 0, 1, 'l', byte(TagList), 0, 0, 0, 1,
+	byte(TagCompound), 0, 0, 0, 1,
+	byte(TagEnd),
+	byte(TagEnd),
+}
+
+func TestMaxDepth(t *testing.T) {
+	for _, depth := range []int{3, 4} {
+		dec := NewDecoder(bytes.NewReader(maxDepth))
+		dec.MaxDepth = depth
+		_, err := dec.Decode()
+		if depth == 3 && err != ErrTooDeep {
+			t.Errorf("MaxDepth %d: expected ErrTooDeep, got %v", depth, err)
+		}
+		if depth == 4 && err != nil {
+			t.Errorf("MaxDepth %d: %v", depth, err)
+		}
+	}
+
+	// nested deeper than the vanilla limit
+	deep := []byte{byte(TagCompound), 0, 0}
+	for i := 0; i < NetworkMaxDepth; i++ {
+		deep = append(deep, byte(TagCompound), 0, 0)
+	}
+	dec := NewDecoder(bytes.NewReader(deep))
+	dec.DecodeOptions = NetworkDecodeOptions()
+	if _, err := dec.Decode(); err != ErrTooDeep {
+		t.Errorf("NetworkDecodeOptions: expected ErrTooDeep, got %v", err)
+	}
+}
+
+func TestGoMC(t *testing.T) {
+	c, err := (&CompoundTag{Name: "root", Value: []Tag{
+		&ByteTag{"b", -1},
+		&ShortTag{"s", 2},
+		&FloatTag{"f", 0.5},
+		&ByteArrayTag{"bytes", []int8{-1, 2}},
+		&LongArrayTag{"longs", []int64{3}},
+		&ListTag{Name: "list", Elem: TagCompound, Value: []Tag{&CompoundTag{Value: []Tag{&StringTag{"s", "x"}}}}},
+		&ListTag{Name: "empty", Elem: TagEnd},
+	}}).Compound()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := ToGoMC(c)
+	if m["b"] != int8(-1) || m["s"] != int16(2) || m["f"] != float32(0.5) || string(m["bytes"].([]byte)) != "\xff\x02" || m["longs"].([]int64)[0] != 3 {
+		t.Errorf("ToGoMC: got %#v", m)
+	}
+	if m["list"].([]interface{})[0].(map[string]interface{})["s"] != "x" {
+		t.Errorf("ToGoMC: got list %#v", m["list"])
+	}
+
+	back, err := FromGoMC("root", m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if back.Name() != "root" || !Equal(back, c) {
+		t.Errorf("FromGoMC: round trip differs: %v", Diff(c, back))
+	}
+	if back.List("list").Compounds()[0].Parent() != back {
+		t.Error("FromGoMC: compound in a list is not a child of the compound holding the list")
+	}
+
+	c, err = FromGoMC("", map[string]interface{}{"ok": true, "mixed": []interface{}{int32(1), "a"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Byte("ok") != 1 || !c.List("mixed").IsMixed() {
+		t.Errorf("FromGoMC: got %v", c.Simplify())
+	}
+	if _, err := FromGoMC("", map[string]interface{}{"x": []string{"a"}}); err == nil {
+		t.Error("FromGoMC: expected an error for []string")
+	}
+}
+
+func TestLazyList(t *testing.T) {
+	var entities []Tag
+	for i := 0; i < 100; i++ {
+		entities = append(entities, &CompoundTag{Value: []Tag{&IntTag{"x", int32(i)}, &StringTag{"id", "minecraft:chest"}}})
+	}
+	c, err := (&CompoundTag{Value: []Tag{
+		&ListTag{Name: "block_entities", Elem: TagCompound, Value: entities},
+		&ListTag{Name: "short", Elem: TagCompound, Value: entities[:2]},
+	}}).Compound()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := c.MarshalBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dec := NewDecoder(bytes.NewReader(b))
+	dec.LazyListThreshold = 10
+	lazy, err := dec.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := lazy.data["short"].ref.(*List); !ok {
+		t.Errorf("LazyListThreshold: short list is %T", lazy.data["short"].ref)
+	}
+	l, ok := lazy.data["block_entities"].ref.(*LazyList)
+	if !ok {
+		t.Fatalf("LazyListThreshold: long list is %T", lazy.data["block_entities"].ref)
+	}
+	if l.Len() != 100 {
+		t.Errorf("LazyList.Len: got %d", l.Len())
+	}
+	e, err := l.Index(42)
+	if err != nil || e.Int("x") != 42 {
+		t.Errorf("LazyList.Index(42): got %v, %v", e, err)
+	}
+	if l.decoded[41] != nil || l.decoded[43] != nil {
+		t.Error("LazyList.Index decoded more than one element")
+	}
+	if v, err := lazy.GetPath(".block_entities[-1].x"); err != nil || v != int32(99) {
+		t.Errorf("GetPath through a LazyList: got %v, %v", v, err)
+	}
+	if _, err := l.Index(100); err == nil {
+		t.Error("LazyList.Index(100): expected an error")
+	}
+
+	// a changed element is written out, the others are copied
+	e.SetPath("x", int32(-1))
+	out, err := lazy.MarshalBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := DecodeBytes(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.List("block_entities").Compounds()[42].SetPath("x", int32(-1))
+	if !Equal(got, c) {
+		t.Errorf("encoding a LazyList: got differences %v", Diff(c, got))
+	}
+
+	list, err := l.List()
+	if err != nil || !Equal(list, c.List("block_entities")) || list.Compounds()[42] != e {
+		t.Errorf("LazyList.List: got %v, %v", list, err)
+	}
+
+	// everything else sees a lazily decoded tree as the eagerly decoded one
+	dec = NewDecoder(bytes.NewReader(b))
+	dec.LazyListThreshold = 10
+	lazy, err = dec.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	eager, err := DecodeBytes(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changes := Diff(eager, lazy); len(changes) != 0 || !Equal(lazy, eager) || lazy.Hash() != eager.Hash() {
+		t.Errorf("Diff with an eagerly decoded tree: got %v", changes)
+	}
+	want, _ := MarshalSNBT(eager)
+	if s, err := MarshalSNBT(lazy); err != nil || !bytes.Equal(s, want) {
+		t.Errorf("MarshalSNBT: got %.60q, %v", s, err)
+	}
+	want, _ = eager.MarshalJSON()
+	if j, err := lazy.MarshalJSON(); err != nil || !bytes.Equal(j, want) {
+		t.Errorf("MarshalJSON: got %.60q, %v", j, err)
+	}
+	if n := lazy.List("block_entities").Len(); n != 100 || lazy.MustList("block_entities") != lazy.ListOr("block_entities", nil) {
+		t.Errorf("List: got %d elements", n)
+	}
+
+	// changing the list through a clone decodes it and leaves the original alone
+	dec = NewDecoder(bytes.NewReader(b))
+	dec.LazyListThreshold = 10
+	lazy, err = dec.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clone := lazy.Clone()
+	if err := clone.SetPath("block_entities[3].x", int32(-3)); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := clone.GetPath("block_entities[3].x"); v != int32(-3) {
+		t.Errorf("Set through a LazyList: got %v", v)
+	}
+	if v, _ := lazy.GetPath("block_entities[3].x"); v != int32(3) {
+		t.Errorf("Set through a LazyList of a clone: original changed to %v", v)
+	}
+	if _, ok := clone.data["block_entities"].ref.(*List); !ok {
+		t.Errorf("Set through a LazyList: left a %T", clone.data["block_entities"].ref)
+	}
+}
+
+func TestCache(t *testing.T) {
+	write := func(path string, n int32, mod time.Time) {
+		c, err := (&CompoundTag{Name: "", Value: []Tag{&IntTag{"n", n}}}).Compound()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := c.MarshalBytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mod, mod); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := t.TempDir() + "/level.dat"
+	mod := time.Now().Add(-time.Hour)
+	write(path, 1, mod)
+
+	var cache Cache
+	a, _, err := cache.DecodeFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _, err := cache.DecodeFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a != b || !a.Frozen() || a.Int("n") != 1 {
+		t.Errorf("DecodeFile: expected the same frozen document twice")
+	}
+
+	// same size, new modification time
+	write(path, 2, mod.Add(time.Second))
+	if c, _, err := cache.DecodeFile(path); err != nil || c == a || c.Int("n") != 2 {
+		t.Errorf("DecodeFile after a change: got %v, %v", c, err)
+	}
+
+	cache.Forget(path)
+	os.Remove(path)
+	if _, _, err := cache.DecodeFile(path); err == nil {
+		t.Error("DecodeFile of a removed file: expected an error")
+	}
+}
+
+// Run with -race: the documents of a cache are shared between goroutines,
+// which clone them to make changes.
+func TestCacheClone(t *testing.T) {
+	c, err := (&CompoundTag{Value: []Tag{
+		&IntTag{"n", 1},
+		&CompoundTag{Name: "inner", Value: []Tag{&IntTag{"x", 1}}},
+	}}).Compound()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := t.TempDir() + "/level.dat"
+	if err := EncodeFile(path, c, Format{Compression: Gzip}); err != nil {
+		t.Fatal(err)
+	}
+	var cache Cache
+	doc, _, err := cache.DecodeFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			clone := doc.Clone()
+			if err := clone.Set(Path{{Key: "inner"}, {Key: "x"}}, int32(10+i)); err != nil {
+				t.Errorf("Set on clone %d: %v", i, err)
+			}
+			if Equal(clone, doc) {
+				t.Errorf("clone %d: the change was not made", i)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if doc.Compound("inner").Int("x") != 1 {
+		t.Errorf("the cached document was changed")
+	}
+}
+
+func TestEncodeFile(t *testing.T) {
+	c, err := (&CompoundTag{Name: "", Value: []Tag{&StringTag{"name", "Bananrama"}}}).Compound()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	path := dir + "/level.dat"
+	if err := os.WriteFile(path, []byte("old"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	format := Format{Compression: Gzip, ByteOrder: binary.BigEndian}
+	if err := EncodeFile(path, c, format); err != nil {
+		t.Fatal(err)
+	}
+	got, f, err := DecodeFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f != format || got.String("name") != "Bananrama" {
+		t.Errorf("EncodeFile: read back %v as %v", got, f)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("EncodeFile: permissions not kept: %v", info.Mode())
+	}
+
+	before, _ := os.ReadFile(path)
+	if err := EncodeFile(path, c, Format{Compression: Compression(9)}); err == nil {
+		t.Error("EncodeFile: expected an error for an unsupported compression")
+	}
+	if after, _ := os.ReadFile(path); !bytes.Equal(after, before) {
+		t.Error("EncodeFile: failed encoding changed the file")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("EncodeFile: temporary file left behind: %v", entries)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	c, err := (&CompoundTag{Name: "", Value: []Tag{&StringTag{"name", "Bananrama"}}}).Compound()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	path := dir + "/level.dat"
+	if err := EncodeFile(path, c, Format{Compression: Gzip}); err != nil {
+		t.Fatal(err)
+	}
+	original, _ := os.ReadFile(path)
+
+	s, err := Edit(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if backup, _ := os.ReadFile(s.Backup()); !bytes.Equal(backup, original) {
+		t.Error("Edit: backup differs from the original")
+	}
+	s.Compound().SetPath("name", "Goodbye")
+	if err := s.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if got, _, _ := DecodeFile(path); got.String("name") != "Goodbye" {
+		t.Errorf("Commit: file not written")
+	}
+	if err := s.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if after, _ := os.ReadFile(path); !bytes.Equal(after, original) {
+		t.Error("Rollback: original not restored")
+	}
+	if err := s.Commit(); err != ErrSessionClosed {
+		t.Errorf("Commit after Rollback: expected ErrSessionClosed, got %v", err)
+	}
+
+	failing := errors.New("broken")
+	err = EditFile(path, func(c *Compound) error {
+		c.SetPath("name", "Halfway")
+		return failing
+	})
+	if err != failing {
+		t.Errorf("EditFile: expected the function's error, got %v", err)
+	}
+	if err := EditFile(path, func(c *Compound) error { return c.SetPath("name", "Done") }); err != nil {
+		t.Fatal(err)
+	}
+	if got, _, _ := DecodeFile(path); got.String("name") != "Done" {
+		t.Errorf("EditFile: file not written")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("EditFile: backup left behind: %v", entries)
+	}
+}
+
+func TestDecoderToken(t *testing.T) {
+	big := make([]int8, 100000)
+	c, err := (&CompoundTag{Name: "root", Value: []Tag{
+		&ByteArrayTag{"big", big},
+		&CompoundTag{Name: "Level", Value: []Tag{
+			&IntTag{"xPos", 3},
+			&ListTag{Name: "Sections", Elem: TagCompound, Value: []Tag{
+				&CompoundTag{Value: []Tag{&ByteTag{"Y", 1}}},
+			}},
+		}},
+		&ListTag{Name: "Pos", Elem: TagDouble, Value: []Tag{&DoubleTag{"", 1}, &DoubleTag{"", 2}}},
+		&StringTag{"name", "Bananrama"},
+	}}).Compound()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := c.MarshalBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, src := range []io.Reader{bytes.NewReader(data), io.MultiReader(bytes.NewReader(data))} {
+		dec := NewDecoder(src)
+		var got []string
+		for {
+			tok, err := dec.Token()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, tok.Type.String()+" "+tok.Name)
+			switch tok.Name {
+			case "big":
+				if err := dec.Skip(); err != nil {
+					t.Fatal(err)
+				}
+				if err := dec.Skip(); err != ErrNoPayload {
+					t.Errorf("Skip twice: expected ErrNoPayload, got %v", err)
+				}
+			case "Pos":
+				if tok.Elem != TagDouble || tok.Len != 2 {
+					t.Errorf("Token: list header %+v", tok)
+				}
+				v, err := dec.Value()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if l, ok := v.(*List); !ok || l.Doubles()[1] != 2 {
+					t.Errorf("Value: got %v", v)
+				}
+			case "name":
+				if v, err := dec.Value(); err != nil || v != "Bananrama" {
+					t.Errorf("Value: got %v, %v", v, err)
+				}
+			}
+		}
+		// entries are encoded in key order
+		want := []string{
+			"TAG_Compound root", "TAG_Compound Level", "TAG_List Sections",
+			"TAG_Compound ", "TAG_Byte Y", "TAG_End ", "TAG_End ", "TAG_Int xPos", "TAG_End ",
+			"TAG_List Pos", "TAG_Byte_Array big", "TAG_String name", "TAG_End ",
+		}
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("Token: got %q", got)
+		}
+	}
+
+	dec := NewDecoder(bytes.NewReader(data[:1000]))
+	dec.Token()
+	if tok, _ := dec.Token(); tok.Name != "Level" {
+		t.Fatalf("Token: expected Level, got %+v", tok)
+	}
+	if err := dec.Skip(); err != nil {
+		t.Fatal(err)
+	}
+	if tok, _ := dec.Token(); tok.Name != "Pos" {
+		t.Errorf("Skip of a compound: next token is %+v", tok)
+	}
+	dec.Skip()
+	if tok, _ := dec.Token(); tok.Name != "big" {
+		t.Errorf("Skip of a list: next token is %+v", tok)
+	}
+	if err := dec.Skip(); err != ErrTruncated {
+		t.Errorf("Skip past the end: expected ErrTruncated, got %v", err)
+	}
+}
+
+func TestDecoderPeek(t *testing.T) {
+	c, err := (&CompoundTag{Name: "", Value: []Tag{
+		&ListTag{Name: "sections", Elem: TagInt, Value: []Tag{&IntTag{"", 7}}},
+		&StringTag{"z", "last"},
+	}}).Compound()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := c.MarshalBytes()
+	dec := NewDecoder(bytes.NewReader(data))
+	dec.Token()
+
+	a, err := dec.Peek()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := dec.Peek()
+	if a != b || a.Name != "sections" || a.Elem != TagInt || a.Len != 1 {
+		t.Errorf("Peek: got %+v then %+v", a, b)
+	}
+	if tok, _ := dec.Token(); tok != a {
+		t.Errorf("Token after Peek: got %+v, expected %+v", tok, a)
+	}
+	if tok, _ := dec.Peek(); tok.Type != TagInt {
+		t.Errorf("Peek into the list: got %+v", tok)
+	}
+	if err := dec.Skip(); err != ErrNoPayload {
+		t.Errorf("Skip after Peek: expected ErrNoPayload, got %v", err)
+	}
+	dec.Token()
+	// the int is skipped unread
+	if tok, _ := dec.Peek(); tok.Type != TagEnd {
+		t.Errorf("Peek at the end of the list: got %+v", tok)
+	}
+	dec.Token()
+	if tok, _ := dec.Token(); tok.Name != "z" {
+		t.Errorf("Token after the list: got %+v", tok)
+	}
+	if v, err := dec.Value(); v != "last" || err != nil {
+		t.Errorf("Value: got %v, %v", v, err)
+	}
+}
+
+func TestDecoderDescend(t *testing.T) {
+	c, err := (&CompoundTag{Name: "", Value: []Tag{
+		&CompoundTag{Name: "Level", Value: []Tag{
+			&ByteArrayTag{"Biomes", make([]int8, 256)},
+			&ListTag{Name: "Sections", Elem: TagCompound, Value: []Tag{
+				&CompoundTag{Value: []Tag{&ByteTag{"Y", 4}}},
+			}},
+			&IntTag{"xPos", 3},
+		}},
+		&IntTag{"DataVersion", 1343},
+	}}).Compound()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := c.MarshalBytes()
+	dec := NewDecoder(bytes.NewReader(data))
+	if _, err := dec.Descend("Level"); err == nil {
+		t.Error("Descend before the root: expected an error")
+	}
+	dec.Token()
+	if tok, err := dec.Descend("Level"); err != nil || tok.Type != TagCompound {
+		t.Fatalf("Descend: got %+v, %v", tok, err)
+	}
+	tok, err := dec.Descend("Sections")
+	if err != nil || tok.Elem != TagCompound || tok.Len != 1 {
+		t.Fatalf("Descend: got %+v, %v", tok, err)
+	}
+	dec.Token()
+	if tok, err := dec.Descend("Y"); err != nil || tok.Type != TagByte {
+		t.Fatalf("Descend: got %+v, %v", tok, err)
+	}
+	if v, _ := dec.Value(); v != int8(4) {
+		t.Errorf("Value: got %v", v)
+	}
+	dec.Token()
+	dec.Token()
+	if _, err := dec.Descend("zPos"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Descend to a missing entry: expected ErrNotFound, got %v", err)
+	}
+	// the rest of Level was skipped, and DataVersion came before it
+	if tok, err := dec.Token(); err != nil || tok.Type != TagEnd {
+		t.Errorf("Token after a miss: got %+v, %v", tok, err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		t.Errorf("Token after the document: expected io.EOF, got %v", err)
+	}
+}
+
+func TestDecoderInputOffset(t *testing.T) {
+	c, err := (&CompoundTag{Name: "ab", Value: []Tag{&IntTag{"n", 1}}}).Compound()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := c.MarshalBytes()
+	dec := NewDecoder(bytes.NewReader(append(data, data...)))
+	if n := dec.InputOffset(); n != 0 {
+		t.Errorf("InputOffset: expected 0, got %d", n)
+	}
+	dec.Token()
+	// type, name length and name
+	if n := dec.InputOffset(); n != 5 {
+		t.Errorf("InputOffset after the root: expected 5, got %d", n)
+	}
+	dec.Token()
+	dec.Value()
+	if n := dec.InputOffset(); n != 5+1+2+1+4 {
+		t.Errorf("InputOffset after the int: expected 13, got %d", n)
+	}
+	dec.Token()
+	if !dec.More() {
+		t.Fatal("More: expected another document")
+	}
+	if n := dec.InputOffset(); n != int64(len(data)) {
+		t.Errorf("InputOffset after More: expected %d, got %d", len(data), n)
+	}
+	if _, err := dec.Decode(); err != nil {
+		t.Fatal(err)
+	}
+	if n := dec.InputOffset(); n != 2*int64(len(data)) {
+		t.Errorf("InputOffset after Decode: expected %d, got %d", 2*len(data), n)
+	}
+}
+
+func TestDecodeIndexed(t *testing.T) {
+	c, err := (&CompoundTag{Name: "", Value: []Tag{
+		&CompoundTag{Name: "Level", Value: []Tag{
+			&ListTag{Name: "Sections", Elem: TagCompound, Value: []Tag{
+				&CompoundTag{Value: []Tag{&ByteTag{"Y", 4}, &ByteArrayTag{"Blocks", []int8{1, 2, 3}}}},
+			}},
+			&IntTag{"xPos", 3},
+			&ListTag{Name: "Pos", Elem: TagDouble, Value: []Tag{&DoubleTag{"", 1}, &DoubleTag{"", 2}}},
+		}},
+		&StringTag{"name", "Bananrama"},
+	}}).Compound()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := c.MarshalBytes()
+
+	got, index, err := NewDecoder(bytes.NewReader(data)).DecodeIndexed(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changes := Diff(c, got); len(changes) > 0 {
+		t.Errorf("DecodeIndexed: %v", changes)
+	}
+	if len(index.Entries) != 10 {
+		t.Errorf("DecodeIndexed: expected 10 entries, got %d", len(index.Entries))
+	}
+
+	saved, err := index.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded := new(OffsetIndex)
+	if err := loaded.UnmarshalBinary(saved); err != nil {
+		t.Fatal(err)
+	}
+	r := bytes.NewReader(data)
+	for _, path := range []string{"name", "Level.xPos", "Level.Sections[0].Y", "Level.Sections[0].Blocks", "Level.Pos", "Level.Pos[1]", "Level"} {
+		want, _ := c.GetPath(path)
+		v, err := loaded.ReadAt(r, path)
+		if err != nil || !Equal(v, want) {
+			t.Errorf("ReadAt(%s): expected %v, got %v (%v)", path, want, v, err)
+		}
+	}
+	if _, err := loaded.ReadAt(r, "Level.zPos"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("ReadAt: expected ErrNotFound, got %v", err)
+	}
+
+	_, index, err = NewDecoder(bytes.NewReader(data)).DecodeIndexed(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(index.Entries) != 2 {
+		t.Errorf("DecodeIndexed(1): expected the 2 root entries, got %v", index.Entries)
+	}
+}
+
+func TestOptionsMethods(t *testing.T) {
+	le := EncodeOptions{ByteOrder: binary.LittleEndian, OverrideRootName: true, RootName: "root"}
+	n, err := (&CompoundTag{Value: []Tag{&IntTag{"n", 1}}}).Compound()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := new(bytes.Buffer)
+	if err := le.Encode(out, n); err != nil {
+		t.Fatal(err)
+	}
+	data := out.Bytes()
+	if _, err := DecodeBytes(data); err == nil {
+		t.Error("DecodeBytes: expected an error for a little endian document")
+	}
+	c, err := DecodeOptions{ByteOrder: binary.LittleEndian}.DecodeBytes(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Name() != "root" || c.IntOr("n", 0) != 1 {
+		t.Errorf("DecodeBytes: got %q, %d", c.Name(), c.IntOr("n", 0))
+	}
+
+	buf := new(bytes.Buffer)
+	if err := le.EncodeGzip(buf, c); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (DecodeOptions{ByteOrder: binary.LittleEndian, MaxBytes: 5}).DecodeGzip(bytes.NewReader(buf.Bytes())); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("DecodeGzip: expected ErrTooLarge, got %v", err)
+	}
+
+	path := t.TempDir() + "/level.dat"
+	if err := le.EncodeFile(path, c, Format{Compression: Zlib}); err != nil {
+		t.Fatal(err)
+	}
+	back, f, err := DecodeOptions{MaxDepth: 1}.DecodeFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Compression != Zlib || f.ByteOrder != binary.LittleEndian || back.Name() != "root" {
+		t.Errorf("DecodeFile: got %v, %q", f, back.Name())
+	}
+}
+
+type recordedMetrics struct {
+	decoded, encoded []int64
+	errors           []string
+}
+
+func (self *recordedMetrics) Decoded(bytes int64, d time.Duration, err error) {
+	self.decoded = append(self.decoded, bytes)
+	if err != nil {
+		self.errors = append(self.errors, ErrorClass(err))
+	}
+}
+
+func (self *recordedMetrics) Encoded(bytes int64, d time.Duration, err error) {
+	self.encoded = append(self.encoded, bytes)
+	if err != nil {
+		self.errors = append(self.errors, ErrorClass(err))
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	m := new(recordedMetrics)
+	dec := DecodeOptions{Metrics: m}.NewDecoder(bytes.NewReader(append(append([]byte{}, helloWorld...), helloWorld...)))
+	for {
+		if _, err := dec.Decode(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := (DecodeOptions{Metrics: m}).DecodeBytes(helloWorld[:10]); err == nil {
+		t.Error("DecodeBytes: expected an error for truncated input")
+	}
+	n := int64(len(helloWorld))
+	if len(m.decoded) != 3 || m.decoded[0] != n || m.decoded[1] != n {
+		t.Errorf("Decoded: got %v", m.decoded)
+	}
+
+	c, _ := DecodeBytes(helloWorld)
+	buf := new(bytes.Buffer)
+	enc := EncodeOptions{Metrics: m}.NewEncoder(buf)
+	if err := enc.Encode(c); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.encoded) != 1 || m.encoded[0] != n || m.encoded[0] != int64(buf.Len()) {
+		t.Errorf("Encoded: got %v for %d bytes", m.encoded, buf.Len())
+	}
+	if len(m.errors) != 1 || m.errors[0] != "truncated" {
+		t.Errorf("ErrorClass: got %v", m.errors)
+	}
+}
@@ -0,0 +1,228 @@
+// Package nbtgen generates Go struct definitions from sample NBT documents,
+// for decoding undocumented formats with nbt.Unmarshal.
+//
+// Each compound becomes a struct type with one field per entry, tagged with
+// the entry's name. Lists become slices; the elements of a list of compounds
+// are merged into a single struct type holding every entry seen in any of
+// them, and entries missing from some elements are marked optional.
+package nbtgen
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/moshee/go-nbt"
+)
+
+// Returns Go source for package pkg declaring a struct type named name for
+// the compound, and one type for each compound nested in it.
+func Generate(c *nbt.Compound, pkg, name string) ([]byte, error) {
+	g := &generator{names: make(map[string]bool)}
+	g.struct_type(exported(name), []*nbt.CompoundTag{c.Tag()})
+
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "// Code generated by nbtgen from a sample document; DO NOT EDIT.\n\n")
+	fmt.Fprintf(buf, "package %s\n", pkg)
+	for _, decl := range g.decls {
+		buf.WriteString("\n" + decl)
+	}
+	return format.Source(buf.Bytes())
+}
+
+type generator struct {
+	decls []string
+	names map[string]bool
+}
+
+// Returns a type name based on name that is not taken yet.
+func (self *generator) unique(name string) string {
+	unique := name
+	for i := 2; self.names[unique]; i++ {
+		unique = fmt.Sprintf("%s%d", name, i)
+	}
+	self.names[unique] = true
+	return unique
+}
+
+type field struct {
+	key   string
+	tags  []nbt.Tag
+	count int
+}
+
+// Declares a struct type merging the entries of the samples, and returns its
+// name.
+func (self *generator) struct_type(name string, samples []*nbt.CompoundTag) string {
+	name = self.unique(name)
+	// reserve this type's place ahead of its nested types
+	i := len(self.decls)
+	self.decls = append(self.decls, "")
+
+	fields := make(map[string]*field)
+	for _, sample := range samples {
+		for _, t := range sample.Value {
+			f, ok := fields[t.TagName()]
+			if !ok {
+				f = &field{key: t.TagName()}
+				fields[f.key] = f
+			}
+			f.tags = append(f.tags, t)
+			f.count++
+		}
+	}
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "type %s struct {\n", name)
+	used := make(map[string]bool)
+	for _, k := range keys {
+		f := fields[k]
+		field_name := exported(k)
+		unique := field_name
+		for n := 2; used[unique]; n++ {
+			unique = fmt.Sprintf("%s%d", field_name, n)
+		}
+		used[unique] = true
+
+		typ, note := self.go_type(name+field_name, f.tags)
+		if f.count < len(samples) {
+			note = join_notes("optional", note)
+		}
+		fmt.Fprintf(buf, "\t%s %s `nbt:%q`", unique, typ, k)
+		if note != "" {
+			fmt.Fprintf(buf, " // %s", note)
+		}
+		buf.WriteString("\n")
+	}
+	buf.WriteString("}\n")
+	self.decls[i] = buf.String()
+	return name
+}
+
+func join_notes(a, b string) string {
+	if b == "" {
+		return a
+	}
+	return a + "; " + b
+}
+
+var scalar_types = map[nbt.TagType]string{
+	nbt.TagByte:      "int8",
+	nbt.TagShort:     "int16",
+	nbt.TagInt:       "int32",
+	nbt.TagLong:      "int64",
+	nbt.TagFloat:     "float32",
+	nbt.TagDouble:    "float64",
+	nbt.TagString:    "string",
+	nbt.TagByteArray: "[]int8",
+	nbt.TagIntArray:  "[]int32",
+	nbt.TagLongArray: "[]int64",
+}
+
+// Returns the Go type for values seen as the given tags, naming new struct
+// types after name, and a note on anything that could not be inferred.
+func (self *generator) go_type(name string, tags []nbt.Tag) (string, string) {
+	first := tags[0].Type()
+	var others []string
+	var same []nbt.Tag
+	for _, t := range tags {
+		if t.Type() != first {
+			others = append(others, t.Type().String())
+		} else {
+			same = append(same, t)
+		}
+	}
+	typ, note := self.go_type_of(name, same)
+	if len(others) > 0 {
+		note = join_notes("also seen as "+strings.Join(dedup(others), ", "), note)
+	}
+	return typ, note
+}
+
+func (self *generator) go_type_of(name string, tags []nbt.Tag) (string, string) {
+	switch tags[0].Type() {
+	case nbt.TagCompound:
+		samples := make([]*nbt.CompoundTag, len(tags))
+		for i, t := range tags {
+			samples[i] = t.(*nbt.CompoundTag)
+		}
+		return self.struct_type(name, samples), ""
+
+	case nbt.TagList:
+		var elem nbt.TagType
+		var items []nbt.Tag
+		for _, t := range tags {
+			l := t.(*nbt.ListTag)
+			if l.Elem == nbt.TagEnd {
+				continue
+			}
+			if elem != nbt.TagEnd && l.Elem != elem {
+				return "[]interface{}", "lists of different element types"
+			}
+			elem = l.Elem
+			items = append(items, l.Value...)
+		}
+		if len(items) == 0 {
+			return "[]interface{}", "element type unknown: only empty lists seen"
+		}
+		typ, note := self.go_type(singular(name), items)
+		return "[]" + typ, note
+	}
+	if typ, ok := scalar_types[tags[0].Type()]; ok {
+		return typ, ""
+	}
+	return "interface{}", "unsupported " + tags[0].Type().String()
+}
+
+func dedup(s []string) []string {
+	sort.Strings(s)
+	out := s[:0]
+	for i, v := range s {
+		if i == 0 || v != s[i-1] {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// Returns the name for the element type of a list named name.
+func singular(name string) string {
+	switch {
+	case strings.HasSuffix(name, "ies"):
+		return strings.TrimSuffix(name, "ies") + "y"
+	case strings.HasSuffix(name, "s") && !strings.HasSuffix(name, "ss"):
+		return strings.TrimSuffix(name, "s")
+	}
+	return name + "Elem"
+}
+
+// Turns an entry name into an exported Go identifier, capitalizing each
+// word: "listTest (long)" becomes ListTestLong.
+func exported(key string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range key {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	s := b.String()
+	if s == "" || !unicode.IsLetter([]rune(s)[0]) {
+		s = "X" + s
+	}
+	return s
+}
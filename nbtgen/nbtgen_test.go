@@ -0,0 +1,55 @@
+package nbtgen
+
+import (
+	"testing"
+
+	"github.com/moshee/go-nbt"
+)
+
+func TestGenerate(t *testing.T) {
+	c, err := (&nbt.CompoundTag{Name: "Level", Value: []nbt.Tag{
+		&nbt.StringTag{Name: "LevelName", Value: "world"},
+		&nbt.ListTag{Name: "Pos", Elem: nbt.TagDouble, Value: []nbt.Tag{&nbt.DoubleTag{Value: 1}}},
+		&nbt.ListTag{Name: "Items", Elem: nbt.TagCompound, Value: []nbt.Tag{
+			&nbt.CompoundTag{Value: []nbt.Tag{&nbt.StringTag{Name: "id", Value: "stone"}, &nbt.ByteTag{Name: "Count", Value: 1}}},
+			&nbt.CompoundTag{Value: []nbt.Tag{&nbt.StringTag{Name: "id", Value: "dirt"}, &nbt.CompoundTag{Name: "tag"}}},
+		}},
+		&nbt.CompoundTag{Name: "listTest (long)", Value: []nbt.Tag{&nbt.IntArrayTag{Name: "ids"}}},
+		&nbt.ListTag{Name: "empty", Elem: nbt.TagEnd},
+	}}).Compound()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src, err := Generate(c, "world", "Level")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "// Code generated by nbtgen from a sample document; DO NOT EDIT.\n" + `
+package world
+
+type Level struct {
+	Items        []LevelItem       ` + "`nbt:\"Items\"`" + `
+	LevelName    string            ` + "`nbt:\"LevelName\"`" + `
+	Pos          []float64         ` + "`nbt:\"Pos\"`" + `
+	Empty        []interface{}     ` + "`nbt:\"empty\"`" + ` // element type unknown: only empty lists seen
+	ListTestLong LevelListTestLong ` + "`nbt:\"listTest (long)\"`" + `
+}
+
+type LevelItem struct {
+	Count int8         ` + "`nbt:\"Count\"`" + ` // optional
+	Id    string       ` + "`nbt:\"id\"`" + `
+	Tag   LevelItemTag ` + "`nbt:\"tag\"`" + ` // optional
+}
+
+type LevelItemTag struct {
+}
+
+type LevelListTestLong struct {
+	Ids []int32 ` + "`nbt:\"ids\"`" + `
+}
+`
+	if string(src) != expected {
+		t.Errorf("Generate:\nexpected:\n%s\ngot:\n%s", expected, src)
+	}
+}
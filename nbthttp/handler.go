@@ -0,0 +1,153 @@
+// Package nbthttp serves NBT documents over HTTP as JSON or SNBT, so that
+// dashboards can expose live game state with a few lines of code:
+//
+//	http.Handle("/level", nbthttp.File("world/level.dat"))
+//	http.Handle("/state", nbthttp.Handler(func() (*nbt.Compound, error) {
+//		return server.State(), nil
+//	}))
+//
+// The representation is chosen by the request's Accept header: JSON
+// (application/json, the default) in the type-preserving form read by
+// (*nbt.Compound).UnmarshalJSON, or SNBT (text/x-snbt or text/plain). A
+// format query parameter of json or snbt overrides the Accept header. Add
+// pretty=1 to the query for indented output.
+package nbthttp
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/moshee/go-nbt"
+)
+
+const (
+	JSONType = "application/json"
+	SNBTType = "text/x-snbt"
+)
+
+// Returns a handler that serves the compound returned by get on every
+// request. get is called concurrently if requests are; it must return a
+// compound that is not modified while it is being served, such as a copy.
+func Handler(get func() (*nbt.Compound, error)) http.Handler {
+	return handler(get)
+}
+
+// Returns a handler that serves a fixed compound, which must not be
+// modified afterwards.
+func Compound(c *nbt.Compound) http.Handler {
+	return handler(func() (*nbt.Compound, error) { return c, nil })
+}
+
+// Returns a handler that reads and decodes the NBT file at path on every
+// request, in any format understood by nbt.DecodeFile.
+func File(path string) http.Handler {
+	return handler(func() (*nbt.Compound, error) {
+		c, _, err := nbt.DecodeFile(path)
+		return c, err
+	})
+}
+
+type handler func() (*nbt.Compound, error)
+
+func (self handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var format string
+	switch r.FormValue("format") {
+	case "json":
+		format = JSONType
+	case "snbt":
+		format = SNBTType
+	case "":
+		format = negotiate(r.Header.Get("Accept"))
+	default:
+		http.Error(w, "unknown format", http.StatusBadRequest)
+		return
+	}
+	if format == "" {
+		http.Error(w, "not acceptable: serving "+JSONType+" or "+SNBTType, http.StatusNotAcceptable)
+		return
+	}
+	pretty, _ := strconv.ParseBool(r.FormValue("pretty"))
+
+	c, err := self()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	body, err := marshal(c, format, pretty)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", format+"; charset=utf-8")
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.Header().Add("Vary", "Accept")
+	if r.Method == "GET" {
+		w.Write(body)
+	}
+}
+
+func marshal(c *nbt.Compound, format string, pretty bool) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	switch format {
+	case JSONType:
+		out, err := json.Marshal(c)
+		if err != nil || !pretty {
+			return out, err
+		}
+		err = json.Indent(buf, out, "", "    ")
+		return buf.Bytes(), err
+	default:
+		out, err := nbt.MarshalSNBT(c)
+		if err != nil || !pretty {
+			return out, err
+		}
+		err = nbt.IndentSNBT(buf, out, "", "    ")
+		return buf.Bytes(), err
+	}
+}
+
+// Picks the served media type the Accept header prefers, or "" if it accepts
+// none of them. Ties go to JSON.
+func negotiate(accept string) string {
+	if accept == "" {
+		return JSONType
+	}
+	best, best_q := "", 0.0
+	for _, part := range strings.Split(accept, ",") {
+		media, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if s, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(s, 64); err != nil {
+				continue
+			}
+		}
+
+		var format string
+		switch media {
+		case JSONType, "application/*", "*/*":
+			format = JSONType
+		case SNBTType, "text/plain", "text/*":
+			format = SNBTType
+		default:
+			continue
+		}
+		if q > best_q || q == best_q && format == JSONType {
+			best, best_q = format, q
+		}
+	}
+	return best
+}
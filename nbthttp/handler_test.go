@@ -0,0 +1,61 @@
+package nbthttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/moshee/go-nbt"
+)
+
+// TAG_Compound('hello world'): TAG_String('name'): 'Bananrama'
+var helloWorld = []byte{
+	0x0a, 0x00, 0x0b, 'h', 'e', 'l', 'l', 'o', ' ', 'w', 'o', 'r', 'l', 'd',
+	0x08, 0x00, 0x04, 'n', 'a', 'm', 'e',
+	0x00, 0x09, 'B', 'a', 'n', 'a', 'n', 'r', 'a', 'm', 'a',
+	0x00,
+}
+
+func TestHandler(t *testing.T) {
+	c, err := nbt.DecodeBytes(helloWorld)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := Compound(c)
+
+	tests := []struct {
+		url, accept string
+		status      int
+		typ, body   string
+	}{
+		{"/", "", 200, JSONType, `"value":"Bananrama"`},
+		{"/", "text/html, */*;q=0.1", 200, JSONType, `"type":"compound"`},
+		{"/", "text/plain", 200, SNBTType, `{name:"Bananrama"}`},
+		{"/", "application/json;q=0.5, text/x-snbt", 200, SNBTType, `{name:"Bananrama"}`},
+		{"/?format=snbt", "application/json", 200, SNBTType, `{name:"Bananrama"}`},
+		{"/", "image/png", http.StatusNotAcceptable, "", ""},
+		{"/?format=xml", "", http.StatusBadRequest, "", ""},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", test.url, nil)
+		if test.accept != "" {
+			r.Header.Set("Accept", test.accept)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != test.status {
+			t.Errorf("%s (Accept: %s): expected status %d, got %d", test.url, test.accept, test.status, w.Code)
+			continue
+		}
+		if test.status != 200 {
+			continue
+		}
+		if typ := w.Header().Get("Content-Type"); !strings.HasPrefix(typ, test.typ) {
+			t.Errorf("%s (Accept: %s): expected %s, got %s", test.url, test.accept, test.typ, typ)
+		}
+		if !strings.Contains(w.Body.String(), test.body) {
+			t.Errorf("%s (Accept: %s): expected body containing %s, got %s", test.url, test.accept, test.body, w.Body)
+		}
+	}
+}
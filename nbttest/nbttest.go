@@ -0,0 +1,111 @@
+// Package nbttest provides assertions for testing code that handles NBT.
+package nbttest
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/moshee/go-nbt"
+)
+
+// Update makes Golden write the golden files instead of comparing against
+// them. It is set if the NBTTEST_UPDATE environment variable is not empty.
+var Update = os.Getenv("NBTTEST_UPDATE") != ""
+
+// Fails the test if got is not equal to want as NBT (see nbt.Equal),
+// listing every difference between them.
+func AssertEqual(t testing.TB, want, got *nbt.Compound) {
+	t.Helper()
+	if changes := nbt.Diff(want, got); len(changes) > 0 {
+		t.Errorf("NBT differs from the expected document:\n%s", format_changes(changes))
+	}
+}
+
+func format_changes(changes []nbt.Change) string {
+	lines := make([]string, len(changes))
+	for i, c := range changes {
+		lines[i] = "\t" + c.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Compares the canonical encoding of the compound, as written by
+// Compound.MarshalBytes, with the uncompressed NBT file at path, which is
+// relative to the test's working directory by convention something like
+// testdata/name.nbt. If they differ, the test fails with the differences
+// between the two documents. If Update is set, the file is written instead.
+func Golden(t testing.TB, path string, c *nbt.Compound) {
+	t.Helper()
+	got, err := c.MarshalBytes()
+	if err != nil {
+		t.Fatalf("Encoding %s: %v", path, err)
+	}
+	if Update {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Golden file %s does not exist; run with NBTTEST_UPDATE=1 to create it", path)
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(want, got) {
+		return
+	}
+	expected, err := nbt.DecodeBytes(want)
+	if err != nil {
+		t.Fatalf("Golden file %s: %v", path, err)
+	}
+	if changes := nbt.Diff(expected, c); len(changes) > 0 {
+		t.Errorf("NBT differs from golden file %s:\n%s", path, format_changes(changes))
+	} else {
+		t.Errorf("Encoding differs from golden file %s, but the documents are equal", path)
+	}
+}
+
+// Checks that the compound survives encoding and decoding unchanged as NBT,
+// type-preserving JSON and CBOR.
+func RoundTrip(t testing.TB, c *nbt.Compound) {
+	t.Helper()
+	formats := []struct {
+		name   string
+		encode func(*nbt.Compound) ([]byte, error)
+		decode func([]byte) (*nbt.Compound, error)
+	}{
+		{"NBT", (*nbt.Compound).MarshalBytes, nbt.DecodeBytes},
+		{"JSON", (*nbt.Compound).MarshalJSON, func(data []byte) (*nbt.Compound, error) {
+			c := new(nbt.Compound)
+			return c, c.UnmarshalJSON(data)
+		}},
+		{"CBOR", nbt.ToCBOR, nbt.FromCBOR},
+	}
+	for _, f := range formats {
+		data, err := f.encode(c)
+		if err != nil {
+			t.Errorf("Encoding as %s: %v", f.name, err)
+			continue
+		}
+		got, err := f.decode(data)
+		if err != nil {
+			t.Errorf("Decoding %s: %v", f.name, err)
+			continue
+		}
+		if changes := nbt.Diff(c, got); len(changes) > 0 {
+			t.Errorf("%s round trip changed the document:\n%s", f.name, format_changes(changes))
+		}
+		if got.Name() != c.Name() {
+			t.Errorf("%s round trip changed the root's name from %q to %q", f.name, c.Name(), got.Name())
+		}
+	}
+}
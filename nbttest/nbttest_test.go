@@ -0,0 +1,133 @@
+package nbttest
+
+import (
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/quick"
+
+	"github.com/moshee/go-nbt"
+)
+
+// recorder is a testing.TB that records failures instead of failing.
+type recorder struct {
+	testing.TB
+	failures []string
+}
+
+func (self *recorder) Helper() {}
+
+func (self *recorder) Errorf(format string, args ...interface{}) {
+	self.failures = append(self.failures, fmt.Sprintf(format, args...))
+}
+
+func (self *recorder) Fatalf(format string, args ...interface{}) {
+	self.Errorf(format, args...)
+	panic(self)
+}
+
+// Runs f with a recorder and returns the recorded failures.
+func record(t *testing.T, f func(t testing.TB)) (failures []string) {
+	r := &recorder{TB: t}
+	defer func() {
+		if v := recover(); v != nil && v != r {
+			panic(v)
+		}
+		failures = r.failures
+	}()
+	f(r)
+	return
+}
+
+func sample(t *testing.T, count int8) *nbt.Compound {
+	c, err := (&nbt.CompoundTag{Name: "root", Value: []nbt.Tag{
+		&nbt.StringTag{Name: "id", Value: "stone"},
+		&nbt.ByteTag{Name: "Count", Value: count},
+		&nbt.ListTag{Name: "Pos", Elem: nbt.TagDouble, Value: []nbt.Tag{&nbt.DoubleTag{Value: 1.5}}},
+		&nbt.LongArrayTag{Name: "longs", Value: []int64{1, -1}},
+	}}).Compound()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestAssertEqual(t *testing.T) {
+	AssertEqual(t, sample(t, 1), sample(t, 1))
+
+	want, got := sample(t, 1), sample(t, 2)
+	failures := record(t, func(r testing.TB) { AssertEqual(r, want, got) })
+	if len(failures) != 1 || !strings.Contains(failures[0], "~ .Count: 1b -> 2b") {
+		t.Errorf("AssertEqual with different documents: %v", failures)
+	}
+}
+
+func TestGolden(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "testdata", "sample.nbt")
+	if failures := record(t, func(r testing.TB) { Golden(r, path, sample(t, 1)) }); len(failures) != 1 || !strings.Contains(failures[0], "NBTTEST_UPDATE") {
+		t.Errorf("Golden without a file: %v", failures)
+	}
+
+	Update = true
+	Golden(t, path, sample(t, 1))
+	Update = false
+	Golden(t, path, sample(t, 1))
+
+	failures := record(t, func(r testing.TB) { Golden(r, path, sample(t, 2)) })
+	if len(failures) != 1 || !strings.Contains(failures[0], "~ .Count: 1b -> 2b") {
+		t.Errorf("Golden with a different document: %v", failures)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	RoundTrip(t, sample(t, 1))
+}
+
+func TestRandom(t *testing.T) {
+	a := Random(rand.New(rand.NewSource(1)), RandomOptions{})
+	b := Random(rand.New(rand.NewSource(1)), RandomOptions{})
+	AssertEqual(t, a, b)
+
+	seen := map[nbt.TagType]bool{}
+	r := rand.New(rand.NewSource(2))
+	for i := 0; i < 50; i++ {
+		c := Random(r, RandomOptions{SpecialFloats: true})
+		data, err := c.MarshalBytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := nbt.DecodeBytes(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		AssertEqual(t, c, got)
+		for _, tag := range c.Tag().Value {
+			seen[tag.Type()] = true
+		}
+	}
+	for tag := nbt.TagByte; tag <= nbt.TagLongArray; tag++ {
+		if !seen[tag] {
+			t.Errorf("Random: never generated %v", tag)
+		}
+	}
+
+	if err := quick.Check(func(tree Tree) bool {
+		data, err := tree.MarshalBytes()
+		if err != nil {
+			return false
+		}
+		got, err := nbt.DecodeBytes(data)
+		return err == nil && nbt.Equal(tree.Compound, got)
+	}, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRandomRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(3))
+	for i := 0; i < 20; i++ {
+		RoundTrip(t, Random(r, RandomOptions{}))
+	}
+}
@@ -0,0 +1,160 @@
+package nbttest
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"strings"
+
+	"github.com/moshee/go-nbt"
+)
+
+// RandomOptions bound the size of the trees made by Random. Zero fields
+// take the default given.
+type RandomOptions struct {
+	MaxDepth     int // nesting of compounds and lists below the root; 4
+	MaxEntries   int // entries of a compound or elements of a list; 8
+	MaxArrayLen  int // elements of an array; 16
+	MaxStringLen int // runes of a string or name; 12
+
+	// Include NaNs and infinities among the floats, which not every text
+	// format can represent.
+	SpecialFloats bool
+}
+
+func (self RandomOptions) or_defaults() RandomOptions {
+	def := func(n *int, d int) {
+		if *n <= 0 {
+			*n = d
+		}
+	}
+	def(&self.MaxDepth, 4)
+	def(&self.MaxEntries, 8)
+	def(&self.MaxArrayLen, 16)
+	def(&self.MaxStringLen, 12)
+	return self
+}
+
+// Returns a random valid document using every tag type, for property
+// tests and fuzzing. The same source and options always give the same
+// document.
+func Random(r *rand.Rand, opts RandomOptions) *nbt.Compound {
+	g := generator{r, opts.or_defaults()}
+	c, err := g.compound(g.string(), 0).Compound()
+	if err != nil {
+		panic("nbttest: generated an invalid document: " + err.Error())
+	}
+	return c
+}
+
+// Tree is a document that testing/quick can generate at random, e.g.
+//
+//	quick.Check(func(tree nbttest.Tree) bool { ... }, nil)
+type Tree struct {
+	*nbt.Compound
+}
+
+// Implements quick.Generator, scaling the number of entries with size.
+func (Tree) Generate(r *rand.Rand, size int) reflect.Value {
+	c := Random(r, RandomOptions{MaxEntries: size/4 + 1, MaxArrayLen: size + 1})
+	return reflect.ValueOf(Tree{c})
+}
+
+type generator struct {
+	r    *rand.Rand
+	opts RandomOptions
+}
+
+var random_runes = []rune("abcdefghijklmnopqrstuvwxyzABCXYZ0189_-.:+ \"'\\[]{}é日本🍌\u0000")
+
+func (self generator) string() string {
+	var b strings.Builder
+	for i := self.r.Intn(self.opts.MaxStringLen + 1); i > 0; i-- {
+		b.WriteRune(random_runes[self.r.Intn(len(random_runes))])
+	}
+	return b.String()
+}
+
+func (self generator) tag_type(depth int) nbt.TagType {
+	if depth >= self.opts.MaxDepth {
+		// no more nesting
+		for {
+			if tag := nbt.TagType(1 + self.r.Intn(12)); tag != nbt.TagList && tag != nbt.TagCompound {
+				return tag
+			}
+		}
+	}
+	return nbt.TagType(1 + self.r.Intn(12))
+}
+
+func (self generator) compound(name string, depth int) *nbt.CompoundTag {
+	c := &nbt.CompoundTag{Name: name}
+	seen := map[string]bool{}
+	for i := self.r.Intn(self.opts.MaxEntries + 1); i > 0; i-- {
+		name := self.string()
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		c.Value = append(c.Value, self.tag(self.tag_type(depth), name, depth))
+	}
+	return c
+}
+
+func (self generator) float() float64 {
+	if self.opts.SpecialFloats && self.r.Intn(8) == 0 {
+		return []float64{math.NaN(), math.Inf(1), math.Inf(-1), math.Copysign(0, -1)}[self.r.Intn(4)]
+	}
+	return self.r.NormFloat64() * math.Pow(10, float64(self.r.Intn(20)-10))
+}
+
+func (self generator) tag(tag nbt.TagType, name string, depth int) nbt.Tag {
+	r := self.r
+	switch tag {
+	case nbt.TagByte:
+		return &nbt.ByteTag{Name: name, Value: int8(r.Uint32())}
+	case nbt.TagShort:
+		return &nbt.ShortTag{Name: name, Value: int16(r.Uint32())}
+	case nbt.TagInt:
+		return &nbt.IntTag{Name: name, Value: int32(r.Uint32())}
+	case nbt.TagLong:
+		return &nbt.LongTag{Name: name, Value: int64(r.Uint64())}
+	case nbt.TagFloat:
+		return &nbt.FloatTag{Name: name, Value: float32(self.float())}
+	case nbt.TagDouble:
+		return &nbt.DoubleTag{Name: name, Value: self.float()}
+	case nbt.TagString:
+		return &nbt.StringTag{Name: name, Value: self.string()}
+
+	case nbt.TagByteArray:
+		v := make([]int8, r.Intn(self.opts.MaxArrayLen+1))
+		for i := range v {
+			v[i] = int8(r.Uint32())
+		}
+		return &nbt.ByteArrayTag{Name: name, Value: v}
+	case nbt.TagIntArray:
+		v := make([]int32, r.Intn(self.opts.MaxArrayLen+1))
+		for i := range v {
+			v[i] = int32(r.Uint32())
+		}
+		return &nbt.IntArrayTag{Name: name, Value: v}
+	case nbt.TagLongArray:
+		v := make([]int64, r.Intn(self.opts.MaxArrayLen+1))
+		for i := range v {
+			v[i] = int64(r.Uint64())
+		}
+		return &nbt.LongArrayTag{Name: name, Value: v}
+
+	case nbt.TagList:
+		n := r.Intn(self.opts.MaxEntries + 1)
+		if n == 0 {
+			return &nbt.ListTag{Name: name, Elem: nbt.TagEnd}
+		}
+		l := &nbt.ListTag{Name: name, Elem: self.tag_type(depth + 1)}
+		for i := 0; i < n; i++ {
+			l.Value = append(l.Value, self.tag(l.Elem, "", depth+1))
+		}
+		return l
+	}
+	return self.compound(name, depth+1)
+}
@@ -0,0 +1,27 @@
+//go:build !nbt_noreflect
+
+package nbttest
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/moshee/go-nbt"
+)
+
+// Checks that v, a pointer to a struct, survives nbt.Marshal and
+// nbt.Unmarshal into a new value of the same type unchanged.
+func RoundTripValue(t testing.TB, v interface{}) {
+	t.Helper()
+	data, err := nbt.Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	got := reflect.New(reflect.TypeOf(v).Elem())
+	if err := nbt.Unmarshal(data, got.Interface()); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual(v, got.Interface()) {
+		t.Errorf("Round trip changed %T:\nbefore: %+v\nafter:  %+v", v, reflect.ValueOf(v).Elem(), got.Elem())
+	}
+}
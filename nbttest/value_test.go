@@ -0,0 +1,16 @@
+//go:build !nbt_noreflect
+
+package nbttest
+
+import (
+	"testing"
+)
+
+func TestRoundTripValue(t *testing.T) {
+	type item struct {
+		ID    string `nbt:"id"`
+		Count int8
+		Pos   []float64
+	}
+	RoundTripValue(t, &item{"stone", 1, []float64{1.5}})
+}
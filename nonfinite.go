@@ -0,0 +1,81 @@
+package nbt
+
+import (
+	"fmt"
+	"math"
+)
+
+// NonFinite says what to do with a float or double that is NaN or infinite
+// when writing SNBT or JSON, neither of which has a literal for it that
+// other readers understand.
+type NonFinite int
+
+const (
+	// Fail with a *NonFiniteError, since changing the value silently would
+	// be worse.
+	NonFiniteFail NonFinite = iota
+
+	// Write NaN, Infinity or -Infinity: in SNBT as a word with the type's
+	// suffix, such as NaNf, and in JSON as a string, as the JSON mapping of
+	// protocol buffers does. This package reads both back as the same value
+	// (SNBT only with the same option), but the game and most other tools
+	// do not.
+	NonFiniteLiteral
+
+	// Write 0 in place of NaN, and the largest finite value of the type in
+	// place of an infinity, with the infinity's sign.
+	NonFiniteSubstitute
+)
+
+// NonFiniteError reports a NaN or infinite float or double that could not
+// be written in a text format.
+type NonFiniteError struct {
+	Type   TagType // TagFloat or TagDouble
+	Value  float64
+	Format string // "SNBT" or "JSON"
+}
+
+func (self *NonFiniteError) Error() string {
+	return fmt.Sprintf("Cannot encode %v %v as %s", self.Type, self.Value, self.Format)
+}
+
+// Applies the policy to a value of a float or double tag. It returns the
+// value to write, or the literal to write instead if that is not empty.
+func (self NonFinite) apply(f float64, tag TagType, format string) (float64, string, error) {
+	if !math.IsNaN(f) && !math.IsInf(f, 0) {
+		return f, "", nil
+	}
+	switch self {
+	case NonFiniteLiteral:
+		switch {
+		case math.IsNaN(f):
+			return f, "NaN", nil
+		case f > 0:
+			return f, "Infinity", nil
+		}
+		return f, "-Infinity", nil
+	case NonFiniteSubstitute:
+		if math.IsNaN(f) {
+			return 0, "", nil
+		}
+		max := math.MaxFloat64
+		if tag == TagFloat {
+			max = math.MaxFloat32
+		}
+		return math.Copysign(max, f), "", nil
+	}
+	return f, "", &NonFiniteError{tag, f, format}
+}
+
+// Reads a literal written with NonFiniteLiteral.
+func parse_non_finite(s string) (float64, bool) {
+	switch s {
+	case "NaN":
+		return math.NaN(), true
+	case "Infinity", "+Infinity":
+		return math.Inf(1), true
+	case "-Infinity":
+		return math.Inf(-1), true
+	}
+	return 0, false
+}
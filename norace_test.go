@@ -0,0 +1,5 @@
+//go:build !race
+
+package nbt
+
+const race_enabled = false
@@ -0,0 +1,163 @@
+package nbt
+
+import (
+	"math"
+	"strconv"
+)
+
+// Number is a numeric tag value that remembers which tag it came from, so
+// that generic code can do arithmetic on any of TAG_Byte through TAG_Double
+// and still have the result encoded with the original width.
+type Number struct {
+	Type TagType // one of TagByte, TagShort, TagInt, TagLong, TagFloat or TagDouble
+	i    int64
+	f    float64
+}
+
+// Wraps a numeric value as stored in a Compound (int8 through float64, or a
+// pointer to one). The second result is false if v is not numeric.
+func NumberOf(v interface{}) (Number, bool) {
+	switch v := v.(type) {
+	case Number:
+		return v, true
+	case int8:
+		return Number{Type: TagByte, i: int64(v)}, true
+	case *int8:
+		return Number{Type: TagByte, i: int64(*v)}, true
+	case int16:
+		return Number{Type: TagShort, i: int64(v)}, true
+	case *int16:
+		return Number{Type: TagShort, i: int64(*v)}, true
+	case int32:
+		return Number{Type: TagInt, i: int64(v)}, true
+	case *int32:
+		return Number{Type: TagInt, i: int64(*v)}, true
+	case int64:
+		return Number{Type: TagLong, i: v}, true
+	case *int64:
+		return Number{Type: TagLong, i: *v}, true
+	case float32:
+		return Number{Type: TagFloat, f: float64(v)}, true
+	case *float32:
+		return Number{Type: TagFloat, f: float64(*v)}, true
+	case float64:
+		return Number{Type: TagDouble, f: v}, true
+	case *float64:
+		return Number{Type: TagDouble, f: *v}, true
+	}
+	return Number{}, false
+}
+
+// Returns the named numeric entry of any width as a Number.
+func (self *Compound) Number(name string) (Number, bool) {
+	return self.data[name].number()
+}
+
+// Returns the named entry as an int64 whatever its integer tag type, so a
+// flag stored as a TAG_Byte in one file and a TAG_Int in another reads the
+// same. Floating point entries are accepted only if they hold a whole number
+// that fits in an int64. The second result is false if the entry is missing
+// or not numeric.
+func (self *Compound) AnyInt(name string) (int64, bool) {
+	n, ok := self.Number(name)
+	if !ok {
+		return 0, false
+	}
+	if n.IsFloat() && (n.f != math.Trunc(n.f) || !(n.f >= -1<<63 && n.f < 1<<63)) {
+		// NaN fails both, and ±Inf only the second
+		return 0, false
+	}
+	return n.Int64(), true
+}
+
+// Returns the named entry as a float64 whatever its numeric tag type. The
+// second result is false if the entry is missing or not numeric.
+func (self *Compound) AnyFloat(name string) (float64, bool) {
+	n, ok := self.Number(name)
+	if !ok {
+		return 0, false
+	}
+	return n.Float64(), true
+}
+
+// Reports whether the number came from a TAG_Float or TAG_Double.
+func (n Number) IsFloat() bool {
+	return n.Type == TagFloat || n.Type == TagDouble
+}
+
+// Returns the value as an int64, truncating floating point values.
+func (n Number) Int64() int64 {
+	if n.IsFloat() {
+		return int64(n.f)
+	}
+	return n.i
+}
+
+// Returns the value as a float64.
+func (n Number) Float64() float64 {
+	if n.IsFloat() {
+		return n.f
+	}
+	return float64(n.i)
+}
+
+// Returns a Number of the same type holding v, truncated or wrapped to fit
+// the original width.
+func (n Number) WithInt64(v int64) Number {
+	if n.IsFloat() {
+		return n.WithFloat64(float64(v))
+	}
+	switch n.Type {
+	case TagByte:
+		v = int64(int8(v))
+	case TagShort:
+		v = int64(int16(v))
+	case TagInt:
+		v = int64(int32(v))
+	}
+	n.i = v
+	return n
+}
+
+// Returns a Number of the same type holding v, converted to fit the
+// original width.
+func (n Number) WithFloat64(v float64) Number {
+	if !n.IsFloat() {
+		return n.WithInt64(int64(v))
+	}
+	if n.Type == TagFloat {
+		v = float64(float32(v))
+	}
+	n.f = v
+	return n
+}
+
+// Returns the value as the Go type the decoder uses for its tag: int8,
+// int16, int32, int64, float32 or float64.
+func (n Number) Value() interface{} {
+	switch n.Type {
+	case TagByte:
+		return int8(n.i)
+	case TagShort:
+		return int16(n.i)
+	case TagInt:
+		return int32(n.i)
+	case TagLong:
+		return n.i
+	case TagFloat:
+		return float32(n.f)
+	case TagDouble:
+		return n.f
+	}
+	return nil
+}
+
+func (n Number) String() string {
+	if n.Type == TagFloat {
+		return strconv.FormatFloat(n.f, 'g', -1, 32)
+	}
+	if n.IsFloat() {
+		return strconv.FormatFloat(n.f, 'g', -1, 64)
+	}
+	return strconv.FormatInt(n.i, 10)
+}
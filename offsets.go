@@ -0,0 +1,207 @@
+package nbt
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// OffsetIndex records where the tags of an uncompressed NBT file are, as
+// built by Decoder.DecodeIndexed, so that later reads can go straight to
+// the tags they need through an io.ReaderAt instead of decoding the whole
+// file again. It can be saved next to the file with MarshalBinary.
+type OffsetIndex struct {
+	// Byte order of the file.
+	ByteOrder binary.ByteOrder
+
+	// In document order.
+	Entries []IndexEntry
+
+	by_path map[string]int
+}
+
+// IndexEntry locates the payload of a tag in its file.
+type IndexEntry struct {
+	// Path of the tag from the root, in its text form.
+	Path string
+
+	Type TagType
+
+	// Position and size of the payload, which follows the tag's type and
+	// name, in bytes from the start of the file.
+	Offset int64
+	Length int64
+}
+
+// Decodes the next document as Decode does, recording the position of
+// every tag in it down to the given depth, where 1 is the entries of the
+// root compound, or of every tag if depth is 0. Tags below that depth are
+// read with the tag that holds them and not recorded.
+func (self *Decoder) DecodeIndexed(depth int) (*Compound, *OffsetIndex, error) {
+	index := &OffsetIndex{ByteOrder: self.byte_order()}
+	tok, err := self.Token()
+	if err != nil {
+		return nil, nil, err
+	}
+	v, err := self.decode_indexed(tok, nil, depth, index)
+	if err != nil {
+		return nil, nil, err
+	}
+	return v.(*Compound), index, nil
+}
+
+func (self *Decoder) decode_indexed(tok Token, path Path, depth int, index *OffsetIndex) (interface{}, error) {
+	start := self.InputOffset()
+	if tok.Type == TagList {
+		// the list header was read with the token
+		start -= 5
+	}
+
+	var v interface{}
+	var err error
+	switch {
+	case depth > 0 && len(path) >= depth, tok.Type != TagCompound && tok.Type != TagList:
+		v, err = self.Value()
+
+	case tok.Type == TagCompound:
+		c := &Compound{name: tok.Name, data: make(map[string]entry)}
+		for {
+			child, err := self.Token()
+			if err != nil {
+				return nil, err
+			}
+			if child.Type == TagEnd {
+				break
+			}
+			cv, err := self.decode_indexed(child, extend_path(path, PathElem{Key: child.Name}), depth, index)
+			if err != nil {
+				return nil, err
+			}
+			if cc, ok := cv.(*Compound); ok {
+				cc.parent = c
+			}
+			c.data[child.Name] = c.hold(cv)
+		}
+		v = c
+
+	default:
+		items := make([]interface{}, 0, tok.Len)
+		for i := 0; ; i++ {
+			elem, err := self.Token()
+			if err != nil {
+				return nil, err
+			}
+			if elem.Type == TagEnd {
+				break
+			}
+			ev, err := self.decode_indexed(elem, extend_path(path, PathElem{Index: i, IsIndex: true}), depth, index)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, ev)
+		}
+		v, err = new_list(tok.Name, tok.Elem, items)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(path) > 0 {
+		index.Entries = append(index.Entries, IndexEntry{path.String(), tok.Type, start, self.InputOffset() - start})
+		index.by_path = nil
+	}
+	return v, nil
+}
+
+// Returns the entry for a tag, by its path in any text form ParsePath
+// accepts.
+func (self *OffsetIndex) Lookup(path string) (IndexEntry, bool) {
+	if self.by_path == nil {
+		self.by_path = make(map[string]int, len(self.Entries))
+		for i, e := range self.Entries {
+			self.by_path[e.Path] = i
+		}
+	}
+	i, ok := self.by_path[path]
+	if !ok {
+		p, err := ParsePath(path)
+		if err != nil {
+			return IndexEntry{}, false
+		}
+		if i, ok = self.by_path[p.String()]; !ok {
+			return IndexEntry{}, false
+		}
+	}
+	return self.Entries[i], true
+}
+
+// Reads the tag at the path from the file the index was built from, which
+// must not have changed since, returning it as Compound.Get would. The
+// error wraps ErrNotFound if the tag was not indexed.
+func (self *OffsetIndex) ReadAt(r io.ReaderAt, path string) (interface{}, error) {
+	e, ok := self.Lookup(path)
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", path, ErrNotFound)
+	}
+	name := ""
+	if p, err := ParsePath(path); err == nil && len(p) > 0 && !p[len(p)-1].IsIndex {
+		name = p[len(p)-1].Key
+	}
+	dec := NewDecoder(io.NewSectionReader(r, e.Offset, e.Length))
+	dec.ByteOrder = self.ByteOrder
+	return dec.read_payload(e.Type, name)
+}
+
+// Encodes the index as an NBT document, for saving it next to its file.
+func (self *OffsetIndex) MarshalBinary() ([]byte, error) {
+	items := make([]interface{}, len(self.Entries))
+	for i, e := range self.Entries {
+		items[i] = &Compound{data: map[string]entry{
+			"Path":   entry_of(e.Path),
+			"Type":   entry_of(int8(e.Type)),
+			"Offset": entry_of(e.Offset),
+			"Length": entry_of(e.Length),
+		}}
+	}
+	entries, err := new_list("Entries", TagCompound, items)
+	if err != nil {
+		return nil, err
+	}
+	little := int8(0)
+	if self.ByteOrder == binary.LittleEndian {
+		little = 1
+	}
+	c := &Compound{data: map[string]entry{
+		"LittleEndian": entry_of(little),
+		"Entries":      entry_of(entries),
+	}}
+	return c.MarshalBytes()
+}
+
+// Decodes an index saved by MarshalBinary.
+func (self *OffsetIndex) UnmarshalBinary(data []byte) error {
+	c, err := DecodeBytes(data)
+	if err != nil {
+		return err
+	}
+	list := c.ListOr("Entries", nil)
+	if list == nil || list.ListType() != TagCompound && list.Len() > 0 {
+		return fmt.Errorf("Entries: %w", ErrInvalidTag)
+	}
+	self.ByteOrder = binary.BigEndian
+	if c.ByteOr("LittleEndian", 0) != 0 {
+		self.ByteOrder = binary.LittleEndian
+	}
+	self.Entries, self.by_path = make([]IndexEntry, list.Len()), nil
+	if list.Len() > 0 {
+		for i, e := range list.Compounds() {
+			self.Entries[i] = IndexEntry{
+				Path:   e.StringOr("Path", ""),
+				Type:   TagType(e.ByteOr("Type", 0)),
+				Offset: e.LongOr("Offset", 0),
+				Length: e.LongOr("Length", 0),
+			}
+		}
+	}
+	return nil
+}
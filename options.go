@@ -0,0 +1,105 @@
+package nbt
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+)
+
+// The methods of DecodeOptions and EncodeOptions are the package's entry
+// points with the options applied to a single call, so that byte order,
+// limits, strictness and hooks can be chosen per call without keeping a
+// Decoder or Encoder around. The functions of the same names are these
+// methods with the zero options.
+
+// Returns a Decoder reading src with the options.
+func (self DecodeOptions) NewDecoder(src io.Reader) *Decoder {
+	dec := NewDecoder(src)
+	dec.DecodeOptions = self
+	return dec
+}
+
+// Decodes an uncompressed NBT document as Decode does.
+func (self DecodeOptions) Decode(src io.Reader) (*Compound, error) {
+	return self.NewDecoder(src).Decode()
+}
+
+// Decodes an uncompressed NBT document held in memory as DecodeBytes does.
+func (self DecodeOptions) DecodeBytes(data []byte) (*Compound, error) {
+	return self.Decode(bytes.NewReader(data))
+}
+
+// Decodes a gzipped NBT document as DecodeGzip does.
+func (self DecodeOptions) DecodeGzip(src io.Reader) (*Compound, error) {
+	r, err := gzip.NewReader(src)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return self.DecodeBytes(data)
+}
+
+// Decodes a document of any supported format as DecodeAny does. The byte
+// order is detected, so ByteOrder is ignored.
+func (self DecodeOptions) DecodeAny(data []byte) (*Compound, Format, error) {
+	return decode_any(data, self)
+}
+
+// Reads and decodes an NBT file of any supported format as DecodeFile
+// does. The byte order is detected, so ByteOrder is ignored.
+func (self DecodeOptions) DecodeFile(path string) (*Compound, Format, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, Format{}, err
+	}
+	return self.DecodeAny(data)
+}
+
+// Returns an Encoder writing to dst with the options.
+func (self EncodeOptions) NewEncoder(dst io.Writer) *Encoder {
+	enc := NewEncoder(dst)
+	enc.EncodeOptions = self
+	return enc
+}
+
+// Encodes a compound as an uncompressed NBT document as Encode does.
+func (self EncodeOptions) Encode(dst io.Writer, c *Compound) error {
+	return self.NewEncoder(dst).Encode(c)
+}
+
+// Encodes a compound as a gzipped NBT document as EncodeGzip does.
+func (self EncodeOptions) EncodeGzip(dst io.Writer, c *Compound) error {
+	return self.EncodeGzipHeader(dst, c, gzip.Header{OS: 255})
+}
+
+// Encodes a compound as a gzipped NBT document with the given header as
+// EncodeGzipHeader does.
+func (self EncodeOptions) EncodeGzipHeader(dst io.Writer, c *Compound, header gzip.Header) error {
+	w := gzip.NewWriter(dst)
+	w.Header = header
+	if err := self.Encode(w, c); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// Encodes a compound in the given format as EncodeFormat does. The byte
+// order of the format, if set, takes precedence over ByteOrder.
+func (self EncodeOptions) EncodeFormat(dst io.Writer, c *Compound, f Format) error {
+	return encode_format(dst, c, f, self)
+}
+
+// Encodes a compound in the given format into the named file, replacing it
+// atomically, as EncodeFile does. The byte order of the format, if set,
+// takes precedence over ByteOrder.
+func (self EncodeOptions) EncodeFile(path string, c *Compound, f Format) error {
+	return replace_file(path, func(w io.Writer) error {
+		return self.EncodeFormat(w, c, f)
+	})
+}
@@ -0,0 +1,393 @@
+package nbt
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrNotFound = errors.New("No such path")
+	ErrFrozen   = errors.New("Compound is frozen")
+)
+
+// Path addresses a value inside a compound as a sequence of compound keys
+// and list or array indices. Its text form follows jq:
+//
+//	.Data.Player.Pos[1]
+//	."listTest (long)"[0]
+//	.Data["odd.key"]
+//
+// Keys may be written bare unless they contain '.', '[', ']' or '"', or are
+// empty; otherwise they are written as a double quoted Go string literal,
+// either after a '.' or inside brackets. The leading '.' is optional. String
+// quotes every key that is not a bare SNBT key.
+type Path []PathElem
+
+// PathElem is one step of a Path: a compound key, or a list or array index
+// if IsIndex is set. Negative indices count from the end.
+type PathElem struct {
+	Key     string
+	Index   int
+	IsIndex bool
+}
+
+// Parses the text form of a path.
+func ParsePath(s string) (Path, error) {
+	var path Path
+	i := 0
+	for i < len(s) {
+		switch {
+		case s[i] == '.' || i == 0 && s[i] != '[':
+			if s[i] == '.' {
+				i++
+				if i == len(s) && len(path) == 0 {
+					// "." is the root itself
+					return path, nil
+				}
+				if strings.HasPrefix(s[i:], "[") {
+					// jq's .[0]
+					continue
+				}
+			}
+			key, n, err := parse_path_key(s[i:])
+			if err != nil {
+				return nil, fmt.Errorf("Invalid path %q at offset %d: %v", s, i, err)
+			}
+			path = append(path, PathElem{Key: key})
+			i += n
+
+		case s[i] == '[':
+			end := strings.IndexByte(s[i:], ']')
+			if s[i+1:] != "" && s[i+1] == '"' {
+				key, n, err := parse_path_key(s[i+1:])
+				if err != nil || !strings.HasPrefix(s[i+1+n:], "]") {
+					return nil, fmt.Errorf("Invalid path %q at offset %d: malformed [\"key\"]", s, i)
+				}
+				path = append(path, PathElem{Key: key})
+				i += n + 2
+				continue
+			}
+			if end < 0 {
+				return nil, fmt.Errorf("Invalid path %q at offset %d: missing ']'", s, i)
+			}
+			index, err := strconv.Atoi(s[i+1 : i+end])
+			if err != nil {
+				return nil, fmt.Errorf("Invalid path %q at offset %d: bad index %q", s, i, s[i+1:i+end])
+			}
+			path = append(path, PathElem{Index: index, IsIndex: true})
+			i += end + 1
+
+		default:
+			return nil, fmt.Errorf("Invalid path %q at offset %d: expected '.' or '['", s, i)
+		}
+	}
+	return path, nil
+}
+
+// Reads a bare or quoted key at the start of s, returning it and the number
+// of bytes it took up.
+func parse_path_key(s string) (string, int, error) {
+	if strings.HasPrefix(s, `"`) {
+		quoted, err := strconv.QuotedPrefix(s)
+		if err != nil {
+			return "", 0, errors.New("unterminated quoted key")
+		}
+		key, err := strconv.Unquote(quoted)
+		return key, len(quoted), err
+	}
+	n := strings.IndexAny(s, `.[]"`)
+	if n < 0 {
+		n = len(s)
+	}
+	if n == 0 {
+		return "", 0, errors.New("empty key")
+	}
+	return s[:n], n, nil
+}
+
+// Returns the text form of the path, which ParsePath reads back.
+func (self Path) String() string {
+	if len(self) == 0 {
+		return "."
+	}
+	var b strings.Builder
+	for _, elem := range self {
+		switch {
+		case elem.IsIndex:
+			b.WriteString("[" + strconv.Itoa(elem.Index) + "]")
+		case !snbt_bare(elem.Key) || strings.ContainsAny(elem.Key, `.[]"`):
+			b.WriteString("." + strconv.Quote(elem.Key))
+		default:
+			b.WriteString("." + elem.Key)
+		}
+	}
+	return b.String()
+}
+
+// Returns the value at the path, as a plain value (int8 through float64,
+// string, []int8, []int32, []int64, *List or *Compound). The error wraps
+// ErrNotFound if some step of the path does not exist.
+func (self *Compound) Get(path Path) (interface{}, error) {
+	var v interface{} = self
+	for i, elem := range path {
+		next, err := path_step(v, elem)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", path[:i+1], err)
+		}
+		v = next
+	}
+	return v, nil
+}
+
+// Returns the path at which the compound is found in its Root, so that
+// root.Get(c.PathFromRoot()) returns c. The index of a compound in a list is
+// found by looking through the lists of its parent.
+func (self *Compound) PathFromRoot() Path {
+	var path Path
+	for c := self; c.parent != nil; c = c.parent {
+		path = append(child_path(c.parent, c), path...)
+	}
+	return path
+}
+
+// Returns the path from parent to c, one of its entries or a compound in
+// one of its lists.
+func child_path(parent, c *Compound) Path {
+	if e, ok := parent.data[c.name]; ok && e.ref == c {
+		return Path{{Key: c.name}}
+	}
+	for _, k := range parent.sorted_keys() {
+		if path, ok := list_path(parent.data[k].stored(), c); ok {
+			return append(Path{{Key: k}}, path...)
+		}
+	}
+	// no longer in its parent
+	return Path{{Key: c.name}}
+}
+
+// Returns the path from v to c if v is a list holding c, directly or in a
+// list inside it.
+func list_path(v interface{}, c *Compound) (Path, bool) {
+	var items []interface{}
+	switch l := v.(type) {
+	case *List:
+		switch l.data.(type) {
+		case []*Compound, []*List, []interface{}:
+			items = l.items()
+		}
+	case *LazyList:
+		items = l.loaded()
+	}
+	for i, item := range items {
+		if item == c {
+			return Path{{Index: i, IsIndex: true}}, true
+		}
+		if path, ok := list_path(item, c); ok {
+			return append(Path{{Index: i, IsIndex: true}}, path...), true
+		}
+	}
+	return nil, false
+}
+
+// Parses the path and returns the value at it. See Get.
+func (self *Compound) GetPath(path string) (interface{}, error) {
+	p, err := ParsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	return self.Get(p)
+}
+
+// Takes one step of a path from the value v.
+func path_step(v interface{}, elem PathElem) (interface{}, error) {
+	if !elem.IsIndex {
+		c, ok := v.(*Compound)
+		if !ok {
+			return nil, fmt.Errorf("%v is not a compound", TypeOf(v))
+		}
+		child, ok := c.data[elem.Key]
+		if !ok {
+			return nil, ErrNotFound
+		}
+		// a LazyList is indexed without decoding all of it
+		return child.stored(), nil
+	}
+
+	var items reflect.Value
+	switch v := v.(type) {
+	case *LazyList:
+		i := elem.Index
+		if i < 0 {
+			i += v.Len()
+		}
+		if i < 0 || i >= v.Len() {
+			return nil, ErrNotFound
+		}
+		return v.Index(i)
+	case *List:
+		if v.data == nil {
+			return nil, ErrNotFound
+		}
+		items = reflect.ValueOf(v.data)
+	case []int8, []int32, []int64:
+		items = reflect.ValueOf(v)
+	default:
+		return nil, fmt.Errorf("%v is not a list or array", TypeOf(v))
+	}
+	i := elem.Index
+	if i < 0 {
+		i += items.Len()
+	}
+	if i < 0 || i >= items.Len() {
+		return nil, ErrNotFound
+	}
+	return items.Index(i).Interface(), nil
+}
+
+// Sets the value at the path. The last step may name a compound entry that
+// does not exist yet, which is then created; all earlier steps must exist.
+// Replacing a compound entry may change its tag type, but a list element
+// must be of the list's element type. v is a plain value of one of the types
+// returned by Get, or a Number. As with Attach, a compound must be a root,
+// such as one returned by Detach, and not the root of this tree.
+func (self *Compound) Set(path Path, v interface{}) error {
+	if len(path) == 0 {
+		return errors.New("Cannot replace the root compound")
+	}
+	if err := self.writable(); err != nil {
+		return err
+	}
+	parent, err := self.own_path(path[:len(path)-1])
+	if err != nil {
+		return err
+	}
+	if n, ok := v.(Number); ok {
+		v = n.Value()
+	}
+	if _, ok := tag_of(v); !ok {
+		return fmt.Errorf("%v: cannot store %T", path, v)
+	}
+	if child, ok := v.(*Compound); ok {
+		if child.parent != nil {
+			return fmt.Errorf("%v: compound \"%s\" is already attached to \"%s\"", path, child.name, child.parent.name)
+		}
+		if self.Root() == child {
+			return fmt.Errorf("%v: cannot store compound \"%s\" inside itself", path, child.name)
+		}
+	}
+	self.adopt(v)
+	return path_store(parent, path, v)
+}
+
+// Stores v in parent, the value at all but the last step of path, at the
+// last step.
+func path_store(parent interface{}, path Path, v interface{}) error {
+	last := path[len(path)-1]
+	if !last.IsIndex {
+		c, ok := parent.(*Compound)
+		if !ok {
+			return fmt.Errorf("%v: %v is not a compound", path, TypeOf(parent))
+		}
+		if child, ok := v.(*Compound); ok {
+			child.parent = c
+			child.name = last.Key
+		}
+		if c.data == nil {
+			// the zero Compound is empty and ready to use
+			c.data = make(map[string]entry)
+		}
+		c.data[last.Key] = c.hold(v)
+		return nil
+	}
+
+	var items reflect.Value
+	switch p := parent.(type) {
+	case *List:
+		items = reflect.ValueOf(p.data)
+	case []int8, []int32, []int64:
+		items = reflect.ValueOf(p)
+	default:
+		return fmt.Errorf("%v: %v is not a list or array", path, TypeOf(parent))
+	}
+	i := last.Index
+	if items.IsValid() && i < 0 {
+		i += items.Len()
+	}
+	if !items.IsValid() || i < 0 || i >= items.Len() {
+		return fmt.Errorf("%v: %w", path, ErrNotFound)
+	}
+	if elem := items.Type().Elem(); !reflect.TypeOf(v).AssignableTo(elem) {
+		return fmt.Errorf("%v: cannot store %v in a list of %v", path, TypeOf(v), type_of(elem))
+	}
+	items.Index(i).Set(reflect.ValueOf(v))
+	if l, ok := parent.(*List); ok {
+		switch v := v.(type) {
+		case *Compound:
+			v.parent = l.parent
+		case *List:
+			v.set_parent(l.parent)
+		}
+	}
+	return nil
+}
+
+// Parses the path and sets the value at it. See Set.
+func (self *Compound) SetPath(path string, v interface{}) error {
+	p, err := ParsePath(path)
+	if err != nil {
+		return err
+	}
+	return self.Set(p, v)
+}
+
+// Removes the named compound entry and returns it as a root of its own,
+// with no parent, so that it can be attached elsewhere. The error wraps
+// ErrNotFound if there is no such entry.
+func (self *Compound) Detach(name string) (*Compound, error) {
+	if err := self.writable(); err != nil {
+		return nil, err
+	}
+	e, ok := self.data[name]
+	if !ok {
+		return nil, fmt.Errorf("%v: %w", Path{{Key: name}}, ErrNotFound)
+	}
+	child, ok := e.compound()
+	if !ok {
+		return nil, fmt.Errorf("%v: %v is not a compound", Path{{Key: name}}, e.tag)
+	}
+	if owned, copied := self.own(child, nil); copied {
+		// still part of a clone
+		child = owned.(*Compound)
+	}
+	delete(self.data, name)
+	child.parent = nil
+	return child, nil
+}
+
+// Adds a root compound, such as one returned by Detach, as an entry named
+// after it. It is an error if the compound already has a parent, or if an
+// entry of that name exists.
+func (self *Compound) Attach(child *Compound) error {
+	if err := self.writable(); err != nil {
+		return err
+	}
+	if child.parent != nil {
+		return fmt.Errorf("Compound \"%s\" is already attached to \"%s\"", child.name, child.parent.name)
+	}
+	if self.Root() == child {
+		return fmt.Errorf("Cannot attach compound \"%s\" inside itself", child.name)
+	}
+	if _, ok := self.data[child.name]; ok {
+		return fmt.Errorf("Compound \"%s\" already has an entry \"%s\"", self.name, child.name)
+	}
+	self.adopt(child)
+	child.parent = self
+	if self.data == nil {
+		self.data = make(map[string]entry)
+	}
+	self.data[child.name] = entry{tag: TagCompound, ref: child}
+	return nil
+}
@@ -0,0 +1,516 @@
+package nbt
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParsePath(t *testing.T) {
+	tests := []struct {
+		in, out string
+		path    Path
+	}{
+		{".", ".", nil},
+		{".Data.Player.Pos[1]", ".Data.Player.Pos[1]", Path{{Key: "Data"}, {Key: "Player"}, {Key: "Pos"}, {Index: 1, IsIndex: true}}},
+		{"Data[-1]", ".Data[-1]", Path{{Key: "Data"}, {Index: -1, IsIndex: true}}},
+		{`."listTest (long)"[0]`, `."listTest (long)"[0]`, Path{{Key: "listTest (long)"}, {Index: 0, IsIndex: true}}},
+		{`.a["b.c"].[2]`, `.a."b.c"[2]`, Path{{Key: "a"}, {Key: "b.c"}, {Index: 2, IsIndex: true}}},
+		{`.""`, `.""`, Path{{Key: ""}}},
+	}
+	for _, test := range tests {
+		path, err := ParsePath(test.in)
+		if err != nil {
+			t.Errorf("ParsePath(%q): %v", test.in, err)
+			continue
+		}
+		if len(path) != len(test.path) {
+			t.Errorf("ParsePath(%q): expected %#v, got %#v", test.in, test.path, path)
+			continue
+		}
+		for i := range path {
+			if path[i] != test.path[i] {
+				t.Errorf("ParsePath(%q): expected %#v, got %#v", test.in, test.path, path)
+				break
+			}
+		}
+		if s := path.String(); s != test.out {
+			t.Errorf("ParsePath(%q).String(): expected %s, got %s", test.in, test.out, s)
+		}
+	}
+
+	for _, in := range []string{".a[", ".a[x]", `.a["b"`, ".a..b", `."unterminated`, ".a]"} {
+		if _, err := ParsePath(in); err == nil {
+			t.Errorf("ParsePath(%q): expected an error", in)
+		}
+	}
+}
+
+func TestGetPath(t *testing.T) {
+	data, err := DecodeBytes(helloWorld)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := data.GetPath(".name"); err != nil || v != "Bananrama" {
+		t.Errorf("GetPath(\".name\"): got %v, %v", v, err)
+	}
+	if _, err := data.GetPath(".nope"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetPath(\".nope\"): expected ErrNotFound, got %v", err)
+	}
+	if _, err := data.GetPath(".name[0]"); err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("GetPath(\".name[0]\"): expected a type error, got %v", err)
+	}
+}
+
+func TestSetPath(t *testing.T) {
+	data, err := DecodeBytes(helloWorld)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := data.SetPath(".name", "Hampus"); err != nil {
+		t.Fatal(err)
+	}
+	if err := data.SetPath(".count", int32(3)); err != nil {
+		t.Fatal(err)
+	}
+	pos, _ := new_list("", TagDouble, []interface{}{1.0, 2.0})
+	if err := data.SetPath(".pos", pos); err != nil {
+		t.Fatal(err)
+	}
+	if err := data.SetPath(".pos[-1]", 64.5); err != nil {
+		t.Fatal(err)
+	}
+	if data.String("name") != "Hampus" || data.Int("count") != 3 || data.List("pos").Doubles()[1] != 64.5 {
+		t.Errorf("SetPath: values not stored, got %v %v %v", data.String("name"), data.Int("count"), data.List("pos").Doubles())
+	}
+
+	if err := data.SetPath(".pos[0]", int32(1)); err == nil {
+		t.Errorf("SetPath: stored an int in a list of doubles")
+	}
+	if err := data.SetPath(".pos[2]", 1.0); !errors.Is(err, ErrNotFound) {
+		t.Errorf("SetPath(\".pos[2]\"): expected ErrNotFound, got %v", err)
+	}
+	if err := data.SetPath(".missing.key", int8(1)); !errors.Is(err, ErrNotFound) {
+		t.Errorf("SetPath(\".missing.key\"): expected ErrNotFound, got %v", err)
+	}
+
+	// the zero Compound is ready to use
+	var zero Compound
+	if err := zero.Set(Path{{Key: "a"}}, int32(1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := new(Compound).Attach(new(Compound)); err != nil {
+		t.Fatal(err)
+	}
+	if zero.Int("a") != 1 || zero.Len() != 1 {
+		t.Errorf("Set on a zero Compound: got %v", zero.data)
+	}
+
+	// a compound is stored only if it is the root of another tree
+	c, err := (&CompoundTag{Value: []Tag{
+		&CompoundTag{Name: "kid", Value: []Tag{&CompoundTag{Name: "grandkid"}}},
+		&ListTag{Name: "l", Elem: TagCompound, Value: []Tag{&CompoundTag{}}},
+	}}).Compound()
+	if err != nil {
+		t.Fatal(err)
+	}
+	kid := c.Compound("kid")
+	for _, v := range []*Compound{kid, c.List("l").Compounds()[0]} {
+		if err := c.SetPath("moved", v); err == nil {
+			t.Error("SetPath: stored a compound that is already attached")
+		}
+	}
+	if path := kid.PathFromRoot(); path.String() != ".kid" || c.Len() != 2 {
+		t.Errorf("SetPath of an attached compound: moved it to %v", path)
+	}
+	for _, p := range []string{"x", "kid.grandkid.x", "l[0]"} {
+		if err := c.SetPath(p, c); err == nil {
+			t.Errorf("SetPath %s: stored the root inside itself", p)
+		}
+	}
+	if c.Len() != 2 || kid.Compound("grandkid").Len() != 0 {
+		t.Errorf("SetPath of the root inside itself: got %v", c)
+	}
+	kid, err = c.Detach("kid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetPath("moved", kid); err != nil || kid.PathFromRoot().String() != ".moved" {
+		t.Errorf("SetPath of a detached compound: %v, at %v", err, kid.PathFromRoot())
+	}
+}
+
+func TestValidate(t *testing.T) {
+	item := &Schema{
+		Type:     TagCompound,
+		Required: []string{"id", "Count"},
+		Fields: map[string]*Schema{
+			"id":    {Type: TagString, MaxLen: 32},
+			"Count": {Type: TagByte, Range: &Range{1, 64}},
+		},
+		DisallowUnknown: true,
+	}
+	schema := &Schema{
+		Type:     TagCompound,
+		Required: []string{"Items"},
+		Fields: map[string]*Schema{
+			"Items": {Type: TagList, Elem: item, MaxLen: 36},
+			"UUID":  {Type: TagIntArray, MaxLen: 4, Range: &Range{0, 100}},
+		},
+	}
+
+	c, err := (&CompoundTag{Value: []Tag{
+		&ListTag{Name: "Items", Elem: TagCompound, Value: []Tag{
+			&CompoundTag{Value: []Tag{&StringTag{"id", "minecraft:stone"}, &ByteTag{"Count", 64}}},
+			&CompoundTag{Value: []Tag{&StringTag{"id", "minecraft:dirt"}, &ByteTag{"Count", 65}, &IntTag{"hack", 1}}},
+			&CompoundTag{Value: []Tag{&IntTag{"id", 1}}},
+		}},
+		&IntArrayTag{"UUID", []int32{1, 2, 300}},
+	}}).Compound()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.Validate(schema)
+	violations, ok := err.(ValidationError)
+	if !ok {
+		t.Fatalf("Validate: expected a ValidationError, got %v", err)
+	}
+	expected := []string{
+		".Items[1].Count: 65 is out of range [1, 64]",
+		".Items[1].hack: is not allowed",
+		".Items[2].Count: is missing",
+		".Items[2].id: is TAG_Int, expected TAG_String",
+		".UUID[2]: 300 is out of range [0, 100]",
+	}
+	if len(violations) != len(expected) {
+		t.Fatalf("Validate: expected %d violations, got %v", len(expected), err)
+	}
+	for i, v := range violations {
+		if v.String() != expected[i] {
+			t.Errorf("Validate: violation %d: expected %s, got %s", i, expected[i], v)
+		}
+	}
+
+	if err := c.Validate(&Schema{}); err != nil {
+		t.Errorf("Validate against an empty schema: %v", err)
+	}
+}
+
+func TestPathFromRoot(t *testing.T) {
+	c, err := (&CompoundTag{Name: "root", Value: []Tag{
+		&CompoundTag{Name: "Data", Value: []Tag{
+			&CompoundTag{Name: "odd.key", Value: []Tag{&IntTag{"x", 1}}},
+		}},
+		&ListTag{Name: "l", Elem: TagCompound, Value: []Tag{&CompoundTag{Value: []Tag{&IntTag{"x", 1}}}}},
+		&ListTag{Name: "ll", Elem: TagList, Value: []Tag{
+			&ListTag{Elem: TagCompound},
+			&ListTag{Elem: TagCompound, Value: []Tag{&CompoundTag{}, &CompoundTag{Value: []Tag{&IntTag{"x", 2}}}}},
+		}},
+	}}).Compound()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inner := c.Compound("Data").Compound("odd.key")
+	if inner.Parent() != c.Compound("Data") || inner.Root() != c || c.Parent() != nil || c.Root() != c {
+		t.Error("Parent or Root: wrong compound")
+	}
+	path := inner.PathFromRoot()
+	if path.String() != `.Data."odd.key"` {
+		t.Errorf("PathFromRoot: expected .Data.\"odd.key\", got %v", path)
+	}
+	if v, err := c.Get(path); err != nil || v != inner {
+		t.Errorf("PathFromRoot: path does not lead back to the compound: %v %v", v, err)
+	}
+	if path := c.PathFromRoot(); path.String() != "." {
+		t.Errorf("PathFromRoot of the root: expected ., got %v", path)
+	}
+
+	// list elements are children of the compound holding the list, however
+	// the document was made
+	data, err := c.MarshalBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := DecodeBytes(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lazy, err := DecodeOptions{LazyListThreshold: 1}.DecodeBytes(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, doc := range []*Compound{c, decoded, lazy} {
+		for _, want := range []string{".l[0]", ".ll[1][1]"} {
+			v, err := doc.GetPath(want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			elem := v.(*Compound)
+			if elem.Parent() != doc || elem.Root() != doc {
+				t.Errorf("%s: expected the root as the parent", want)
+			}
+			if path := elem.PathFromRoot(); path.String() != want {
+				t.Errorf("PathFromRoot of a list element: expected %s, got %v", want, path)
+			}
+		}
+	}
+
+	// and of the compound they are stored in
+	if err := c.SetPath("Data.items", copy_value(c.List("l"), nil)); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetPath("l[0]", new(Compound)); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{".Data.items[0]", ".l[0]"} {
+		v, _ := c.GetPath(want)
+		if path := v.(*Compound).PathFromRoot(); path.String() != want {
+			t.Errorf("PathFromRoot of a stored list element: expected %s, got %v", want, path)
+		}
+	}
+}
+
+func TestDetachAttach(t *testing.T) {
+	src, err := (&CompoundTag{Value: []Tag{
+		&CompoundTag{Name: "item", Value: []Tag{&StringTag{"id", "stone"}}},
+		&IntTag{"n", 1},
+	}}).Compound()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst, _ := (&CompoundTag{Value: []Tag{&CompoundTag{Name: "inv"}}}).Compound()
+
+	item, err := src.Detach("item")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.Parent() != nil || src.Len() != 1 {
+		t.Error("Detach: entry not removed")
+	}
+	if err := dst.Compound("inv").Attach(item); err != nil {
+		t.Fatal(err)
+	}
+	if item.Root() != dst || item.PathFromRoot().String() != ".inv.item" {
+		t.Errorf("Attach: item at %v", item.PathFromRoot())
+	}
+	if err := src.Attach(item); err == nil {
+		t.Error("Attach: expected an error attaching an attached compound")
+	}
+	if err := item.Attach(dst); err == nil {
+		t.Error("Attach: expected an error attaching a compound inside itself")
+	}
+	if _, err := src.Detach("item"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Detach: expected ErrNotFound, got %v", err)
+	}
+	if _, err := src.Detach("n"); err == nil {
+		t.Error("Detach: expected an error detaching a TAG_Int")
+	}
+
+	// detaching from a clone leaves the other tree alone
+	clone := dst.Clone()
+	moved, err := clone.Compound("inv").Detach("item")
+	if err != ErrShared {
+		t.Errorf("Detach from a shared compound: expected ErrShared, got %v", err)
+	}
+	moved, err = clone.Detach("inv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := moved.SetPath("item.id", "dirt"); err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := dst.GetPath("inv.item.id"); s != "stone" {
+		t.Errorf("Detach from a clone: original changed to %v", s)
+	}
+}
+
+func TestListOrder(t *testing.T) {
+	var items []Tag
+	for _, slot := range []int8{3, 0, 2, 1} {
+		items = append(items, &CompoundTag{Value: []Tag{&ByteTag{"Slot", slot}}})
+	}
+	c, err := (&CompoundTag{Value: []Tag{&ListTag{Name: "Items", Elem: TagCompound, Value: items}}}).Compound()
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := c.List("Items")
+	slots := func() (s []int8) {
+		for _, item := range l.Compounds() {
+			s = append(s, item.Byte("Slot"))
+		}
+		return s
+	}
+	if err := l.Sort(func(i, j int) bool {
+		return l.Compounds()[i].Byte("Slot") < l.Compounds()[j].Byte("Slot")
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if s := slots(); !reflect.DeepEqual(s, []int8{0, 1, 2, 3}) {
+		t.Errorf("Sort: got %v", s)
+	}
+	l.Swap(0, 3)
+	if s := slots(); !reflect.DeepEqual(s, []int8{3, 1, 2, 0}) {
+		t.Errorf("Swap: got %v", s)
+	}
+	l.Move(0, 2)
+	if s := slots(); !reflect.DeepEqual(s, []int8{1, 2, 3, 0}) {
+		t.Errorf("Move forward: got %v", s)
+	}
+	l.Move(3, 0)
+	if s := slots(); !reflect.DeepEqual(s, []int8{0, 1, 2, 3}) {
+		t.Errorf("Move back: got %v", s)
+	}
+
+	frozen := c.Freeze().List("Items")
+	if err := frozen.Swap(0, 1); err != ErrFrozen {
+		t.Errorf("Swap on a frozen list: expected ErrFrozen, got %v", err)
+	}
+	if b := frozen.Compounds()[0].Byte("Slot"); b != 0 {
+		t.Errorf("Swap on a frozen list: reordered it, first slot %d", b)
+	}
+
+	// reordering a list shared with a clone leaves the other tree alone
+	clone := c.Clone()
+	if err := clone.List("Items").Move(0, 3); err != ErrShared {
+		t.Errorf("Move on a shared list: expected ErrShared, got %v", err)
+	}
+	if err := clone.SetPath("Items[0].Slot", int8(0)); err != nil {
+		t.Fatal(err)
+	}
+	if err := clone.List("Items").Move(0, 3); err != nil {
+		t.Fatal(err)
+	}
+	if s := slots(); !reflect.DeepEqual(s, []int8{0, 1, 2, 3}) {
+		t.Errorf("Move on a clone: original changed to %v", s)
+	}
+	if err := l.Swap(0, 1); err != ErrShared {
+		t.Errorf("Swap on the original of a clone: expected ErrShared, got %v", err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Swap: expected a panic for an index out of range")
+		}
+	}()
+	l.Swap(0, 4)
+}
+
+func TestQuery(t *testing.T) {
+	item := func(id string, count int8) Tag {
+		return &CompoundTag{Value: []Tag{&StringTag{"id", id}, &ByteTag{"Count", count}}}
+	}
+	chest := func(x int32, items ...Tag) Tag {
+		return &CompoundTag{Value: []Tag{
+			&StringTag{"id", "minecraft:chest"},
+			&IntTag{"x", x},
+			&ListTag{Name: "Items", Elem: TagCompound, Value: items},
+		}}
+	}
+	c, err := (&CompoundTag{Value: []Tag{&CompoundTag{Name: "Level", Value: []Tag{
+		&ListTag{Name: "TileEntities", Elem: TagCompound, Value: []Tag{
+			chest(1, item("minecraft:stone", 64), item("minecraft:dirt", 1)),
+			&CompoundTag{Value: []Tag{&StringTag{"id", "minecraft:furnace"}, &IntTag{"x", 2}}},
+			chest(3, item("minecraft:diamond", 2)),
+		}},
+		&IntArrayTag{"Heights", []int32{5, 6, 7}},
+	}}}}).Compound()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values := func(matches []Match) []interface{} {
+		var v []interface{}
+		for _, m := range matches {
+			v = append(v, m.Value)
+		}
+		return v
+	}
+	tests := []struct {
+		query string
+		want  []interface{}
+	}{
+		{".Level.Heights[-1]", []interface{}{int32(7)}},
+		{"Level.Heights[*]", []interface{}{int32(5), int32(6), int32(7)}},
+		{`.Level.TileEntities[?(@.id == "minecraft:chest")].x`, []interface{}{int32(1), int32(3)}},
+		{`.Level.TileEntities[?(@.id != "minecraft:chest" || @.x >= 3)].x`, []interface{}{int32(2), int32(3)}},
+		{`.Level.TileEntities[?(!@.Items)].id`, []interface{}{"minecraft:furnace"}},
+		{`..Items[?(@.Count > 1b && @.Count < 63.5)].id`, []interface{}{"minecraft:diamond"}},
+		{`..[?(@.Count == 1)].id`, []interface{}{"minecraft:dirt"}},
+		{`..x`, []interface{}{int32(1), int32(2), int32(3)}},
+		{`.Level.TileEntities[0].Items[*].Count`, []interface{}{int8(64), int8(1)}},
+		{`.Level.nope[*]`, nil},
+	}
+	for _, test := range tests {
+		q, err := CompileQuery(test.query)
+		if err != nil {
+			t.Errorf("CompileQuery(%q): %v", test.query, err)
+			continue
+		}
+		if got := values(q.Run(c)); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: expected %v, got %v", test.query, test.want, got)
+		}
+	}
+
+	matches := MustCompileQuery(`..Items[?(@.id == "minecraft:diamond")]`).Run(c)
+	if len(matches) != 1 || matches[0].Path.String() != ".Level.TileEntities[2].Items[0]" {
+		t.Errorf("match paths: got %v", matches)
+	}
+	if v, err := c.Get(matches[0].Path); err != nil || v != matches[0].Value {
+		t.Errorf("Get of a match's path: got %v, %v", v, err)
+	}
+
+	matches = MustCompileQuery(`.Level.TileEntities[?(@.Items)]{x, first: .Items[0].id, Items}`).Run(c)
+	if len(matches) != 2 {
+		t.Fatalf("projection: got %v", matches)
+	}
+	p := matches[1].Value.(*Compound)
+	if p.Len() != 3 || p.Int("x") != 3 || p.String("first") != "minecraft:diamond" || p.List("Items").Len() != 1 {
+		t.Errorf("projection: got %v", p.Simplify())
+	}
+	if p.List("Items") == c.Compound("Level").List("TileEntities").Compounds()[2].List("Items") {
+		t.Error("projection: list was not copied")
+	}
+
+	for _, bad := range []string{"..", ".a[", "[?(@.a ==)]", "[?(1)]", ".a{b", ".a{b}.c", "[x]", ".a b"} {
+		if _, err := CompileQuery(bad); err == nil {
+			t.Errorf("CompileQuery(%q): expected an error", bad)
+		}
+	}
+}
+
+func TestIndex(t *testing.T) {
+	data, err := DecodeBytes(helloWorld)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data.SetPath("list", mustList(t, TagCompound, data.Clone()))
+	data.SetPath("ints", []int32{1, 2, 3})
+	index := data.Index()
+
+	for _, path := range []string{".", ".name", "name", `.list[0]["name"]`, ".list[-1].name", ".ints[2]", ".ints[-1]"} {
+		want, err := data.GetPath(path)
+		got, ok := index.GetPath(path)
+		if err != nil || !ok || !reflect.DeepEqual(got, want) {
+			t.Errorf("PathIndex.GetPath(%q): got %v, %v; expected %v, %v", path, got, ok, want, err)
+		}
+	}
+	for _, path := range []string{".nope", ".list[1]", ".list[-2]", ".ints[3]", ".name.x", "[", ".ints[0].x"} {
+		if v, ok := index.GetPath(path); ok {
+			t.Errorf("PathIndex.GetPath(%q): expected nothing, got %v", path, v)
+		}
+	}
+	if index.Len() != 6 {
+		t.Errorf("PathIndex.Len: got %d", index.Len())
+	}
+}
+
+func mustList(t *testing.T, elem TagType, items ...interface{}) *List {
+	l, err := new_list("", elem, items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
@@ -0,0 +1,673 @@
+package nbt
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Query is a compiled query selecting any number of values inside a
+// compound. It is safe for concurrent use. Its text form extends that of
+// Path with these steps:
+//
+//	.key ."key" ["key"]  a compound entry
+//	[n]                  a list or array element; negative counts from the end
+//	.* [*]               every entry of a compound or element of a list or array
+//	..                   the value itself and every value below it, followed by
+//	                     another step, as in ..id or ..[?(@.Count > 1)]
+//	[?(expr)]            the entries or elements for which expr holds
+//
+// For example
+//
+//	.Level.TileEntities[?(@.id == "minecraft:chest")].Items[*].id
+//
+// In a filter expression, @ stands for the entry or element being tested and
+// may be followed by keys and indices as in a Path. A path on its own tests
+// whether it exists. Paths and literals are compared with ==, !=, <, <=, >
+// and >=: numbers by value whatever their tag types and strings bytewise.
+// Other values are equal if Equal says so, and are never ordered; a path
+// that does not exist makes every comparison false. Conditions combine
+// with &&, || and ! and group with parentheses. Literals are double quoted
+// strings, numbers with an optional SNBT type suffix, and true and false,
+// which are 1b and 0b.
+//
+// A query may end in a projection that turns each value it selected, which
+// must be a compound, into a new compound holding only the listed entries:
+//
+//	..[?(@.id == "minecraft:villager")]{id, x: .Pos[0], trades: .Offers.Recipes}
+//
+// A bare key copies that entry; name: query stores the first value the
+// relative query selects under name. Entries that are missing are left out.
+type Query struct {
+	src     string
+	steps   []query_step
+	project []query_projection
+}
+
+const (
+	step_key = iota
+	step_index
+	step_all
+	step_descend
+	step_filter
+)
+
+type query_step struct {
+	kind   int
+	key    string
+	index  int
+	filter query_expr
+}
+
+type query_projection struct {
+	name  string
+	query *Query
+}
+
+// Match is a value selected by a Query, with the path at which it was found.
+type Match struct {
+	Path  Path
+	Value interface{}
+}
+
+// Compiles the text form of a query.
+func CompileQuery(s string) (*Query, error) {
+	p := &query_parser{src: s}
+	q, err := p.query(true)
+	if err == nil && p.pos < len(s) {
+		err = p.errorf("unexpected %q", s[p.pos])
+	}
+	if err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// Like CompileQuery, but panics if the query is invalid.
+func MustCompileQuery(s string) *Query {
+	q, err := CompileQuery(s)
+	if err != nil {
+		panic(err)
+	}
+	return q
+}
+
+// Returns the text the query was compiled from.
+func (self *Query) String() string { return self.src }
+
+// Runs the query against a compound, returning the values it selects as
+// plain values, as returned by Compound.Get, in document order with
+// compound entries ordered by key. The values are those inside c, except
+// for the compounds built by a projection.
+func (self *Query) Run(c *Compound) []Match {
+	return self.run(Match{Value: c})
+}
+
+// Runs the query and returns the first value it selects, if any.
+func (self *Query) First(c *Compound) (interface{}, bool) {
+	matches := self.Run(c)
+	if len(matches) == 0 {
+		return nil, false
+	}
+	return matches[0].Value, true
+}
+
+func (self *Query) run(start Match) []Match {
+	current := []Match{start}
+	for _, step := range self.steps {
+		var next []Match
+		for _, m := range current {
+			next = step.apply(m, next)
+		}
+		current = next
+	}
+	if self.project == nil {
+		return current
+	}
+
+	projected := current[:0]
+	for _, m := range current {
+		if _, ok := m.Value.(*Compound); !ok {
+			continue
+		}
+		c := &Compound{data: make(map[string]entry)}
+		for _, p := range self.project {
+			matches := p.query.run(m)
+			if len(matches) == 0 {
+				continue
+			}
+			v := copy_value(matches[0].Value, c)
+			if child, ok := v.(*Compound); ok {
+				child.name = p.name
+			}
+			c.data[p.name] = c.hold(v)
+		}
+		projected = append(projected, Match{m.Path, c})
+	}
+	return projected
+}
+
+// Appends the values the step selects from m to out.
+func (self *query_step) apply(m Match, out []Match) []Match {
+	switch self.kind {
+	case step_key, step_index:
+		elem := PathElem{Key: self.key, Index: self.index, IsIndex: self.kind == step_index}
+		v, err := path_step(m.Value, elem)
+		if err != nil {
+			return out
+		}
+		if elem.IsIndex && elem.Index < 0 {
+			elem.Index += reflect.ValueOf(list_data(m.Value)).Len()
+		}
+		return append(out, Match{extend_path(m.Path, elem), v})
+
+	case step_all:
+		return query_children(m, out)
+
+	case step_descend:
+		out = append(out, m)
+		for _, child := range query_children(m, nil) {
+			out = self.apply(child, out)
+		}
+		return out
+
+	case step_filter:
+		for _, child := range query_children(m, nil) {
+			if self.filter.eval(child.Value) {
+				out = append(out, child)
+			}
+		}
+	}
+	return out
+}
+
+// Returns the items of a list or array, or nil for other values.
+func list_data(v interface{}) interface{} {
+	switch v := v.(type) {
+	case *List:
+		return v.data
+	case []int8, []int32, []int64:
+		return v
+	}
+	return nil
+}
+
+// Appends the entries of a compound, ordered by key, or the elements of a
+// list or array, to out.
+func query_children(m Match, out []Match) []Match {
+	if c, ok := m.Value.(*Compound); ok {
+		for _, k := range c.sorted_keys() {
+			out = append(out, Match{extend_path(m.Path, PathElem{Key: k}), c.data[k].value()})
+		}
+		return out
+	}
+	if data := list_data(m.Value); data != nil {
+		items := reflect.ValueOf(data)
+		for i := 0; i < items.Len(); i++ {
+			out = append(out, Match{extend_path(m.Path, PathElem{Index: i, IsIndex: true}), items.Index(i).Interface()})
+		}
+	}
+	return out
+}
+
+func extend_path(path Path, elem PathElem) Path {
+	return append(path[:len(path):len(path)], elem)
+}
+
+// query_expr is a compiled filter expression.
+type query_expr interface {
+	eval(v interface{}) bool
+}
+
+type expr_and struct{ a, b query_expr }
+type expr_or struct{ a, b query_expr }
+type expr_not struct{ a query_expr }
+type expr_exists struct{ path Path }
+
+type expr_compare struct {
+	op          string
+	left, right query_operand
+}
+
+// query_operand is either a path relative to @ or a literal.
+type query_operand struct {
+	path    Path
+	literal interface{}
+}
+
+func (self expr_and) eval(v interface{}) bool { return self.a.eval(v) && self.b.eval(v) }
+func (self expr_or) eval(v interface{}) bool  { return self.a.eval(v) || self.b.eval(v) }
+func (self expr_not) eval(v interface{}) bool { return !self.a.eval(v) }
+
+func (self expr_exists) eval(v interface{}) bool {
+	_, ok := query_get(v, self.path)
+	return ok
+}
+
+func (self query_operand) value(v interface{}) (interface{}, bool) {
+	if self.literal != nil {
+		return self.literal, true
+	}
+	return query_get(v, self.path)
+}
+
+func query_get(v interface{}, path Path) (interface{}, bool) {
+	for _, elem := range path {
+		next, err := path_step(v, elem)
+		if err != nil {
+			return nil, false
+		}
+		v = next
+	}
+	return v, true
+}
+
+func (self expr_compare) eval(v interface{}) bool {
+	a, ok := self.left.value(v)
+	if !ok {
+		return false
+	}
+	b, ok := self.right.value(v)
+	if !ok {
+		return false
+	}
+
+	cmp, ok := query_compare(a, b)
+	if !ok {
+		return self.op == "!=" && !Equal(a, b) || self.op == "==" && Equal(a, b)
+	}
+	switch self.op {
+	case "==":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	}
+	return cmp >= 0
+}
+
+// Compares two numbers or two strings, reporting false for other values.
+func query_compare(a, b interface{}) (int, bool) {
+	if sa, ok := a.(string); ok {
+		sb, ok := b.(string)
+		return strings.Compare(sa, sb), ok
+	}
+	na, ok := NumberOf(a)
+	if !ok {
+		return 0, false
+	}
+	nb, ok := NumberOf(b)
+	if !ok {
+		return 0, false
+	}
+	if !na.IsFloat() && !nb.IsFloat() {
+		x, y := na.Int64(), nb.Int64()
+		switch {
+		case x < y:
+			return -1, true
+		case x > y:
+			return 1, true
+		}
+		return 0, true
+	}
+	x, y := na.Float64(), nb.Float64()
+	switch {
+	case x < y:
+		return -1, true
+	case x > y:
+		return 1, true
+	case x == y:
+		return 0, true
+	}
+	// NaN
+	return 0, false
+}
+
+type query_parser struct {
+	src string
+	pos int
+}
+
+func (self *query_parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("Invalid query %q at offset %d: %s", self.src, self.pos, fmt.Sprintf(format, args...))
+}
+
+func (self *query_parser) skip_space() {
+	for self.pos < len(self.src) && strings.IndexByte(" \t\n", self.src[self.pos]) >= 0 {
+		self.pos++
+	}
+}
+
+func (self *query_parser) consume(s string) bool {
+	self.skip_space()
+	if strings.HasPrefix(self.src[self.pos:], s) {
+		self.pos += len(s)
+		return true
+	}
+	return false
+}
+
+func (self *query_parser) peek(s string) bool {
+	return strings.HasPrefix(self.src[self.pos:], s)
+}
+
+// Parses steps up to the end of the input, or to a ',' or '}' ending a
+// projection entry if top is false.
+func (self *query_parser) query(top bool) (*Query, error) {
+	start := self.pos
+	q := &Query{}
+	first := true
+	for self.pos < len(self.src) {
+		switch {
+		case self.peek(".."):
+			self.pos += 2
+			q.steps = append(q.steps, query_step{kind: step_descend})
+			if self.pos == len(self.src) || strings.IndexByte(".{,} ", self.src[self.pos]) >= 0 {
+				return nil, self.errorf("expected a step after '..'")
+			}
+			if self.peek("[") {
+				continue
+			}
+			if err := self.key_step(q); err != nil {
+				return nil, err
+			}
+
+		case self.peek("."):
+			self.pos++
+			if first && (self.pos == len(self.src) || strings.IndexByte(",} ", self.src[self.pos]) >= 0) {
+				// "." is the value itself
+				break
+			}
+			if self.peek("[") {
+				// jq's .[0]
+				continue
+			}
+			if err := self.key_step(q); err != nil {
+				return nil, err
+			}
+
+		case self.peek("["):
+			if err := self.bracket_step(q); err != nil {
+				return nil, err
+			}
+
+		case self.peek("{"):
+			if !top {
+				return nil, self.errorf("nested projection")
+			}
+			if err := self.projection(q); err != nil {
+				return nil, err
+			}
+			if self.skip_space(); self.pos < len(self.src) {
+				return nil, self.errorf("projection must come last")
+			}
+
+		case self.peek(",") || self.peek("}") || self.peek(" "):
+			if top {
+				return nil, self.errorf("unexpected %q", self.src[self.pos])
+			}
+			q.src = self.src[start:self.pos]
+			return q, nil
+
+		case first:
+			// the leading '.' is optional
+			if err := self.key_step(q); err != nil {
+				return nil, err
+			}
+
+		default:
+			return nil, self.errorf("expected '.', '[' or '{'")
+		}
+		first = false
+	}
+	q.src = self.src[start:self.pos]
+	return q, nil
+}
+
+func (self *query_parser) key_step(q *Query) error {
+	if self.peek("*") {
+		self.pos++
+		q.steps = append(q.steps, query_step{kind: step_all})
+		return nil
+	}
+	key, err := self.key(`.[]"{},* `)
+	if err != nil {
+		return err
+	}
+	q.steps = append(q.steps, query_step{kind: step_key, key: key})
+	return nil
+}
+
+// Reads a bare key, which ends at any of the given bytes, or a quoted one.
+func (self *query_parser) key(ends string) (string, error) {
+	rest := self.src[self.pos:]
+	if strings.HasPrefix(rest, `"`) {
+		quoted, err := strconv.QuotedPrefix(rest)
+		if err != nil {
+			return "", self.errorf("unterminated quoted key")
+		}
+		self.pos += len(quoted)
+		return strconv.Unquote(quoted)
+	}
+	n := strings.IndexAny(rest, ends)
+	if n < 0 {
+		n = len(rest)
+	}
+	if n == 0 {
+		return "", self.errorf("empty key")
+	}
+	self.pos += n
+	return rest[:n], nil
+}
+
+func (self *query_parser) bracket_step(q *Query) error {
+	self.pos++
+	switch {
+	case self.consume("*"):
+		q.steps = append(q.steps, query_step{kind: step_all})
+
+	case self.consume("?("):
+		expr, err := self.or_expr()
+		if err != nil {
+			return err
+		}
+		if !self.consume(")") {
+			return self.errorf("missing ')'")
+		}
+		q.steps = append(q.steps, query_step{kind: step_filter, filter: expr})
+
+	case self.peek(`"`):
+		key, err := self.key("")
+		if err != nil {
+			return err
+		}
+		q.steps = append(q.steps, query_step{kind: step_key, key: key})
+
+	default:
+		end := strings.IndexByte(self.src[self.pos:], ']')
+		if end < 0 {
+			return self.errorf("missing ']'")
+		}
+		index, err := strconv.Atoi(strings.TrimSpace(self.src[self.pos : self.pos+end]))
+		if err != nil {
+			return self.errorf("bad index %q", self.src[self.pos:self.pos+end])
+		}
+		self.pos += end
+		q.steps = append(q.steps, query_step{kind: step_index, index: index})
+	}
+	if !self.consume("]") {
+		return self.errorf("missing ']'")
+	}
+	return nil
+}
+
+func (self *query_parser) projection(q *Query) error {
+	self.pos++
+	q.project = []query_projection{}
+	for {
+		if len(q.project) == 0 && self.consume("}") {
+			return nil
+		}
+		self.skip_space()
+		name, err := self.key(`.[]"{},: `)
+		if err != nil {
+			return err
+		}
+		p := query_projection{name: name, query: &Query{src: "." + name, steps: []query_step{{kind: step_key, key: name}}}}
+		if self.consume(":") {
+			self.skip_space()
+			if p.query, err = self.query(false); err != nil {
+				return err
+			}
+		}
+		q.project = append(q.project, p)
+		if self.consume("}") {
+			return nil
+		}
+		if !self.consume(",") {
+			return self.errorf("expected ',' or '}'")
+		}
+	}
+}
+
+func (self *query_parser) or_expr() (query_expr, error) {
+	a, err := self.and_expr()
+	for err == nil && self.consume("||") {
+		var b query_expr
+		if b, err = self.and_expr(); err == nil {
+			a = expr_or{a, b}
+		}
+	}
+	return a, err
+}
+
+func (self *query_parser) and_expr() (query_expr, error) {
+	a, err := self.unary_expr()
+	for err == nil && self.consume("&&") {
+		var b query_expr
+		if b, err = self.unary_expr(); err == nil {
+			a = expr_and{a, b}
+		}
+	}
+	return a, err
+}
+
+func (self *query_parser) unary_expr() (query_expr, error) {
+	if self.consume("!") {
+		a, err := self.unary_expr()
+		return expr_not{a}, err
+	}
+	if self.consume("(") {
+		a, err := self.or_expr()
+		if err == nil && !self.consume(")") {
+			err = self.errorf("missing ')'")
+		}
+		return a, err
+	}
+
+	left, err := self.operand()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if self.consume(op) {
+			right, err := self.operand()
+			if err != nil {
+				return nil, err
+			}
+			return expr_compare{op, left, right}, nil
+		}
+	}
+	if left.literal != nil {
+		return nil, self.errorf("expected a comparison")
+	}
+	return expr_exists{left.path}, nil
+}
+
+func (self *query_parser) operand() (query_operand, error) {
+	self.skip_space()
+	rest := self.src[self.pos:]
+	switch {
+	case strings.HasPrefix(rest, "@"):
+		self.pos++
+		end := self.pos
+		for end < len(self.src) {
+			if self.src[end] == '"' {
+				quoted, err := strconv.QuotedPrefix(self.src[end:])
+				if err != nil {
+					return query_operand{}, self.errorf("unterminated quoted key")
+				}
+				end += len(quoted)
+				continue
+			}
+			if strings.IndexByte(" =!<>&|)", self.src[end]) >= 0 {
+				break
+			}
+			end++
+		}
+		path, err := ParsePath(self.src[self.pos:end])
+		if err != nil {
+			return query_operand{}, self.errorf("%v", err)
+		}
+		self.pos = end
+		return query_operand{path: path}, nil
+
+	case strings.HasPrefix(rest, `"`):
+		quoted, err := strconv.QuotedPrefix(rest)
+		if err != nil {
+			return query_operand{}, self.errorf("unterminated string")
+		}
+		s, err := strconv.Unquote(quoted)
+		if err != nil {
+			return query_operand{}, self.errorf("%v", err)
+		}
+		self.pos += len(quoted)
+		return query_operand{literal: s}, nil
+
+	case strings.HasPrefix(rest, "true"):
+		self.pos += 4
+		return query_operand{literal: int8(1)}, nil
+
+	case strings.HasPrefix(rest, "false"):
+		self.pos += 5
+		return query_operand{literal: int8(0)}, nil
+	}
+
+	n := strings.IndexAny(rest, " =!<>&|)")
+	if n < 0 {
+		n = len(rest)
+	}
+	num, err := parse_query_number(rest[:n])
+	if err != nil {
+		return query_operand{}, self.errorf("expected @, a string or a number, got %q", rest[:n])
+	}
+	self.pos += n
+	return query_operand{literal: num}, nil
+}
+
+// Parses a number with an optional SNBT type suffix, as an int64 if it is an
+// integer without a float suffix and as a float64 otherwise.
+func parse_query_number(s string) (interface{}, error) {
+	if s == "" {
+		return nil, errors.New("empty number")
+	}
+	float := false
+	switch s[len(s)-1] {
+	case 'f', 'F', 'd', 'D':
+		float = true
+		fallthrough
+	case 'b', 'B', 's', 'S', 'l', 'L':
+		s = s[:len(s)-1]
+	}
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil && !float {
+		return i, nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
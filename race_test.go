@@ -0,0 +1,7 @@
+//go:build race
+
+package nbt
+
+// The race detector makes allocations of its own, so tests counting them
+// are skipped when it is on.
+const race_enabled = true
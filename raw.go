@@ -0,0 +1,34 @@
+package nbt
+
+import (
+	"bytes"
+)
+
+// RawTag is the payload of a tag kept in its encoded form. A struct field of
+// this type, or a map field of them such as one tagged `nbt:",inline"`,
+// takes whatever tag it is matched with in DecodeValue without decoding it,
+// and EncodeValue writes it back byte for byte, so that typed structs can
+// carry the parts of a document they do not model, compound entry order
+// included. The payload is in the byte order it was decoded with and must
+// be encoded with the same one. A RawTag of type TAG_End is left out.
+//
+// Other than the encoders, most of this package does not look inside a
+// RawTag; use Value to decode it.
+type RawTag struct {
+	Type    TagType
+	Payload []byte
+}
+
+// Decodes the payload, which must be big endian, as a plain value of one of
+// the types returned by Compound.Get.
+func (self RawTag) Value() (interface{}, error) {
+	dec := NewDecoder(bytes.NewReader(self.Payload))
+	v, err := dec.read_payload(self.Type, "")
+	if err != nil {
+		return nil, err
+	}
+	if dec.r.n != int64(len(self.Payload)) {
+		return nil, ErrInvalidTag
+	}
+	return v, nil
+}
@@ -0,0 +1,52 @@
+package region
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// Kind is the kind of chunk data a region file holds. Since 1.17 a
+// dimension keeps the entities and the points of interest of its chunks in
+// region files of their own, in the entities and poi directories next to
+// the region directory, with the same layout but other chunk schemas.
+type Kind int
+
+const (
+	// Blocks, biomes, block entities and the rest of the chunk, in
+	// region/.
+	Terrain Kind = iota
+
+	// Entities, in entities/. See ReadEntities.
+	Entities
+
+	// Points of interest, in poi/. See ReadPOI.
+	POI
+)
+
+func (self Kind) String() string {
+	switch self {
+	case Terrain:
+		return "terrain"
+	case Entities:
+		return "entities"
+	case POI:
+		return "poi"
+	}
+	return fmt.Sprintf("Kind(%d)", int(self))
+}
+
+// Returns the kind of a region file from the name of its directory,
+// defaulting to Terrain.
+func KindOf(path string) Kind {
+	switch filepath.Base(filepath.Dir(path)) {
+	case "entities":
+		return Entities
+	case "poi":
+		return POI
+	}
+	return Terrain
+}
+
+// Returns the kind of the region file, as found by KindOf when it was
+// opened. Regions not opened from a file are Terrain.
+func (self *Region) Kind() Kind { return self.kind }
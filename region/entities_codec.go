@@ -0,0 +1,81 @@
+//go:build !nbt_noreflect
+
+package region
+
+import (
+	"strconv"
+
+	"github.com/moshee/go-nbt"
+)
+
+// EntityChunk is a chunk of an entities region file.
+type EntityChunk struct {
+	DataVersion int32
+
+	// Coordinates of the chunk in the world, not within the region.
+	Position [2]int32
+
+	// The entities, left as compounds since their schema depends on their
+	// id.
+	Entities []*nbt.Compound
+}
+
+// Reads a chunk of an entities region file.
+func (self *Region) ReadEntities(x, z int) (*EntityChunk, error) {
+	chunk := new(EntityChunk)
+	if err := self.unmarshal_chunk(x, z, chunk); err != nil {
+		return nil, err
+	}
+	return chunk, nil
+}
+
+// POIChunk is a chunk of a poi region file.
+type POIChunk struct {
+	DataVersion int32
+
+	// Keyed by the section's Y coordinate, in decimal. See Section.
+	Sections map[string]*POISection
+}
+
+// POISection holds the points of interest of a chunk section.
+type POISection struct {
+	// Unset when the game must scan the section again.
+	Valid   bool
+	Records []POIRecord
+}
+
+// POIRecord is a point of interest, such as a bed, a workstation or a
+// nether portal.
+type POIRecord struct {
+	// Coordinates of the block in the world.
+	Pos [3]int32 `nbt:"pos"`
+
+	// Such as minecraft:home.
+	Type string `nbt:"type"`
+
+	// How many more villagers may claim the point.
+	FreeTickets int32 `nbt:"free_tickets"`
+}
+
+// Returns the section at the given section Y coordinate, or nil if it has
+// no points of interest recorded.
+func (self *POIChunk) Section(y int) *POISection {
+	return self.Sections[strconv.Itoa(y)]
+}
+
+// Reads a chunk of a poi region file.
+func (self *Region) ReadPOI(x, z int) (*POIChunk, error) {
+	chunk := new(POIChunk)
+	if err := self.unmarshal_chunk(x, z, chunk); err != nil {
+		return nil, err
+	}
+	return chunk, nil
+}
+
+func (self *Region) unmarshal_chunk(x, z int, v interface{}) error {
+	data, err := self.ChunkData(x, z)
+	if err != nil {
+		return err
+	}
+	return nbt.Unmarshal(data, v)
+}
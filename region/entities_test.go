@@ -0,0 +1,79 @@
+//go:build !nbt_noreflect
+
+package region
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/moshee/go-nbt"
+)
+
+func TestEntitiesAndPOI(t *testing.T) {
+	doc, err := nbt.Marshal(map[string]interface{}{
+		"DataVersion": int32(3953),
+		"Position":    []int32{-29, 5},
+		"Entities": []map[string]interface{}{
+			{"id": "minecraft:cow", "Health": float32(10)},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := test_region_of(doc)
+	dir := t.TempDir() + "/entities"
+	os.Mkdir(dir, 0755)
+	path := dir + "/r.-1.0.mca"
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if r.Kind() != Entities {
+		t.Errorf("Kind: expected entities, got %v", r.Kind())
+	}
+	entities, err := r.ReadEntities(3, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entities.DataVersion != 3953 || entities.Position != [2]int32{-29, 5} ||
+		len(entities.Entities) != 1 || entities.Entities[0].String("id") != "minecraft:cow" {
+		t.Errorf("ReadEntities: got %+v", entities)
+	}
+
+	doc, err = nbt.Marshal(map[string]interface{}{
+		"DataVersion": int32(3953),
+		"Sections": map[string]interface{}{
+			"-1": POISection{Valid: true, Records: []POIRecord{
+				{Pos: [3]int32{-461, -9, 88}, Type: "minecraft:home", FreeTickets: 1},
+			}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = test_region_of(doc)
+	r, err = New(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	poi, err := r.ReadPOI(3, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	section := poi.Section(-1)
+	if section == nil || !section.Valid || len(section.Records) != 1 || section.Records[0].Type != "minecraft:home" ||
+		section.Records[0].Pos != [3]int32{-461, -9, 88} || section.Records[0].FreeTickets != 1 {
+		t.Errorf("ReadPOI: got %+v", section)
+	}
+	if poi.Section(0) != nil {
+		t.Error("Section(0): expected nil")
+	}
+	if KindOf("world/poi/r.0.0.mca") != POI || KindOf("r.0.0.mca") != Terrain {
+		t.Error("KindOf: wrong kinds")
+	}
+}
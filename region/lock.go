@@ -0,0 +1,61 @@
+package region
+
+import (
+	"errors"
+	"os"
+)
+
+// Lock is the kind of advisory lock OpenLocked takes on a region file. The
+// locks are flock(2) locks, which only coordinate programs that take them
+// too: a program that reads a region while holding a Shared lock cannot see
+// it half written by one that writes it while holding an Exclusive lock,
+// and two writers holding Exclusive locks take turns.
+type Lock int
+
+const (
+	// Held by any number of readers at once, but never alongside an
+	// Exclusive lock.
+	Shared Lock = 1 + iota
+
+	// Held by a single writer, alone. The region is opened for writing.
+	Exclusive
+
+	// May be added to Shared or Exclusive to fail with ErrLocked instead
+	// of waiting when the lock is held by another program.
+	NoWait Lock = 0x10
+)
+
+var (
+	ErrLocked          = errors.New("Region file is locked by another program")
+	ErrLockUnsupported = errors.New("File locking is not supported on this system")
+)
+
+// Opens a region file as Open does, holding the given lock on it until the
+// region is closed. The lock is taken before the region's tables are read.
+// With an Exclusive lock, the file is opened for reading and writing, and
+// chunks can be stored with WriteChunk; with a Shared lock, it is only
+// read.
+func OpenLocked(path string, lock Lock) (*Region, error) {
+	kind := lock &^ NoWait
+	if kind != Shared && kind != Exclusive {
+		return nil, errors.New("Invalid region lock")
+	}
+	flag := os.O_RDONLY
+	if kind == Exclusive {
+		flag = os.O_RDWR
+	}
+	f, err := os.OpenFile(path, flag, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := flock(f, lock); err != nil {
+		f.Close()
+		return nil, err
+	}
+	// closing the file releases the lock
+	r, err := open(path, f)
+	if err == nil && kind == Exclusive {
+		r.w = f
+	}
+	return r, err
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package region
+
+import "os"
+
+func flock(f *os.File, lock Lock) error {
+	return ErrLockUnsupported
+}
@@ -0,0 +1,30 @@
+//go:build unix
+
+package region
+
+import (
+	"os"
+	"syscall"
+)
+
+func flock(f *os.File, lock Lock) error {
+	how := syscall.LOCK_SH
+	if lock&^NoWait == Exclusive {
+		how = syscall.LOCK_EX
+	}
+	if lock&NoWait != 0 {
+		how |= syscall.LOCK_NB
+	}
+	for {
+		err := syscall.Flock(int(f.Fd()), how)
+		switch err {
+		case nil:
+			return nil
+		case syscall.EINTR:
+			continue
+		case syscall.EWOULDBLOCK:
+			return ErrLocked
+		}
+		return &os.PathError{Op: "flock", Path: f.Name(), Err: err}
+	}
+}
@@ -0,0 +1,131 @@
+package region
+
+import (
+	"fmt"
+	"math/bits"
+
+	"github.com/moshee/go-nbt"
+)
+
+// Since 1.18, the sections of a chunk store their block states and biomes
+// as paletted containers: a list of the distinct values in the section and
+// a TAG_Long_Array of indices into it, each index using just enough bits
+// for the palette, packed from the least significant bit up without
+// spanning two longs. A palette of one value has no indices at all.
+
+// Returns the number of bits an index into a palette of n values takes,
+// but no fewer than min. Block states use a minimum of 4 and biomes of 0.
+func PaletteBits(n, min int) int {
+	b := 0
+	if n > 1 {
+		b = bits.Len(uint(n - 1))
+	}
+	if b < min {
+		b = min
+	}
+	return b
+}
+
+// Packs indices into a palette of n values, using PaletteBits(n, min) bits
+// each. It returns nil if they take no bits.
+func PackPalette(indices []int, n, min int) []int64 {
+	b := PaletteBits(n, min)
+	if b == 0 {
+		return nil
+	}
+	per_long := 64 / b
+	data := make([]int64, (len(indices)+per_long-1)/per_long)
+	for i, index := range indices {
+		data[i/per_long] |= int64(uint64(index) << uint(i%per_long*b))
+	}
+	return data
+}
+
+// Unpacks count indices into a palette of n values from data, the
+// counterpart of PackPalette.
+func UnpackPalette(data []int64, count, n, min int) ([]int, error) {
+	if n < 1 {
+		return nil, fmt.Errorf("Empty palette")
+	}
+	indices := make([]int, count)
+	b := PaletteBits(n, min)
+	if b == 0 {
+		return indices, nil
+	}
+	per_long := 64 / b
+	if want := (count + per_long - 1) / per_long; len(data) != want {
+		return nil, fmt.Errorf("Expected %d longs of %d bit indices, got %d", want, b, len(data))
+	}
+	mask := uint64(1)<<uint(b) - 1
+	for i := range indices {
+		index := int(uint64(data[i/per_long]) >> uint(i%per_long*b) & mask)
+		if index >= n {
+			return nil, fmt.Errorf("Palette index %d out of range for a palette of %d", index, n)
+		}
+		indices[i] = index
+	}
+	return indices, nil
+}
+
+// Biomes holds the biomes of a chunk section, which are set for cells of
+// 4×4×4 blocks, indexed by BiomeIndex.
+type Biomes [64]string
+
+// Returns the index in Biomes of the cell at x, y and z, counted in cells
+// (0–3) from the section's lowest corner.
+func BiomeIndex(x, y, z int) int {
+	return y<<4 | z<<2 | x
+}
+
+// Decodes the biomes compound of a section, holding the palette and data
+// entries.
+func UnpackBiomes(c *nbt.Compound) (*Biomes, error) {
+	palette, err := c.GetPath("palette")
+	if err != nil {
+		return nil, err
+	}
+	list, ok := palette.(*nbt.List)
+	if !ok || list.ListType() != nbt.TagString {
+		return nil, fmt.Errorf("Biome palette is not a list of strings")
+	}
+	names := list.Strings()
+
+	var data []int64
+	if v, err := c.GetPath("data"); err == nil {
+		if data, ok = v.([]int64); !ok {
+			return nil, fmt.Errorf("Biome data is a %v, not a TAG_Long_Array", nbt.TypeOf(v))
+		}
+	}
+	indices, err := UnpackPalette(data, len(Biomes{}), len(names), 0)
+	if err != nil {
+		return nil, err
+	}
+	biomes := new(Biomes)
+	for i, index := range indices {
+		biomes[i] = names[index]
+	}
+	return biomes, nil
+}
+
+// Encodes biomes as the biomes compound of a section, with the biomes in
+// the palette in the order they first appear.
+func PackBiomes(biomes *Biomes) (*nbt.Compound, error) {
+	var names []nbt.Tag
+	seen := make(map[string]int)
+	indices := make([]int, len(biomes))
+	for i, name := range biomes {
+		index, ok := seen[name]
+		if !ok {
+			index = len(names)
+			seen[name] = index
+			names = append(names, &nbt.StringTag{Value: name})
+		}
+		indices[i] = index
+	}
+
+	tags := []nbt.Tag{&nbt.ListTag{Name: "palette", Elem: nbt.TagString, Value: names}}
+	if data := PackPalette(indices, len(names), 0); data != nil {
+		tags = append(tags, &nbt.LongArrayTag{Name: "data", Value: data})
+	}
+	return (&nbt.CompoundTag{Name: "biomes", Value: tags}).Compound()
+}
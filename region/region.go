@@ -0,0 +1,323 @@
+// Package region reads Minecraft Java Edition region files (.mca), which
+// store the NBT data of 32×32 chunks, and writes chunks to region files
+// opened with OpenLocked.
+//
+// A region file starts with two 4 KiB tables of 1024 entries, one per chunk,
+// indexed by x + z*32 where x and z are the chunk's coordinates within the
+// region (0–31). The first table holds each chunk's location as a 3 byte
+// offset and a 1 byte length, both counted in 4 KiB sectors; the second holds
+// the time each chunk was last saved, in seconds since the Unix epoch. A
+// chunk's data starts with its length in bytes as a big endian int32, then a
+// byte naming its compression scheme, then the compressed NBT document.
+// Chunks too large for the region file are stored in a separate c.X.Z.mcc
+// file next to it, which is flagged by the high bit of the compression byte.
+//
+// The entities and points of interest of chunks are kept in region files of
+// the same layout in other directories; see Kind.
+package region
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/moshee/go-nbt"
+)
+
+const (
+	SectorSize = 4096
+
+	// Chunks per side of a region.
+	Width = 32
+)
+
+var (
+	ErrNoChunk     = errors.New("Chunk is not present in the region")
+	ErrBadLocation = errors.New("Chunk location points outside of the region file")
+)
+
+// Compression is the compression scheme of a chunk.
+type Compression byte
+
+const (
+	Gzip Compression = 1 + iota
+	Zlib
+	Uncompressed
+	LZ4
+
+	// Set on the compression byte of chunks stored in a .mcc file.
+	external = 0x80
+)
+
+func (self Compression) String() string {
+	switch self {
+	case Gzip:
+		return "gzip"
+	case Zlib:
+		return "zlib"
+	case Uncompressed:
+		return "uncompressed"
+	case LZ4:
+		return "lz4"
+	}
+	return fmt.Sprintf("Compression(%d)", byte(self))
+}
+
+// ChunkInfo describes a chunk present in a region.
+type ChunkInfo struct {
+	// Coordinates of the chunk within the region, 0–31.
+	X, Z int
+
+	// Position and size of the chunk's sectors in the region file, in bytes.
+	Offset int64
+	Size   int64
+
+	Timestamp time.Time
+
+	// Length of the chunk's compressed data and its compression, read from
+	// the chunk's own header. For an external chunk, Length is that of the
+	// .mcc file.
+	Length      int64
+	Compression Compression
+	External    bool
+}
+
+// Region is an open region file.
+type Region struct {
+	// If set, corrupt chunks skipped by Chunks and chunks whose data
+	// overruns the sectors allocated to them are logged at LogLevel, or
+	// slog.LevelWarn if LogLevel is nil.
+	Logger   *slog.Logger
+	LogLevel slog.Leveler
+
+	r    io.ReaderAt
+	w    io.WriterAt // if opened for writing
+	size int64
+
+	// directory of the region file and its coordinates, for finding .mcc
+	// files; dir is empty if the region was not opened from a file.
+	dir    string
+	rx, rz int
+	kind   Kind
+	closer io.Closer
+
+	locations  [Width * Width]uint32
+	timestamps [Width * Width]uint32
+}
+
+var region_name = regexp.MustCompile(`^r\.(-?\d+)\.(-?\d+)\.mca$`)
+
+// Opens a region file. External chunks are looked up next to it if its name
+// follows the usual r.X.Z.mca pattern.
+func Open(path string) (*Region, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return open(path, f)
+}
+
+// Reads the tables of the region file f, closing it on failure.
+func open(path string, f *os.File) (*Region, error) {
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	r, err := New(f, info.Size())
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	r.closer = f
+	r.kind = KindOf(path)
+	if m := region_name.FindStringSubmatch(filepath.Base(path)); m != nil {
+		r.dir = filepath.Dir(path)
+		r.rx, _ = strconv.Atoi(m[1])
+		r.rz, _ = strconv.Atoi(m[2])
+	}
+	return r, nil
+}
+
+// Reads the tables of a region held in r, which is size bytes long. Chunks
+// stored in external files cannot be read from such a region.
+func New(r io.ReaderAt, size int64) (*Region, error) {
+	self := &Region{r: r, size: size}
+	if size == 0 {
+		// the game creates empty region files
+		return self, nil
+	}
+	header := io.NewSectionReader(r, 0, 2*SectorSize)
+	if err := binary.Read(header, binary.BigEndian, &self.locations); err != nil {
+		return nil, fmt.Errorf("Reading region locations: %v", err)
+	}
+	if err := binary.Read(header, binary.BigEndian, &self.timestamps); err != nil {
+		return nil, fmt.Errorf("Reading region timestamps: %v", err)
+	}
+	return self, nil
+}
+
+// Closes the underlying file if the region was opened with Open.
+func (self *Region) Close() error {
+	if self.closer == nil {
+		return nil
+	}
+	return self.closer.Close()
+}
+
+func index(x, z int) (int, error) {
+	if x < 0 || x >= Width || z < 0 || z >= Width {
+		return 0, fmt.Errorf("Chunk coordinates (%d, %d) out of range", x, z)
+	}
+	return x + z*Width, nil
+}
+
+// Returns information on a chunk, or ErrNoChunk if it is not present.
+func (self *Region) Info(x, z int) (ChunkInfo, error) {
+	i, err := index(x, z)
+	if err != nil {
+		return ChunkInfo{}, err
+	}
+	loc := self.locations[i]
+	if loc == 0 {
+		return ChunkInfo{}, ErrNoChunk
+	}
+	info := ChunkInfo{
+		X:         x,
+		Z:         z,
+		Offset:    int64(loc>>8) * SectorSize,
+		Size:      int64(loc&0xff) * SectorSize,
+		Timestamp: time.Unix(int64(self.timestamps[i]), 0),
+	}
+	if info.Offset < 2*SectorSize || info.Offset+5 > self.size {
+		return info, ErrBadLocation
+	}
+
+	var header [5]byte
+	if _, err := self.r.ReadAt(header[:], info.Offset); err != nil {
+		return info, err
+	}
+	info.Length = int64(binary.BigEndian.Uint32(header[:4])) - 1
+	info.Compression = Compression(header[4] &^ external)
+	info.External = header[4]&external != 0
+	if info.External {
+		fi, err := os.Stat(self.external_path(x, z))
+		if err != nil {
+			return info, err
+		}
+		info.Length = fi.Size()
+	} else if info.Length < 0 || info.Offset+5+info.Length > self.size {
+		return info, ErrBadLocation
+	}
+	return info, nil
+}
+
+// Returns information on every chunk present in the region, in the order
+// they appear in the tables. Corrupt chunks are skipped, and the error for
+// the first of them is returned along with the others.
+func (self *Region) Chunks() ([]ChunkInfo, error) {
+	var chunks []ChunkInfo
+	var first error
+	for z := 0; z < Width; z++ {
+		for x := 0; x < Width; x++ {
+			info, err := self.Info(x, z)
+			if err == ErrNoChunk {
+				continue
+			}
+			if err != nil {
+				self.warn("region: skipping corrupt chunk", "x", x, "z", z, "error", err)
+				if first == nil {
+					first = fmt.Errorf("Chunk (%d, %d): %v", x, z, err)
+				}
+				continue
+			}
+			if !info.External && info.Length+5 > info.Size {
+				self.warn("region: chunk overruns its sectors", "x", x, "z", z,
+					"length", info.Length, "size", info.Size)
+			}
+			chunks = append(chunks, info)
+		}
+	}
+	return chunks, first
+}
+
+func (self *Region) warn(msg string, args ...interface{}) {
+	if self.Logger == nil {
+		return
+	}
+	level := self.LogLevel
+	if level == nil {
+		level = slog.LevelWarn
+	}
+	self.Logger.Log(context.Background(), level.Level(), msg, args...)
+}
+
+func (self *Region) external_path(x, z int) string {
+	name := fmt.Sprintf("c.%d.%d.mcc", self.rx*Width+x, self.rz*Width+z)
+	return filepath.Join(self.dir, name)
+}
+
+// Returns a chunk's uncompressed NBT document.
+func (self *Region) ChunkData(x, z int) ([]byte, error) {
+	info, err := self.Info(x, z)
+	if err != nil {
+		return nil, err
+	}
+
+	var src io.Reader
+	if info.External {
+		if self.dir == "" {
+			return nil, errors.New("Chunk is stored in an external file")
+		}
+		f, err := os.Open(self.external_path(x, z))
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		src = f
+	} else {
+		src = io.NewSectionReader(self.r, info.Offset+5, info.Length)
+	}
+
+	switch info.Compression {
+	case Gzip:
+		r, err := gzip.NewReader(src)
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		src = r
+	case Zlib:
+		r, err := zlib.NewReader(src)
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		src = r
+	case Uncompressed:
+	default:
+		return nil, fmt.Errorf("Unsupported chunk compression: %v", info.Compression)
+	}
+	return ioutil.ReadAll(src)
+}
+
+// Reads and decodes a chunk.
+func (self *Region) ReadChunk(x, z int) (*nbt.Compound, error) {
+	data, err := self.ChunkData(x, z)
+	if err != nil {
+		return nil, err
+	}
+	return nbt.Decode(bytes.NewReader(data))
+}
@@ -0,0 +1,246 @@
+package region
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"math/rand"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/moshee/go-nbt"
+)
+
+// TAG_Compound('hello world'): TAG_String('name'): 'Bananrama'
+var helloWorld = []byte{
+	0x0a, 0x00, 0x0b, 'h', 'e', 'l', 'l', 'o', ' ', 'w', 'o', 'r', 'l', 'd',
+	0x08, 0x00, 0x04, 'n', 'a', 'm', 'e',
+	0x00, 0x09, 'B', 'a', 'n', 'a', 'n', 'r', 'a', 'm', 'a',
+	0x00,
+}
+
+// Builds a region holding helloWorld at chunk (3, 5), zlib compressed.
+func test_region() []byte {
+	return test_region_of(helloWorld)
+}
+
+// Builds a region holding doc at chunk (3, 5), zlib compressed.
+func test_region_of(doc []byte) []byte {
+	chunk := new(bytes.Buffer)
+	w := zlib.NewWriter(chunk)
+	w.Write(doc)
+	w.Close()
+
+	data := make([]byte, (3+chunk.Len()/SectorSize)*SectorSize)
+	i := 3 + 5*Width
+	binary.BigEndian.PutUint32(data[i*4:], uint32(2<<8|len(data)/SectorSize-2))
+	binary.BigEndian.PutUint32(data[SectorSize+i*4:], 1500000000)
+	binary.BigEndian.PutUint32(data[2*SectorSize:], uint32(chunk.Len()+1))
+	data[2*SectorSize+4] = byte(Zlib)
+	copy(data[2*SectorSize+5:], chunk.Bytes())
+	return data
+}
+
+func TestReadChunk(t *testing.T) {
+	data := test_region()
+	r, err := New(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chunks, err := r.Chunks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunks) != 1 {
+		t.Fatalf("Chunks: expected 1 chunk, got %v", chunks)
+	}
+	info := chunks[0]
+	if info.X != 3 || info.Z != 5 || info.Offset != 2*SectorSize || info.Compression != Zlib || !info.Timestamp.Equal(time.Unix(1500000000, 0)) {
+		t.Errorf("Chunks: unexpected %+v", info)
+	}
+
+	c, err := r.ReadChunk(3, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := c.String("name"); name != "Bananrama" {
+		t.Errorf("ReadChunk: expected /name 'Bananrama', got %s", name)
+	}
+
+	if _, err := r.ReadChunk(0, 0); err != ErrNoChunk {
+		t.Errorf("ReadChunk(0, 0): expected ErrNoChunk, got %v", err)
+	}
+
+	binary.BigEndian.PutUint32(data[0:], 9<<8|1)
+	r, err = New(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.ReadChunk(0, 0); err != ErrBadLocation {
+		t.Errorf("ReadChunk(0, 0): expected ErrBadLocation, got %v", err)
+	}
+}
+
+func TestOpenLocked(t *testing.T) {
+	path := t.TempDir() + "/r.0.0.mca"
+	if err := os.WriteFile(path, test_region(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := OpenLocked(path, Shared)
+	if err == ErrLockUnsupported {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := OpenLocked(path, Shared|NoWait)
+	if err != nil {
+		t.Fatalf("OpenLocked: second shared lock: %v", err)
+	}
+	if _, err := b.ReadChunk(3, 5); err != nil {
+		t.Error(err)
+	}
+	if _, err := OpenLocked(path, Exclusive|NoWait); err != ErrLocked {
+		t.Errorf("OpenLocked: expected ErrLocked while shared, got %v", err)
+	}
+	a.Close()
+	b.Close()
+
+	w, err := OpenLocked(path, Exclusive|NoWait)
+	if err != nil {
+		t.Fatalf("OpenLocked: exclusive lock after close: %v", err)
+	}
+	if _, err := OpenLocked(path, Shared|NoWait); err != ErrLocked {
+		t.Errorf("OpenLocked: expected ErrLocked while exclusive, got %v", err)
+	}
+	w.Close()
+
+	if _, err := OpenLocked(path, NoWait); err == nil {
+		t.Error("OpenLocked: expected an error for an invalid lock")
+	}
+}
+
+func TestWriteChunk(t *testing.T) {
+	path := t.TempDir() + "/r.0.0.mca"
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	doc := func(name string) *nbt.Compound {
+		c, err := (&nbt.CompoundTag{Value: []nbt.Tag{&nbt.StringTag{Name: "name", Value: name}}}).Compound()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	r, err := OpenLocked(path, Shared)
+	if err == ErrLockUnsupported {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.WriteChunk(1, 2, doc("a")); err != ErrReadOnly {
+		t.Errorf("WriteChunk with a shared lock: expected ErrReadOnly, got %v", err)
+	}
+	r.Close()
+
+	w, err := OpenLocked(path, Exclusive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteChunk(1, 2, doc("Bananrama")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteChunk(3, 4, doc("short")); err != nil {
+		t.Fatal(err)
+	}
+	// too long for the sector it had
+	long := make([]byte, 3*SectorSize)
+	rand.New(rand.NewSource(1)).Read(long)
+	if err := w.WriteChunk(1, 2, doc(string(long))); err != nil {
+		t.Fatal(err)
+	}
+	if c, err := w.ReadChunk(1, 2); err != nil || c.String("name") != string(long) {
+		t.Errorf("ReadChunk after WriteChunk: %v", err)
+	}
+	w.Close()
+
+	r, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	chunks, err := r.Chunks()
+	if err != nil || len(chunks) != 2 {
+		t.Fatalf("Chunks after WriteChunk: got %v, %v", chunks, err)
+	}
+	if chunks[0].X != 1 || chunks[0].Z != 2 || chunks[0].Offset != 4*SectorSize || time.Since(chunks[0].Timestamp) > time.Minute {
+		t.Errorf("Chunks after WriteChunk: got %+v", chunks[0])
+	}
+	if c, err := r.ReadChunk(3, 4); err != nil || c.String("name") != "short" {
+		t.Errorf("ReadChunk(3, 4): got %v, %v", c, err)
+	}
+	if err := r.WriteChunk(0, 0, doc("a")); err != ErrReadOnly {
+		t.Errorf("WriteChunk on a region opened with Open: expected ErrReadOnly, got %v", err)
+	}
+}
+
+func TestPalette(t *testing.T) {
+	indices := make([]int, 4096)
+	for i := range indices {
+		indices[i] = i * 7 % 17
+	}
+	data := PackPalette(indices, 17, 4)
+	// 5 bit indices, 12 to a long
+	if len(data) != 342 {
+		t.Errorf("PackPalette: expected 342 longs, got %d", len(data))
+	}
+	got, err := UnpackPalette(data, len(indices), 17, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range got {
+		if got[i] != indices[i] {
+			t.Fatalf("UnpackPalette: index %d is %d, expected %d", i, got[i], indices[i])
+		}
+	}
+	if PaletteBits(1, 0) != 0 || PaletteBits(2, 0) != 1 || PaletteBits(2, 4) != 4 || PaletteBits(64, 0) != 6 {
+		t.Error("PaletteBits: wrong widths")
+	}
+	if _, err := UnpackPalette(data[1:], len(indices), 17, 4); err == nil {
+		t.Error("UnpackPalette: expected an error for short data")
+	}
+	if _, err := UnpackPalette(data, len(indices), 16, 4); err == nil {
+		t.Error("UnpackPalette: expected an error for an index out of range")
+	}
+
+	var biomes Biomes
+	for i := range biomes {
+		biomes[i] = "minecraft:plains"
+	}
+	c, err := PackBiomes(&biomes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetPath("data"); err == nil {
+		t.Error("PackBiomes: a single biome should have no data")
+	}
+	biomes[BiomeIndex(1, 2, 3)] = "minecraft:river"
+	if c, err = PackBiomes(&biomes); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := c.GetPath("data"); len(data.([]int64)) != 1 {
+		t.Errorf("PackBiomes: expected one long of 1 bit indices, got %v", data)
+	}
+	back, err := UnpackBiomes(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *back != biomes {
+		t.Errorf("UnpackBiomes: got %v", back)
+	}
+}
@@ -0,0 +1,96 @@
+package region
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/moshee/go-nbt"
+)
+
+var ErrReadOnly = errors.New("Region was not opened for writing")
+
+// Encodes a chunk and stores it in the region, as WriteChunkData does.
+func (self *Region) WriteChunk(x, z int, c *nbt.Compound) error {
+	data, err := c.MarshalBytes()
+	if err != nil {
+		return err
+	}
+	return self.WriteChunkData(x, z, data)
+}
+
+// Stores a chunk's uncompressed NBT document in the region, zlib compressed,
+// and sets its timestamp to now. The region must have been opened with
+// OpenLocked and an Exclusive lock. The chunk is rewritten in place if it
+// fits in the sectors it had, and appended to the file otherwise; the
+// sectors it leaves behind are not reused. Chunks too large for the region
+// file cannot be written, since that takes an external file; one that was
+// external before is moved into the region file.
+func (self *Region) WriteChunkData(x, z int, data []byte) error {
+	if self.w == nil {
+		return ErrReadOnly
+	}
+	i, err := index(x, z)
+	if err != nil {
+		return err
+	}
+
+	buf := bytes.NewBuffer(make([]byte, 5, 5+len(data)/2))
+	w := zlib.NewWriter(buf)
+	w.Write(data)
+	if err := w.Close(); err != nil {
+		return err
+	}
+	payload := buf.Bytes()
+	binary.BigEndian.PutUint32(payload, uint32(len(payload)-4))
+	payload[4] = byte(Zlib)
+	sectors := (len(payload) + SectorSize - 1) / SectorSize
+	if sectors > 0xff {
+		return fmt.Errorf("Chunk (%d, %d) of %d sectors is too large for the region file", x, z, sectors)
+	}
+	payload = append(payload, make([]byte, sectors*SectorSize-len(payload))...)
+
+	if self.size < 2*SectorSize {
+		// an empty region file, as the game creates them
+		if _, err := self.w.WriteAt(make([]byte, 2*SectorSize-self.size), self.size); err != nil {
+			return err
+		}
+		self.size = 2 * SectorSize
+	}
+	info, err := self.Info(x, z)
+	external := err == nil && info.External
+	offset := int64(self.locations[i] >> 8)
+	if err != nil || external || int(self.locations[i]&0xff) < sectors {
+		offset = (self.size + SectorSize - 1) / SectorSize
+	}
+	if _, err := self.w.WriteAt(payload, offset*SectorSize); err != nil {
+		return err
+	}
+	if end := (offset + int64(sectors)) * SectorSize; end > self.size {
+		self.size = end
+	}
+
+	// the tables are written last, so that the chunk is never found
+	// pointing at sectors not yet written
+	var table [4]byte
+	self.locations[i] = uint32(offset)<<8 | uint32(sectors)
+	binary.BigEndian.PutUint32(table[:], self.locations[i])
+	if _, err := self.w.WriteAt(table[:], int64(i*4)); err != nil {
+		return err
+	}
+	self.timestamps[i] = uint32(time.Now().Unix())
+	binary.BigEndian.PutUint32(table[:], self.timestamps[i])
+	if _, err := self.w.WriteAt(table[:], SectorSize+int64(i*4)); err != nil {
+		return err
+	}
+	if external {
+		if err := os.Remove(self.external_path(x, z)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package nbt
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Schema describes the shape a value must have, for rejecting malformed
+// documents such as player supplied item NBT. The zero Schema accepts
+// anything.
+type Schema struct {
+	// Required tag type, or TagEnd for any.
+	Type TagType
+
+	// Entries of a compound. Entries that are present are checked against
+	// their schema; those named in Required must be present. Entries not in
+	// Fields are allowed unless DisallowUnknown is set.
+	Fields          map[string]*Schema
+	Required        []string
+	DisallowUnknown bool
+
+	// Schema of the elements of a list. Its Type, if set, is the element type
+	// the list must have, unless the list is empty.
+	Elem *Schema
+
+	// Inclusive bounds of a number, or of every element of an array.
+	Range *Range
+
+	// Maximum length of a string in bytes, or of a list or array, or 0 for
+	// no limit.
+	MaxLen int
+
+	// Additional check of the value, which is a plain value as returned by
+	// Get.
+	Check func(v interface{}) error
+}
+
+// Range is an inclusive range of numbers.
+type Range struct {
+	Min, Max float64
+}
+
+// Violation is a place where a value does not match its schema.
+type Violation struct {
+	Path    Path
+	Message string
+}
+
+func (self Violation) String() string {
+	return fmt.Sprintf("%v: %s", self.Path, self.Message)
+}
+
+// ValidationError lists every violation found by Validate, ordered by path.
+type ValidationError []Violation
+
+func (self ValidationError) Error() string {
+	s := make([]string, len(self))
+	for i, v := range self {
+		s[i] = v.String()
+	}
+	return "nbt: schema violated: " + strings.Join(s, "; ")
+}
+
+// Checks the compound against a schema and returns a ValidationError
+// listing every violation, or nil if there is none.
+func (self *Compound) Validate(s *Schema) error {
+	var violations ValidationError
+	validate(nil, self, s, &violations)
+	if len(violations) == 0 {
+		return nil
+	}
+	sort.SliceStable(violations, func(i, j int) bool {
+		return violations[i].Path.String() < violations[j].Path.String()
+	})
+	return violations
+}
+
+func validate(path Path, v interface{}, s *Schema, violations *ValidationError) {
+	fail := func(p Path, format string, args ...interface{}) {
+		*violations = append(*violations, Violation{p, fmt.Sprintf(format, args...)})
+	}
+	v = unbox(v)
+	tag := TypeOf(v)
+	if s.Type != TagEnd && tag != s.Type {
+		fail(path, "is %v, expected %v", tag, s.Type)
+		return
+	}
+
+	if s.Range != nil {
+		check_range := func(p Path, n Number) {
+			if f := n.Float64(); f < s.Range.Min || f > s.Range.Max {
+				fail(p, "%v is out of range [%v, %v]", n, s.Range.Min, s.Range.Max)
+			}
+		}
+		switch v.(type) {
+		case []int8, []int32, []int64:
+			items := reflect.ValueOf(v)
+			for i := 0; i < items.Len(); i++ {
+				n, _ := NumberOf(items.Index(i).Interface())
+				check_range(append(path[:len(path):len(path)], PathElem{Index: i, IsIndex: true}), n)
+			}
+		default:
+			if n, ok := NumberOf(v); ok {
+				check_range(path, n)
+			}
+		}
+	}
+
+	if s.MaxLen > 0 {
+		n := -1
+		switch v := v.(type) {
+		case string:
+			n = len(v)
+		case *List:
+			n = v.Len()
+		case []int8, []int32, []int64:
+			n = reflect.ValueOf(v).Len()
+		}
+		if n > s.MaxLen {
+			fail(path, "length %d exceeds %d", n, s.MaxLen)
+		}
+	}
+
+	switch v := v.(type) {
+	case *Compound:
+		for _, k := range s.Required {
+			if _, ok := v.data[k]; !ok {
+				fail(append(path[:len(path):len(path)], PathElem{Key: k}), "is missing")
+			}
+		}
+		for _, k := range v.sorted_keys() {
+			p := append(path[:len(path):len(path)], PathElem{Key: k})
+			child, ok := s.Fields[k]
+			switch {
+			case ok:
+				validate(p, v.data[k].value(), child, violations)
+			case s.DisallowUnknown:
+				fail(p, "is not allowed")
+			}
+		}
+
+	case *List:
+		if s.Elem == nil {
+			break
+		}
+		if s.Elem.Type != TagEnd && v.Len() > 0 && !v.IsMixed() && v.list_type != s.Elem.Type {
+			fail(path, "is a list of %v, expected %v", v.list_type, s.Elem.Type)
+			break
+		}
+		for i, item := range v.items() {
+			validate(append(path[:len(path):len(path)], PathElem{Index: i, IsIndex: true}), item, s.Elem, violations)
+		}
+	}
+
+	if s.Check != nil {
+		if err := s.Check(v); err != nil {
+			fail(path, "%v", err)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package nbt
+
+// Returns the compound's contents as plain Go values, for feeding into
+// text/template, JSON encoders or scripting layers. Integers of every size
+// become int64, floats become float64, strings stay strings, byte arrays
+// become []byte, lists and the other arrays become []interface{}, and
+// compounds become map[string]interface{}. Values of extension tags are
+// kept as their handler decoded them.
+func (self *Compound) Simplify() map[string]interface{} {
+	m := make(map[string]interface{}, len(self.data))
+	for k, v := range self.data {
+		m[k] = simplify(v.value())
+	}
+	return m
+}
+
+func simplify(v interface{}) interface{} {
+	switch v := v.(type) {
+	case int8:
+		return int64(v)
+	case int16:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case int64:
+		return v
+	case float32:
+		return float64(v)
+	case float64:
+		return v
+	case string:
+		return v
+	case []int8:
+		b := make([]byte, len(v))
+		for i, n := range v {
+			b[i] = byte(n)
+		}
+		return b
+	case []int32:
+		s := make([]interface{}, len(v))
+		for i, n := range v {
+			s[i] = int64(n)
+		}
+		return s
+	case []int64:
+		s := make([]interface{}, len(v))
+		for i, n := range v {
+			s[i] = n
+		}
+		return s
+	case *List:
+		items := v.items()
+		s := make([]interface{}, len(items))
+		for i, item := range items {
+			s[i] = simplify(item)
+		}
+		return s
+	case *Compound:
+		return v.Simplify()
+	case Extension:
+		return v.Value
+	}
+	return v
+}
@@ -0,0 +1,513 @@
+package nbt
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// SNBTSyntaxError describes malformed SNBT text.
+type SNBTSyntaxError struct {
+	msg    string
+	Offset int64 // byte offset in the input where the error was detected
+
+	// Position of the error, both counted from 1, with the column in
+	// characters, and the text of its line around it.
+	Line, Column int
+	Snippet      string
+}
+
+func (self *SNBTSyntaxError) Error() string {
+	return fmt.Sprintf("SNBT syntax error at line %d, column %d: %s, near %q",
+		self.Line, self.Column, self.msg, self.Snippet)
+}
+
+// SNBTOptions control how SNBT text is read and written. The zero value
+// reads and writes it the way the game does.
+type SNBTOptions struct {
+	// Types of numbers without a suffix: integers are ints and decimals
+	// doubles if these are TagEnd. IntType may be any number type, so
+	// that TagLong or TagDouble read integers as JSON would; FloatType may
+	// be TagFloat or TagDouble.
+	IntType, FloatType TagType
+
+	// Read integers without a suffix that are out of range for IntType as
+	// the next larger type they fit, up to longs and then doubles, rather
+	// than as strings.
+	PromoteOverflow bool
+
+	// Reject numbers without a suffix, except integers read as ints, and
+	// words that read as numbers but are out of range for their type,
+	// instead of taking them as strings. Unsuffixed elements of byte and
+	// long arrays are rejected as well.
+	Strict bool
+
+	// Read SNBT as forgiving tools do: allow a comma after the last entry
+	// of a compound, list or array, unquoted strings with any characters
+	// but whitespace, quotes and punctuation, and resource locations such
+	// as minecraft:stone unquoted, and read lists with elements of more
+	// than one type as mixed lists, as the game does since 1.21.5.
+	Lenient bool
+
+	// Write control characters in strings with escapes such as \n, and
+	// characters outside of ASCII as \uXXXX, so that the text survives
+	// tools and command blocks that mangle them.
+	EscapeUnicode bool
+
+	// Quote every key, rather than only keys that cannot be written as a
+	// bare word.
+	QuoteKeys bool
+
+	// Quote strings in single quotes, unless they contain single quotes but
+	// no double quotes, rather than the other way around.
+	SingleQuotes bool
+
+	// Write floats and doubles without an exponent, as 0.000001f rather
+	// than 1e-06f, for readers that do not take exponents. Either way they
+	// are written with the fewest digits that read back as the same value.
+	FixedFloats bool
+
+	// What to do with floats and doubles that are NaN or infinite, which
+	// the game can neither write nor read back. With NonFiniteLiteral,
+	// Parse reads the literals written back as floats and doubles too,
+	// rather than as strings.
+	NonFinite NonFinite
+}
+
+// How much text around an error its snippet shows at most, on each side.
+const snbt_snippet_context = 20
+
+func snbt_error(src []byte, offset int, msg string) *SNBTSyntaxError {
+	err := &SNBTSyntaxError{msg: msg, Offset: int64(offset), Line: 1}
+	start := 0
+	for i := 0; i < offset && i < len(src); i++ {
+		if src[i] == '\n' {
+			err.Line++
+			start = i + 1
+		}
+	}
+	err.Column = utf8.RuneCount(src[start:offset]) + 1
+
+	end := bytes.IndexByte(src[offset:], '\n')
+	if end < 0 {
+		end = len(src)
+	} else {
+		end += offset
+	}
+	from, to := start, end
+	if offset-from > snbt_snippet_context {
+		from = offset - snbt_snippet_context
+		for from < offset && !utf8.RuneStart(src[from]) {
+			from++
+		}
+	}
+	if to-offset > snbt_snippet_context {
+		to = offset + snbt_snippet_context
+		for to > offset && !utf8.RuneStart(src[to]) {
+			to--
+		}
+	}
+	err.Snippet = strings.TrimRight(string(src[from:to]), "\r")
+	return err
+}
+
+// Appends to dst the SNBT text in src with insignificant whitespace removed.
+// Whitespace inside quoted strings is kept as is.
+func CompactSNBT(dst *bytes.Buffer, src []byte) error {
+	return format_snbt(dst, src, false, "", "")
+}
+
+// Appends to dst an indented form of the SNBT text in src. Each entry of a
+// compound or list begins on a new line starting with prefix followed by one
+// or more copies of indent according to the nesting depth. Typed arrays such
+// as [I; 1, 2, 3] are kept on a single line. Like encoding/json's Indent, the
+// text appended to dst does not begin with the prefix nor any indentation.
+func IndentSNBT(dst *bytes.Buffer, src []byte, prefix, indent string) error {
+	return format_snbt(dst, src, true, prefix, indent)
+}
+
+// What the formatter last emitted, which decides what may legally follow.
+const (
+	snbt_expect_value = iota // nothing yet, or an opening bracket, ',', ':' or ';'
+	snbt_after_bare          // an unquoted word such as a key, number or boolean
+	snbt_after_string        // a quoted string
+	snbt_after_close         // a closing bracket
+)
+
+// Container kinds on the formatter's stack.
+const (
+	snbt_compound = '{'
+	snbt_list     = '['
+	snbt_array    = 'A'
+)
+
+// Rewrites the SNBT in src token by token without building a tree. Only as
+// much syntax is checked as is needed to reformat safely: brackets must
+// balance and match, strings must be terminated, and tokens must be
+// separated by punctuation.
+func format_snbt(dst *bytes.Buffer, src []byte, pretty bool, prefix, indent string) error {
+	orig := dst.Len()
+	fail := func(i int, format string, args ...interface{}) error {
+		dst.Truncate(orig)
+		return snbt_error(src, i, fmt.Sprintf(format, args...))
+	}
+
+	var stack []byte
+	last := snbt_expect_value
+	opened := false // the last token opened a container
+
+	newline := func(depth int) {
+		dst.WriteByte('\n')
+		dst.WriteString(prefix)
+		dst.WriteString(strings.Repeat(indent, depth))
+	}
+	// Called before every token that begins a value or key.
+	begin := func() {
+		if pretty && opened && stack[len(stack)-1] != snbt_array {
+			newline(len(stack))
+		}
+		opened = false
+	}
+
+	scanner := NewSNBTScanner(src)
+	for {
+		tok, err := scanner.Scan()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			dst.Truncate(orig)
+			return err
+		}
+		i, c := tok.Offset, tok.Text[0]
+
+		switch tok.Kind {
+		case SNBTWord, SNBTString:
+			if last != snbt_expect_value {
+				return fail(i, "unexpected %q after a complete value", c)
+			}
+			begin()
+			dst.Write(tok.Text)
+			last = snbt_after_bare
+			if tok.Kind == SNBTString {
+				last = snbt_after_string
+			}
+
+		case SNBTCompoundStart, SNBTListStart, SNBTArrayStart:
+			if last != snbt_expect_value {
+				return fail(i, "unexpected %q after a complete value", c)
+			}
+			begin()
+			dst.WriteByte(c)
+			kind := c
+			if tok.Kind == SNBTArrayStart {
+				dst.WriteByte(tok.Text[bytes.IndexAny(tok.Text, "BIL")])
+				dst.WriteByte(';')
+				if pretty {
+					dst.WriteByte(' ')
+				}
+				kind = snbt_array
+			}
+			stack = append(stack, kind)
+			last = snbt_expect_value
+			opened = true
+
+		case SNBTCompoundEnd, SNBTListEnd:
+			if len(stack) == 0 {
+				return fail(i, "unexpected %q outside of any compound or list", c)
+			}
+			kind := stack[len(stack)-1]
+			if (c == '}') != (kind == snbt_compound) {
+				return fail(i, "mismatched %q", c)
+			}
+			if last == snbt_expect_value && !opened {
+				return fail(i, "expected a value before %q", c)
+			}
+			stack = stack[:len(stack)-1]
+			if kind == snbt_array && pretty && opened {
+				// drop the space written after the "[I;" header
+				dst.Truncate(dst.Len() - 1)
+			}
+			if pretty && !opened && kind != snbt_array {
+				newline(len(stack))
+			}
+			dst.WriteByte(c)
+			last = snbt_after_close
+			opened = false
+
+		case SNBTComma:
+			if len(stack) == 0 || last == snbt_expect_value {
+				return fail(i, "unexpected ','")
+			}
+			dst.WriteByte(c)
+			if pretty {
+				if stack[len(stack)-1] == snbt_array {
+					dst.WriteByte(' ')
+				} else {
+					newline(len(stack))
+				}
+			}
+			last = snbt_expect_value
+
+		case SNBTColon:
+			if len(stack) == 0 || stack[len(stack)-1] != snbt_compound || last == snbt_expect_value {
+				return fail(i, "unexpected ':'")
+			}
+			dst.WriteByte(c)
+			if pretty {
+				dst.WriteByte(' ')
+			}
+			last = snbt_expect_value
+		}
+	}
+
+	if len(stack) > 0 {
+		return fail(len(src), "unexpected end of input inside %d open containers", len(stack))
+	}
+	if last == snbt_expect_value {
+		return fail(len(src), "unexpected end of input")
+	}
+	return nil
+}
+
+// Looks for the "B;", "I;" or "L;" header of a typed array starting at i,
+// allowing whitespace around the type letter. Returns the index of the type
+// letter and of the semicolon following it.
+func snbt_array_header(src []byte, i int) (int, int, bool) {
+	i = snbt_skip_space(src, i)
+	if i >= len(src) {
+		return 0, 0, false
+	}
+	switch src[i] {
+	case 'B', 'I', 'L':
+	default:
+		return 0, 0, false
+	}
+	j := snbt_skip_space(src, i+1)
+	if j >= len(src) || src[j] != ';' {
+		return 0, 0, false
+	}
+	return i, j, true
+}
+
+func snbt_skip_space(src []byte, i int) int {
+	for i < len(src) && is_snbt_space(src[i]) {
+		i++
+	}
+	return i
+}
+
+func is_snbt_space(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// Reports whether c may appear in an unquoted SNBT string or number.
+func is_snbt_bare(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' ||
+		c == '_' || c == '-' || c == '.' || c == '+'
+}
+
+// Encodes a value as SNBT (stringified NBT), the text format used in
+// Minecraft commands, in its compact form. v may be a *Compound, a *List or
+// any value stored in one. Compound entries are written in key order. Use
+// IndentSNBT on the result for a multi-line form.
+func MarshalSNBT(v interface{}) ([]byte, error) {
+	return SNBTOptions{}.Marshal(v)
+}
+
+// Encodes a value as MarshalSNBT does, with strings and keys quoted as the
+// options say.
+func (self SNBTOptions) Marshal(v interface{}) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	if err := self.write(buf, v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (self *SNBTOptions) write(buf *bytes.Buffer, v interface{}) error {
+	switch v := unbox(v).(type) {
+	case int8:
+		buf.WriteString(strconv.FormatInt(int64(v), 10))
+		buf.WriteByte('b')
+	case int16:
+		buf.WriteString(strconv.FormatInt(int64(v), 10))
+		buf.WriteByte('s')
+	case int32:
+		buf.WriteString(strconv.FormatInt(int64(v), 10))
+	case int64:
+		buf.WriteString(strconv.FormatInt(v, 10))
+		buf.WriteByte('L')
+	case float32:
+		if err := self.write_float(buf, float64(v), TagFloat); err != nil {
+			return err
+		}
+	case float64:
+		if err := self.write_float(buf, v, TagDouble); err != nil {
+			return err
+		}
+	case string:
+		buf.WriteString(self.quote(v))
+
+	case []int8:
+		buf.WriteString("[B;")
+		for i, n := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.WriteString(strconv.FormatInt(int64(n), 10))
+			buf.WriteByte('b')
+		}
+		buf.WriteByte(']')
+	case []int32:
+		buf.WriteString("[I;")
+		for i, n := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.WriteString(strconv.FormatInt(int64(n), 10))
+		}
+		buf.WriteByte(']')
+	case []int64:
+		buf.WriteString("[L;")
+		for i, n := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.WriteString(strconv.FormatInt(n, 10))
+			buf.WriteByte('L')
+		}
+		buf.WriteByte(']')
+
+	case *List:
+		buf.WriteByte('[')
+		for i, item := range v.items() {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := self.write(buf, item); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+
+	case *Compound:
+		buf.WriteByte('{')
+		for i, k := range v.sorted_keys() {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if snbt_bare(k) && !self.QuoteKeys {
+				buf.WriteString(k)
+			} else {
+				buf.WriteString(self.quote(k))
+			}
+			buf.WriteByte(':')
+			if err := self.write(buf, v.data[k].value()); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+
+	default:
+		return fmt.Errorf("Cannot encode %T as SNBT", v)
+	}
+	return nil
+}
+
+func (self *SNBTOptions) write_float(buf *bytes.Buffer, f float64, tag TagType) error {
+	f, literal, err := self.NonFinite.apply(f, tag, "SNBT")
+	if err != nil {
+		return err
+	}
+	suffix, bits := byte('d'), 64
+	if tag == TagFloat {
+		suffix, bits = 'f', 32
+	}
+	if literal == "" {
+		literal = snbt_float(f, bits, self.FixedFloats)
+	}
+	buf.WriteString(literal)
+	buf.WriteByte(suffix)
+	return nil
+}
+
+// Formats a floating point number so that it reads back as the same value
+// of the given bit size, in fixed notation if fixed is set. SNBT needs a
+// decimal point in every floating point literal, so one is added where
+// strconv leaves it out.
+func snbt_float(f float64, bits int, fixed bool) string {
+	format := byte('g')
+	if fixed {
+		format = 'f'
+	}
+	s := strconv.FormatFloat(f, format, -1, bits)
+	if strings.ContainsAny(s, ".IN") {
+		return s
+	}
+	if i := strings.IndexByte(s, 'e'); i >= 0 {
+		return s[:i] + ".0" + s[i:]
+	}
+	return s + ".0"
+}
+
+// Quotes a string the way Minecraft does: in double quotes, unless the string
+// contains double quotes but no single quotes, or the other way around with
+// SingleQuotes.
+func (self *SNBTOptions) quote(s string) string {
+	quote, other := byte('"'), byte('\'')
+	if self.SingleQuotes {
+		quote, other = other, quote
+	}
+	if strings.IndexByte(s, quote) >= 0 && strings.IndexByte(s, other) < 0 {
+		quote = other
+	}
+	buf := make([]byte, 0, len(s)+2)
+	buf = append(buf, quote)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == quote || c == '\\':
+			buf = append(buf, '\\', c)
+		case !self.EscapeUnicode:
+			buf = append(buf, c)
+		case c < ' ' || c == 0x7f:
+			if e := strings.IndexByte(snbt_escapes, c); e >= 0 && e%2 == 1 {
+				buf = append(buf, '\\', snbt_escapes[e-1])
+			} else {
+				buf = append(buf, fmt.Sprintf("\\u%04x", c)...)
+			}
+		case c < utf8.RuneSelf:
+			buf = append(buf, c)
+		default:
+			r, size := utf8.DecodeRuneInString(s[i:])
+			if r1, r2 := utf16.EncodeRune(r); r1 != utf8.RuneError {
+				buf = append(buf, fmt.Sprintf("\\u%04x\\u%04x", r1, r2)...)
+			} else {
+				buf = append(buf, fmt.Sprintf("\\u%04x", r)...)
+			}
+			i += size - 1
+		}
+	}
+	return string(append(buf, quote))
+}
+
+// Escapes of single characters, each followed by the character it stands
+// for.
+const snbt_escapes = "b\bf\fn\nr\rt\ts "
+
+// Reports whether s can be written as an unquoted key.
+func snbt_bare(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !is_snbt_bare(s[i]) {
+			return false
+		}
+	}
+	return true
+}
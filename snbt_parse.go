@@ -0,0 +1,593 @@
+package nbt
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// How deeply compounds and lists may nest in SNBT, as in the game.
+const snbt_max_depth = 512
+
+// Decodes SNBT text, as written by MarshalSNBT or in Minecraft commands,
+// returning the value it holds as Compound.Get would: a *Compound, a *List
+// or a plain value.
+//
+// Numbers are typed by their suffix: b, s, L, f and d for bytes, shorts,
+// longs, floats and doubles, in either case. Numbers without one are ints,
+// or doubles if they have a decimal point or exponent; true and false are
+// the bytes 1 and 0. Other unquoted words, including numbers out of range
+// for their type, are strings, as they are to the game. Typed arrays such
+// as [B; 1b, -2b] hold numbers of their own type, with or without its
+// suffix. Quoted strings may hold the escapes the game reads, such as \n
+// and \u00e9.
+func ParseSNBT(data []byte) (interface{}, error) {
+	return SNBTOptions{}.Parse(data)
+}
+
+// Decodes SNBT text as ParseSNBT does, with numbers typed as the options
+// say.
+func (self SNBTOptions) Parse(data []byte) (interface{}, error) {
+	p, err := self.new_parser(data)
+	if err != nil {
+		return nil, err
+	}
+	v, err := p.value("", nil)
+	if err != nil {
+		return nil, err
+	}
+	if !p.eof {
+		return nil, p.fail("unexpected %s after the value", p.tok.Kind)
+	}
+	return v, nil
+}
+
+// Decodes the SNBT value at the start of s, as ParseSNBT does, and returns
+// the text after it, whitespace included, without looking at it further,
+// for parsers of command arguments such as the count after the item in
+// /give @p stone{Damage:1} 3.
+func ParseSNBTPrefix(s string) (interface{}, string, error) {
+	return SNBTOptions{}.ParsePrefix(s)
+}
+
+// Decodes the SNBT value at the start of s as ParseSNBTPrefix does, with
+// numbers typed as the options say.
+func (self SNBTOptions) ParsePrefix(s string) (interface{}, string, error) {
+	p, err := self.new_parser([]byte(s))
+	if err != nil {
+		return nil, "", err
+	}
+	p.prefix = true
+	v, err := p.value("", nil)
+	if err != nil {
+		return nil, "", err
+	}
+	return v, s[p.end:], nil
+}
+
+func (self SNBTOptions) new_parser(data []byte) (*snbt_parser, error) {
+	p := &snbt_parser{scanner: NewSNBTScanner(data), src: data, opts: self, int_type: TagInt, float_type: TagDouble}
+	p.scanner.Lenient = self.Lenient
+	if self.IntType != TagEnd {
+		if fixed_size(self.IntType) == 0 {
+			return nil, fmt.Errorf("SNBTOptions: IntType %v is not a number type", self.IntType)
+		}
+		p.int_type = self.IntType
+	}
+	if self.FloatType != TagEnd {
+		if self.FloatType != TagFloat && self.FloatType != TagDouble {
+			return nil, fmt.Errorf("SNBTOptions: FloatType %v is not TagFloat or TagDouble", self.FloatType)
+		}
+		p.float_type = self.FloatType
+	}
+	return p, p.advance()
+}
+
+type snbt_parser struct {
+	scanner *SNBTScanner
+	src     []byte
+
+	opts                 SNBTOptions
+	int_type, float_type TagType
+
+	// The next token, unless at the end of the input.
+	tok SNBTToken
+	eof bool
+
+	// The offset just past the last token consumed.
+	end int
+
+	depth int
+
+	// Set when parsing a prefix of the input, whose text after the value
+	// need not be SNBT.
+	prefix bool
+}
+
+func (self *snbt_parser) advance() error {
+	if !self.eof {
+		self.end = self.tok.Offset + len(self.tok.Text)
+	}
+	tok, err := self.scanner.Scan()
+	if err == io.EOF || err != nil && self.prefix && self.depth == 0 {
+		self.tok, self.eof = SNBTToken{Offset: len(self.src)}, true
+		return nil
+	}
+	self.tok = tok
+	return err
+}
+
+func (self *snbt_parser) fail(format string, args ...interface{}) error {
+	if self.eof {
+		return snbt_error(self.src, len(self.src), "unexpected end of input")
+	}
+	return snbt_error(self.src, self.tok.Offset, fmt.Sprintf(format, args...))
+}
+
+// Expects and consumes a token of the given kind.
+func (self *snbt_parser) expect(kind SNBTTokenKind) error {
+	if self.eof || self.tok.Kind != kind {
+		return self.fail("expected %v, found %v", kind, self.tok.Kind)
+	}
+	return self.advance()
+}
+
+// Reports whether a comma just read is followed by the end of its
+// compound, list or array, which only Lenient allows.
+func (self *snbt_parser) trailing_comma(end SNBTTokenKind) bool {
+	return self.opts.Lenient && !self.eof && self.tok.Kind == end
+}
+
+func (self *snbt_parser) enter() error {
+	if self.depth++; self.depth > snbt_max_depth {
+		return self.fail("compounds and lists nested more than %d deep", snbt_max_depth)
+	}
+	return nil
+}
+
+func (self *snbt_parser) value(name string, parent *Compound) (interface{}, error) {
+	if self.eof {
+		return nil, self.fail("")
+	}
+	switch self.tok.Kind {
+	case SNBTWord:
+		start, end := self.tok.Offset, self.tok.Offset+len(self.tok.Text)
+		if err := self.advance(); err != nil {
+			return nil, err
+		}
+		// resource locations such as minecraft:stone
+		for self.opts.Lenient && !self.eof && self.tok.Offset == end &&
+			(self.tok.Kind == SNBTColon || self.tok.Kind == SNBTWord) {
+			end += len(self.tok.Text)
+			if err := self.advance(); err != nil {
+				return nil, err
+			}
+		}
+		return self.word(string(self.src[start:end]), start)
+
+	case SNBTString:
+		s, err := self.unquote()
+		if err != nil {
+			return nil, err
+		}
+		return s, self.advance()
+
+	case SNBTCompoundStart:
+		return self.compound(name, parent)
+	case SNBTListStart:
+		return self.list(name)
+	case SNBTArrayStart:
+		return self.array()
+	}
+	return nil, self.fail("expected a value, found %v", self.tok.Kind)
+}
+
+func (self *snbt_parser) compound(name string, parent *Compound) (*Compound, error) {
+	if err := self.enter(); err != nil {
+		return nil, err
+	}
+	c := &Compound{parent: parent, name: name, data: make(map[string]entry)}
+	if err := self.advance(); err != nil {
+		return nil, err
+	}
+	for first := true; self.eof || self.tok.Kind != SNBTCompoundEnd; first = false {
+		if !first {
+			if err := self.expect(SNBTComma); err != nil {
+				return nil, err
+			}
+			if self.trailing_comma(SNBTCompoundEnd) {
+				break
+			}
+		}
+
+		var key string
+		switch {
+		case self.eof:
+			return nil, self.fail("")
+		case self.tok.Kind == SNBTWord:
+			key = string(self.tok.Text)
+		case self.tok.Kind == SNBTString:
+			s, err := self.unquote()
+			if err != nil {
+				return nil, err
+			}
+			key = s
+		default:
+			return nil, self.fail("expected a key, found %v", self.tok.Kind)
+		}
+		if err := self.advance(); err != nil {
+			return nil, err
+		}
+		if err := self.expect(SNBTColon); err != nil {
+			return nil, err
+		}
+		v, err := self.value(key, c)
+		if err != nil {
+			return nil, err
+		}
+		c.data[key] = c.hold(v)
+	}
+	self.depth--
+	return c, self.advance()
+}
+
+func (self *snbt_parser) list(name string) (*List, error) {
+	if err := self.enter(); err != nil {
+		return nil, err
+	}
+	if err := self.advance(); err != nil {
+		return nil, err
+	}
+	var items []interface{}
+	elem := TagEnd
+	mixed := false
+	for first := true; self.eof || self.tok.Kind != SNBTListEnd; first = false {
+		if !first {
+			if err := self.expect(SNBTComma); err != nil {
+				return nil, err
+			}
+			if self.trailing_comma(SNBTListEnd) {
+				break
+			}
+		}
+		start := self.tok
+		v, err := self.value("", nil)
+		if err != nil {
+			return nil, err
+		}
+		tag, _ := tag_of(v)
+		switch {
+		case elem == TagEnd:
+			elem = tag
+		case tag == elem:
+		case self.opts.Lenient:
+			mixed = true
+		default:
+			return nil, snbt_error(self.src, start.Offset, fmt.Sprintf("%v in a list of %v", tag, elem))
+		}
+		items = append(items, v)
+	}
+	self.depth--
+	if mixed {
+		list := &List{name: name, list_type: TagCompound, data: items, length: int32(len(items))}
+		return list, self.advance()
+	}
+	list, err := new_list(name, elem, items)
+	if err != nil {
+		return nil, err
+	}
+	return list, self.advance()
+}
+
+func (self *snbt_parser) array() (interface{}, error) {
+	header := self.tok.Text
+	var tag TagType
+	switch header[bytes.IndexAny(header, "BIL")] {
+	case 'B':
+		tag = TagByteArray
+	case 'I':
+		tag = TagIntArray
+	default:
+		tag = TagLongArray
+	}
+	elem := array_elem(tag)
+	if err := self.enter(); err != nil {
+		return nil, err
+	}
+	if err := self.advance(); err != nil {
+		return nil, err
+	}
+
+	var byte_items []int8
+	var int_items []int32
+	var long_items []int64
+	for first := true; self.eof || self.tok.Kind != SNBTListEnd; first = false {
+		if !first {
+			if err := self.expect(SNBTComma); err != nil {
+				return nil, err
+			}
+			if self.trailing_comma(SNBTListEnd) {
+				break
+			}
+		}
+		if self.eof || self.tok.Kind != SNBTWord {
+			return nil, self.fail("expected a number, found %v", self.tok.Kind)
+		}
+		word := string(self.tok.Text)
+		var v interface{}
+		if _, ok := snbt_suffixes[word[len(word)-1]|0x20]; !ok && is_snbt_number(word) {
+			// unsuffixed numbers take the type of the array
+			if self.opts.Strict && elem != TagInt {
+				return nil, self.fail("%s has no type suffix", word)
+			}
+			var ok bool
+			if v, ok = snbt_convert(word, !strings.ContainsAny(word, ".eE"), elem); !ok {
+				return nil, self.fail("%q is not a valid element of %v", word, tag)
+			}
+		} else {
+			var err error
+			if v, err = self.word(word, self.tok.Offset); err != nil {
+				return nil, err
+			}
+		}
+		switch n := v.(type) {
+		case int8:
+			if elem == TagByte {
+				byte_items = append(byte_items, n)
+				break
+			}
+			return nil, self.fail("%v in %v", TagByte, tag)
+		case int32:
+			if elem == TagInt {
+				int_items = append(int_items, n)
+				break
+			}
+			return nil, self.fail("%v in %v", TagInt, tag)
+		case int64:
+			if elem == TagLong {
+				long_items = append(long_items, n)
+				break
+			}
+			return nil, self.fail("%v in %v", TagLong, tag)
+		default:
+			return nil, self.fail("%q is not a valid element of %v", word, tag)
+		}
+		if err := self.advance(); err != nil {
+			return nil, err
+		}
+	}
+	self.depth--
+	if err := self.advance(); err != nil {
+		return nil, err
+	}
+
+	switch tag {
+	case TagByteArray:
+		if byte_items == nil {
+			byte_items = []int8{}
+		}
+		return byte_items, nil
+	case TagIntArray:
+		if int_items == nil {
+			int_items = []int32{}
+		}
+		return int_items, nil
+	}
+	if long_items == nil {
+		long_items = []int64{}
+	}
+	return long_items, nil
+}
+
+// Returns the text of the current token, a quoted string, with its escapes
+// replaced: \\, \" and \', \b, \f, \n, \r, \s for a space and \t, and
+// characters by their code point as \xXX, \uXXXX, with surrogate pairs
+// combined, or \UXXXXXXXX.
+func (self *snbt_parser) unquote() (string, error) {
+	text := self.tok.Text[1 : len(self.tok.Text)-1]
+	if bytes.IndexByte(text, '\\') < 0 {
+		return string(text), nil
+	}
+	buf := make([]byte, 0, len(text))
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		if c != '\\' {
+			buf = append(buf, c)
+			continue
+		}
+		start := i
+		fail := func(format string, args ...interface{}) (string, error) {
+			return "", snbt_error(self.src, self.tok.Offset+1+start, fmt.Sprintf(format, args...))
+		}
+		i++
+		switch c = text[i]; c {
+		case '\\', '"', '\'':
+			buf = append(buf, c)
+			continue
+		case 'x', 'u', 'U':
+		default:
+			e := strings.IndexByte(snbt_escapes, c)
+			if e < 0 || e%2 == 1 {
+				return fail("invalid escape \\%c", c)
+			}
+			buf = append(buf, snbt_escapes[e+1])
+			continue
+		}
+
+		n := map[byte]int{'x': 2, 'u': 4, 'U': 8}[c]
+		r, ok := snbt_hex(text, i+1, n)
+		if !ok {
+			return fail("invalid \\%c escape", c)
+		}
+		i += n
+		if utf16.IsSurrogate(r) {
+			var r2 rune
+			if i+6 < len(text) && text[i+1] == '\\' && text[i+2] == 'u' {
+				r2, _ = snbt_hex(text, i+3, 4)
+			}
+			if r = utf16.DecodeRune(r, r2); r == utf8.RuneError {
+				return fail("unpaired surrogate in %q", text[start:i+1])
+			}
+			i += 6
+		}
+		if !utf8.ValidRune(r) {
+			return fail("invalid code point in %q", text[start:i+1])
+		}
+		buf = utf8.AppendRune(buf, r)
+	}
+	return string(buf), nil
+}
+
+// Reads n hexadecimal digits starting at i.
+func snbt_hex(text []byte, i, n int) (rune, bool) {
+	if i+n > len(text) {
+		return 0, false
+	}
+	v, err := strconv.ParseUint(string(text[i:i+n]), 16, 32)
+	return rune(v), err == nil
+}
+
+// Returns the value of an unquoted word: a number if it reads as one of its
+// type, a boolean as a byte, or else the word itself as a string.
+func (self *snbt_parser) word(word string, offset int) (interface{}, error) {
+	switch word {
+	case "true":
+		return int8(1), nil
+	case "false":
+		return int8(0), nil
+	}
+	if self.opts.NonFinite == NonFiniteLiteral {
+		if v, ok := snbt_non_finite(word); ok {
+			return v, nil
+		}
+	}
+	if !is_snbt_number(word) {
+		return word, nil
+	}
+
+	digits, tag := word, TagEnd
+	if t, ok := snbt_suffixes[word[len(word)-1]|0x20]; ok {
+		digits, tag = word[:len(word)-1], t
+	}
+	integer := !strings.ContainsAny(digits, ".eE")
+
+	var v interface{}
+	var ok bool
+	switch {
+	case tag != TagEnd:
+		v, ok = snbt_convert(digits, integer, tag)
+	case self.opts.Strict && !(integer && self.int_type == TagInt):
+		return nil, snbt_error(self.src, offset, fmt.Sprintf("%s has no type suffix", word))
+	case integer:
+		tag = self.int_type
+		v, ok = snbt_convert(digits, true, tag)
+		for !ok && self.opts.PromoteOverflow && tag != TagDouble {
+			if tag++; tag == TagFloat {
+				tag = TagDouble
+			}
+			v, ok = snbt_convert(digits, true, tag)
+		}
+	default:
+		tag = self.float_type
+		v, ok = snbt_convert(digits, false, tag)
+	}
+	if !ok {
+		if self.opts.Strict {
+			return nil, snbt_error(self.src, offset, fmt.Sprintf("%s does not fit in a %v", word, tag))
+		}
+		return word, nil
+	}
+	return v, nil
+}
+
+// Reads a literal written with NonFiniteLiteral, such as NaNf or
+// -Infinityd.
+func snbt_non_finite(word string) (interface{}, bool) {
+	if len(word) < 2 {
+		return nil, false
+	}
+	f, ok := parse_non_finite(word[:len(word)-1])
+	if !ok {
+		return nil, false
+	}
+	switch word[len(word)-1] | 0x20 {
+	case 'f':
+		return float32(f), true
+	case 'd':
+		return f, true
+	}
+	return nil, false
+}
+
+// Types of numbers by their suffix, in lower case.
+var snbt_suffixes = map[byte]TagType{'b': TagByte, 's': TagShort, 'l': TagLong, 'f': TagFloat, 'd': TagDouble}
+
+// Converts the text of a number to the given type, reporting whether it
+// fits. Decimals only convert to floats and doubles.
+func snbt_convert(digits string, integer bool, tag TagType) (interface{}, bool) {
+	switch tag {
+	case TagFloat:
+		f, err := strconv.ParseFloat(digits, 32)
+		return float32(f), err == nil
+	case TagDouble:
+		f, err := strconv.ParseFloat(digits, 64)
+		return f, err == nil
+	}
+	if !integer {
+		return nil, false
+	}
+	n, err := strconv.ParseInt(digits, 10, 8*int(fixed_size(tag)))
+	if err != nil {
+		return nil, false
+	}
+	switch tag {
+	case TagByte:
+		return int8(n), true
+	case TagShort:
+		return int16(n), true
+	case TagInt:
+		return int32(n), true
+	}
+	return n, true
+}
+
+// Reports whether a word has the form of a number: a sign, digits with an
+// optional decimal point and exponent, and an optional type suffix.
+func is_snbt_number(s string) bool {
+	i := 0
+	if s[i] == '+' || s[i] == '-' {
+		i++
+	}
+	digits := 0
+	for ; i < len(s) && s[i] >= '0' && s[i] <= '9'; i++ {
+		digits++
+	}
+	if i < len(s) && s[i] == '.' {
+		for i++; i < len(s) && s[i] >= '0' && s[i] <= '9'; i++ {
+			digits++
+		}
+	}
+	if digits == 0 {
+		return false
+	}
+	if i < len(s) && (s[i] == 'e' || s[i] == 'E') {
+		i++
+		if i < len(s) && (s[i] == '+' || s[i] == '-') {
+			i++
+		}
+		start := i
+		for ; i < len(s) && s[i] >= '0' && s[i] <= '9'; i++ {
+		}
+		if i == start {
+			return false
+		}
+	}
+	if i == len(s)-1 && strings.IndexByte("bBsSlLfFdD", s[i]) >= 0 {
+		i++
+	}
+	return i == len(s)
+}
@@ -0,0 +1,191 @@
+package nbt
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// SNBTTokenKind is the kind of an SNBTToken.
+type SNBTTokenKind int
+
+const (
+	// An unquoted string, number or boolean, such as Eggbert, 12b or true.
+	SNBTWord SNBTTokenKind = iota
+
+	// A string in single or double quotes.
+	SNBTString
+
+	// The "[B;", "I;" or "L;" opening a typed array, with any whitespace
+	// inside it.
+	SNBTArrayStart
+
+	SNBTCompoundStart // {
+	SNBTCompoundEnd   // }
+	SNBTListStart     // [
+	SNBTListEnd       // ], which also ends typed arrays
+	SNBTComma         // ,
+	SNBTColon         // :
+)
+
+func (self SNBTTokenKind) String() string {
+	switch self {
+	case SNBTWord:
+		return "word"
+	case SNBTString:
+		return "string"
+	case SNBTArrayStart:
+		return "array start"
+	case SNBTCompoundStart:
+		return "'{'"
+	case SNBTCompoundEnd:
+		return "'}'"
+	case SNBTListStart:
+		return "'['"
+	case SNBTListEnd:
+		return "']'"
+	case SNBTComma:
+		return "','"
+	case SNBTColon:
+		return "':'"
+	}
+	return fmt.Sprintf("SNBTTokenKind(%d)", int(self))
+}
+
+// SNBTToken is a token of SNBT text, read by an SNBTScanner.
+type SNBTToken struct {
+	Kind SNBTTokenKind
+
+	// The token as it appears in the input, quotes and escapes included.
+	// It shares memory with the input.
+	Text []byte
+
+	// Byte offset of the token in the input, and its line and column,
+	// counted from 1 with the column in characters.
+	Offset       int
+	Line, Column int
+}
+
+// SNBTScanner splits SNBT text into tokens, for editors and linters that
+// highlight or check it without parsing it whole. It only checks that each
+// token is well formed; whether the tokens make up a valid document is up
+// to its user.
+type SNBTScanner struct {
+	// Lets words hold any character but whitespace, quotes and the
+	// punctuation of SNBT, as in the messy SNBT pasted from other tools,
+	// rather than only letters, digits and _-.+
+	Lenient bool
+
+	src []byte
+	pos int
+
+	// Line of pos and the offset that line starts at.
+	line, line_start int
+
+	err error
+}
+
+// Returns a scanner reading the tokens of src.
+func NewSNBTScanner(src []byte) *SNBTScanner {
+	return &SNBTScanner{src: src, line: 1}
+}
+
+// Returns the next token, or io.EOF after the last one. Malformed tokens,
+// such as unterminated strings or characters SNBT has no use for, are
+// reported as an *SNBTSyntaxError, which every later call returns as well.
+func (self *SNBTScanner) Scan() (SNBTToken, error) {
+	if self.err != nil {
+		return SNBTToken{}, self.err
+	}
+	src := self.src
+	for self.pos < len(src) && is_snbt_space(src[self.pos]) {
+		if src[self.pos] == '\n' {
+			self.line++
+			self.line_start = self.pos + 1
+		}
+		self.pos++
+	}
+	if self.pos >= len(src) {
+		return SNBTToken{}, io.EOF
+	}
+
+	start := self.pos
+	tok := SNBTToken{
+		Offset: start,
+		Line:   self.line,
+		Column: utf8.RuneCount(src[self.line_start:start]) + 1,
+	}
+	end := start + 1
+	switch c := src[start]; {
+	case self.is_word(c):
+		tok.Kind = SNBTWord
+		for end < len(src) && self.is_word(src[end]) {
+			end++
+		}
+
+	case c == '"' || c == '\'':
+		tok.Kind = SNBTString
+		for ; end < len(src) && src[end] != c; end++ {
+			switch src[end] {
+			case '\\':
+				end++
+			case '\n':
+				self.line++
+				self.line_start = end + 1
+			}
+		}
+		if end >= len(src) {
+			return self.fail(start, "unterminated string")
+		}
+		end++
+
+	case c == '[':
+		tok.Kind = SNBTListStart
+		if _, semi, ok := snbt_array_header(src, end); ok {
+			tok.Kind = SNBTArrayStart
+			for i := end; i < semi; i++ {
+				if src[i] == '\n' {
+					self.line++
+					self.line_start = i + 1
+				}
+			}
+			end = semi + 1
+		}
+
+	case c == '{':
+		tok.Kind = SNBTCompoundStart
+	case c == '}':
+		tok.Kind = SNBTCompoundEnd
+	case c == ']':
+		tok.Kind = SNBTListEnd
+	case c == ',':
+		tok.Kind = SNBTComma
+	case c == ':':
+		tok.Kind = SNBTColon
+
+	default:
+		return self.fail(start, "invalid character %q", c)
+	}
+
+	tok.Text = src[start:end:end]
+	self.pos = end
+	return tok, nil
+}
+
+func (self *SNBTScanner) is_word(c byte) bool {
+	if self.Lenient {
+		return c > ' ' && c != 0x7f && strings.IndexByte("\"'{}[],:", c) < 0
+	}
+	return is_snbt_bare(c)
+}
+
+// Returns the offset of the next byte to be scanned.
+func (self *SNBTScanner) Offset() int {
+	return self.pos
+}
+
+func (self *SNBTScanner) fail(i int, format string, args ...interface{}) (SNBTToken, error) {
+	self.err = snbt_error(self.src, i, fmt.Sprintf(format, args...))
+	return SNBTToken{}, self.err
+}
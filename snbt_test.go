@@ -0,0 +1,481 @@
+package nbt
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"strings"
+	"testing"
+)
+
+var snbtFormatTests = []struct {
+	in, compact, indented string
+}{
+	{`1b`, `1b`, `1b`},
+	{` { } `, `{}`, `{}`},
+	{`[I; ]`, `[I;]`, `[I;]`},
+	{
+		"{name: \"Eggbert\", value :0.5f, 'odd key': [ 1L , 2L ], ids: [ I ; 1, -2 ], e: []}",
+		`{name:"Eggbert",value:0.5f,'odd key':[1L,2L],ids:[I;1,-2],e:[]}`,
+		`{
+>  name: "Eggbert",
+>  value: 0.5f,
+>  'odd key': [
+>    1L,
+>    2L
+>  ],
+>  ids: [I; 1, -2],
+>  e: []
+>}`,
+	},
+	{`["a \" b", 'c']`, `["a \" b",'c']`, "[\n>  \"a \\\" b\",\n>  'c'\n>]"},
+}
+
+func TestCompactIndentSNBT(t *testing.T) {
+	for _, test := range snbtFormatTests {
+		buf := new(bytes.Buffer)
+		if err := CompactSNBT(buf, []byte(test.in)); err != nil {
+			t.Errorf("CompactSNBT(%q): %v", test.in, err)
+		} else if buf.String() != test.compact {
+			t.Errorf("CompactSNBT(%q):\nexpected %s\ngot      %s", test.in, test.compact, buf)
+		}
+
+		buf.Reset()
+		if err := IndentSNBT(buf, []byte(test.in), ">", "  "); err != nil {
+			t.Errorf("IndentSNBT(%q): %v", test.in, err)
+		} else if buf.String() != test.indented {
+			t.Errorf("IndentSNBT(%q):\nexpected %s\ngot      %s", test.in, test.indented, buf)
+		}
+	}
+
+	for _, in := range []string{``, `{`, `{a:1}}`, `[1 2]`, `{a:[1,]}`, `"abc`, `{a:1]`, `{a:1}{}`, `{a::1}`, `[a:1]`, `{a:%}`} {
+		buf := bytes.NewBufferString("keep")
+		if err := CompactSNBT(buf, []byte(in)); err == nil {
+			t.Errorf("CompactSNBT(%q): expected an error, got %s", in, buf)
+		} else if buf.String() != "keep" {
+			t.Errorf("CompactSNBT(%q): dst modified on error", in)
+		}
+	}
+}
+
+func TestSNBTSyntaxErrorPosition(t *testing.T) {
+	in := "{\n  name: \"Grüße\",\n  pos: [1, 2 3],\n}"
+	err := CompactSNBT(new(bytes.Buffer), []byte(in))
+	serr, ok := err.(*SNBTSyntaxError)
+	if !ok {
+		t.Fatalf("CompactSNBT: expected an SNBTSyntaxError, got %v", err)
+	}
+	if serr.Line != 3 || serr.Column != 14 || serr.Snippet != "  pos: [1, 2 3]," || serr.Offset != int64(strings.Index(in, "3]")) {
+		t.Errorf("CompactSNBT: error at %d:%d (offset %d) near %q", serr.Line, serr.Column, serr.Offset, serr.Snippet)
+	}
+
+	in = `{a:1, long_key_number_one: 1, long_key_number_two: 2 % more and more text after it}`
+	serr = CompactSNBT(new(bytes.Buffer), []byte(in)).(*SNBTSyntaxError)
+	if serr.Line != 1 || serr.Snippet != "g_key_number_two: 2 % more and more text" {
+		t.Errorf("CompactSNBT: error at %d:%d near %q", serr.Line, serr.Column, serr.Snippet)
+	}
+	if s := serr.Error(); !strings.Contains(s, "line 1, column 54") {
+		t.Errorf("Error: %s", s)
+	}
+}
+
+func TestSNBTScanner(t *testing.T) {
+	in := "{id: \"a\\\"b\",\n  ids:[ I; 1,-2]}"
+	expected := []struct {
+		kind         SNBTTokenKind
+		text         string
+		line, column int
+	}{
+		{SNBTCompoundStart, "{", 1, 1},
+		{SNBTWord, "id", 1, 2},
+		{SNBTColon, ":", 1, 4},
+		{SNBTString, `"a\"b"`, 1, 6},
+		{SNBTComma, ",", 1, 12},
+		{SNBTWord, "ids", 2, 3},
+		{SNBTColon, ":", 2, 6},
+		{SNBTArrayStart, "[ I;", 2, 7},
+		{SNBTWord, "1", 2, 12},
+		{SNBTComma, ",", 2, 13},
+		{SNBTWord, "-2", 2, 14},
+		{SNBTListEnd, "]", 2, 16},
+		{SNBTCompoundEnd, "}", 2, 17},
+	}
+	s := NewSNBTScanner([]byte(in))
+	for _, e := range expected {
+		tok, err := s.Scan()
+		if err != nil {
+			t.Fatalf("Scan: %v", err)
+		}
+		if tok.Kind != e.kind || string(tok.Text) != e.text || tok.Line != e.line || tok.Column != e.column {
+			t.Errorf("Scan: expected %v %q at %d:%d, got %v %q at %d:%d",
+				e.kind, e.text, e.line, e.column, tok.Kind, tok.Text, tok.Line, tok.Column)
+		}
+		if in[tok.Offset:tok.Offset+len(tok.Text)] != string(tok.Text) {
+			t.Errorf("Scan: %q is not at offset %d", tok.Text, tok.Offset)
+		}
+	}
+	if _, err := s.Scan(); err != io.EOF {
+		t.Errorf("Scan: expected io.EOF, got %v", err)
+	}
+
+	// tokens before a malformed one can still be used
+	s = NewSNBTScanner([]byte("[1, %]"))
+	for i := 0; i < 3; i++ {
+		if _, err := s.Scan(); err != nil {
+			t.Fatalf("Scan: %v", err)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := s.Scan(); err == nil {
+			t.Fatal("Scan: expected an error for '%'")
+		} else if serr, ok := err.(*SNBTSyntaxError); !ok || serr.Offset != 4 {
+			t.Errorf("Scan: %v", err)
+		}
+	}
+}
+
+func TestParseSNBT(t *testing.T) {
+	in := `{bytes: [B; 1b, -2B, 3, true], ints: [I;-1, 2147483647], longs:[L; 1L, -9000000000l, 3],
+		empty: [L;], n: 3, d: 1.5, e: 1e3, f: -2.5f, s: 7s, l: 1L, b: false, big: 3000000000, word: minecraft_stone,
+		'a key': "q\"uote", list: [[1, 2], [a, 'b']], c: {x: 1b}}`
+	v, err := ParseSNBT([]byte(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, ok := v.(*Compound)
+	if !ok {
+		t.Fatalf("ParseSNBT: expected a compound, got %T", v)
+	}
+	out, err := MarshalSNBT(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"a key":'q"uote',b:0b,big:"3000000000",bytes:[B;1b,-2b,3b,1b],c:{x:1b},d:1.5d,e:1000.0d,empty:[L;],` +
+		`f:-2.5f,ints:[I;-1,2147483647],l:1L,list:[[1,2],["a","b"]],longs:[L;1L,-9000000000L,3L],n:3,s:7s,word:"minecraft_stone"}`
+	if string(out) != expected {
+		t.Errorf("ParseSNBT:\nexpected %s\ngot      %s", expected, out)
+	}
+	x, _ := c.Get(Path{{Key: "c"}})
+	if x.(*Compound).parent != c {
+		t.Error("ParseSNBT: nested compound has no parent")
+	}
+
+	// list elements are unnamed, as when decoded
+	parsed, err := ParseSNBT([]byte(`{items: [{id: a}], ll: [[{id: b}]]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := parsed.(*Compound).MarshalBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := DecodeBytes(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"items[0]", "ll[0]", "ll[0][0]"} {
+		a, _ := parsed.(*Compound).GetPath(p)
+		b, _ := decoded.GetPath(p)
+		switch a := a.(type) {
+		case *Compound:
+			if a.Name() != "" || a.PathFromRoot().String() != b.(*Compound).PathFromRoot().String() {
+				t.Errorf("ParseSNBT: %s named %q at %v", p, a.Name(), a.PathFromRoot())
+			}
+		case *List:
+			if a.name != b.(*List).name {
+				t.Errorf("ParseSNBT: %s named %q", p, a.name)
+			}
+		}
+	}
+
+	back, err := ParseSNBT(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := MarshalSNBT(back); string(again) != expected {
+		t.Errorf("ParseSNBT: round trip gave %s", again)
+	}
+
+	for _, in := range []string{``, `{`, `{a:1`, `{a 1}`, `[1, 2b]`, `[B; 1L]`, `[I; 1b]`, `[B; 300]`, `[L; a]`, `[B; "1"]`,
+		`{a:1}}`, `[1,]`, `"a\q"`, `1 2`} {
+		if v, err := ParseSNBT([]byte(in)); err == nil {
+			t.Errorf("ParseSNBT(%q): expected an error, got %v", in, v)
+		} else if _, ok := err.(*SNBTSyntaxError); !ok {
+			t.Errorf("ParseSNBT(%q): expected an SNBTSyntaxError, got %v", in, err)
+		}
+	}
+}
+
+func TestSNBTOptionsNumbers(t *testing.T) {
+	tests := []struct {
+		opts     SNBTOptions
+		in, out  string
+		mustFail bool
+	}{
+		{SNBTOptions{}, `[1, 3000000000]`, ``, true},
+		{SNBTOptions{}, `{a: 3000000000, b: 1.5}`, `{a:"3000000000",b:1.5d}`, false},
+		{SNBTOptions{PromoteOverflow: true}, `[3000000000, 99999999999999999999]`, ``, true},
+		{SNBTOptions{PromoteOverflow: true}, `{a: 3000000000, b: 99999999999999999999, c: 2}`, `{a:3000000000L,b:1.0e+20d,c:2}`, false},
+		{SNBTOptions{IntType: TagDouble, FloatType: TagFloat}, `{a: 3, b: 1.5, c: 2L}`, `{a:3.0d,b:1.5f,c:2L}`, false},
+		{SNBTOptions{IntType: TagByte, PromoteOverflow: true}, `[B; 1, 2]`, `[B;1b,2b]`, false},
+		{SNBTOptions{IntType: TagByte, PromoteOverflow: true}, `{a: 1, b: 200, c: 70000}`, `{a:1b,b:200s,c:70000}`, false},
+		{SNBTOptions{Strict: true}, `{a: 1, b: 1.5d, c: [L; 2L], d: abc}`, `{a:1,b:1.5d,c:[L;2L],d:"abc"}`, false},
+		{SNBTOptions{Strict: true}, `1.5`, ``, true},
+		{SNBTOptions{Strict: true}, `300b`, ``, true},
+		{SNBTOptions{Strict: true}, `[L; 1]`, ``, true},
+		{SNBTOptions{Strict: true, IntType: TagLong}, `1`, ``, true},
+		{SNBTOptions{IntType: TagString}, `1`, ``, true},
+		{SNBTOptions{FloatType: TagInt}, `1`, ``, true},
+	}
+	for _, test := range tests {
+		v, err := test.opts.Parse([]byte(test.in))
+		if test.mustFail {
+			if err == nil {
+				t.Errorf("%+v.Parse(%q): expected an error, got %v", test.opts, test.in, v)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%+v.Parse(%q): %v", test.opts, test.in, err)
+			continue
+		}
+		if out, _ := MarshalSNBT(v); string(out) != test.out {
+			t.Errorf("%+v.Parse(%q): expected %s, got %s", test.opts, test.in, test.out, out)
+		}
+	}
+}
+
+func TestSNBTEscapes(t *testing.T) {
+	in := `{"kéy": "tab\there\nnew\\line\s\x41ü\U0001F600😀\'\"", 'b': 'it\'s'}`
+	v, err := ParseSNBT([]byte(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := v.(*Compound)
+	if s := c.StringOr("kéy", ""); s != "tab\there\nnew\\line Aü😀😀'\"" {
+		t.Errorf("ParseSNBT: got %q", s)
+	}
+	if s := c.StringOr("b", ""); s != "it's" {
+		t.Errorf("ParseSNBT: got %q", s)
+	}
+
+	out, err := SNBTOptions{EscapeUnicode: true}.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{b:"it's","k\u00e9y":"tab\there\nnew\\line A\u00fc\ud83d\ude00\ud83d\ude00'\""}`
+	if string(out) != expected {
+		t.Errorf("Marshal:\nexpected %s\ngot      %s", expected, out)
+	}
+	back, err := ParseSNBT(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := back.(*Compound).StringOr("kéy", ""); s != c.StringOr("kéy", "") {
+		t.Errorf("ParseSNBT: round trip gave %q", s)
+	}
+	if out, _ := MarshalSNBT("é\n"); string(out) != "\"é\n\"" {
+		t.Errorf("MarshalSNBT: got %s", out)
+	}
+
+	for _, in := range []string{`"\q"`, `"\u12"`, `"\u12g4"`, `"\ud83d"`, `"\ud83dx\ude00"`, `"\U00110000"`, `"\x"`} {
+		if v, err := ParseSNBT([]byte(in)); err == nil {
+			t.Errorf("ParseSNBT(%s): expected an error, got %q", in, v)
+		}
+	}
+}
+
+func TestSNBTLenient(t *testing.T) {
+	in := `{id: minecraft:stone, name: Grüße!, list: [1, "a", [I; 2,], {x: 1b,},], tags: [a, b,],}`
+	if v, err := ParseSNBT([]byte(in)); err == nil {
+		t.Errorf("ParseSNBT(%q): expected an error, got %v", in, v)
+	}
+	v, err := SNBTOptions{Lenient: true}.Parse([]byte(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := v.(*Compound)
+	if s := c.StringOr("id", ""); s != "minecraft:stone" {
+		t.Errorf("Parse: id is %q", s)
+	}
+	if s := c.StringOr("name", ""); s != "Grüße!" {
+		t.Errorf("Parse: name is %q", s)
+	}
+	list, _ := c.Get(Path{{Key: "list"}})
+	if l, ok := list.(*List); !ok || !l.IsMixed() || len(l.Mixed()) != 4 {
+		t.Errorf("Parse: expected a mixed list of 4, got %v", list)
+	}
+	out, err := MarshalSNBT(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{id:"minecraft:stone",list:[1,"a",[I;2],{x:1b}],name:"Grüße!",tags:["a","b"]}`
+	if string(out) != expected {
+		t.Errorf("MarshalSNBT:\nexpected %s\ngot      %s", expected, out)
+	}
+
+	for _, in := range []string{`[1,,]`, `{a:1,,}`, `[,]`, `{a b: 1}`, `{a:1 b:2}`} {
+		if v, err := (SNBTOptions{Lenient: true}).Parse([]byte(in)); err == nil {
+			t.Errorf("Parse(%q): expected an error, got %v", in, v)
+		}
+	}
+	if _, err := (SNBTOptions{Strict: true}).Parse([]byte("{\n  a: 1.5\n}")); err == nil {
+		t.Error("Parse: expected an error")
+	} else if serr := err.(*SNBTSyntaxError); serr.Line != 2 || serr.Column != 6 {
+		t.Errorf("Parse: error at %d:%d", serr.Line, serr.Column)
+	}
+}
+
+func TestSNBTQuoting(t *testing.T) {
+	c, err := FromGoMC("", map[string]interface{}{"id": "a\"b", "key": "it's", "odd key": "plain"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		opts SNBTOptions
+		out  string
+	}{
+		{SNBTOptions{}, `{id:'a"b',key:"it's","odd key":"plain"}`},
+		{SNBTOptions{QuoteKeys: true}, `{"id":'a"b',"key":"it's","odd key":"plain"}`},
+		{SNBTOptions{SingleQuotes: true}, `{id:'a"b',key:"it's",'odd key':'plain'}`},
+		{SNBTOptions{SingleQuotes: true, QuoteKeys: true}, `{'id':'a"b','key':"it's",'odd key':'plain'}`},
+	}
+	for _, test := range tests {
+		out, err := test.opts.Marshal(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(out) != test.out {
+			t.Errorf("%+v.Marshal:\nexpected %s\ngot      %s", test.opts, test.out, out)
+		}
+		if back, err := ParseSNBT(out); err != nil {
+			t.Errorf("ParseSNBT(%s): %v", out, err)
+		} else if again, _ := MarshalSNBT(back); string(again) != `{id:'a"b',key:"it's","odd key":"plain"}` {
+			t.Errorf("ParseSNBT(%s): round trip gave %s", out, again)
+		}
+	}
+}
+
+func TestParseSNBTPrefix(t *testing.T) {
+	tests := []struct {
+		in, out, rest string
+	}{
+		{`{Damage:1} 3`, `{Damage:1}`, ` 3`},
+		{`[B; 1b, 2b]@p`, `[B;1b,2b]`, `@p`},
+		{`"a b" c`, `"a b"`, ` c`},
+		{`12b`, `12b`, ``},
+		{`stone{a:1}`, `"stone"`, `{a:1}`},
+		{`{a:[1,2]}}} trailing % garbage`, `{a:[1,2]}`, `}} trailing % garbage`},
+	}
+	for _, test := range tests {
+		v, rest, err := ParseSNBTPrefix(test.in)
+		if err != nil {
+			t.Errorf("ParseSNBTPrefix(%q): %v", test.in, err)
+			continue
+		}
+		if out, _ := MarshalSNBT(v); string(out) != test.out || rest != test.rest {
+			t.Errorf("ParseSNBTPrefix(%q): expected %s, %q, got %s, %q", test.in, test.out, test.rest, out, rest)
+		}
+	}
+	for _, in := range []string{``, ` `, `@p`, `{a:1 3`, `{a:%} 3`, `[B; 1, %] 3`} {
+		if v, rest, err := ParseSNBTPrefix(in); err == nil {
+			t.Errorf("ParseSNBTPrefix(%q): expected an error, got %v, %q", in, v, rest)
+		}
+	}
+}
+
+func TestSNBTFloats(t *testing.T) {
+	values := []interface{}{
+		0.49823147058486938, float32(0.1), float32(math.SmallestNonzeroFloat32), math.MaxFloat64,
+		float32(16777216), 1e21, math.Copysign(0, -1), float32(3.4028235e38), 5e-324,
+	}
+	for _, opts := range []SNBTOptions{{}, {FixedFloats: true}} {
+		for _, v := range values {
+			out, err := opts.Marshal(v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if opts.FixedFloats && bytes.ContainsAny(out, "eE") {
+				t.Errorf("FixedFloats: %v written as %s", v, out)
+			}
+			got, err := ParseSNBT(out)
+			if err != nil {
+				t.Errorf("%s: %v", out, err)
+				continue
+			}
+			want, _ := NumberOf(v)
+			if n, ok := NumberOf(got); !ok || n.Type != want.Type || math.Float64bits(n.f) != math.Float64bits(want.f) {
+				t.Errorf("%v written as %s reads back as %v", v, out, got)
+			}
+		}
+	}
+	if out, _ := MarshalSNBT(0.49823147058486938); string(out) != "0.4982314705848694d" {
+		t.Errorf("expected the shortest form, got %s", out)
+	}
+	if out, _ := (SNBTOptions{FixedFloats: true}).Marshal(float32(1e-6)); string(out) != "0.000001f" {
+		t.Errorf("FixedFloats: expected 0.000001f, got %s", out)
+	}
+
+	c, _ := FromGoMC("", map[string]interface{}{"d": 0.49823147058486938, "f": float32(0.1)})
+	js, err := c.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	back := new(Compound)
+	if err := back.UnmarshalJSON(js); err != nil {
+		t.Fatal(err)
+	}
+	if back.Double("d") != 0.49823147058486938 || back.Float("f") != 0.1 {
+		t.Errorf("JSON %s reads back as %v", js, back.Simplify())
+	}
+}
+
+func TestNonFinite(t *testing.T) {
+	c, err := FromGoMC("", map[string]interface{}{
+		"d": math.NaN(), "f": float32(math.Inf(1)), "l": []interface{}{math.Inf(-1)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := MarshalSNBT(c); err == nil {
+		t.Error("MarshalSNBT: expected an error for NaN")
+	} else if e, ok := err.(*NonFiniteError); !ok || e.Format != "SNBT" {
+		t.Errorf("MarshalSNBT: expected a NonFiniteError, got %v", err)
+	}
+	if _, err := c.MarshalJSON(); err == nil {
+		t.Error("MarshalJSON: expected an error for NaN")
+	}
+
+	literal := SNBTOptions{NonFinite: NonFiniteLiteral}
+	out, err := literal.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != `{d:NaNd,f:Infinityf,l:[-Infinityd]}` {
+		t.Errorf("NonFiniteLiteral: got %s", out)
+	}
+	if back, err := literal.Parse(out); err != nil || !Equal(c, back) {
+		t.Errorf("NonFiniteLiteral: %s reads back as %v, %v", out, back, err)
+	}
+	if back, _ := ParseSNBT(out); back.(*Compound).StringOr("d", "") != "NaNd" {
+		t.Errorf("ParseSNBT: NaNd should read as a string without NonFiniteLiteral")
+	}
+	js, err := JSONOptions{NonFinite: NonFiniteLiteral}.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	back := new(Compound)
+	if err := back.UnmarshalJSON(js); err != nil || !Equal(c, back) {
+		t.Errorf("NonFiniteLiteral: JSON %s reads back as %v, %v", js, back.Simplify(), err)
+	}
+
+	out, err = SNBTOptions{NonFinite: NonFiniteSubstitute}.Marshal(c)
+	if err != nil || string(out) != `{d:0.0d,f:3.4028235e+38f,l:[-1.7976931348623157e+308d]}` {
+		t.Errorf("NonFiniteSubstitute: got %s, %v", out, err)
+	}
+	js, err = JSONOptions{NonFinite: NonFiniteSubstitute}.Marshal(c)
+	if err != nil || !bytes.Contains(js, []byte("3.4028235e+38")) {
+		t.Errorf("NonFiniteSubstitute: got JSON %s, %v", js, err)
+	}
+}
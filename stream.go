@@ -0,0 +1,62 @@
+package nbt
+
+import (
+	"fmt"
+	"io"
+)
+
+// ByteArrayReader is a TAG_Byte_Array whose Len bytes are read from R when
+// it is encoded, so that a large array can be streamed into a document, e.g.
+// from a file, instead of being held in memory as a []int8. It can be stored
+// in a Compound with Set, and returned by DecodeOptions.ByteArrayFunc. R is
+// read only once, so the compound can be encoded only once.
+//
+// Other than the encoder, most of this package does not look inside a
+// ByteArrayReader: Diff compares it by identity and text formats refuse it.
+type ByteArrayReader struct {
+	R   io.Reader
+	Len int
+}
+
+// Writes the array's length and contents, failing if R runs short.
+func (self *Encoder) write_byte_array_reader(a ByteArrayReader) error {
+	if err := self.write(int32(a.Len)); err != nil {
+		return err
+	}
+	n, err := io.CopyN(self.buf, a.R, int64(a.Len))
+	if err == io.EOF {
+		return fmt.Errorf("Byte array reader ended after %d of %d bytes", n, a.Len)
+	}
+	return err
+}
+
+// Reads a byte array entry through DecodeOptions.ByteArrayFunc, returning
+// the value to store in its place, if any.
+func (self *Decoder) stream_byte_array(name string) (interface{}, error) {
+	length, err := self.read_length(1)
+	if err != nil {
+		return nil, err
+	}
+	if length < self.ByteArrayThreshold {
+		b := self.Arena.make_int8s(length)
+		return b, self.read(b)
+	}
+
+	r := &io.LimitedReader{R: self.r, N: int64(length)}
+	v, err := self.ByteArrayFunc(name, length, r)
+	if err != nil {
+		return nil, err
+	}
+	// skip whatever was not read
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		return nil, err
+	}
+	if r.N > 0 {
+		return nil, ErrTruncated
+	}
+	switch v.(type) {
+	case nil, []int8, ByteArrayReader:
+		return v, nil
+	}
+	return nil, fmt.Errorf("ByteArrayFunc returned %T for \"%s\"", v, name)
+}
@@ -0,0 +1,88 @@
+package nbt
+
+import (
+	"io"
+	"sync"
+)
+
+// SyncCompound guards a Compound for use by several goroutines at once:
+// any number of readers may run concurrently, while writers run one at a
+// time with no readers.
+type SyncCompound struct {
+	mu sync.RWMutex
+	c  *Compound
+}
+
+// Wraps the compound, which must not be used directly afterwards.
+func NewSyncCompound(c *Compound) *SyncCompound {
+	return &SyncCompound{c: c}
+}
+
+// Calls f with the compound locked for reading. f must not modify the
+// compound or keep any part of it after returning.
+func (self *SyncCompound) View(f func(c *Compound)) {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	f(self.c)
+}
+
+// Calls f with the compound locked for writing and returns its error.
+// f must not keep any part of the compound after returning.
+func (self *SyncCompound) Update(f func(c *Compound) error) error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	return f(self.c)
+}
+
+// Returns the value at the path, like Compound.Get. Compounds, lists and
+// arrays are deep copies, so the result may be kept and modified freely.
+func (self *SyncCompound) Get(path Path) (interface{}, error) {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	v, err := self.c.Get(path)
+	if err != nil {
+		return nil, err
+	}
+	return copy_value(v, nil), nil
+}
+
+// Parses the path and returns the value at it. See Get.
+func (self *SyncCompound) GetPath(path string) (interface{}, error) {
+	p, err := ParsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	return self.Get(p)
+}
+
+// Sets the value at the path, like Compound.Set. The value becomes part of
+// the tree and must not be used by the caller afterwards.
+func (self *SyncCompound) Set(path Path, v interface{}) error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	return self.c.Set(path, v)
+}
+
+// Parses the path and sets the value at it. See Set.
+func (self *SyncCompound) SetPath(path string, v interface{}) error {
+	p, err := ParsePath(path)
+	if err != nil {
+		return err
+	}
+	return self.Set(p, v)
+}
+
+// Returns a deep copy of the compound.
+func (self *SyncCompound) Copy() *Compound {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	return copy_value(self.c, nil).(*Compound)
+}
+
+// Encodes the compound as an uncompressed NBT document, holding the read
+// lock until it is written.
+func (self *SyncCompound) WriteTo(dst io.Writer) (int64, error) {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	return self.c.WriteTo(dst)
+}
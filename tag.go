@@ -0,0 +1,242 @@
+package nbt
+
+import (
+	"fmt"
+)
+
+// Tag is a node of the explicit tag tree, an alternative to Compound's
+// map of interface{} values in which every value is a concrete node type
+// carrying its own name. Elements of a ListTag have empty names.
+//
+// Use (*Compound).Tag and (*CompoundTag).Compound to convert between the two
+// representations.
+type Tag interface {
+	Type() TagType
+	TagName() string
+}
+
+type ByteTag struct {
+	Name  string
+	Value int8
+}
+
+type ShortTag struct {
+	Name  string
+	Value int16
+}
+
+type IntTag struct {
+	Name  string
+	Value int32
+}
+
+type LongTag struct {
+	Name  string
+	Value int64
+}
+
+type FloatTag struct {
+	Name  string
+	Value float32
+}
+
+type DoubleTag struct {
+	Name  string
+	Value float64
+}
+
+type ByteArrayTag struct {
+	Name  string
+	Value []int8
+}
+
+type StringTag struct {
+	Name  string
+	Value string
+}
+
+// ListTag holds nameless elements which must all be of type Elem.
+type ListTag struct {
+	Name  string
+	Elem  TagType
+	Value []Tag
+}
+
+// CompoundTag holds named entries in order.
+type CompoundTag struct {
+	Name  string
+	Value []Tag
+}
+
+type IntArrayTag struct {
+	Name  string
+	Value []int32
+}
+
+type LongArrayTag struct {
+	Name  string
+	Value []int64
+}
+
+func (self *ByteTag) Type() TagType      { return TagByte }
+func (self *ShortTag) Type() TagType     { return TagShort }
+func (self *IntTag) Type() TagType       { return TagInt }
+func (self *LongTag) Type() TagType      { return TagLong }
+func (self *FloatTag) Type() TagType     { return TagFloat }
+func (self *DoubleTag) Type() TagType    { return TagDouble }
+func (self *ByteArrayTag) Type() TagType { return TagByteArray }
+func (self *StringTag) Type() TagType    { return TagString }
+func (self *ListTag) Type() TagType      { return TagList }
+func (self *CompoundTag) Type() TagType  { return TagCompound }
+func (self *IntArrayTag) Type() TagType  { return TagIntArray }
+func (self *LongArrayTag) Type() TagType { return TagLongArray }
+
+func (self *ByteTag) TagName() string      { return self.Name }
+func (self *ShortTag) TagName() string     { return self.Name }
+func (self *IntTag) TagName() string       { return self.Name }
+func (self *LongTag) TagName() string      { return self.Name }
+func (self *FloatTag) TagName() string     { return self.Name }
+func (self *DoubleTag) TagName() string    { return self.Name }
+func (self *ByteArrayTag) TagName() string { return self.Name }
+func (self *StringTag) TagName() string    { return self.Name }
+func (self *ListTag) TagName() string      { return self.Name }
+func (self *CompoundTag) TagName() string  { return self.Name }
+func (self *IntArrayTag) TagName() string  { return self.Name }
+func (self *LongArrayTag) TagName() string { return self.Name }
+
+// Returns the named entry, or nil if there is none.
+func (self *CompoundTag) Get(name string) Tag {
+	for _, t := range self.Value {
+		if t.TagName() == name {
+			return t
+		}
+	}
+	return nil
+}
+
+// Converts the compound into the explicit tag tree. Entries are ordered by
+// name.
+func (self *Compound) Tag() *CompoundTag {
+	return compound_tag(self.name, self)
+}
+
+func compound_tag(name string, c *Compound) *CompoundTag {
+	t := &CompoundTag{Name: name, Value: make([]Tag, 0, len(c.data))}
+	for _, k := range c.sorted_keys() {
+		if child := to_tag(k, c.data[k].value()); child != nil {
+			t.Value = append(t.Value, child)
+		}
+	}
+	return t
+}
+
+func to_tag(name string, v interface{}) Tag {
+	switch v := unbox(v).(type) {
+	case int8:
+		return &ByteTag{name, v}
+	case int16:
+		return &ShortTag{name, v}
+	case int32:
+		return &IntTag{name, v}
+	case int64:
+		return &LongTag{name, v}
+	case float32:
+		return &FloatTag{name, v}
+	case float64:
+		return &DoubleTag{name, v}
+	case []int8:
+		return &ByteArrayTag{name, v}
+	case string:
+		return &StringTag{name, v}
+	case *List:
+		t := &ListTag{Name: name, Elem: v.list_type}
+		for _, item := range v.items() {
+			elem := to_tag("", item)
+			if v.IsMixed() && (elem.Type() != TagCompound || is_list_wrapper(item.(*Compound))) {
+				// mixed lists are represented as they are on the wire
+				elem = &CompoundTag{Value: []Tag{elem}}
+			}
+			t.Value = append(t.Value, elem)
+		}
+		return t
+	case *Compound:
+		return compound_tag(name, v)
+	case []int32:
+		return &IntArrayTag{name, v}
+	case []int64:
+		return &LongArrayTag{name, v}
+	}
+	return nil
+}
+
+// Converts the explicit tag tree into a Compound. It fails if a list holds
+// elements of the wrong type or a compound holds two entries of the same
+// name.
+func (self *CompoundTag) Compound() (*Compound, error) {
+	return from_compound_tag(self, nil)
+}
+
+func from_compound_tag(t *CompoundTag, parent *Compound) (*Compound, error) {
+	c := &Compound{
+		parent: parent,
+		name:   t.Name,
+		data:   make(map[string]entry, len(t.Value)),
+	}
+	for _, child := range t.Value {
+		if child == nil {
+			continue
+		}
+		name := child.TagName()
+		if _, ok := c.data[name]; ok {
+			return nil, fmt.Errorf("Compound \"%s\": duplicate entry \"%s\"", t.Name, name)
+		}
+		v, err := from_tag(child, c)
+		if err != nil {
+			return nil, err
+		}
+		c.data[name] = c.hold(v)
+	}
+	return c, nil
+}
+
+func from_tag(t Tag, parent *Compound) (interface{}, error) {
+	switch t := t.(type) {
+	case *ByteTag:
+		return t.Value, nil
+	case *ShortTag:
+		return t.Value, nil
+	case *IntTag:
+		return t.Value, nil
+	case *LongTag:
+		return t.Value, nil
+	case *FloatTag:
+		return t.Value, nil
+	case *DoubleTag:
+		return t.Value, nil
+	case *ByteArrayTag:
+		return t.Value, nil
+	case *StringTag:
+		return t.Value, nil
+	case *ListTag:
+		items := make([]interface{}, len(t.Value))
+		for i, elem := range t.Value {
+			if elem == nil || elem.Type() != t.Elem {
+				return nil, fmt.Errorf("List \"%s\" of %v: element %d is %T", t.Name, t.Elem, i, elem)
+			}
+			// list elements have no parent compound
+			v, err := from_tag(elem, nil)
+			if err != nil {
+				return nil, err
+			}
+			items[i] = v
+		}
+		return new_list(t.Name, t.Elem, items)
+	case *CompoundTag:
+		return from_compound_tag(t, parent)
+	case *IntArrayTag:
+		return t.Value, nil
+	case *LongArrayTag:
+		return t.Value, nil
+	}
+	return nil, fmt.Errorf("Unsupported tag node %T", t)
+}
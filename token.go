@@ -0,0 +1,280 @@
+package nbt
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+var ErrNoPayload = errors.New("No tag payload left to read")
+
+// Token is the header of a tag read by Decoder.Token: its type and name,
+// and for lists the type and number of their elements. The end of a
+// compound or list is reported as a Token of type TagEnd; lists have none
+// in their encoding, but get one all the same.
+type Token struct {
+	Type TagType
+
+	// Empty for list elements and TagEnd.
+	Name string
+
+	// Element type and length of a list.
+	Elem TagType
+	Len  int
+}
+
+// A compound or list being read through Token.
+type token_frame struct {
+	list bool
+	elem TagType
+	left int
+}
+
+// Reads the header of the next tag in the input, for programs that walk
+// large documents without building them in memory. The tags come in
+// document order: a compound's entries or a list's elements follow the
+// compound or list itself, and are followed by a TagEnd token. Each root
+// compound starts a new document; Token returns io.EOF if the input ends
+// before one starts.
+//
+// The payload of other tags, and a compound or list as a whole, can be read
+// with Value or skipped with Skip right after their token. Payloads left
+// unread when Token is called again are skipped. Token must not be mixed
+// with Decode or DecodeValue in the middle of a document.
+func (self *Decoder) Token() (Token, error) {
+	tok, err := self.Peek()
+	if err != nil {
+		return Token{}, err
+	}
+	self.peeked = false
+	return self.accept(tok)
+}
+
+// Moves past the header of a token read ahead.
+func (self *Decoder) accept(tok Token) (Token, error) {
+	if len(self.frames) > 0 {
+		top := &self.frames[len(self.frames)-1]
+		if tok.Type == TagEnd {
+			self.pop_frame()
+			return tok, nil
+		}
+		if top.list {
+			top.left--
+		}
+	}
+	switch tok.Type {
+	case TagCompound:
+		if err := self.push_frame(token_frame{}); err != nil {
+			return Token{}, err
+		}
+	case TagList:
+		if err := self.push_frame(token_frame{list: true, elem: tok.Elem, left: tok.Len}); err != nil {
+			return Token{}, err
+		}
+	default:
+		self.pending = tok.Type
+	}
+	self.token = tok
+	return tok, nil
+}
+
+// Returns the token the next call to Token will, without consuming it, for
+// choosing how to read a tag by its type or name. The payload of the last
+// token is skipped if it was not read, as for Token, and a compound or
+// list that was just entered can no longer be read or skipped as a whole.
+func (self *Decoder) Peek() (Token, error) {
+	if self.peeked {
+		return self.next_token, nil
+	}
+	if self.pending != TagEnd {
+		if err := self.Skip(); err != nil {
+			return Token{}, err
+		}
+	}
+	self.fresh = false
+
+	var tok Token
+	var err error
+	if len(self.frames) == 0 {
+		self.start = self.r.n
+		self.depth, self.nesting, self.elements = 0, 0, 0
+		b, err := self.next(1)
+		if err != nil {
+			if err == ErrTruncated && self.r.n == self.start {
+				return Token{}, io.EOF
+			}
+			return Token{}, err
+		}
+		if tok.Type = TagType(b[0]); tok.Type != TagCompound {
+			return Token{}, ErrNotCompound
+		}
+		if tok.Name, err = self.read_string(); err != nil {
+			return Token{}, err
+		}
+	} else if top := self.frames[len(self.frames)-1]; top.list {
+		if top.left > 0 {
+			tok.Type = top.elem
+		}
+	} else {
+		b, err := self.next(1)
+		if err != nil {
+			return Token{}, err
+		}
+		tok.Type = TagType(b[0])
+		if tok.Type != TagEnd {
+			if tok.Name, err = self.read_string(); err != nil {
+				return Token{}, err
+			}
+		}
+	}
+	if tok.Type == TagList {
+		if tok.Elem, tok.Len, err = self.read_list_header(); err != nil {
+			return Token{}, err
+		}
+	}
+
+	self.next_token, self.peeked = tok, true
+	return tok, nil
+}
+
+// Advances to the entry with the given name of the compound last entered
+// through Token, skipping the entries before it without decoding or
+// allocating anything, and returns its token as Token would, so that a
+// reader can drill down to Level.Sections cheaply. If there is no such
+// entry, the rest of the compound is skipped, so that Token continues after
+// it, and the error wraps ErrNotFound.
+func (self *Decoder) Descend(name string) (Token, error) {
+	if len(self.frames) == 0 || self.frames[len(self.frames)-1].list {
+		return Token{}, errors.New("Descend outside of a compound")
+	}
+	if self.pending != TagEnd {
+		if err := self.Skip(); err != nil {
+			return Token{}, err
+		}
+	}
+	self.fresh = false
+
+	for {
+		if self.peeked {
+			tok, err := self.Token()
+			if err != nil || tok.Name == name && tok.Type != TagEnd {
+				return tok, err
+			}
+			if tok.Type == TagEnd {
+				return Token{}, fmt.Errorf("%v: %w", Path{{Key: name}}, ErrNotFound)
+			}
+			if err := self.Skip(); err != nil {
+				return Token{}, err
+			}
+			continue
+		}
+
+		b, err := self.next(1)
+		if err != nil {
+			return Token{}, err
+		}
+		tag := TagType(b[0])
+		if tag == TagEnd {
+			self.pop_frame()
+			return Token{}, fmt.Errorf("%v: %w", Path{{Key: name}}, ErrNotFound)
+		}
+		n, err := self.next_length(2, 1)
+		if err != nil {
+			return Token{}, err
+		}
+		key, err := self.next(n)
+		if err != nil {
+			return Token{}, err
+		}
+		if string(join_surrogates(key)) != name {
+			if err := self.skip(tag); err != nil {
+				return Token{}, err
+			}
+			continue
+		}
+
+		tok := Token{Type: tag, Name: name}
+		if tag == TagList {
+			if tok.Elem, tok.Len, err = self.read_list_header(); err != nil {
+				return Token{}, err
+			}
+		}
+		return self.accept(tok)
+	}
+}
+
+func (self *Decoder) push_frame(f token_frame) error {
+	if err := self.enter(); err != nil {
+		return err
+	}
+	self.frames = append(self.frames, f)
+	self.fresh = true
+	return nil
+}
+
+func (self *Decoder) pop_frame() {
+	self.frames = self.frames[:len(self.frames)-1]
+	self.leave()
+	self.fresh = false
+}
+
+// Reads the payload of the tag whose token was read last, returning it as
+// a plain value of one of the types returned by Compound.Get: a compound
+// or list as a whole is returned as a *Compound or *List, after which
+// Token continues after it. It returns ErrNoPayload if the payload was
+// read or skipped already, or the compound or list was entered.
+func (self *Decoder) Value() (interface{}, error) {
+	switch {
+	case self.pending != TagEnd:
+		tag := self.pending
+		self.pending = TagEnd
+		return self.read_payload(tag, self.token.Name)
+
+	case self.fresh:
+		self.pop_frame()
+		if self.token.Type == TagCompound {
+			return self.read_compound(self.token.Name, nil)
+		}
+		if err := self.enter(); err != nil {
+			return nil, err
+		}
+		defer self.leave()
+		return self.read_list_items(self.token.Name, self.token.Elem, self.token.Len)
+	}
+	return nil, ErrNoPayload
+}
+
+// Skips the payload of the tag whose token was read last, or the rest of
+// a compound or list whose token was just read, without decoding it:
+// strings and arrays are skipped by their length, and lists of numbers by
+// their length times the size of their elements. When the input is an
+// io.Seeker, large payloads are skipped by seeking over them. It returns
+// ErrNoPayload if there is nothing left to skip.
+func (self *Decoder) Skip() error {
+	switch {
+	case self.pending != TagEnd:
+		tag := self.pending
+		self.pending = TagEnd
+		return self.skip(tag)
+
+	case self.fresh:
+		self.pop_frame()
+		if self.token.Type == TagCompound {
+			return self.skip(TagCompound)
+		}
+		if size := fixed_size(self.token.Elem); size > 0 {
+			return self.discard(int64(self.token.Len) * size)
+		}
+		if err := self.enter(); err != nil {
+			return err
+		}
+		defer self.leave()
+		for i := 0; i < self.token.Len; i++ {
+			if err := self.skip(self.token.Elem); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return ErrNoPayload
+}
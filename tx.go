@@ -0,0 +1,107 @@
+package nbt
+
+import (
+	"errors"
+)
+
+var ErrTxDone = errors.New("Transaction has already ended")
+
+// Tx makes the changes of one call to Compound.Update. Its methods fail with
+// ErrTxDone once the call has returned.
+type Tx struct {
+	c    *Compound
+	undo []revert
+	done bool
+}
+
+// Runs f with a transaction on the compound and keeps the changes made
+// through it only if f returns nil. If f returns an error or panics, the
+// changes are undone, last first, and the error returned or the panic
+// resumed; otherwise the changes stay as they were made. A multi-key edit
+// can thus check each step and give up halfway without leaving the tree
+// half modified:
+//
+//	err := player.Update(func(tx *nbt.Tx) error {
+//		if err := tx.Set(nbt.Path{{Key: "XpLevel"}}, int32(30)); err != nil {
+//			return err
+//		}
+//		return tx.Delete(nbt.Path{{Key: "SpawnX"}})
+//	})
+//
+// Each change is journaled with what reverts it, a copy of the value it
+// replaced or removed, so a transaction costs in proportion to the values
+// it changes, not to the document. During f the tree should be modified
+// only through the Tx: changes made to it otherwise are not undone.
+func (self *Compound) Update(f func(tx *Tx) error) error {
+	if err := self.writable(); err != nil {
+		return err
+	}
+	tx := &Tx{c: self}
+	ok := false
+	defer func() {
+		tx.done = true
+		if !ok {
+			tx.rollback()
+		}
+	}()
+	err := f(tx)
+	ok = err == nil
+	return err
+}
+
+// Reverts the changes made, last first.
+func (self *Tx) rollback() {
+	for i := len(self.undo) - 1; i >= 0; i-- {
+		self.undo[i].apply(self.c)
+	}
+	self.undo = nil
+}
+
+// Makes an operation and journals the change that reverts it.
+func (self *Tx) apply(kind OpKind, path Path, v interface{}) error {
+	undo, err := apply_op(self.c, kind, path, v)
+	if err != nil {
+		return err
+	}
+	self.undo = append(self.undo, undo)
+	return nil
+}
+
+// Returns the compound being changed, for reading.
+func (self *Tx) Compound() *Compound { return self.c }
+
+// Returns the value at the path, as Compound.Get does.
+func (self *Tx) Get(path Path) (interface{}, error) {
+	if self.done {
+		return nil, ErrTxDone
+	}
+	return self.c.Get(path)
+}
+
+// Sets the value at the path, as Compound.Set does.
+func (self *Tx) Set(path Path, v interface{}) error {
+	if self.done {
+		return ErrTxDone
+	}
+	return self.apply(OpSet, path, v)
+}
+
+// Removes the compound entry or the element of a list or array at the path,
+// as EditSession.Delete does.
+func (self *Tx) Delete(path Path) error {
+	if self.done {
+		return ErrTxDone
+	}
+	return self.apply(OpDelete, path, nil)
+}
+
+// Appends v to the list or array at the path, as EditSession.Append does.
+func (self *Tx) Append(path Path, v interface{}) error {
+	if self.done {
+		return ErrTxDone
+	}
+	if n, ok := v.(Number); ok {
+		v = n.Value()
+	}
+	return self.apply(OpAppend, path, v)
+}
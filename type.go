@@ -0,0 +1,85 @@
+package nbt
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Returns the tag type a value is, or would be, encoded as. Besides the
+// values found in a decoded Compound (including *Compound, *List and Number),
+// plain Go values are mapped as follows:
+//
+//	bool, int8, uint8        TAG_Byte
+//	int16, uint16            TAG_Short
+//	int, uint, int32, uint32 TAG_Int
+//	int64, uint64            TAG_Long
+//	float32                  TAG_Float
+//	float64                  TAG_Double
+//	string                   TAG_String
+//	[]byte, []int8           TAG_Byte_Array
+//	[]int32                  TAG_Int_Array
+//	[]int64                  TAG_Long_Array
+//	other slices and arrays  TAG_List
+//	maps with string keys    TAG_Compound
+//	structs                  TAG_Compound
+//
+// Pointers are followed. TagEnd is returned for nil and for values that have
+// no NBT representation.
+func TypeOf(v interface{}) TagType {
+	if tag, ok := tag_of(v); ok {
+		return tag
+	}
+	if _, ok := v.(Number); ok || v == nil {
+		return TagEnd
+	}
+	return type_of(reflect.TypeOf(v))
+}
+
+func type_of(t reflect.Type) TagType {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return type_of(t.Elem())
+	case reflect.Bool, reflect.Int8, reflect.Uint8:
+		return TagByte
+	case reflect.Int16, reflect.Uint16:
+		return TagShort
+	case reflect.Int, reflect.Uint, reflect.Int32, reflect.Uint32:
+		return TagInt
+	case reflect.Int64, reflect.Uint64:
+		return TagLong
+	case reflect.Float32:
+		return TagFloat
+	case reflect.Float64:
+		return TagDouble
+	case reflect.String:
+		return TagString
+	case reflect.Slice, reflect.Array:
+		switch t.Elem().Kind() {
+		case reflect.Int8, reflect.Uint8:
+			return TagByteArray
+		case reflect.Int32:
+			return TagIntArray
+		case reflect.Int64:
+			return TagLongArray
+		}
+		return TagList
+	case reflect.Map:
+		if t.Key().Kind() == reflect.String {
+			return TagCompound
+		}
+	case reflect.Struct:
+		return TagCompound
+	}
+	return TagEnd
+}
+
+// UnmarshalTypeError describes a value that cannot be decoded into the Go
+// value it was matched with.
+type UnmarshalTypeError struct {
+	Tag  TagType
+	Type reflect.Type
+}
+
+func (self *UnmarshalTypeError) Error() string {
+	return fmt.Sprintf("nbt: cannot unmarshal %v into Go value of type %v", self.Tag, self.Type)
+}
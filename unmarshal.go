@@ -0,0 +1,657 @@
+//go:build !nbt_noreflect
+
+package nbt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrInvalidTarget = errors.New("nbt: can only decode into a non-nil pointer to a struct")
+)
+
+// Decodes an uncompressed NBT document held in memory into v, which must be
+// a non-nil pointer to a struct. See (*Decoder).DecodeValue.
+func Unmarshal(data []byte, v interface{}) error {
+	return DecodeOptions{}.Unmarshal(data, v)
+}
+
+// Decodes an uncompressed NBT document held in memory into v as Unmarshal
+// does.
+func (self DecodeOptions) Unmarshal(data []byte, v interface{}) error {
+	dec := bytes_decoders.Get().(*bytes_decoder)
+	dec.src.Reset(data)
+	dec.counter.n = 0
+	dec.DecodeOptions = self
+	err := dec.DecodeValue(v)
+	dec.src.Reset(nil)
+	dec.DecodeOptions = DecodeOptions{}
+	bytes_decoders.Put(dec)
+	return err
+}
+
+// A Decoder reading from memory, kept in a pool so that Unmarshal does not
+// allocate.
+type bytes_decoder struct {
+	Decoder
+	src     bytes.Reader
+	counter counting_reader
+}
+
+var bytes_decoders = sync.Pool{
+	New: func() interface{} {
+		dec := new(bytes_decoder)
+		dec.counter.r = &dec.src
+		dec.r = &dec.counter
+		return dec
+	},
+}
+
+// Decodes the next uncompressed NBT document from the input directly into
+// v, which must be a non-nil pointer to a struct, without building a
+// Compound. Compound entries are matched to exported struct fields by name,
+// or by the name given in the field's `nbt:"name"` tag; fields tagged
+// `nbt:"-"` are ignored. Entries whose name matches no field exactly are
+// matched through FieldNameFunc and CaseInsensitiveFields, if set. Entries
+// that still match no field are stored in the map field tagged
+// `nbt:",inline"`, if there is one, and are otherwise skipped unless
+// DisallowUnknownFields is set.
+//
+// The fields of anonymous struct fields are decoded as if they were fields
+// of the outer struct. A field hides more deeply embedded ones of the same
+// name, and of fields of the same name at the same depth the first one
+// wins. An anonymous field given a name in its tag is an ordinary field.
+// Nil pointers to embedded structs are allocated as needed; pointers to
+// unexported struct types are not followed.
+//
+// Values are converted as follows:
+//
+//	TAG_Byte, TAG_Short, TAG_Int, TAG_Long  any signed integer type that
+//	                                        holds the value, or unsigned
+//	                                        one that holds its bits
+//	TAG_Byte                                bool, true unless 0
+//	TAG_Float, TAG_Double                   float32, float64
+//	TAG_String                              string
+//	TAG_Byte_Array                          []int8, []byte
+//	TAG_Int_Array                           []int32
+//	TAG_Long_Array                          []int64
+//	TAG_List                                a slice of a type its elements
+//	                                        convert to
+//	TAG_Compound                            a struct, or a map with
+//	                                        string keys of a type its
+//	                                        entries convert to
+//	TAG_Compound, TAG_List                  *Compound, *List
+//	any                                     RawTag, undecoded
+//	any                                     interface{}, as the plain
+//	                                        values Compound.Get returns
+//
+// An empty list of any element type, such as the lists of TAG_End vanilla
+// writes for empty lists, decodes into any slice, so that a list of
+// compounds decodes into a []T or []*T of structs whether it is empty or
+// not.
+//
+// Go arrays, such as [4]int32 for a UUID or [3]float64 for a position, may
+// be used in place of slices, and fail to decode unless the array or list
+// is of their length.
+//
+// Integers are decoded into unsigned types as the bits they were written
+// with by Encoder.EncodeValue, so that a TAG_Byte of -1 is 255 as a uint8 or
+// uint16. With StrictUnsigned, negative integers are an error instead.
+//
+// A pointer to any of these types holds a value that is optional: it is
+// allocated when the entry is present, and left alone otherwise, so that
+// pointer fields of a zero struct stay nil for absent entries and missing
+// values can be told from zero ones.
+//
+// DecodeValue reuses the strings, slices and pointers already held by v
+// when their contents or capacity allow, so that decoding repeatedly into
+// the same value allocates nothing. Entries are added to maps that are not
+// nil, as encoding/json does.
+func (self *Decoder) DecodeValue(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return ErrInvalidTarget
+	}
+	start := self.clock()
+	err := self.decode_value(rv)
+	self.measure(start, err)
+	return err
+}
+
+func (self *Decoder) decode_value(rv reflect.Value) error {
+	self.start = self.r.n
+	self.nesting, self.elements = 0, 0
+	b, err := self.next(1)
+	if err != nil {
+		if self.r.n == self.start {
+			return io.EOF
+		}
+		return err
+	}
+	if TagType(b[0]) != TagCompound {
+		return ErrNotCompound
+	}
+	if err := self.skip(TagString); err != nil {
+		return err
+	}
+	return self.unmarshal_compound(rv.Elem())
+}
+
+// Reads the name of a compound entry, which stays valid until the next
+// name read at the same nesting.
+func (self *Decoder) next_name() ([]byte, error) {
+	name, err := self.next_string()
+	if err != nil {
+		return nil, err
+	}
+	for len(self.names) < self.nesting {
+		self.names = append(self.names, nil)
+	}
+	held := append(self.names[self.nesting-1][:0], name...)
+	self.names[self.nesting-1] = held
+	return held, nil
+}
+
+func (self *Decoder) unmarshal_compound(v reflect.Value) error {
+	if err := self.enter(); err != nil {
+		return err
+	}
+	defer self.leave()
+	fields := struct_fields(v.Type())
+	for {
+		b, err := self.next(1)
+		if err != nil {
+			return err
+		}
+		tag := TagType(b[0])
+		if tag == TagEnd {
+			return nil
+		}
+		name, err := self.next_name()
+		if err != nil {
+			return err
+		}
+		i, ok := fields.by_name[string(name)]
+		if !ok {
+			i, ok = self.match_field(fields, name)
+		}
+		if !ok && fields.inline != nil {
+			if err := self.unmarshal_inline(tag, string(name), v, fields.inline); err != nil {
+				return with_path(err, tag, PathElem{Key: string(name)})
+			}
+			continue
+		}
+		if !ok {
+			if self.DisallowUnknownFields {
+				return &UnknownFieldError{string(name), v.Type()}
+			}
+			if err := self.skip(tag); err != nil {
+				return with_path(err, tag, PathElem{Key: string(name)})
+			}
+			continue
+		}
+		field, _ := field_by_index(v, fields.list[i].index, true)
+		if err := self.unmarshal_value(tag, field); err != nil {
+			return with_path(err, tag, PathElem{Key: string(name)})
+		}
+	}
+}
+
+// Decodes an entry that matches no field into the struct's inline map.
+func (self *Decoder) unmarshal_inline(tag TagType, name string, v reflect.Value, index []int) error {
+	m, _ := field_by_index(v, index, true)
+	if m.IsNil() {
+		m.Set(reflect.MakeMap(m.Type()))
+	}
+	return self.unmarshal_map_entry(tag, name, m)
+}
+
+// Decodes the entries of a compound into a map with string keys.
+func (self *Decoder) unmarshal_map(v reflect.Value) error {
+	if err := self.enter(); err != nil {
+		return err
+	}
+	defer self.leave()
+	if v.IsNil() {
+		v.Set(reflect.MakeMap(v.Type()))
+	}
+	for {
+		b, err := self.next(1)
+		if err != nil {
+			return err
+		}
+		tag := TagType(b[0])
+		if tag == TagEnd {
+			return nil
+		}
+		name, err := self.next_name()
+		if err != nil {
+			return err
+		}
+		if err := self.unmarshal_map_entry(tag, string(name), v); err != nil {
+			var neg *NegativeLengthError
+			if errors.As(err, &neg) {
+				return with_path(err, tag, PathElem{Key: string(name)})
+			}
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+}
+
+func (self *Decoder) unmarshal_map_entry(tag TagType, name string, m reflect.Value) error {
+	elem := reflect.New(m.Type().Elem()).Elem()
+	if err := self.unmarshal_value(tag, elem); err != nil {
+		return err
+	}
+	m.SetMapIndex(reflect.ValueOf(name).Convert(m.Type().Key()), elem)
+	return nil
+}
+
+// Looks for the field an entry name that matched none exactly belongs to,
+// through FieldNameFunc and CaseInsensitiveFields.
+func (self *Decoder) match_field(fields *field_set, name []byte) (int, bool) {
+	if self.FieldNameFunc != nil {
+		mapped := self.FieldNameFunc(string(name))
+		if i, ok := fields.by_name[mapped]; ok {
+			return i, true
+		}
+		name = []byte(mapped)
+	}
+	if self.CaseInsensitiveFields {
+		i, ok := fields.by_folded[strings.ToLower(string(name))]
+		return i, ok
+	}
+	return 0, false
+}
+
+// UnknownFieldError describes a compound entry that matches no field of the
+// struct it is decoded into, with DecodeOptions.DisallowUnknownFields set.
+type UnknownFieldError struct {
+	Name string
+	Type reflect.Type
+}
+
+func (self *UnknownFieldError) Error() string {
+	return fmt.Sprintf("nbt: unknown entry %q for Go value of type %v", self.Name, self.Type)
+}
+
+func (self *Decoder) unmarshal_value(tag TagType, v reflect.Value) error {
+	if v.Type() == raw_tag_type {
+		return self.unmarshal_raw(tag, v)
+	}
+	if t := v.Type(); t == compound_type && tag == TagCompound || t == list_type && tag == TagList {
+		item, err := self.read_payload(tag, "")
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(item))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.NumMethod() > 0 {
+			break
+		}
+		item, err := self.read_payload(tag, "")
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(item))
+		return nil
+
+	case reflect.Map:
+		if tag != TagCompound || v.Type().Key().Kind() != reflect.String {
+			break
+		}
+		return self.unmarshal_map(v)
+
+	case reflect.Ptr:
+		if v.IsNil() {
+			elem := reflect.New(v.Type().Elem())
+			if err := self.unmarshal_value(tag, elem.Elem()); err != nil {
+				return err
+			}
+			v.Set(elem)
+			return nil
+		}
+		return self.unmarshal_value(tag, v.Elem())
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if tag < TagByte || tag > TagLong {
+			break
+		}
+		n, err := self.next_int(int(fixed_size(tag)))
+		if err != nil {
+			return err
+		}
+		if v.OverflowInt(n) {
+			return fmt.Errorf("nbt: %v %d overflows %v", tag, n, v.Type())
+		}
+		v.SetInt(n)
+		return nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if tag < TagByte || tag > TagLong {
+			break
+		}
+		size := fixed_size(tag)
+		n, err := self.next_int(int(size))
+		if err != nil {
+			return err
+		}
+		if n < 0 && self.StrictUnsigned {
+			return fmt.Errorf("nbt: %v %d overflows %v", tag, n, v.Type())
+		}
+		u := uint64(n)
+		if size < 8 {
+			u &= 1<<(8*size) - 1
+		}
+		if v.OverflowUint(u) {
+			return fmt.Errorf("nbt: %v %d overflows %v", tag, u, v.Type())
+		}
+		v.SetUint(u)
+		return nil
+
+	case reflect.Bool:
+		if tag != TagByte {
+			break
+		}
+		n, err := self.next_int(1)
+		if err != nil {
+			return err
+		}
+		if self.StrictBools && n != 0 && n != 1 {
+			return fmt.Errorf("nbt: %v %d is not a bool", tag, n)
+		}
+		v.SetBool(n != 0)
+		return nil
+
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		switch tag {
+		case TagFloat:
+			n, err := self.next_int(4)
+			if err != nil {
+				return err
+			}
+			f = float64(math.Float32frombits(uint32(n)))
+		case TagDouble:
+			n, err := self.next_int(8)
+			if err != nil {
+				return err
+			}
+			f = math.Float64frombits(uint64(n))
+		default:
+			return &UnmarshalTypeError{tag, v.Type()}
+		}
+		v.SetFloat(f)
+		return nil
+
+	case reflect.String:
+		if tag != TagString {
+			break
+		}
+		b, err := self.next_string()
+		if err != nil {
+			return err
+		}
+		if v.String() != string(b) {
+			v.SetString(string(b))
+		}
+		return nil
+
+	case reflect.Struct:
+		if tag != TagCompound {
+			break
+		}
+		return self.unmarshal_compound(v)
+
+	case reflect.Slice, reflect.Array:
+		switch tag {
+		case TagByteArray, TagIntArray, TagLongArray:
+			return self.unmarshal_array(tag, v)
+		case TagList:
+			return self.unmarshal_list(v)
+		}
+	}
+	return &UnmarshalTypeError{tag, v.Type()}
+}
+
+// Returns v resliced to length n, reusing its backing array if it is large
+// enough. Go arrays are not resized and must be of length n.
+func resize(v reflect.Value, n int) error {
+	switch {
+	case v.Kind() == reflect.Array:
+		if v.Len() != n {
+			return fmt.Errorf("nbt: cannot decode %d elements into %v", n, v.Type())
+		}
+	case v.Cap() >= n:
+		v.SetLen(n)
+	default:
+		v.Set(reflect.MakeSlice(v.Type(), n, n))
+	}
+	return nil
+}
+
+func (self *Decoder) unmarshal_array(tag TagType, v reflect.Value) error {
+	elem := int(fixed_size(array_elem(tag)))
+	kind := v.Type().Elem().Kind()
+	switch {
+	case tag == TagByteArray && (kind == reflect.Int8 || kind == reflect.Uint8):
+	case tag == TagIntArray && kind == reflect.Int32:
+	case tag == TagLongArray && kind == reflect.Int64:
+	default:
+		return &UnmarshalTypeError{tag, v.Type()}
+	}
+
+	n, err := self.next_length(4, int64(elem))
+	if err != nil {
+		return err
+	}
+	if err := self.count_elements(n); err != nil {
+		return err
+	}
+	b, err := self.next(n * elem)
+	if err != nil {
+		return err
+	}
+	if err := resize(v, n); err != nil {
+		return err
+	}
+	if kind == reflect.Uint8 {
+		copy(v.Bytes(), b)
+		return nil
+	}
+	order := self.byte_order()
+	for i := 0; i < n; i++ {
+		switch elem {
+		case 1:
+			v.Index(i).SetInt(int64(int8(b[i])))
+		case 4:
+			v.Index(i).SetInt(int64(int32(order.Uint32(b[4*i:]))))
+		case 8:
+			v.Index(i).SetInt(int64(order.Uint64(b[8*i:])))
+		}
+	}
+	return nil
+}
+
+func (self *Decoder) unmarshal_list(v reflect.Value) error {
+	if err := self.enter(); err != nil {
+		return err
+	}
+	defer self.leave()
+	b, err := self.next(1)
+	if err != nil {
+		return err
+	}
+	elem := TagType(b[0])
+	n, err := self.next_length(4, min_size(elem))
+	if err != nil {
+		return err
+	}
+	if err := self.count_elements(n); err != nil {
+		return err
+	}
+	// slices are grown as their elements are read if the input might not
+	// hold as many as n says
+	grow := v.Kind() == reflect.Slice && v.Cap() < n && self.prealloc(n) < n
+	if grow {
+		v.Set(reflect.MakeSlice(v.Type(), 0, list_prealloc))
+	} else if err := resize(v, n); err != nil {
+		return err
+	}
+	for i := 0; i < n; i++ {
+		if grow {
+			v.Set(reflect.Append(v, reflect.Zero(v.Type().Elem())))
+		}
+		if err := self.unmarshal_value(elem, v.Index(i)); err != nil {
+			return with_path(err, elem, PathElem{Index: i, IsIndex: true})
+		}
+	}
+	return nil
+}
+
+// Exported fields of a struct type that take part in encoding and decoding,
+// computed once per type, so that encoding and decoding many values of the
+// same type does no reflection on the type itself. The fields of anonymous
+// struct fields without a name in their tag are promoted into the list.
+type field_set struct {
+	list    []field_info
+	by_name map[string]int
+
+	// by lower-cased name, for CaseInsensitiveFields; the first field of
+	// each wins
+	by_folded map[string]int
+
+	// index of the map field tagged `nbt:",inline"`, if any
+	inline []int
+}
+
+type field_info struct {
+	name string
+
+	// index sequence for reflect.Value.FieldByIndex
+	index []int
+
+	// depth of embedding
+	depth int
+
+	// tag type of the field's values from static_tag, or TagEnd if it has
+	// to be worked out from each value
+	tag TagType
+}
+
+var field_cache sync.Map // reflect.Type -> *field_set
+
+func struct_fields(t reflect.Type) *field_set {
+	if f, ok := field_cache.Load(t); ok {
+		return f.(*field_set)
+	}
+	fields := &field_set{by_name: make(map[string]int)}
+	var all []field_info
+	collect_fields(t, nil, 0, fields, &all)
+
+	// a shallower field hides deeper ones of the same name, and of fields
+	// at the same depth the first one wins
+	for _, f := range all {
+		if i, ok := fields.by_name[f.name]; ok {
+			if fields.list[i].depth <= f.depth {
+				continue
+			}
+			fields.list[i] = f
+			continue
+		}
+		fields.by_name[f.name] = len(fields.list)
+		fields.list = append(fields.list, f)
+	}
+	fields.by_folded = make(map[string]int, len(fields.list))
+	for i, f := range fields.list {
+		folded := strings.ToLower(f.name)
+		if _, ok := fields.by_folded[folded]; !ok {
+			fields.by_folded[folded] = i
+		}
+	}
+	f, _ := field_cache.LoadOrStore(t, fields)
+	return f.(*field_set)
+}
+
+func collect_fields(t reflect.Type, index []int, depth int, fields *field_set, all *[]field_info) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, opts := "", ""
+		if tag, ok := f.Tag.Lookup("nbt"); ok {
+			if tag == "-" {
+				continue
+			}
+			name, opts, _ = strings.Cut(tag, ",")
+		}
+		idx := append(index[:len(index):len(index)], i)
+
+		embedded := f.Type
+		if embedded.Kind() == reflect.Ptr && f.PkgPath == "" {
+			embedded = embedded.Elem()
+		}
+		if f.Anonymous && name == "" && embedded.Kind() == reflect.Struct && depth < 16 {
+			collect_fields(embedded, idx, depth+1, fields, all)
+			continue
+		}
+		if f.PkgPath != "" {
+			// unexported
+			continue
+		}
+		if opts == "inline" && f.Type.Kind() == reflect.Map && f.Type.Key().Kind() == reflect.String {
+			if fields.inline == nil || len(idx) < len(fields.inline) {
+				fields.inline = idx
+			}
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		*all = append(*all, field_info{name, idx, depth, static_tag(f.Type)})
+	}
+}
+
+// Returns the field of the struct v at the index sequence, allocating the
+// embedded structs on the way through nil pointers if alloc is set, or
+// reporting false on reaching one otherwise.
+func field_by_index(v reflect.Value, index []int, alloc bool) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !alloc {
+					return reflect.Value{}, false
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+var raw_tag_type = reflect.TypeOf(RawTag{})
+
+// Captures the payload of a tag into the RawTag v, reusing its buffer.
+func (self *Decoder) unmarshal_raw(tag TagType, v reflect.Value) error {
+	raw := v.Interface().(RawTag)
+	self.r.capture, self.r.capturing = raw.Payload[:0], true
+	err := self.skip(tag)
+	raw.Type, raw.Payload = tag, self.r.capture
+	self.r.capture, self.r.capturing = nil, false
+	if err != nil {
+		return err
+	}
+	v.Set(reflect.ValueOf(raw))
+	return nil
+}
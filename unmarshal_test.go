@@ -0,0 +1,797 @@
+//go:build !nbt_noreflect
+
+package nbt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"hash/crc32"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testItem struct {
+	ID    string `nbt:"id"`
+	Count int8
+}
+
+type testPlayer struct {
+	Name      string `nbt:"name"`
+	Health    float32
+	Pos       []float64
+	XpLevel   int
+	UUID      []int32
+	Inventory []testItem
+	Ignored   string `nbt:"-"`
+}
+
+func testPlayerNBT(t testing.TB) []byte {
+	tree := &CompoundTag{Value: []Tag{
+		&StringTag{"name", "Bananrama"},
+		&FloatTag{"Health", 20},
+		&ListTag{Name: "Pos", Elem: TagDouble, Value: []Tag{&DoubleTag{Value: 1.5}, &DoubleTag{Value: 64}, &DoubleTag{Value: -3}}},
+		&ShortTag{"XpLevel", 30},
+		&IntArrayTag{"UUID", []int32{1, 2, 3, 4}},
+		&ListTag{Name: "Inventory", Elem: TagCompound, Value: []Tag{
+			&CompoundTag{Value: []Tag{&StringTag{"id", "minecraft:stone"}, &ByteTag{"Count", 64}, &ShortTag{"Slot", 1}}},
+		}},
+		&StringTag{"Ignored", "x"},
+		&CompoundTag{Name: "abilities", Value: []Tag{&ByteTag{"flying", 1}, &ListTag{Name: "l", Elem: TagString, Value: []Tag{&StringTag{Value: "s"}}}}},
+		&LongArrayTag{"heightmap", make([]int64, 37)},
+	}}
+	c, err := tree.Compound()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := c.MarshalBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestUnmarshal(t *testing.T) {
+	data := testPlayerNBT(t)
+	var p testPlayer
+	if err := Unmarshal(data, &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "Bananrama" || p.Health != 20 || len(p.Pos) != 3 || p.Pos[1] != 64 || p.XpLevel != 30 ||
+		len(p.UUID) != 4 || p.UUID[3] != 4 || len(p.Inventory) != 1 || p.Inventory[0].ID != "minecraft:stone" ||
+		p.Inventory[0].Count != 64 || p.Ignored != "" {
+		t.Errorf("Unmarshal: got %+v", p)
+	}
+
+	if !race_enabled {
+		allocs := testing.AllocsPerRun(100, func() {
+			if err := Unmarshal(data, &p); err != nil {
+				t.Fatal(err)
+			}
+		})
+		if allocs != 0 {
+			t.Errorf("Unmarshal into a reused value: expected no allocations, got %v", allocs)
+		}
+	}
+
+	var wrong struct{ Health string }
+	var te *UnmarshalTypeError
+	if err := Unmarshal(data, &wrong); !errors.As(err, &te) || te.Tag != TagFloat {
+		t.Errorf("Unmarshal float into string: expected an UnmarshalTypeError, got %v", err)
+	}
+	var small struct{ XpLevel int8 }
+	if err := Unmarshal(data, &small); err != nil {
+		t.Errorf("Unmarshal short into int8: %v", err)
+	}
+	if err := Unmarshal(data, p); err != ErrInvalidTarget {
+		t.Errorf("Unmarshal into a non-pointer: expected ErrInvalidTarget, got %v", err)
+	}
+	if err := Unmarshal(data[:len(data)-1], &p); err != ErrTruncated {
+		t.Errorf("Unmarshal truncated input: expected ErrTruncated, got %v", err)
+	}
+}
+
+func TestDisallowUnknownFields(t *testing.T) {
+	data := testPlayerNBT(t)
+	decode := func(v interface{}) error {
+		dec := NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields = true
+		return dec.DecodeValue(v)
+	}
+
+	var p testPlayer
+	var ue *UnknownFieldError
+	if err := decode(&p); !errors.As(err, &ue) || ue.Name != "Ignored" {
+		t.Errorf("DisallowUnknownFields: expected an UnknownFieldError for Ignored, got %v", err)
+	}
+
+	// entries of nested compounds are checked as well
+	var all struct {
+		Name      string `nbt:"name"`
+		Health    float32
+		Pos       []float64
+		XpLevel   int
+		UUID      []int32
+		Inventory []testItem
+		Ignored   string
+		Abilities struct {
+			Flying int8     `nbt:"flying"`
+			L      []string `nbt:"l"`
+		} `nbt:"abilities"`
+		Heightmap []int64 `nbt:"heightmap"`
+	}
+	if err := decode(&all); !errors.As(err, &ue) || ue.Name != "Slot" || ue.Type != reflect.TypeOf(testItem{}) {
+		t.Errorf("DisallowUnknownFields: expected an UnknownFieldError for Slot, got %v", err)
+	}
+}
+
+func TestFieldMatching(t *testing.T) {
+	data := testPlayerNBT(t)
+	var p struct {
+		Name   string
+		Health float32 `nbt:"health"`
+		Flying struct {
+			Flying int8 `nbt:"FLYING"`
+		}
+		Heights []int64
+	}
+	dec := NewDecoder(bytes.NewReader(data))
+	dec.CaseInsensitiveFields = true
+	dec.FieldNameFunc = func(name string) string {
+		switch name {
+		case "abilities":
+			return "Flying"
+		case "heightmap":
+			return "heights"
+		}
+		return name
+	}
+	if err := dec.DecodeValue(&p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "Bananrama" || p.Health != 20 || p.Flying.Flying != 1 || len(p.Heights) != 37 {
+		t.Errorf("CaseInsensitiveFields and FieldNameFunc: got %+v", p)
+	}
+
+	p.Name = ""
+	if err := Unmarshal(data, &p); err != nil || p.Name != "" {
+		t.Errorf("Unmarshal without CaseInsensitiveFields: got %q, %v", p.Name, err)
+	}
+}
+
+func TestFieldCache(t *testing.T) {
+	type item struct {
+		N     int32
+		S     string    `nbt:"s"`
+		B     []int8    `nbt:"b"`
+		L     []float64 `nbt:"l"`
+		Num   Number
+		P     *int16
+		I     interface{}
+		Upper int8 `nbt:"UPPER"`
+	}
+	typ := reflect.TypeOf(item{})
+	fields := struct_fields(typ)
+	if struct_fields(typ) != fields {
+		t.Error("struct_fields: fields were computed again")
+	}
+	want := []TagType{TagInt, TagString, TagByteArray, TagList, TagEnd, TagEnd, TagEnd, TagByte}
+	for i, f := range fields.list {
+		if f.tag != want[i] {
+			t.Errorf("struct_fields: %s has tag type %v, expected %v", f.name, f.tag, want[i])
+		}
+	}
+	if i, ok := fields.by_folded["upper"]; !ok || fields.list[i].name != "UPPER" {
+		t.Errorf("struct_fields: by_folded is %v", fields.by_folded)
+	}
+
+	// fields of plain types are written as the values themselves would be
+	n := int16(2)
+	num, _ := NumberOf(int64(3))
+	v := item{7, "x", []int8{1}, []float64{0.5}, num, &n, int32(4), 5}
+	got, err := Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := Marshal(map[string]interface{}{
+		"N": int32(7), "s": "x", "b": []int8{1}, "l": []float64{0.5},
+		"Num": int64(3), "P": int16(2), "I": int32(4), "UPPER": int8(5),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c1, _ := DecodeBytes(got)
+	c2, _ := DecodeBytes(expected)
+	if changes := Diff(c2, c1); len(changes) > 0 {
+		t.Errorf("Marshal: %v", changes)
+	}
+}
+
+type testEntity struct {
+	ID  string `nbt:"id"`
+	Pos []float64
+}
+
+type testMob struct {
+	testEntity
+	*TestLiving
+	Pos   []int32                `nbt:"BlockPos"`
+	Extra map[string]interface{} `nbt:",inline"`
+}
+
+type TestLiving struct {
+	Health float32
+	ID     string `nbt:"id"`
+}
+
+func TestEmbedded(t *testing.T) {
+	data := testPlayerNBT(t)
+	var mob testMob
+	if err := Unmarshal(data, &mob); err != nil {
+		t.Fatal(err)
+	}
+	if len(mob.testEntity.Pos) != 3 || mob.TestLiving == nil || mob.Health != 20 {
+		t.Errorf("Unmarshal into embedded structs: got %+v", mob)
+	}
+	if mob.Extra["name"] != "Bananrama" || mob.Extra["XpLevel"] != int16(30) || mob.Extra["abilities"].(*Compound).Byte("flying") != 1 {
+		t.Errorf("Unmarshal into an inline map: got %v", mob.Extra)
+	}
+	if _, ok := mob.Extra["Health"]; ok {
+		t.Error("Unmarshal into an inline map: got an entry matching a field")
+	}
+
+	mob = testMob{
+		testEntity: testEntity{ID: "minecraft:zombie", Pos: []float64{1, 2, 3}},
+		Pos:        []int32{1, 2, 3},
+		Extra:      map[string]interface{}{"Fire": int16(-1), "BlockPos": "hidden"},
+	}
+	b, err := Marshal(&mob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := DecodeBytes(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Len() != 4 || c.String("id") != "minecraft:zombie" || len(c.List("Pos").Doubles()) != 3 || c.Short("Fire") != -1 {
+		t.Errorf("Marshal with embedded structs: got %v", c.Simplify())
+	}
+	if v, _ := c.GetPath("BlockPos"); TypeOf(v) != TagIntArray {
+		t.Errorf("Marshal with an inline map: entry hides a field")
+	}
+}
+
+func TestUnmarshalPointers(t *testing.T) {
+	data := testPlayerNBT(t)
+	var p struct {
+		Name      *string `nbt:"name"`
+		Health    *float32
+		Inventory *[]*testItem
+		Abilities *struct {
+			Flying *int8 `nbt:"flying"`
+			Mayfly *int8 `nbt:"mayfly"`
+		} `nbt:"abilities"`
+		Missing *int32
+	}
+	if err := Unmarshal(data, &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Name == nil || *p.Name != "Bananrama" || p.Health == nil || *p.Health != 20 ||
+		p.Inventory == nil || (*p.Inventory)[0].ID != "minecraft:stone" {
+		t.Errorf("Unmarshal into pointers: got %+v", p)
+	}
+	if p.Abilities == nil || p.Abilities.Flying == nil || *p.Abilities.Flying != 1 || p.Abilities.Mayfly != nil || p.Missing != nil {
+		t.Errorf("Unmarshal into pointers: got %+v", p.Abilities)
+	}
+
+	name := p.Name
+	if err := Unmarshal(data, &p); err != nil || p.Name != name {
+		t.Errorf("Unmarshal into a reused pointer: got a new one")
+	}
+
+	var wrong struct{ Health *string }
+	var te *UnmarshalTypeError
+	if err := Unmarshal(data, &wrong); !errors.As(err, &te) || wrong.Health != nil {
+		t.Errorf("Unmarshal float into *string: expected an UnmarshalTypeError and nil, got %v, %v", err, wrong.Health)
+	}
+}
+
+func TestUnmarshalBools(t *testing.T) {
+	b, err := Marshal(map[string]interface{}{"yes": true, "no": false, "two": int8(2), "short": int16(1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var bools struct {
+		Yes bool `nbt:"yes"`
+		No  bool `nbt:"no"`
+		Two bool `nbt:"two"`
+	}
+	bools.No = true
+	if err := Unmarshal(b, &bools); err != nil || !bools.Yes || bools.No || !bools.Two {
+		t.Errorf("Unmarshal into bools: got %+v, %v", bools, err)
+	}
+	out, err := Marshal(&bools)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c, err := DecodeBytes(out); err != nil || c.Byte("yes") != 1 || c.Byte("no") != 0 {
+		t.Errorf("Marshal bools: got %v, %v", c, err)
+	}
+
+	dec := NewDecoder(bytes.NewReader(b))
+	dec.StrictBools = true
+	if err := dec.DecodeValue(&bools); err == nil {
+		t.Error("StrictBools: expected an error for 2b")
+	}
+	var short struct {
+		Short bool `nbt:"short"`
+	}
+	var te *UnmarshalTypeError
+	if err := Unmarshal(b, &short); !errors.As(err, &te) {
+		t.Errorf("Unmarshal short into bool: expected an UnmarshalTypeError, got %v", err)
+	}
+}
+
+func TestUnsigned(t *testing.T) {
+	type unsigned struct {
+		B uint8
+		S uint16
+		I uint
+		L uint64
+	}
+	in := unsigned{255, 40000, math.MaxUint32, math.MaxUint64}
+	b, err := Marshal(&in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := DecodeBytes(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Byte("B") != -1 || c.Short("S") != -25536 || c.Int("I") != -1 || c.Long("L") != -1 {
+		t.Errorf("Marshal unsigned: got %v", c.Simplify())
+	}
+	var out unsigned
+	if err := Unmarshal(b, &out); err != nil || out != in {
+		t.Errorf("Unmarshal unsigned: got %+v, %v", out, err)
+	}
+
+	// a TAG_Byte into a wider type takes its 8 bits
+	var wide struct{ B uint64 }
+	if err := Unmarshal(b, &wide); err != nil || wide.B != 255 {
+		t.Errorf("Unmarshal byte into uint64: got %v, %v", wide.B, err)
+	}
+	var narrow struct{ S uint8 }
+	if err := Unmarshal(b, &narrow); err == nil {
+		t.Errorf("Unmarshal short 40000 into uint8: expected an error")
+	}
+
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	enc.StrictUnsigned = true
+	if err := enc.EncodeValue(&in); err == nil {
+		t.Error("EncodeValue with StrictUnsigned: expected an error")
+	}
+	if err := enc.EncodeValue(&unsigned{127, 32767, math.MaxInt32, math.MaxInt64}); err != nil {
+		t.Errorf("EncodeValue with StrictUnsigned: %v", err)
+	}
+	dec := NewDecoder(bytes.NewReader(b))
+	dec.StrictUnsigned = true
+	if err := dec.DecodeValue(&out); err == nil {
+		t.Error("DecodeValue with StrictUnsigned: expected an error")
+	}
+}
+
+func TestFixedArrays(t *testing.T) {
+	data := testPlayerNBT(t)
+	var p struct {
+		UUID      [4]int32
+		Pos       [3]float64
+		Heightmap [37]int64 `nbt:"heightmap"`
+	}
+	if err := Unmarshal(data, &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.UUID != [4]int32{1, 2, 3, 4} || p.Pos != [3]float64{1.5, 64, -3} {
+		t.Errorf("Unmarshal into arrays: got %+v", p)
+	}
+
+	b, err := Marshal(&struct {
+		UUID  [4]int32
+		Bytes [2]byte
+		Pos   [3]float64
+	}{[4]int32{1, 2, 3, 4}, [2]byte{255, 1}, [3]float64{1, 2, 3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := DecodeBytes(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := c.GetPath("UUID"); !reflect.DeepEqual(v, []int32{1, 2, 3, 4}) {
+		t.Errorf("Marshal [4]int32: got %v", v)
+	}
+	if v, _ := c.GetPath("Bytes"); !reflect.DeepEqual(v, []int8{-1, 1}) {
+		t.Errorf("Marshal [2]byte: got %v", v)
+	}
+	var raw struct{ Bytes [2]byte }
+	if err := Unmarshal(b, &raw); err != nil || raw.Bytes != [2]byte{255, 1} {
+		t.Errorf("Unmarshal into [2]byte: got %v, %v", raw.Bytes, err)
+	}
+
+	var short struct{ UUID [3]int32 }
+	if err := Unmarshal(data, &short); err == nil {
+		t.Error("Unmarshal 4 ints into [3]int32: expected an error")
+	}
+}
+
+func TestStructLists(t *testing.T) {
+	type inventory struct {
+		Items    []testItem
+		Pointers []*testItem
+		Empty    []testItem
+		Nil      []testItem
+	}
+	in := inventory{
+		Items:    []testItem{{"minecraft:stone", 64}, {"minecraft:dirt", 1}},
+		Pointers: []*testItem{{"minecraft:diamond", 2}},
+		Empty:    []testItem{},
+	}
+	b, err := Marshal(&in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := DecodeBytes(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := c.List("Items"); l.ListType() != TagCompound || l.Len() != 2 || l.Compounds()[1].String("id") != "minecraft:dirt" {
+		t.Errorf("Marshal []T: got %v", c.Simplify())
+	}
+	if l := c.List("Pointers"); l.ListType() != TagCompound || l.Compounds()[0].Byte("Count") != 2 {
+		t.Errorf("Marshal []*T: got %v", c.Simplify())
+	}
+	if l := c.List("Empty"); l.ListType() != TagCompound || l.Len() != 0 {
+		t.Errorf("Marshal empty []T: got %v of %v", l.Len(), l.ListType())
+	}
+	if _, err := c.GetPath("Nil"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Marshal nil []T: expected it to be left out")
+	}
+
+	var out inventory
+	if err := Unmarshal(b, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out.Items, in.Items) || len(out.Pointers) != 1 || *out.Pointers[0] != *in.Pointers[0] || len(out.Empty) != 0 {
+		t.Errorf("Unmarshal lists of compounds: got %+v", out)
+	}
+
+	// vanilla writes empty lists as lists of TAG_End
+	var empty struct{ Empty []testItem }
+	if b, err := Marshal(map[string]interface{}{"Empty": []interface{}{}}); err != nil || Unmarshal(b, &empty) != nil || len(empty.Empty) != 0 {
+		t.Errorf("Unmarshal an empty list of TAG_End into []T: %v", err)
+	}
+
+	in.Pointers = append(in.Pointers, nil)
+	if _, err := Marshal(&in); err == nil {
+		t.Error("Marshal []*T holding nil: expected an error")
+	}
+}
+
+func TestUnmarshalMaps(t *testing.T) {
+	type level struct {
+		GameRules  map[string]string
+		Scores     map[string]int32
+		Objectives map[string]testItem
+		Raw        map[string]*Compound
+		Any        map[string]interface{}
+		Tree       *Compound
+		List       *List
+	}
+	in := map[string]interface{}{
+		"GameRules":  map[string]string{"keepInventory": "true", "doDaylightCycle": "false"},
+		"Scores":     map[string]int32{"alice": 3, "bob": -1},
+		"Objectives": map[string]testItem{"a": {"minecraft:stone", 1}},
+		"Raw":        map[string]map[string]int8{"x": {"b": 1}},
+		"Any":        map[string]interface{}{"s": int16(2), "l": []string{"a"}},
+		"Tree":       map[string]int64{"n": 7},
+		"List":       []float32{1, 2},
+	}
+	b, err := Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out level
+	if err := Unmarshal(b, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.GameRules["keepInventory"] != "true" || len(out.GameRules) != 2 || out.Scores["bob"] != -1 || out.Objectives["a"].ID != "minecraft:stone" {
+		t.Errorf("Unmarshal into maps: got %+v", out)
+	}
+	if out.Raw["x"].Byte("b") != 1 || out.Any["s"] != int16(2) || out.Any["l"].(*List).Strings()[0] != "a" {
+		t.Errorf("Unmarshal into maps of compounds and interfaces: got %+v", out)
+	}
+	if out.Tree.Long("n") != 7 || out.List.Floats()[1] != 2 {
+		t.Errorf("Unmarshal into *Compound and *List: got %v, %v", out.Tree, out.List)
+	}
+
+	again, err := Marshal(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c1, _ := DecodeBytes(b)
+	c2, _ := DecodeBytes(again)
+	if !Equal(c1, c2) {
+		t.Errorf("Marshal after Unmarshal into maps: round trip differs: %v", Diff(c1, c2))
+	}
+
+	var wrong struct{ Scores map[string]string }
+	var te *UnmarshalTypeError
+	if err := Unmarshal(b, &wrong); !errors.As(err, &te) {
+		t.Errorf("Unmarshal ints into map[string]string: expected an UnmarshalTypeError, got %v", err)
+	}
+}
+
+func TestRawTag(t *testing.T) {
+	data := testPlayerNBT(t)
+	var p struct {
+		Name      string `nbt:"name"`
+		Abilities RawTag `nbt:"abilities"`
+		Missing   RawTag
+		Rest      map[string]RawTag `nbt:",inline"`
+	}
+	if err := Unmarshal(data, &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Abilities.Type != TagCompound || p.Missing.Type != TagEnd || p.Rest["Health"].Type != TagFloat || len(p.Rest) != 7 {
+		t.Errorf("Unmarshal into RawTag: got %+v", p)
+	}
+	v, err := p.Abilities.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.(*Compound).Byte("flying") != 1 {
+		t.Errorf("RawTag.Value: got %v", v)
+	}
+
+	// everything is written back as it was
+	out, err := Marshal(&p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := DecodeBytes(data)
+	got, err := DecodeBytes(out)
+	if err != nil || !Equal(got, want) {
+		t.Errorf("Marshal of RawTag: round trip differs: %v, %v", Diff(want, got), err)
+	}
+
+	payload := p.Abilities.Payload
+	if err := Unmarshal(data, &p); err != nil {
+		t.Fatal(err)
+	}
+	if &p.Abilities.Payload[0] != &payload[0] {
+		t.Error("Unmarshal into RawTag: payload buffer was not reused")
+	}
+}
+
+func BenchmarkUnmarshal(b *testing.B) {
+	data := testPlayerNBT(b)
+	var p testPlayer
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		if err := Unmarshal(data, &p); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeBytes(b *testing.B) {
+	data := testPlayerNBT(b)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		if _, err := DecodeBytes(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestMarshalMaps(t *testing.T) {
+	v := map[string]interface{}{
+		"name":    "Bananrama",
+		"flag":    true,
+		"count":   3,
+		"ratio":   0.5,
+		"big":     uint64(1 << 63),
+		"pos":     []interface{}{1.5, 64.0, -3.0},
+		"ids":     []int32{1, 2},
+		"tags":    []string{"a", "b"},
+		"empty":   []interface{}{},
+		"nothing": nil,
+		"nested":  map[string]interface{}{"x": int16(7)},
+		"items":   []map[string]interface{}{{"id": "stone"}},
+	}
+	data, err := Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := DecodeBytes(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.String("name") != "Bananrama" || c.Byte("flag") != 1 || c.Int("count") != 3 || c.Double("ratio") != 0.5 ||
+		c.Long("big") != -1<<63 || c.List("pos").Doubles()[1] != 64 || c.data["ids"].ref.([]int32)[1] != 2 ||
+		c.List("tags").Strings()[1] != "b" || c.List("empty").ListType() != TagEnd ||
+		c.Compound("nested").Short("x") != 7 || c.List("items").Compounds()[0].String("id") != "stone" {
+		t.Errorf("Marshal: unexpected result")
+		c.PrettyPrint()
+	}
+	if _, ok := c.data["nothing"]; ok {
+		t.Errorf("Marshal: nil map entry was written")
+	}
+
+	var p testPlayer
+	data, err = Marshal(&testPlayer{Name: "Hampus", Pos: []float64{1, 2, 3}, Inventory: []testItem{{"minecraft:dirt", 1}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Unmarshal(data, &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "Hampus" || p.Pos[2] != 3 || p.Inventory[0].ID != "minecraft:dirt" {
+		t.Errorf("Marshal struct: round trip gave %+v", p)
+	}
+
+	bad := []interface{}{
+		map[string]interface{}{"mixed": []interface{}{1, "a"}},
+		map[string]interface{}{"big": 1 << 40},
+		map[int]string{1: "a"},
+		[]int{1},
+	}
+	for _, v := range bad {
+		if _, err := Marshal(v); err == nil {
+			t.Errorf("Marshal(%v): expected an error", v)
+		}
+	}
+}
+
+func TestHostileLengthsValue(t *testing.T) {
+	data := []byte{0x0a, 0x00, 0x00, 0x09, 0x00, 0x01, 'a', 0x0a, 0x7f, 0xff, 0xff, 0xff}
+	var v struct{ A []struct{} }
+	err := NewDecoder(struct{ io.Reader }{bytes.NewReader(data)}).DecodeValue(&v)
+	if !errors.Is(err, ErrTruncated) {
+		t.Errorf("huge list of compounds into a struct: expected ErrTruncated, got %v", err)
+	}
+
+	var w struct {
+		L []int32 `nbt:"l"`
+	}
+	dec := NewDecoder(bytes.NewReader(bigList(100000)))
+	dec.MaxElements = 100000
+	if err := dec.DecodeValue(&w); err != nil || len(w.L) != 100000 {
+		t.Errorf("MaxElements: %v, %d elements", err, len(w.L))
+	}
+}
+
+func TestNegativeLengthValue(t *testing.T) {
+	var v struct {
+		C struct {
+			L [][]int32 `nbt:"l"`
+		} `nbt:"c"`
+	}
+	checkNegativeLength(t, "Unmarshal", Unmarshal(negativeLength, &v))
+	var w struct {
+		C map[string][][]int32 `nbt:"c"`
+	}
+	checkNegativeLength(t, "Unmarshal into a map", Unmarshal(negativeLength, &w))
+}
+
+func TestSurrogatePairsValue(t *testing.T) {
+	const want = "a\U0001F600b"
+	var v struct {
+		S string `nbt:"s"`
+	}
+	if err := Unmarshal(surrogatePairs, &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.S != want {
+		t.Errorf("Unmarshal: got %q, expected %q", v.S, want)
+	}
+	b, err := Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, surrogatePairs) {
+		t.Errorf("Marshal: got % x, expected % x", b, surrogatePairs)
+	}
+}
+
+func TestEncodeValueOptions(t *testing.T) {
+	buf := new(bytes.Buffer)
+	enc := NewEncoder(buf)
+	enc.Checksum = crc32.NewIEEE()
+	enc.OverrideRootName, enc.RootName = true, "Data"
+	if err := enc.EncodeValue(map[string]int32{"x": 1}); err != nil {
+		t.Fatal(err)
+	}
+	if sum, expected := enc.Checksum.(hash.Hash32).Sum32(), crc32.ChecksumIEEE(buf.Bytes()); sum != expected {
+		t.Errorf("Checksum: expected %08x, got %08x", expected, sum)
+	}
+	c, err := DecodeBytes(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Name() != "Data" || c.IntOr("x", 0) != 1 {
+		t.Errorf("OverrideRootName: got %q, %d", c.Name(), c.IntOr("x", 0))
+	}
+}
+
+func TestMaxDepthValue(t *testing.T) {
+	var v struct{ L [][]struct{} }
+	for _, depth := range []int{3, 4} {
+		dec := NewDecoder(bytes.NewReader(maxDepth))
+		dec.MaxDepth = depth
+		err := dec.DecodeValue(&v)
+		if depth == 3 && err != ErrTooDeep {
+			t.Errorf("MaxDepth %d: expected ErrTooDeep, got %v", depth, err)
+		}
+		if depth == 4 && err != nil {
+			t.Errorf("MaxDepth %d: %v", depth, err)
+		}
+	}
+}
+
+func TestOptionsUnmarshal(t *testing.T) {
+	le := EncodeOptions{ByteOrder: binary.LittleEndian}
+	data, err := le.Marshal(map[string]interface{}{"n": int32(1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v struct {
+		N int32 `nbt:"n"`
+	}
+	if err := (DecodeOptions{ByteOrder: binary.LittleEndian}).Unmarshal(data, &v); err != nil || v.N != 1 {
+		t.Errorf("Unmarshal: %v, %d", err, v.N)
+	}
+	// the pooled decoder does not keep the options
+	if err := Unmarshal(data, &v); err == nil {
+		t.Error("Unmarshal: expected an error for a little endian document")
+	}
+}
+
+func TestMetricsValue(t *testing.T) {
+	m := new(recordedMetrics)
+	var v struct {
+		Name string `nbt:"name"`
+	}
+	if err := (DecodeOptions{Metrics: m}).Unmarshal(helloWorld, &v); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.decoded) != 1 || m.decoded[0] != int64(len(helloWorld)) {
+		t.Errorf("Decoded: got %v", m.decoded)
+	}
+	buf := new(bytes.Buffer)
+	if err := (EncodeOptions{Metrics: m}).NewEncoder(buf).EncodeValue(v); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.encoded) != 1 || m.encoded[0] != int64(buf.Len()) {
+		t.Errorf("Encoded: got %v for %d bytes", m.encoded, buf.Len())
+	}
+
+	e := NewExpvarMetrics("nbt_test")
+	if _, err := (DecodeOptions{Metrics: e}).DecodeBytes(helloWorld); err != nil {
+		t.Fatal(err)
+	}
+	(DecodeOptions{Metrics: e}).DecodeBytes(helloWorld[:10])
+	for _, want := range []string{`"decode_documents": 2`, `"decode_errors": {"truncated": 1}`, `"+Inf": 2`} {
+		if !strings.Contains(e.m.String(), want) {
+			t.Errorf("ExpvarMetrics: %s has no %s", e.m.String(), want)
+		}
+	}
+}
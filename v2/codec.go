@@ -0,0 +1,46 @@
+package nbt
+
+import (
+	"io"
+
+	v1 "github.com/moshee/go-nbt"
+)
+
+// DecodeOptions controls decoding. It has the fields of the version 1
+// DecodeOptions, and its methods are the decoding functions with the
+// options applied to one call.
+type DecodeOptions v1.DecodeOptions
+
+// EncodeOptions controls encoding. It has the fields of the version 1
+// EncodeOptions, and its methods are the encoding functions with the
+// options applied to one call.
+type EncodeOptions v1.EncodeOptions
+
+// Decodes an uncompressed NBT document.
+func Decode(src io.Reader) (*Compound, error) {
+	return DecodeOptions{}.Decode(src)
+}
+
+// Decodes an uncompressed NBT document held in memory.
+func DecodeBytes(data []byte) (*Compound, error) {
+	return DecodeOptions{}.DecodeBytes(data)
+}
+
+// Encodes a compound as an uncompressed NBT document.
+func Encode(dst io.Writer, c *Compound) error {
+	return EncodeOptions{}.Encode(dst, c)
+}
+
+func (o DecodeOptions) Decode(src io.Reader) (*Compound, error) {
+	c, err := v1.DecodeOptions(o).Decode(src)
+	return Wrap(c), err
+}
+
+func (o DecodeOptions) DecodeBytes(data []byte) (*Compound, error) {
+	c, err := v1.DecodeOptions(o).DecodeBytes(data)
+	return Wrap(c), err
+}
+
+func (o EncodeOptions) Encode(dst io.Writer, c *Compound) error {
+	return v1.EncodeOptions(o).Encode(dst, c.c)
+}
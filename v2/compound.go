@@ -0,0 +1,209 @@
+package nbt
+
+import (
+	"fmt"
+	"sort"
+
+	v1 "github.com/moshee/go-nbt"
+)
+
+// ErrNotFound is wrapped by the errors of accessors for missing entries.
+var ErrNotFound = v1.ErrNotFound
+
+// TagType is the type of a tag.
+type TagType = v1.TagType
+
+// TypeError is returned by an accessor for an entry of another type than
+// the one asked for.
+type TypeError struct {
+	Key  string
+	Want TagType
+	Got  TagType
+}
+
+func (e *TypeError) Error() string {
+	return fmt.Sprintf("nbt: entry %q is a %v, not a %v", e.Key, e.Got, e.Want)
+}
+
+// Compound is a compound tag: a named set of entries, each a tag of any
+// type. The zero value is not usable; make compounds with New, Wrap or the
+// decoding functions.
+type Compound struct {
+	c *v1.Compound
+}
+
+// Returns an empty compound with the given name.
+func New(name string) *Compound {
+	c, err := v1.FromGoMC(name, nil)
+	if err != nil {
+		// an empty map always converts
+		panic(err)
+	}
+	return &Compound{c}
+}
+
+// Returns a Compound sharing the contents of a version 1 compound, or nil
+// for nil, so that changes made through either are seen by both.
+func Wrap(c *v1.Compound) *Compound {
+	if c == nil {
+		return nil
+	}
+	return &Compound{c}
+}
+
+// Returns the version 1 compound behind c, for the parts of the API that
+// have not moved yet.
+func (c *Compound) Unwrap() *v1.Compound {
+	return c.c
+}
+
+func (c *Compound) Name() string {
+	return c.c.Name()
+}
+
+// Returns the number of entries.
+func (c *Compound) Len() int {
+	return c.c.Len()
+}
+
+// Returns the names of the entries, sorted.
+func (c *Compound) Keys() []string {
+	keys := make([]string, 0, c.c.Len())
+	for k := range v1.ToGoMC(c.c) {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Reports whether there is an entry with the given name.
+func (c *Compound) Has(key string) bool {
+	_, err := c.Value(key)
+	return err == nil
+}
+
+// Returns the value of an entry as a plain value: int8 through float64,
+// string, []int8, []int32, []int64, a *v1.List or a *Compound. The error
+// wraps ErrNotFound if there is no such entry.
+func (c *Compound) Value(key string) (interface{}, error) {
+	v, err := c.c.Get(v1.Path{{Key: key}})
+	if err != nil {
+		return nil, err
+	}
+	if child, ok := v.(*v1.Compound); ok {
+		return &Compound{child}, nil
+	}
+	return v, nil
+}
+
+// Returns the value of an entry of the given type.
+func (c *Compound) typed(key string, want TagType) (interface{}, error) {
+	v, err := c.Value(key)
+	if err != nil {
+		return nil, err
+	}
+	if inner, ok := v.(*Compound); ok {
+		v = inner.c
+	}
+	if got := v1.TypeOf(v); got != want {
+		return nil, &TypeError{key, want, got}
+	}
+	return v, nil
+}
+
+func (c *Compound) Byte(key string) (int8, error) {
+	v, err := c.typed(key, v1.TagByte)
+	if err != nil {
+		return 0, err
+	}
+	return v.(int8), nil
+}
+
+func (c *Compound) Short(key string) (int16, error) {
+	v, err := c.typed(key, v1.TagShort)
+	if err != nil {
+		return 0, err
+	}
+	return v.(int16), nil
+}
+
+func (c *Compound) Int(key string) (int32, error) {
+	v, err := c.typed(key, v1.TagInt)
+	if err != nil {
+		return 0, err
+	}
+	return v.(int32), nil
+}
+
+func (c *Compound) Long(key string) (int64, error) {
+	v, err := c.typed(key, v1.TagLong)
+	if err != nil {
+		return 0, err
+	}
+	return v.(int64), nil
+}
+
+func (c *Compound) Float(key string) (float32, error) {
+	v, err := c.typed(key, v1.TagFloat)
+	if err != nil {
+		return 0, err
+	}
+	return v.(float32), nil
+}
+
+func (c *Compound) Double(key string) (float64, error) {
+	v, err := c.typed(key, v1.TagDouble)
+	if err != nil {
+		return 0, err
+	}
+	return v.(float64), nil
+}
+
+func (c *Compound) String(key string) (string, error) {
+	v, err := c.typed(key, v1.TagString)
+	if err != nil {
+		return "", err
+	}
+	return v.(string), nil
+}
+
+func (c *Compound) List(key string) (*v1.List, error) {
+	v, err := c.typed(key, v1.TagList)
+	if err != nil {
+		return nil, err
+	}
+	return v.(*v1.List), nil
+}
+
+func (c *Compound) Compound(key string) (*Compound, error) {
+	v, err := c.typed(key, v1.TagCompound)
+	if err != nil {
+		return nil, err
+	}
+	return &Compound{v.(*v1.Compound)}, nil
+}
+
+// Returns a numeric entry of any width as an int64, or def if there is no
+// such entry or it is not an integer.
+func (c *Compound) IntOr(key string, def int64) int64 {
+	if n, ok := c.c.AnyInt(key); ok {
+		return n
+	}
+	return def
+}
+
+// Returns a string entry, or def if there is no such entry or it is not a
+// string.
+func (c *Compound) StringOr(key string, def string) string {
+	return c.c.StringOr(key, def)
+}
+
+// Sets an entry, replacing any entry of the same name whatever its type. v
+// is a plain value of one of the types returned by Value, a v1.Number, or a
+// *v1.Compound. A compound stored here becomes part of c, named key.
+func (c *Compound) Set(key string, v interface{}) error {
+	if child, ok := v.(*Compound); ok {
+		v = child.c
+	}
+	return c.c.Set(v1.Path{{Key: key}}, v)
+}
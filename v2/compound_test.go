@@ -0,0 +1,72 @@
+package nbt
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	v1 "github.com/moshee/go-nbt"
+)
+
+func TestCompound(t *testing.T) {
+	c := New("root")
+	if err := c.Set("n", int32(5)); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Set("s", "hello"); err != nil {
+		t.Fatal(err)
+	}
+	child := New("")
+	child.Set("b", int8(1))
+	if err := c.Set("child", child); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Set("bad", struct{}{}); err == nil {
+		t.Error("storing a struct succeeded")
+	}
+
+	if n, err := c.Int("n"); err != nil || n != 5 {
+		t.Errorf("Int = %d, %v", n, err)
+	}
+	if _, err := c.Int("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Int of a missing entry: %v", err)
+	}
+	var te *TypeError
+	if _, err := c.Int("s"); !errors.As(err, &te) || te.Want != v1.TagInt || te.Got != v1.TagString {
+		t.Errorf("Int of a string: %v", err)
+	}
+	if got := c.IntOr("missing", 7); got != 7 {
+		t.Errorf("IntOr = %d", got)
+	}
+	if keys := c.Keys(); len(keys) != 3 || keys[0] != "child" || keys[2] != "s" {
+		t.Errorf("Keys = %q", keys)
+	}
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, c); err != nil {
+		t.Fatal(err)
+	}
+	d, err := DecodeBytes(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Name() != "root" {
+		t.Errorf("Name = %q", d.Name())
+	}
+	inner, err := d.Compound("child")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, err := inner.Byte("b"); err != nil || b != 1 {
+		t.Errorf("child.b = %d, %v", b, err)
+	}
+
+	// changes through either API are seen by the other
+	d.Unwrap().SetPath("s", "changed")
+	if s, _ := d.String("s"); s != "changed" {
+		t.Errorf("String after a v1 change = %q", s)
+	}
+	if _, err := DecodeBytes(buf.Bytes()[:5]); err == nil {
+		t.Error("decoding a truncated document succeeded")
+	}
+}
@@ -0,0 +1,33 @@
+// Package nbt is the beginning of version 2 of github.com/moshee/go-nbt,
+// an API meant to be safe to use from programs that build and change
+// documents, not only dump them.
+//
+// # Plan
+//
+// Version 1 grew around a Compound whose accessors panic on a missing entry
+// or a wrong type, values that are boxed differently depending on how they
+// were stored, and behavior set by fields of long-lived Decoders. Version 2
+// keeps the wire format code and changes the surface:
+//
+//   - Names follow Go conventions: receivers are named after their type,
+//     nothing exported uses underscores, and getters have no Get prefix.
+//   - Every accessor that can fail returns an error instead of panicking,
+//     wrapping ErrNotFound for missing entries and returning a *TypeError
+//     for entries of another type. The ...Or variants of version 1 remain
+//     for defaults.
+//   - Documents are built as values: New and Set construct compounds
+//     without going through maps of interface{} or the tag tree.
+//   - Decoding and encoding take their options per call, as the methods of
+//     DecodeOptions and EncodeOptions already do in version 1.
+//
+// # Status
+//
+// This package is the compatibility shim through which the new surface is
+// being shaped: a Compound here wraps a version 1 *nbt.Compound, so that
+// both APIs can be used on the same document while code moves over. Wrap
+// and Unwrap convert between them without copying. Lists, paths and the
+// reflection codec are still those of version 1 and are used through
+// Unwrap. Once the surface has settled, the implementation moves into this
+// package, it gets a go.mod declaring the /v2 module path, and version 1
+// becomes the shim.
+package nbt
@@ -0,0 +1,27 @@
+//go:build !nbt_noreflect
+
+package nbt
+
+import (
+	v1 "github.com/moshee/go-nbt"
+)
+
+// Decodes an uncompressed NBT document held in memory into the Go value v,
+// as the version 1 Unmarshal does.
+func Unmarshal(data []byte, v interface{}) error {
+	return DecodeOptions{}.Unmarshal(data, v)
+}
+
+// Encodes the Go value v as an uncompressed NBT document, as the version 1
+// Marshal does.
+func Marshal(v interface{}) ([]byte, error) {
+	return EncodeOptions{}.Marshal(v)
+}
+
+func (o DecodeOptions) Unmarshal(data []byte, v interface{}) error {
+	return v1.DecodeOptions(o).Unmarshal(data, v)
+}
+
+func (o EncodeOptions) Marshal(v interface{}) ([]byte, error) {
+	return v1.EncodeOptions(o).Marshal(v)
+}
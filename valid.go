@@ -0,0 +1,198 @@
+package nbt
+
+import (
+	"encoding/binary"
+)
+
+// Reports whether data is a single, structurally correct, uncompressed NBT
+// document: the root is a TAG_Compound, every tag ID is known, every length
+// prefix is non-negative and fits in the remaining input, every compound is
+// closed and nothing follows the root. No tree is built, so it is cheap to
+// run on untrusted input before handing it to Decode.
+func Valid(data []byte) bool {
+	return valid(data, binary.BigEndian)
+}
+
+func valid(data []byte, order binary.ByteOrder) bool {
+	s := &scanner{data: data, order: order}
+	return s.valid()
+}
+
+type scanner struct {
+	data  []byte
+	pos   int
+	order binary.ByteOrder
+}
+
+// A compound or list the scanner is currently inside of.
+type scan_frame struct {
+	list      bool
+	elem      TagType
+	remaining int64
+}
+
+func (self *scanner) left() int64 {
+	return int64(len(self.data) - self.pos)
+}
+
+func (self *scanner) skip(n int64) bool {
+	if n < 0 || n > self.left() {
+		return false
+	}
+	self.pos += int(n)
+	return true
+}
+
+func (self *scanner) read_byte() (byte, bool) {
+	if self.left() < 1 {
+		return 0, false
+	}
+	b := self.data[self.pos]
+	self.pos++
+	return b, true
+}
+
+func (self *scanner) read_int32() (int64, bool) {
+	if self.left() < 4 {
+		return 0, false
+	}
+	n := int32(self.order.Uint32(self.data[self.pos:]))
+	self.pos += 4
+	return int64(n), true
+}
+
+func (self *scanner) skip_string() bool {
+	if self.left() < 2 {
+		return false
+	}
+	n := self.order.Uint16(self.data[self.pos:])
+	self.pos += 2
+	return self.skip(int64(n))
+}
+
+func (self *scanner) valid() bool {
+	b, ok := self.read_byte()
+	tag := TagType(b)
+	if !ok || tag != TagCompound || !self.skip_string() {
+		return false
+	}
+
+	// Nesting is tracked on an explicit stack rather than by recursion so
+	// that hostile, very deeply nested input cannot exhaust the goroutine
+	// stack.
+	stack := []scan_frame{{}}
+	for len(stack) > 0 {
+		top := &stack[len(stack)-1]
+		if top.list {
+			if top.remaining == 0 {
+				stack = stack[:len(stack)-1]
+				continue
+			}
+			top.remaining--
+			tag = top.elem
+		} else {
+			if b, ok = self.read_byte(); !ok {
+				return false
+			}
+			tag = TagType(b)
+			if tag == TagEnd {
+				stack = stack[:len(stack)-1]
+				continue
+			}
+			if !self.skip_string() {
+				return false
+			}
+		}
+
+		if size := fixed_size(tag); size > 0 {
+			if !self.skip(size) {
+				return false
+			}
+			continue
+		}
+
+		switch tag {
+		case TagByteArray, TagIntArray, TagLongArray:
+			n, ok := self.read_int32()
+			if !ok || n < 0 || !self.skip(n*fixed_size(array_elem(tag))) {
+				return false
+			}
+
+		case TagString:
+			if !self.skip_string() {
+				return false
+			}
+
+		case TagList:
+			b, ok := self.read_byte()
+			if !ok {
+				return false
+			}
+			elem := TagType(b)
+			n, ok := self.read_int32()
+			if !ok || n < 0 {
+				return false
+			}
+			if size := fixed_size(elem); size > 0 {
+				// Lists of scalars can be skipped in one go.
+				if !self.skip(n * size) {
+					return false
+				}
+				continue
+			}
+			if elem == TagEnd {
+				if n != 0 {
+					return false
+				}
+				continue
+			}
+			if !known_tag(elem) || n > self.left() {
+				// Every element takes at least one byte, so a count that
+				// exceeds the remaining input can never be satisfied.
+				return false
+			}
+			stack = append(stack, scan_frame{list: true, elem: elem, remaining: n})
+
+		case TagCompound:
+			stack = append(stack, scan_frame{})
+
+		default:
+			return false
+		}
+	}
+
+	return self.left() == 0
+}
+
+// Returns the payload size of tags with a fixed size, or 0 for tags whose
+// payload is length-prefixed or nested.
+func fixed_size(tag TagType) int64 {
+	switch tag {
+	case TagByte:
+		return 1
+	case TagShort:
+		return 2
+	case TagInt, TagFloat:
+		return 4
+	case TagLong, TagDouble:
+		return 8
+	}
+	return 0
+}
+
+// Returns the element tag of an array tag.
+func array_elem(tag TagType) TagType {
+	switch tag {
+	case TagByteArray:
+		return TagByte
+	case TagIntArray:
+		return TagInt
+	case TagLongArray:
+		return TagLong
+	}
+	return TagEnd
+}
+
+func known_tag(tag TagType) bool {
+	return tag <= TagLongArray
+}
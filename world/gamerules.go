@@ -0,0 +1,208 @@
+package world
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/moshee/go-nbt"
+)
+
+// RuleKind is the type of a game rule's value.
+type RuleKind int
+
+const (
+	BoolRule RuleKind = iota
+	IntRule
+)
+
+func (self RuleKind) String() string {
+	switch self {
+	case BoolRule:
+		return "bool"
+	case IntRule:
+		return "int"
+	}
+	return fmt.Sprintf("RuleKind(%d)", int(self))
+}
+
+// KnownGameRules maps the names of the game rules of vanilla Java Edition
+// to their kind.
+var KnownGameRules = map[string]RuleKind{
+	"announceAdvancements":             BoolRule,
+	"blockExplosionDropDecay":          BoolRule,
+	"commandBlockOutput":               BoolRule,
+	"commandModificationBlockLimit":    IntRule,
+	"disableElytraMovementCheck":       BoolRule,
+	"disablePlayerMovementCheck":       BoolRule,
+	"disableRaids":                     BoolRule,
+	"doDaylightCycle":                  BoolRule,
+	"doEntityDrops":                    BoolRule,
+	"doFireTick":                       BoolRule,
+	"doImmediateRespawn":               BoolRule,
+	"doInsomnia":                       BoolRule,
+	"doLimitedCrafting":                BoolRule,
+	"doMobLoot":                        BoolRule,
+	"doMobSpawning":                    BoolRule,
+	"doPatrolSpawning":                 BoolRule,
+	"doTileDrops":                      BoolRule,
+	"doTraderSpawning":                 BoolRule,
+	"doVinesSpread":                    BoolRule,
+	"doWardenSpawning":                 BoolRule,
+	"doWeatherCycle":                   BoolRule,
+	"drowningDamage":                   BoolRule,
+	"enderPearlsVanishOnDeath":         BoolRule,
+	"fallDamage":                       BoolRule,
+	"fireDamage":                       BoolRule,
+	"forgiveDeadPlayers":               BoolRule,
+	"freezeDamage":                     BoolRule,
+	"globalSoundEvents":                BoolRule,
+	"keepInventory":                    BoolRule,
+	"lavaSourceConversion":             BoolRule,
+	"logAdminCommands":                 BoolRule,
+	"maxCommandChainLength":            IntRule,
+	"maxCommandForkCount":              IntRule,
+	"maxEntityCramming":                IntRule,
+	"mobExplosionDropDecay":            BoolRule,
+	"mobGriefing":                      BoolRule,
+	"naturalRegeneration":              BoolRule,
+	"playersNetherPortalCreativeDelay": IntRule,
+	"playersNetherPortalDefaultDelay":  IntRule,
+	"playersSleepingPercentage":        IntRule,
+	"projectilesCanBreakBlocks":        BoolRule,
+	"randomTickSpeed":                  IntRule,
+	"reducedDebugInfo":                 BoolRule,
+	"sendCommandFeedback":              BoolRule,
+	"showDeathMessages":                BoolRule,
+	"snowAccumulationHeight":           IntRule,
+	"spawnChunkRadius":                 IntRule,
+	"spawnRadius":                      IntRule,
+	"spectatorsGenerateChunks":         BoolRule,
+	"tntExplosionDropDecay":            BoolRule,
+	"universalAnger":                   BoolRule,
+	"waterSourceConversion":            BoolRule,
+}
+
+var ErrNoGameRules = errors.New("level.dat has no GameRules")
+
+// UnknownRuleError is returned when setting a game rule that is not in
+// KnownGameRules.
+type UnknownRuleError struct {
+	Name string
+}
+
+func (self *UnknownRuleError) Error() string {
+	return fmt.Sprintf("Unknown game rule %q", self.Name)
+}
+
+// GameRules gives typed access to the GameRules compound of a level.dat,
+// where every rule is stored as a TAG_String such as "true" or "3".
+// Changes are made to the compound itself.
+type GameRules struct {
+	// Lets Set store rules missing from KnownGameRules, such as those
+	// added by mods, as they are.
+	AllowUnknown bool
+
+	c *nbt.Compound
+}
+
+// Returns the game rules of a level.dat document, whose root holds them in
+// Data.GameRules. The Data compound itself is accepted as well.
+func GameRulesOf(level *nbt.Compound) (*GameRules, error) {
+	for _, path := range []string{"Data.GameRules", "GameRules"} {
+		if v, err := level.GetPath(path); err == nil {
+			c, ok := v.(*nbt.Compound)
+			if !ok {
+				return nil, fmt.Errorf("%s is a %v, not a TAG_Compound", path, nbt.TypeOf(v))
+			}
+			return &GameRules{c: c}, nil
+		}
+	}
+	return nil, ErrNoGameRules
+}
+
+// Returns the names of the rules present, sorted.
+func (self *GameRules) Names() []string {
+	var names []string
+	for name, v := range nbt.ToGoMC(self.c) {
+		if _, ok := v.(string); ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Returns the text of a rule and whether it is present.
+func (self *GameRules) Get(name string) (string, bool) {
+	v, err := self.c.Get(nbt.Path{{Key: name}})
+	s, ok := v.(string)
+	return s, err == nil && ok
+}
+
+// Returns a rule's value as a bool. The error wraps nbt.ErrNotFound if the
+// rule is not present.
+func (self *GameRules) Bool(name string) (bool, error) {
+	s, ok := self.Get(name)
+	if !ok {
+		return false, fmt.Errorf("Game rule %s: %w", name, nbt.ErrNotFound)
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return false, fmt.Errorf("Game rule %s: %q is not a bool", name, s)
+	}
+	return b, nil
+}
+
+// Returns a rule's value as an int. The error wraps nbt.ErrNotFound if the
+// rule is not present.
+func (self *GameRules) Int(name string) (int, error) {
+	s, ok := self.Get(name)
+	if !ok {
+		return 0, fmt.Errorf("Game rule %s: %w", name, nbt.ErrNotFound)
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("Game rule %s: %q is not an int", name, s)
+	}
+	return n, nil
+}
+
+// Sets a rule from its text, which must parse as the rule's kind. Unknown
+// rules are rejected with an *UnknownRuleError unless AllowUnknown is set.
+func (self *GameRules) Set(name, value string) error {
+	kind, ok := KnownGameRules[name]
+	switch {
+	case !ok && !self.AllowUnknown:
+		return &UnknownRuleError{name}
+	case !ok:
+	case kind == BoolRule:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("Game rule %s: %q is not a bool", name, value)
+		}
+		value = strconv.FormatBool(b)
+	case kind == IntRule:
+		if _, err := strconv.Atoi(value); err != nil {
+			return fmt.Errorf("Game rule %s: %q is not an int", name, value)
+		}
+	}
+	return self.c.Set(nbt.Path{{Key: name}}, value)
+}
+
+// Sets a boolean rule.
+func (self *GameRules) SetBool(name string, b bool) error {
+	if kind, ok := KnownGameRules[name]; ok && kind != BoolRule {
+		return fmt.Errorf("Game rule %s is not a bool", name)
+	}
+	return self.Set(name, strconv.FormatBool(b))
+}
+
+// Sets an integer rule.
+func (self *GameRules) SetInt(name string, n int) error {
+	if kind, ok := KnownGameRules[name]; ok && kind != IntRule {
+		return fmt.Errorf("Game rule %s is not an int", name)
+	}
+	return self.Set(name, strconv.Itoa(n))
+}
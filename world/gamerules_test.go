@@ -0,0 +1,68 @@
+package world
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/moshee/go-nbt"
+)
+
+func TestGameRules(t *testing.T) {
+	level, err := nbt.FromGoMC("", map[string]interface{}{
+		"Data": map[string]interface{}{
+			"GameRules": map[string]interface{}{
+				"keepInventory":   "false",
+				"randomTickSpeed": "3",
+				"someModRule":     "on",
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules, err := GameRulesOf(level)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := rules.Names(); !reflect.DeepEqual(names, []string{"keepInventory", "randomTickSpeed", "someModRule"}) {
+		t.Errorf("Names: got %v", names)
+	}
+	if b, err := rules.Bool("keepInventory"); err != nil || b {
+		t.Errorf("Bool: got %v, %v", b, err)
+	}
+	if n, err := rules.Int("randomTickSpeed"); err != nil || n != 3 {
+		t.Errorf("Int: got %v, %v", n, err)
+	}
+	if _, err := rules.Bool("someModRule"); err == nil {
+		t.Error("Bool: expected an error for a value that is not a bool")
+	}
+	if _, err := rules.Int("doFireTick"); !errors.Is(err, nbt.ErrNotFound) {
+		t.Errorf("Int: expected ErrNotFound, got %v", err)
+	}
+
+	if err := rules.SetBool("keepInventory", true); err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := level.GetPath("Data.GameRules.keepInventory"); s != "true" {
+		t.Errorf("SetBool: stored %v", s)
+	}
+	if err := rules.Set("randomTickSpeed", "fast"); err == nil {
+		t.Error("Set: expected an error for an int rule set to text")
+	}
+	if err := rules.SetInt("keepInventory", 1); err == nil {
+		t.Error("SetInt: expected an error for a bool rule")
+	}
+	var unknown *UnknownRuleError
+	if err := rules.Set("keepInventroy", "true"); !errors.As(err, &unknown) {
+		t.Errorf("Set: expected an UnknownRuleError, got %v", err)
+	}
+	rules.AllowUnknown = true
+	if err := rules.Set("someModRule", "off"); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := GameRulesOf(level.Compound("Data").Compound("GameRules")); err != ErrNoGameRules {
+		t.Errorf("GameRulesOf: expected ErrNoGameRules, got %v", err)
+	}
+}
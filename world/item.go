@@ -0,0 +1,269 @@
+// Package world models the Minecraft Java Edition data most often handled
+// by tools, such as item stacks, on top of the nbt package.
+package world
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/moshee/go-nbt"
+)
+
+// ItemFormat is the encoding of an item stack.
+type ItemFormat int
+
+const (
+	// Before 1.20.5: a TAG_Byte Count and free-form data in a tag compound.
+	LegacyItems ItemFormat = iota
+
+	// Since 1.20.5: a TAG_Int count and typed data components.
+	ComponentItems
+)
+
+func (self ItemFormat) String() string {
+	switch self {
+	case LegacyItems:
+		return "legacy"
+	case ComponentItems:
+		return "components"
+	}
+	return fmt.Sprintf("ItemFormat(%d)", int(self))
+}
+
+// ItemStack is a stack of items, as found in inventories, containers and
+// item entities, in either encoding. Only one of Tag and Components is used,
+// depending on Format; ToLegacy and ToComponents convert between them.
+type ItemStack struct {
+	Format ItemFormat
+
+	// Such as minecraft:diamond_sword.
+	ID    string
+	Count int32
+
+	// Slot in the containing inventory, if HasSlot.
+	Slot    int8
+	HasSlot bool
+
+	// The tag compound of a legacy item, or nil.
+	Tag *nbt.Compound
+
+	// The components of an item since 1.20.5, keyed by id, or nil. Only
+	// those differing from the item's defaults are stored.
+	Components *nbt.Compound
+}
+
+var ErrNotItem = errors.New("Compound is not an item stack")
+
+// Reads an item stack in either encoding, which is told apart by the case
+// of its count.
+func ParseItemStack(c *nbt.Compound) (*ItemStack, error) {
+	id := c.StringOr("id", "")
+	if id == "" {
+		return nil, ErrNotItem
+	}
+	self := &ItemStack{ID: id}
+	if slot, err := c.GetPath("Slot"); err == nil {
+		if self.Slot, self.HasSlot = slot.(int8); !self.HasSlot {
+			return nil, fmt.Errorf("Item slot is a %v, not a TAG_Byte", nbt.TypeOf(slot))
+		}
+	}
+
+	if count, ok := c.AnyInt("Count"); ok {
+		self.Format = LegacyItems
+		self.Count = int32(count)
+		self.Tag = c.CompoundOr("tag", nil)
+		return self, nil
+	}
+	self.Format = ComponentItems
+	self.Count = 1
+	if count, ok := c.AnyInt("count"); ok {
+		self.Count = int32(count)
+	}
+	self.Components = c.CompoundOr("components", nil)
+	return self, nil
+}
+
+// Encodes the item stack in its Format.
+func (self *ItemStack) Compound() (*nbt.Compound, error) {
+	m := map[string]interface{}{"id": self.ID}
+	if self.HasSlot {
+		m["Slot"] = self.Slot
+	}
+	switch self.Format {
+	case LegacyItems:
+		m["Count"] = int8(self.Count)
+		if self.Tag != nil {
+			m["tag"] = nbt.ToGoMC(self.Tag)
+		}
+	case ComponentItems:
+		m["count"] = self.Count
+		if self.Components != nil && self.Components.Len() > 0 {
+			m["components"] = nbt.ToGoMC(self.Components)
+		}
+	default:
+		return nil, fmt.Errorf("Unknown item format: %v", self.Format)
+	}
+	return nbt.FromGoMC("", m)
+}
+
+// Legacy tag entries with a component counterpart. The rest of the tag is
+// kept in the minecraft:custom_data component.
+var legacy_components = []struct {
+	tag, display string
+	component    string
+}{
+	{tag: "Damage", component: "minecraft:damage"},
+	{tag: "RepairCost", component: "minecraft:repair_cost"},
+	{tag: "CustomModelData", component: "minecraft:custom_model_data"},
+	{display: "Name", component: "minecraft:custom_name"},
+	{display: "Lore", component: "minecraft:lore"},
+}
+
+// Returns the item stack converted to ComponentItems, the way the game
+// upgrades items: well known tag entries such as Damage, display names and
+// lore, enchantments and Unbreakable become their components, and the rest
+// of the tag is kept as minecraft:custom_data. Items already in that
+// format are returned as they are.
+func (self *ItemStack) ToComponents() (*ItemStack, error) {
+	if self.Format == ComponentItems {
+		return self, nil
+	}
+	item := *self
+	item.Format, item.Tag, item.Components = ComponentItems, nil, nil
+	if self.Tag == nil {
+		return &item, nil
+	}
+
+	tag := nbt.ToGoMC(self.Tag)
+	display, _ := tag["display"].(map[string]interface{})
+	components := make(map[string]interface{})
+	for _, entry := range legacy_components {
+		src, key := tag, entry.tag
+		if entry.display != "" {
+			src, key = display, entry.display
+		}
+		if v, ok := src[key]; ok {
+			components[entry.component] = v
+			delete(src, key)
+		}
+	}
+	if color, ok := display["color"]; ok {
+		components["minecraft:dyed_color"] = map[string]interface{}{"rgb": color}
+		delete(display, "color")
+	}
+	if display != nil && len(display) == 0 {
+		delete(tag, "display")
+	}
+	if v, ok := tag["Unbreakable"]; ok {
+		if n, _ := nbt.NumberOf(v); n.Int64() != 0 {
+			components["minecraft:unbreakable"] = map[string]interface{}{}
+		}
+		delete(tag, "Unbreakable")
+	}
+	for key, component := range map[string]string{
+		"Enchantments":       "minecraft:enchantments",
+		"StoredEnchantments": "minecraft:stored_enchantments",
+	} {
+		list, ok := tag[key].([]interface{})
+		if !ok {
+			continue
+		}
+		levels := make(map[string]interface{}, len(list))
+		for _, e := range list {
+			e, _ := e.(map[string]interface{})
+			id, _ := e["id"].(string)
+			level, _ := nbt.NumberOf(e["lvl"])
+			if id != "" {
+				levels[id] = int32(level.Int64())
+			}
+		}
+		components[component] = map[string]interface{}{"levels": levels}
+		delete(tag, key)
+	}
+	if len(tag) > 0 {
+		components["minecraft:custom_data"] = tag
+	}
+
+	var err error
+	item.Components, err = nbt.FromGoMC("components", components)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// Returns the item stack converted to LegacyItems, the reverse of
+// ToComponents. Components with no legacy counterpart are dropped. Items
+// already in that format are returned as they are.
+func (self *ItemStack) ToLegacy() (*ItemStack, error) {
+	if self.Format == LegacyItems {
+		return self, nil
+	}
+	item := *self
+	item.Format, item.Tag, item.Components = LegacyItems, nil, nil
+	if self.Components == nil {
+		return &item, nil
+	}
+
+	components := nbt.ToGoMC(self.Components)
+	tag, _ := components["minecraft:custom_data"].(map[string]interface{})
+	if tag == nil {
+		tag = make(map[string]interface{})
+	}
+	display, _ := tag["display"].(map[string]interface{})
+	if display == nil {
+		display = make(map[string]interface{})
+	}
+	for _, entry := range legacy_components {
+		v, ok := components[entry.component]
+		if !ok {
+			continue
+		}
+		if entry.display != "" {
+			display[entry.display] = v
+		} else {
+			tag[entry.tag] = v
+		}
+	}
+	if dyed, ok := components["minecraft:dyed_color"].(map[string]interface{}); ok {
+		if rgb, ok := dyed["rgb"]; ok {
+			display["color"] = rgb
+		}
+	}
+	if len(display) > 0 {
+		tag["display"] = display
+	}
+	if _, ok := components["minecraft:unbreakable"]; ok {
+		tag["Unbreakable"] = int8(1)
+	}
+	for key, component := range map[string]string{
+		"Enchantments":       "minecraft:enchantments",
+		"StoredEnchantments": "minecraft:stored_enchantments",
+	} {
+		c, _ := components[component].(map[string]interface{})
+		levels, ok := c["levels"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		ids := make([]string, 0, len(levels))
+		for id := range levels {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		list := make([]interface{}, len(ids))
+		for i, id := range ids {
+			n, _ := nbt.NumberOf(levels[id])
+			list[i] = map[string]interface{}{"id": id, "lvl": int16(n.Int64())}
+		}
+		tag[key] = list
+	}
+
+	if len(tag) > 0 {
+		var err error
+		if item.Tag, err = nbt.FromGoMC("tag", tag); err != nil {
+			return nil, err
+		}
+	}
+	return &item, nil
+}
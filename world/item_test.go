@@ -0,0 +1,78 @@
+package world
+
+import (
+	"testing"
+
+	"github.com/moshee/go-nbt"
+)
+
+func TestItemStack(t *testing.T) {
+	legacy, err := nbt.FromGoMC("", map[string]interface{}{
+		"id":    "minecraft:diamond_sword",
+		"Count": int8(1),
+		"Slot":  int8(3),
+		"tag": map[string]interface{}{
+			"Damage":       int32(12),
+			"Unbreakable":  int8(1),
+			"display":      map[string]interface{}{"Name": `{"text":"Bananrama"}`},
+			"Enchantments": []interface{}{map[string]interface{}{"id": "minecraft:sharpness", "lvl": int16(5)}},
+			"custom":       "kept",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	item, err := ParseItemStack(legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.Format != LegacyItems || item.ID != "minecraft:diamond_sword" || item.Count != 1 || !item.HasSlot || item.Slot != 3 {
+		t.Errorf("ParseItemStack: got %+v", item)
+	}
+
+	modern, err := item.ToComponents()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := modern.Compound()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range map[string]interface{}{
+		"count":                              int32(1),
+		`components."minecraft:damage"`:      int32(12),
+		`components."minecraft:custom_name"`: `{"text":"Bananrama"}`,
+		`components."minecraft:enchantments".levels."minecraft:sharpness"`: int32(5),
+		`components."minecraft:custom_data".custom`:                        "kept",
+	} {
+		if got, err := c.GetPath(path); err != nil || !nbt.Equal(got, want) {
+			t.Errorf("ToComponents: %s: expected %v, got %v (%v)", path, want, got, err)
+		}
+	}
+	if _, err := c.GetPath(`components."minecraft:unbreakable"`); err != nil {
+		t.Error("ToComponents: minecraft:unbreakable missing")
+	}
+
+	parsed, err := ParseItemStack(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Format != ComponentItems {
+		t.Errorf("ParseItemStack: expected components, got %v", parsed.Format)
+	}
+	back, err := parsed.ToLegacy()
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := back.Compound()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changes := nbt.Diff(legacy, again); len(changes) > 0 {
+		t.Errorf("ToLegacy: round trip changed %v", changes)
+	}
+
+	if _, err := ParseItemStack(c.Compound("components")); err != ErrNotItem {
+		t.Errorf("ParseItemStack: expected ErrNotItem, got %v", err)
+	}
+}
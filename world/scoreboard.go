@@ -0,0 +1,183 @@
+//go:build !nbt_noreflect
+
+package world
+
+import (
+	"encoding/binary"
+
+	"github.com/moshee/go-nbt"
+)
+
+// Scoreboard is the contents of a world's data/scoreboard.dat. Entries the
+// types here do not model are kept in the Extra maps, so that a scoreboard
+// that is read and written back loses nothing.
+type Scoreboard struct {
+	// DataVersion of the file, or 0 if it has none.
+	DataVersion int32 `nbt:"-"`
+
+	Objectives   []Objective
+	PlayerScores []Score
+	Teams        []Team
+
+	// Name of the objective shown in each display slot, keyed by slot:
+	// slot_0 through slot_18 before 1.20.2, and names such as sidebar or
+	// below_name since.
+	DisplaySlots map[string]string
+
+	Extra map[string]interface{} `nbt:",inline"`
+}
+
+// Objective is a scoreboard objective.
+type Objective struct {
+	Name         string
+	CriteriaName string
+
+	// JSON text component.
+	DisplayName string
+
+	// integer or hearts.
+	RenderType string
+
+	Extra map[string]interface{} `nbt:",inline"`
+}
+
+// Score is the score of a player, or of an entity by UUID, for an
+// objective.
+type Score struct {
+	Name      string
+	Objective string
+	Score     int32
+
+	// Set when the score cannot be changed by /trigger.
+	Locked bool
+
+	Extra map[string]interface{} `nbt:",inline"`
+}
+
+// Team is a scoreboard team.
+type Team struct {
+	Name string
+
+	// JSON text components.
+	DisplayName      string
+	MemberNamePrefix string
+	MemberNameSuffix string
+
+	// Such as red, or reset for none.
+	TeamColor string
+
+	Players []string
+
+	AllowFriendlyFire     bool
+	SeeFriendlyInvisibles bool
+
+	// always, never, hideForOtherTeams or hideForOwnTeam.
+	NameTagVisibility      string
+	DeathMessageVisibility string
+
+	// always, never, pushOtherTeams or pushOwnTeam.
+	CollisionRule string
+
+	Extra map[string]interface{} `nbt:",inline"`
+}
+
+// The layout of scoreboard.dat around the scoreboard itself.
+type scoreboard_file struct {
+	DataVersion *int32
+	Data        *Scoreboard            `nbt:"data"`
+	Extra       map[string]interface{} `nbt:",inline"`
+}
+
+// Decodes a scoreboard from an uncompressed scoreboard.dat document.
+func DecodeScoreboard(data []byte) (*Scoreboard, error) {
+	var file scoreboard_file
+	if err := nbt.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+	self := file.Data
+	if self == nil {
+		self = new(Scoreboard)
+	}
+	if file.DataVersion != nil {
+		self.DataVersion = *file.DataVersion
+	}
+	return self, nil
+}
+
+// Reads a scoreboard.dat file.
+func ReadScoreboard(path string) (*Scoreboard, error) {
+	c, _, err := nbt.DecodeFile(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := c.MarshalBytes()
+	if err != nil {
+		return nil, err
+	}
+	return DecodeScoreboard(data)
+}
+
+// Encodes the scoreboard as an uncompressed scoreboard.dat document.
+func (self *Scoreboard) Marshal() ([]byte, error) {
+	file := scoreboard_file{Data: self}
+	if self.DataVersion != 0 {
+		file.DataVersion = &self.DataVersion
+	}
+	return nbt.Marshal(&file)
+}
+
+// Writes the scoreboard to a scoreboard.dat file, gzip compressed as the
+// game writes it, replacing the file atomically as nbt.EncodeFile does.
+func (self *Scoreboard) WriteFile(path string) error {
+	data, err := self.Marshal()
+	if err != nil {
+		return err
+	}
+	c, err := nbt.DecodeBytes(data)
+	if err != nil {
+		return err
+	}
+	return nbt.EncodeFile(path, c, nbt.Format{Compression: nbt.Gzip, ByteOrder: binary.BigEndian})
+}
+
+// Returns the named objective, or nil if there is none.
+func (self *Scoreboard) Objective(name string) *Objective {
+	for i := range self.Objectives {
+		if self.Objectives[i].Name == name {
+			return &self.Objectives[i]
+		}
+	}
+	return nil
+}
+
+// Returns the named team, or nil if there is none.
+func (self *Scoreboard) Team(name string) *Team {
+	for i := range self.Teams {
+		if self.Teams[i].Name == name {
+			return &self.Teams[i]
+		}
+	}
+	return nil
+}
+
+// Returns the score of a player for an objective, and whether there is one.
+func (self *Scoreboard) Score(player, objective string) (int32, bool) {
+	for _, s := range self.PlayerScores {
+		if s.Name == player && s.Objective == objective {
+			return s.Score, true
+		}
+	}
+	return 0, false
+}
+
+// Sets the score of a player for an objective, adding it if there is none.
+func (self *Scoreboard) SetScore(player, objective string, score int32) {
+	for i := range self.PlayerScores {
+		s := &self.PlayerScores[i]
+		if s.Name == player && s.Objective == objective {
+			s.Score = score
+			return
+		}
+	}
+	self.PlayerScores = append(self.PlayerScores, Score{Name: player, Objective: objective, Score: score})
+}
@@ -0,0 +1,73 @@
+//go:build !nbt_noreflect
+
+package world
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/moshee/go-nbt"
+)
+
+func TestScoreboard(t *testing.T) {
+	c, err := nbt.FromGoMC("", map[string]interface{}{
+		"DataVersion": int32(3953),
+		"data": map[string]interface{}{
+			"Objectives": []interface{}{map[string]interface{}{
+				"Name": "kills", "CriteriaName": "playerKillCount", "DisplayName": `"Kills"`,
+				"RenderType": "integer", "display_auto_update": int8(0),
+			}},
+			"PlayerScores": []interface{}{map[string]interface{}{
+				"Name": "moshee", "Objective": "kills", "Score": int32(7), "Locked": int8(1),
+			}},
+			"Teams": []interface{}{map[string]interface{}{
+				"Name": "red", "DisplayName": `"Red"`, "MemberNamePrefix": `""`, "MemberNameSuffix": `""`,
+				"TeamColor": "red", "Players": []interface{}{"moshee"},
+				"AllowFriendlyFire": int8(0), "SeeFriendlyInvisibles": int8(1),
+				"NameTagVisibility": "always", "DeathMessageVisibility": "always", "CollisionRule": "never",
+			}},
+			"DisplaySlots": map[string]interface{}{"sidebar": "kills"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := t.TempDir() + "/scoreboard.dat"
+	if err := nbt.EncodeFile(path, c, nbt.Format{Compression: nbt.Gzip, ByteOrder: binary.BigEndian}); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := ReadScoreboard(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.DataVersion != 3953 || s.Objective("kills") == nil || s.Objective("kills").CriteriaName != "playerKillCount" {
+		t.Errorf("ReadScoreboard: got %+v", s)
+	}
+	if score, ok := s.Score("moshee", "kills"); !ok || score != 7 || !s.PlayerScores[0].Locked {
+		t.Errorf("Score: got %v, %v", score, ok)
+	}
+	if team := s.Team("red"); team == nil || len(team.Players) != 1 || !team.SeeFriendlyInvisibles || team.CollisionRule != "never" {
+		t.Errorf("Team: got %+v", team)
+	}
+	if s.DisplaySlots["sidebar"] != "kills" {
+		t.Errorf("DisplaySlots: got %v", s.DisplaySlots)
+	}
+
+	if err := s.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+	back, _, err := nbt.DecodeFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changes := nbt.Diff(c, back); len(changes) > 0 {
+		t.Errorf("WriteFile: round trip changed %v", changes)
+	}
+
+	s.SetScore("moshee", "kills", 8)
+	s.SetScore("someone", "kills", 1)
+	if score, _ := s.Score("moshee", "kills"); score != 8 || len(s.PlayerScores) != 2 {
+		t.Errorf("SetScore: got %v", s.PlayerScores)
+	}
+}
@@ -0,0 +1,522 @@
+package nbt
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Encodes the compound as YAML, in the same type-preserving form as
+// MarshalJSON:
+//
+//	type: compound
+//	name: ""
+//	value:
+//	  GameRules:
+//	    type: compound
+//	    value:
+//	      keepInventory:
+//	        type: string
+//	        value: "true"
+//
+// Lists and arrays of numbers and strings are written in flow style on a
+// single line.
+func ToYAML(c *Compound) ([]byte, error) {
+	js, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	var tree interface{}
+	if err := json_unmarshal(js, &tree); err != nil {
+		return nil, err
+	}
+	buf := new(bytes.Buffer)
+	yaml_write(buf, tree, 0)
+	return buf.Bytes(), nil
+}
+
+// Decodes a compound from YAML written in the form of ToYAML. FromYAML
+// reads the common subset of YAML used for configuration: block mappings
+// and sequences, flow [sequences] and {mappings} written on a single line,
+// plain, 'single' and "double" quoted scalars, and comments. As in JSON,
+// strings that would read as a number, boolean or null must be quoted.
+func FromYAML(data []byte) (*Compound, error) {
+	tree, err := yaml_parse(data)
+	if err != nil {
+		return nil, err
+	}
+	js, err := json.Marshal(tree)
+	if err != nil {
+		return nil, err
+	}
+	c := new(Compound)
+	return c, c.UnmarshalJSON(js)
+}
+
+// Order of the keys of a tag's YAML form; other keys, such as the entries
+// of a compound, follow in sorted order.
+var yaml_key_order = map[string]int{"type": 1, "name": 2, "elem": 3, "items": 4, "value": 5}
+
+func yaml_keys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		oi, oj := yaml_key_order[keys[i]], yaml_key_order[keys[j]]
+		if oi == 0 || oj == 0 {
+			if oi != oj {
+				return oi != 0
+			}
+			return keys[i] < keys[j]
+		}
+		return oi < oj
+	})
+	return keys
+}
+
+func yaml_write(buf *bytes.Buffer, v interface{}, indent int) {
+	pad := strings.Repeat("  ", indent)
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for _, k := range yaml_keys(v) {
+			buf.WriteString(pad + yaml_scalar(k) + ":")
+			yaml_write_child(buf, v[k], indent+1)
+		}
+
+	case []interface{}:
+		for _, item := range v {
+			buf.WriteString(pad + "-")
+			if m, ok := item.(map[string]interface{}); ok && len(m) > 0 {
+				// the first entry goes on the line of the dash
+				sub := new(bytes.Buffer)
+				yaml_write(sub, m, indent+1)
+				buf.WriteString(" ")
+				buf.Write(bytes.TrimLeft(sub.Bytes(), " "))
+				continue
+			}
+			yaml_write_child(buf, item, indent+1)
+		}
+	}
+}
+
+// Writes a value following "key:" or "-".
+func yaml_write_child(buf *bytes.Buffer, v interface{}, indent int) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if len(v) == 0 {
+			buf.WriteString(" {}\n")
+			return
+		}
+		buf.WriteString("\n")
+		yaml_write(buf, v, indent)
+
+	case []interface{}:
+		flow := true
+		for _, item := range v {
+			switch item.(type) {
+			case map[string]interface{}, []interface{}:
+				flow = false
+			}
+		}
+		if !flow {
+			buf.WriteString("\n")
+			yaml_write(buf, v, indent)
+			return
+		}
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = yaml_scalar(item)
+		}
+		buf.WriteString(" [" + strings.Join(items, ", ") + "]\n")
+
+	default:
+		buf.WriteString(" " + yaml_scalar(v) + "\n")
+	}
+}
+
+var yaml_plain = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_./-]*$`)
+
+func yaml_scalar(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return strconv.FormatBool(v)
+	case json.Number:
+		return v.String()
+	case string:
+		if yaml_plain.MatchString(v) {
+			if _, ok := yaml_resolve(v).(string); ok {
+				return v
+			}
+		}
+		// JSON strings are valid YAML double quoted scalars
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+	return fmt.Sprint(v)
+}
+
+var yaml_number = regexp.MustCompile(`^[-+]?(\.[0-9]+|[0-9]+(\.[0-9]*)?)([eE][-+]?[0-9]+)?$`)
+
+// Returns the value of a plain scalar.
+func yaml_resolve(s string) interface{} {
+	switch s {
+	case "", "~", "null", "Null", "NULL":
+		return nil
+	case "true", "True", "TRUE":
+		return true
+	case "false", "False", "FALSE":
+		return false
+	}
+	if yaml_number.MatchString(s) {
+		return json.Number(strings.TrimPrefix(s, "+"))
+	}
+	return s
+}
+
+// A non-blank line of YAML, without its comment.
+type yaml_line struct {
+	num    int
+	indent int
+	text   string
+}
+
+type yaml_parser struct {
+	lines []yaml_line
+	i     int
+}
+
+func yaml_error(line int, format string, args ...interface{}) error {
+	return fmt.Errorf("YAML line %d: %s", line, fmt.Sprintf(format, args...))
+}
+
+func yaml_parse(data []byte) (interface{}, error) {
+	p := new(yaml_parser)
+	for i, text := range strings.Split(string(data), "\n") {
+		text = strings.TrimRight(yaml_strip_comment(text), " \r")
+		trimmed := strings.TrimLeft(text, " ")
+		if trimmed == "" || trimmed == "---" || trimmed == "..." {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, yaml_error(i+1, "tabs cannot be used for indentation")
+		}
+		p.lines = append(p.lines, yaml_line{i + 1, len(text) - len(trimmed), trimmed})
+	}
+	if len(p.lines) == 0 {
+		return nil, errors.New("YAML document is empty")
+	}
+	v, err := p.node(p.lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.i < len(p.lines) {
+		return nil, yaml_error(p.lines[p.i].num, "unexpected indentation")
+	}
+	return v, nil
+}
+
+// Removes a comment: a '#' at the start of the line or after a space,
+// outside of quotes.
+func yaml_strip_comment(s string) string {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || s[i-1] == ' '):
+			return s[:i]
+		}
+	}
+	return s
+}
+
+func is_yaml_seq_item(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// Parses the block node starting at the current line, which is indented by
+// indent.
+func (self *yaml_parser) node(indent int) (interface{}, error) {
+	line := self.lines[self.i]
+	if is_yaml_seq_item(line.text) {
+		return self.seq(indent)
+	}
+	if _, _, ok := yaml_split_key(line.text); ok {
+		return self.mapping(indent)
+	}
+	self.i++
+	return yaml_inline(line.num, line.text)
+}
+
+func (self *yaml_parser) mapping(indent int) (interface{}, error) {
+	m := make(map[string]interface{})
+	for self.i < len(self.lines) && self.lines[self.i].indent == indent {
+		line := self.lines[self.i]
+		if is_yaml_seq_item(line.text) {
+			return nil, yaml_error(line.num, "expected a mapping entry")
+		}
+		key, rest, ok := yaml_split_key(line.text)
+		if !ok {
+			return nil, yaml_error(line.num, "expected key: value")
+		}
+		k, err := yaml_key(line.num, key)
+		if err != nil {
+			return nil, err
+		}
+		if _, dup := m[k]; dup {
+			return nil, yaml_error(line.num, "duplicate key %q", k)
+		}
+		self.i++
+
+		var v interface{}
+		switch {
+		case rest != "":
+			v, err = yaml_inline(line.num, rest)
+		case self.i < len(self.lines) && self.lines[self.i].indent > indent:
+			v, err = self.node(self.lines[self.i].indent)
+		case self.i < len(self.lines) && self.lines[self.i].indent == indent && is_yaml_seq_item(self.lines[self.i].text):
+			// a sequence may be indented as far as its key
+			v, err = self.seq(indent)
+		}
+		if err != nil {
+			return nil, err
+		}
+		m[k] = v
+	}
+	return m, nil
+}
+
+func (self *yaml_parser) seq(indent int) (interface{}, error) {
+	s := []interface{}{}
+	for self.i < len(self.lines) && self.lines[self.i].indent == indent && is_yaml_seq_item(self.lines[self.i].text) {
+		line := self.lines[self.i]
+		rest := strings.TrimLeft(line.text[1:], " ")
+		if rest == "" {
+			self.i++
+			var v interface{}
+			if self.i < len(self.lines) && self.lines[self.i].indent > indent {
+				var err error
+				if v, err = self.node(self.lines[self.i].indent); err != nil {
+					return nil, err
+				}
+			}
+			s = append(s, v)
+			continue
+		}
+		// read the rest of the line as a node of its own, indented by its
+		// column
+		self.lines[self.i] = yaml_line{line.num, indent + len(line.text) - len(rest), rest}
+		v, err := self.node(self.lines[self.i].indent)
+		if err != nil {
+			return nil, err
+		}
+		s = append(s, v)
+	}
+	return s, nil
+}
+
+// Splits "key: value" or "key:" at the colon, outside of quotes and flow
+// collections.
+func yaml_split_key(text string) (key, rest string, ok bool) {
+	var quote byte
+	depth := 0
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[' || c == '{':
+			depth++
+		case c == ']' || c == '}':
+			depth--
+		case c == ':' && depth == 0 && (i+1 == len(text) || text[i+1] == ' '):
+			return strings.TrimSpace(text[:i]), strings.TrimSpace(text[i+1:]), true
+		}
+	}
+	return "", "", false
+}
+
+func yaml_key(line int, key string) (string, error) {
+	v, err := yaml_inline(line, key)
+	if err != nil {
+		return "", err
+	}
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case nil:
+		if key == "" {
+			return "", yaml_error(line, "missing key")
+		}
+	}
+	return key, nil
+}
+
+// Parses a value written on a single line.
+func yaml_inline(line int, text string) (interface{}, error) {
+	if strings.HasPrefix(text, "|") || strings.HasPrefix(text, ">") {
+		return nil, yaml_error(line, "block scalars are not supported")
+	}
+	f := &yaml_flow{text: text}
+	v, err := f.value(false)
+	if err == nil {
+		f.space()
+		if f.pos < len(f.text) {
+			err = fmt.Errorf("unexpected %q", f.text[f.pos:])
+		}
+	}
+	if err != nil {
+		return nil, yaml_error(line, "%v", err)
+	}
+	return v, nil
+}
+
+// Parser for flow collections and scalars.
+type yaml_flow struct {
+	text string
+	pos  int
+}
+
+func (self *yaml_flow) space() {
+	for self.pos < len(self.text) && self.text[self.pos] == ' ' {
+		self.pos++
+	}
+}
+
+// Parses a value. Inside flow collections, plain scalars end at ',', ']',
+// '}' and ": ".
+func (self *yaml_flow) value(in_flow bool) (interface{}, error) {
+	self.space()
+	if self.pos == len(self.text) {
+		return nil, nil
+	}
+	switch self.text[self.pos] {
+	case '[':
+		self.pos++
+		s := []interface{}{}
+		for {
+			self.space()
+			if strings.HasPrefix(self.text[self.pos:], "]") {
+				self.pos++
+				return s, nil
+			}
+			v, err := self.value(true)
+			if err != nil {
+				return nil, err
+			}
+			s = append(s, v)
+			if err := self.separator(']'); err != nil {
+				return nil, err
+			}
+		}
+
+	case '{':
+		self.pos++
+		m := make(map[string]interface{})
+		for {
+			self.space()
+			if strings.HasPrefix(self.text[self.pos:], "}") {
+				self.pos++
+				return m, nil
+			}
+			k, err := self.value(true)
+			if err != nil {
+				return nil, err
+			}
+			self.space()
+			if !strings.HasPrefix(self.text[self.pos:], ":") {
+				return nil, errors.New("expected ':' in flow mapping")
+			}
+			self.pos++
+			v, err := self.value(true)
+			if err != nil {
+				return nil, err
+			}
+			m[fmt.Sprint(k)] = v
+			if err := self.separator('}'); err != nil {
+				return nil, err
+			}
+		}
+
+	case '"':
+		quoted, err := strconv.QuotedPrefix(self.text[self.pos:])
+		if err != nil {
+			return nil, errors.New("unterminated double quoted string")
+		}
+		var s string
+		if err := json.Unmarshal([]byte(quoted), &s); err != nil {
+			// YAML allows escapes JSON lacks, and so does Go
+			if s, err = strconv.Unquote(quoted); err != nil {
+				return nil, err
+			}
+		}
+		self.pos += len(quoted)
+		return s, nil
+
+	case '\'':
+		var b strings.Builder
+		for i := self.pos + 1; i < len(self.text); i++ {
+			if self.text[i] != '\'' {
+				b.WriteByte(self.text[i])
+				continue
+			}
+			if i+1 < len(self.text) && self.text[i+1] == '\'' {
+				b.WriteByte('\'')
+				i++
+				continue
+			}
+			self.pos = i + 1
+			return b.String(), nil
+		}
+		return nil, errors.New("unterminated single quoted string")
+	}
+
+	start := self.pos
+	for self.pos < len(self.text) {
+		c := self.text[self.pos]
+		if in_flow && (c == ',' || c == ']' || c == '}' || c == ':' && (self.pos+1 == len(self.text) || self.text[self.pos+1] == ' ')) {
+			break
+		}
+		self.pos++
+	}
+	return yaml_resolve(strings.TrimSpace(self.text[start:self.pos])), nil
+}
+
+// Reads the ',' between items of a flow collection, or peeks at its end.
+func (self *yaml_flow) separator(end byte) error {
+	self.space()
+	if self.pos == len(self.text) {
+		return fmt.Errorf("missing '%c'", end)
+	}
+	switch self.text[self.pos] {
+	case ',':
+		self.pos++
+		return nil
+	case end:
+		return nil
+	}
+	return fmt.Errorf("expected ',' or '%c'", end)
+}
@@ -0,0 +1,83 @@
+package nbt
+
+import (
+	"testing"
+)
+
+func TestYAMLRoundTrip(t *testing.T) {
+	c, err := (&CompoundTag{Name: "Level", Value: []Tag{
+		&StringTag{"name", "Bananrama"},
+		&StringTag{"keepInventory", "true"},
+		&StringTag{"odd", "it's: #1\n"},
+		&LongTag{"seed", -9007199254740993},
+		&DoubleTag{"ratio", 0.49823147058486938},
+		&IntArrayTag{"ints", []int32{1, 2, 3}},
+		&ByteArrayTag{"empty", []int8{}},
+		&ListTag{Name: "pos", Elem: TagDouble, Value: []Tag{&DoubleTag{Value: 1.5}, &DoubleTag{Value: 64}}},
+		&ListTag{Name: "nested", Elem: TagList, Value: []Tag{
+			&ListTag{Elem: TagString, Value: []Tag{&StringTag{Value: "a"}}},
+		}},
+		&ListTag{Name: "items", Elem: TagCompound, Value: []Tag{
+			&CompoundTag{Value: []Tag{&StringTag{"id", "minecraft:stone"}, &ByteTag{"Count", 64}}},
+			&CompoundTag{},
+		}},
+		&CompoundTag{Name: "sub", Value: []Tag{&ShortTag{"x", -1}}},
+	}}).Compound()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	y, err := ToYAML(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	back, err := FromYAML(y)
+	if err != nil {
+		t.Fatalf("FromYAML: %v\n%s", err, y)
+	}
+	if changes := Diff(c, back); len(changes) != 0 || back.Name() != "Level" {
+		t.Errorf("YAML round trip changed %v:\n%s", changes, y)
+	}
+}
+
+func TestFromYAML(t *testing.T) {
+	y := `
+# gamerule preset
+---
+type: compound
+value:
+  GameRules:
+    type: compound
+    value: {keepInventory: {type: string, value: 'true'}}
+  Spawn: {type: int_array, value: [0, 64, 0]}   # x, y, z
+  Players:
+    type: list
+    value:
+      elem: compound
+      items:
+      - name: {type: string, value: "Hampus"}
+      -
+        name:
+          type: string
+          value: Bananrama
+`
+	c, err := FromYAML([]byte(y))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := c.Compound("GameRules").String("keepInventory"); s != "true" {
+		t.Errorf("GameRules.keepInventory: expected \"true\", got %q", s)
+	}
+	if v, _ := c.GetPath(".Spawn[1]"); v != int32(64) {
+		t.Errorf("Spawn[1]: expected 64, got %v", v)
+	}
+	if v, _ := c.GetPath(".Players[1].name"); v != "Bananrama" {
+		t.Errorf("Players[1].name: expected Bananrama, got %v", v)
+	}
+
+	for _, bad := range []string{"", "a: 1\n  b: 2", "a: [1, 2", "a: |\n  text", "a: 1\na: 2"} {
+		if _, err := FromYAML([]byte(bad)); err == nil {
+			t.Errorf("FromYAML(%q): expected an error", bad)
+		}
+	}
+}